@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFdsStart is the first descriptor that systemd passes to a socket-activated
+// service.
+const listenFdsStart = 3
+
+// activationListeners are the listeners passed by systemd socket activation, by
+// the FileDescriptorName of their socket unit, which is the flag they stand in
+// for, such as "input-socket".
+var activationListeners = sync.OnceValues(func() (map[string]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	return parseActivation(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"), os.Getpid())
+})
+
+// parseActivation returns the listeners described by the LISTEN_ variables, if
+// they are meant for the process pid.
+func parseActivation(listenPid, listenFds, names string, pid int) (map[string]net.Listener, error) {
+	if listenFds == "" || listenPid != strconv.Itoa(pid) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(listenFds)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %q", listenFds)
+	}
+	fdNames := strings.Split(names, ":")
+	listeners := map[string]net.Listener{}
+	for i := range count {
+		if i >= len(fdNames) || fdNames[i] == "" {
+			return nil, fmt.Errorf("socket %d passed by systemd has no FileDescriptorName naming its flag", i)
+		}
+		f := os.NewFile(uintptr(listenFdsStart+i), fdNames[i])
+		l, err := net.FileListener(f)
+		// The listener has a descriptor of its own
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %s passed by systemd: %w", fdNames[i], err)
+		}
+		listeners[fdNames[i]] = l
+	}
+	return listeners, nil
+}
+
+// activatedListener returns the listener that systemd passed for the flag name, or
+// else the one that listen opens.
+func activatedListener(name string, listen func() (net.Listener, error)) (net.Listener, error) {
+	listeners, err := activationListeners()
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := listeners[name]; ok {
+		return l, nil
+	}
+	return listen()
+}
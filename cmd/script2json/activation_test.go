@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+// TestParseActivation tests reading the sockets passed by systemd, short of
+// taking over descriptors
+func TestParseActivation(t *testing.T) {
+	pid := os.Getpid()
+	tests := []struct {
+		name      string
+		listenPid string
+		listenFds string
+		names     string
+		wantErr   bool
+	}{
+		{"Not activated", "", "", "", false},
+		{"Another process", strconv.Itoa(pid + 1), "1", "input-socket", false},
+		{"No sockets", strconv.Itoa(pid), "0", "", false},
+		{"Invalid count", strconv.Itoa(pid), "many", "", true},
+		{"Unnamed", strconv.Itoa(pid), "1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listeners, err := parseActivation(tt.listenPid, tt.listenFds, tt.names, pid)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseActivation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(listeners) != 0 {
+				t.Errorf("parseActivation() = %v, want no listeners", listeners)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// annotationQueueSize is the number of annotations a session holds until its
+// recordCreator writes them.
+const annotationQueueSize = 16
+
+// maxAnnotationBytes is the longest annotation that the HTTP and gRPC APIs accept.
+const maxAnnotationBytes = 64 * 1024
+
+// AnnotationRecord is a note injected through the control channel, such as
+// "starting maintenance window", so humans can mark context inside the stream.
+// It is distinguished from a CommandRecord by its Type field.
+type AnnotationRecord struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Session   string    `json:"session,omitempty"`
+	OwnerUID  *int      `json:"owner_uid,omitempty"`
+	Text      string    `json:"text"`
+}
+
+// errAnnotationQueueFull is returned by annotate when a session's recordCreator
+// has fallen behind on annotations.
+var errAnnotationQueueFull = errors.New("annotation queue is full")
+
+// annotate queues text to be written as an annotation record of sess. It fails if
+// the session's queue is full.
+func annotate(sess *session, text string) error {
+	select {
+	case sess.annotations <- text:
+		return nil
+	default:
+		return fmt.Errorf("%w for session %q", errAnnotationQueueFull, sess.name)
+	}
+}
+
+// annotateSessions queues text, without surrounding whitespace, as an annotation
+// of the only session in sessions, as selected by selectSessions. Since an
+// annotation belongs to a single stream, it fails if more than one is selected.
+func annotateSessions(sessions []*session, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return errors.New("annotation text is empty")
+	}
+	if len(sessions) != 1 {
+		return fmt.Errorf("%d sessions are running; choose one", len(sessions))
+	}
+	return annotate(sessions[0], text)
+}
+
+// formatPrettyAnnotation renders an annotation as a single highlighted line.
+func formatPrettyAnnotation(record AnnotationRecord, opts recordOptions) string {
+	line := fmt.Sprintf("## %s: %s", formatTime(record.Timestamp, opts.timeDisplay, time.Now()), record.Text)
+	if opts.color {
+		line = sgrBold + line + sgrReset
+	}
+	return line + "\n"
+}
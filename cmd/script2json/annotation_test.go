@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestRecordCreatorAnnotations tests that annotations are written between command
+// records as they arrive
+func TestRecordCreatorAnnotations(t *testing.T) {
+	sess := newSession("web", "", "")
+	commandOutputChan := make(chan commandOutput, 1)
+	commandChan := make(chan commandInfo, 1)
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		recordCreator(commandOutputChan, commandChan, recordOptions{session: sess, stdout: &buf})
+		close(done)
+	}()
+
+	commandOutputChan <- commandOutput{Output: pipeline.Output{Text: "one\r\n"}}
+	time.Sleep(50 * time.Millisecond)
+	if err := annotate(sess, "starting maintenance window"); err != nil {
+		t.Errorf("annotate failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	commandOutputChan <- commandOutput{Output: pipeline.Output{Text: "two\r\n"}}
+	close(commandOutputChan)
+	<-done
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d\nOutput: %s", len(lines), buf.String())
+	}
+	var annotation AnnotationRecord
+	if err := json.Unmarshal(lines[1], &annotation); err != nil {
+		t.Fatalf("Failed to parse annotation JSON: %v", err)
+	}
+	if annotation.Type != "annotation" || annotation.Session != "web" || annotation.Text != "starting maintenance window" || annotation.Timestamp.IsZero() {
+		t.Errorf("Annotation = %+v", annotation)
+	}
+}
+
+// TestAnnotateQueueFull tests that annotations are refused rather than blocking
+// once a session's queue is full
+func TestAnnotateQueueFull(t *testing.T) {
+	sess := newSession("web", "", "")
+	for range annotationQueueSize {
+		if err := annotate(sess, "note"); err != nil {
+			t.Fatalf("annotate failed: %v", err)
+		}
+	}
+	if err := annotate(sess, "one too many"); err == nil || !strings.Contains(err.Error(), "full") {
+		t.Errorf("annotate on a full queue = %v, want a full queue error", err)
+	}
+}
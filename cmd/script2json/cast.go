@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// castHeader is the header line of an asciicast file, as recorded by asciinema.
+type castHeader struct {
+	Version int `json:"version"`
+	// Timestamp is the Unix time when the recording started, or 0 if unknown
+	Timestamp int64 `json:"timestamp"`
+}
+
+// castMarker is a marker event ("m") in an asciicast recording.
+type castMarker struct {
+	offset  int64         // offset in the recording's output where the marker was set
+	elapsed time.Duration // time since the start of the recording
+	label   string
+}
+
+// castRecording is an asciicast recording, with its output events joined into a
+// byte stream like a typescript's.
+type castRecording struct {
+	output []byte
+	// timing maps offsets in output to the times of the events they came from
+	timing  *timingLog
+	markers []castMarker
+}
+
+// parseCastHeader reports whether line is the header of an asciicast v2 or v3 file.
+func parseCastHeader(line []byte) (castHeader, bool) {
+	var header castHeader
+	if !bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) || json.Unmarshal(line, &header) != nil {
+		return castHeader{}, false
+	}
+	return header, header.Version == 2 || header.Version == 3
+}
+
+// readCast parses an asciicast v2 or v3 file. Event times are absolute in v2 and
+// relative to the previous event in v3. Output ("o") events make up the output and
+// marker ("m") events its markers; input, resize and exit events are skipped.
+func readCast(r io.Reader) (*castRecording, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read asciicast: %w", err)
+		}
+		return nil, fmt.Errorf("empty asciicast")
+	}
+	header, ok := parseCastHeader(scanner.Bytes())
+	if !ok {
+		return nil, fmt.Errorf("line 1: not an asciicast v2 or v3 header")
+	}
+
+	rec := &castRecording{timing: &timingLog{}}
+	if header.Timestamp > 0 {
+		rec.timing.startTime = time.Unix(header.Timestamp, 0)
+	}
+	var elapsed float64
+	for lineNum := 2; scanner.Scan(); lineNum++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		// v3 allows comment lines
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		var fields []json.RawMessage
+		if err := json.Unmarshal(line, &fields); err != nil || len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: malformed event", lineNum)
+		}
+		var t float64
+		var code, data string
+		if json.Unmarshal(fields[0], &t) != nil || t < 0 {
+			return nil, fmt.Errorf("line %d: invalid event time: %s", lineNum, fields[0])
+		}
+		if json.Unmarshal(fields[1], &code) != nil {
+			return nil, fmt.Errorf("line %d: invalid event type: %s", lineNum, fields[1])
+		}
+		if json.Unmarshal(fields[2], &data) != nil {
+			// Exit events carry a number rather than a string
+			data = ""
+		}
+		if header.Version == 3 {
+			elapsed += t
+		} else {
+			elapsed = t
+		}
+		at := time.Duration(elapsed * float64(time.Second))
+		rec.timing.total = at
+
+		offset := int64(len(rec.output))
+		switch code {
+		case "o":
+			rec.timing.chunks = append(rec.timing.chunks, timingChunk{offset: offset, size: int64(len(data)), elapsed: at})
+			rec.output = append(rec.output, data...)
+		case "m":
+			rec.markers = append(rec.markers, castMarker{offset: offset, elapsed: at, label: data})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read asciicast: %w", err)
+	}
+	return rec, nil
+}
+
+// convertCast writes the records of an asciicast recording. Commands are found by
+// matching prompts, as in a typescript, unless opts.castMarkers is set and the
+// recording has markers: then each marker starts a command, labelled with the
+// marker's label, that runs until the next marker or the end of the recording.
+func convertCast(r io.Reader, w io.Writer, opts convertOptions) error {
+	rec, err := readCast(r)
+	if err != nil {
+		return err
+	}
+	opts.timing = rec.timing
+	if !opts.castMarkers || len(rec.markers) == 0 {
+		return convertTypescript(bytes.NewReader(rec.output), w, opts)
+	}
+
+	output := pipeline.NewLineEditor(opts.editor.EditorOptions, slog.Default(), nil)
+	command := ""
+	var from int64
+	var start time.Duration
+	flush := func(to int64, end time.Duration) error {
+		data := rec.output[from:to]
+		for _, b := range data {
+			output.WriteByte(b)
+		}
+		out := output.Finish()
+		if command == "" && strings.TrimSpace(out.Text) == "" {
+			return nil
+		}
+		return writeConvertedRecord(w, command, out, data, from, start, end, rec.timing.startTime, opts)
+	}
+	for _, m := range rec.markers {
+		if err := flush(m.offset, m.elapsed); err != nil {
+			return err
+		}
+		command, from, start = m.label, m.offset, m.elapsed
+	}
+	return flush(int64(len(rec.output)), rec.timing.total)
+}
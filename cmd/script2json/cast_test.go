@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// testCast is an asciicast v2 recording with input, resize and marker events
+const testCast = `{"version": 2, "width": 80, "height": 24, "timestamp": 1700000000}
+[0.1, "o", "$ "]
+[0.5, "i", "ls\r"]
+[0.6, "o", "ls\r\n"]
+[0.6, "m", "list"]
+[0.9, "o", "a  b\r\n"]
+[1.0, "r", "100x30"]
+[1.2, "o", "$ "]
+[1.5, "o", "echo hi\r\n"]
+[1.5, "m", "greet"]
+[1.7, "o", "hi\r\n"]
+[2.0, "o", "$ "]
+`
+
+// TestReadCast tests parsing asciicast v2 and v3 recordings
+func TestReadCast(t *testing.T) {
+	tests := []struct {
+		name string
+		cast string
+	}{
+		{"v2", `{"version": 2, "width": 80, "height": 24, "timestamp": 1700000000}
+[0.5, "o", "ab"]
+[1.0, "i", "x"]
+[1.25, "m", "mark"]
+[2.0, "o", "cd"]
+`},
+		{"v3", `{"version": 3, "term": {"cols": 80, "rows": 24}, "timestamp": 1700000000}
+# a comment
+[0.5, "o", "ab"]
+[0.5, "i", "x"]
+[0.25, "m", "mark"]
+[0.75, "o", "cd"]
+[0.1, "x", 0]
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := readCast(strings.NewReader(tt.cast))
+			if err != nil {
+				t.Fatalf("readCast failed: %v", err)
+			}
+			if string(rec.output) != "abcd" {
+				t.Errorf("output = %q, want %q", rec.output, "abcd")
+			}
+			if !rec.timing.startTime.Equal(time.Unix(1700000000, 0)) {
+				t.Errorf("startTime = %v, want %v", rec.timing.startTime, time.Unix(1700000000, 0))
+			}
+			if got := rec.timing.at(2); got != 2*time.Second {
+				t.Errorf("at(2) = %v, want 2s", got)
+			}
+			want := []castMarker{{offset: 2, elapsed: 1250 * time.Millisecond, label: "mark"}}
+			if len(rec.markers) != 1 || rec.markers[0] != want[0] {
+				t.Errorf("markers = %+v, want %+v", rec.markers, want)
+			}
+		})
+	}
+}
+
+// TestReadCastInvalid tests that malformed recordings are rejected
+func TestReadCastInvalid(t *testing.T) {
+	for _, cast := range []string{
+		"",
+		"Script started on 2025-09-29 13:20:00-04:00\n",
+		`{"version": 1, "width": 80, "height": 24, "stdout": []}` + "\n",
+		`{"version": 2}` + "\n[0.5, \"o\"]\n",
+		`{"version": 2}` + "\n[-1, \"o\", \"a\"]\n",
+	} {
+		if _, err := readCast(strings.NewReader(cast)); err == nil {
+			t.Errorf("readCast(%q) succeeded, want error", cast)
+		}
+	}
+}
+
+// TestConvertCast tests splitting a recording at prompts and at markers
+func TestConvertCast(t *testing.T) {
+	started := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		markers  bool
+		expected []pipeline.CommandRecord
+	}{
+		{"prompts", false, []pipeline.CommandRecord{
+			{Command: "ls", Output: "a  b\r\n", DurationMs: 600},
+			{Command: "echo hi", Output: "hi\r\n", DurationMs: 500},
+		}},
+		{"markers", true, []pipeline.CommandRecord{
+			{Command: "", Output: "$ ls\r\n", DurationMs: 600},
+			{Command: "list", Output: "a  b\r\n$ echo hi\r\n", DurationMs: 900},
+			{Command: "greet", Output: "hi\r\n$ ", DurationMs: 500},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := convertOptions{prompt: regexp.MustCompile(defaultPromptPattern), castMarkers: tt.markers}
+			if err := convertInput(strings.NewReader(testCast), &out, opts); err != nil {
+				t.Fatalf("convertInput failed: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != len(tt.expected) {
+				t.Fatalf("Got %d records, want %d:\n%s", len(lines), len(tt.expected), out.String())
+			}
+			for i, line := range lines {
+				var record pipeline.CommandRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("Failed to parse record %d: %v", i, err)
+				}
+				want := tt.expected[i]
+				if record.Command != want.Command || record.Output != want.Output || record.DurationMs != want.DurationMs {
+					t.Errorf("Record %d = (%q, %q, %d), want (%q, %q, %d)", i,
+						record.Command, record.Output, record.DurationMs, want.Command, want.Output, want.DurationMs)
+				}
+				if record.StartTimestamp == nil || record.StartTimestamp.Before(started) {
+					t.Errorf("Record %d start_timestamp = %v, want one after %v", i, record.StartTimestamp, started)
+				}
+			}
+		})
+	}
+}
+
+// TestConvertCastTiming tests that timing logs are refused for recordings
+func TestConvertCastTiming(t *testing.T) {
+	opts := convertOptions{prompt: regexp.MustCompile(defaultPromptPattern), timing: &timingLog{}}
+	if err := convertInput(strings.NewReader(testCast), &bytes.Buffer{}, opts); err == nil {
+		t.Error("convertInput succeeded with a timing log, want error")
+	}
+}
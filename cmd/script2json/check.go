@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Outcomes of a readiness check
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// checkResult is one line of the readiness report of --check.
+type checkResult struct {
+	status string
+	// item is what was checked, such as "script fifo"
+	item   string
+	detail string
+}
+
+// checkOptions are the settings that --check checks beyond the flag validation,
+// which only fail once script2json runs.
+type checkOptions struct {
+	// fifos are the script and command FIFOs of every session, by their item name
+	fifos [][2]string
+	stdin bool
+	// force is set if FIFOs that another instance holds the lock of are read anyway
+	force        bool
+	serialPath   string
+	pidFile      string
+	statusFile   string
+	outputFile   string
+	fallbackFile string
+	// sockets are the Unix sockets listened on, by their item name
+	sockets [][2]string
+	// addresses are the TCP addresses listened on, by their item name
+	addresses [][2]string
+	// signals is set when the shell hooks start and stop reading with signals,
+	// rather than with markers in the byte stream
+	signals bool
+	// controlMessages is set when the shell hooks start and stop reading with
+	// JSON control messages on the command FIFO (--command-protocol=json)
+	controlMessages bool
+	stdout          *os.File
+}
+
+// runChecks checks what opts would need to run, without starting anything.
+func runChecks(opts checkOptions) []checkResult {
+	results := []checkResult{{checkOK, "config", "flags, environment and config file are valid"}}
+	add := func(item string, detail string, err error) {
+		if err != nil {
+			results = append(results, checkResult{checkFail, item, err.Error()})
+			return
+		}
+		results = append(results, checkResult{checkOK, item, detail})
+	}
+	warn := func(item, detail string) {
+		results = append(results, checkResult{checkWarn, item, detail})
+	}
+
+	switch {
+	case opts.stdin:
+		add("script input", "reads from stdin", nil)
+	case opts.serialPath != "":
+		_, err := os.Stat(opts.serialPath)
+		add("script input", "serial device "+opts.serialPath+" exists", err)
+	}
+	for _, fifo := range opts.fifos {
+		detail, err := checkInputPath(fifo[1])
+		add(fifo[0], detail, err)
+		if strings.HasPrefix(fifo[1], "unix:") {
+			continue
+		}
+		// Take the lock for a moment, as the instance about to start would
+		release, err := lockFifo(fifo[1])
+		switch {
+		case errors.Is(err, errFifoLocked) && opts.force:
+			warn(fifo[0]+" lock", err.Error())
+		case err != nil:
+			add(fifo[0]+" lock", "", err)
+		default:
+			release()
+		}
+	}
+	for _, socket := range opts.sockets {
+		detail, err := checkSocketPath(socket[1])
+		add(socket[0], detail, err)
+	}
+	for _, address := range opts.addresses {
+		l, err := net.Listen("tcp", address[1])
+		if err == nil {
+			l.Close()
+		}
+		add(address[0], "can listen on "+address[1], err)
+	}
+
+	if opts.outputFile != "" {
+		detail, err := checkFilePath(opts.outputFile)
+		add("output file", detail, err)
+	} else {
+		detail, err := checkStdout(opts.stdout)
+		add("stdout", detail, err)
+	}
+	if opts.fallbackFile != "" {
+		detail, err := checkFilePath(opts.fallbackFile)
+		add("fallback file", detail, err)
+	}
+	if opts.statusFile != "" {
+		detail, err := checkFilePath(opts.statusFile)
+		add("status file", detail, err)
+	}
+	if opts.pidFile != "" {
+		if pid, err := readPidFile(opts.pidFile); err == nil && processAlive(pid) {
+			warn("pid file", fmt.Sprintf("%s names running process %d; is script2json already running?", opts.pidFile, pid))
+		} else {
+			detail, err := checkFilePath(opts.pidFile)
+			add("pid file", detail, err)
+		}
+	}
+
+	switch {
+	case opts.controlMessages:
+		add("shell hooks", "reading starts and stops on control messages on the command FIFO", nil)
+	case !opts.signals:
+		add("shell hooks", "reading starts and stops on markers in the byte stream", nil)
+	case hasSocket(opts.sockets, "signal socket"):
+		add("shell hooks", "can reach script2json through the signal socket", nil)
+	case opts.pidFile != "":
+		add("shell hooks", "can signal the process in "+opts.pidFile, nil)
+	default:
+		warn("shell hooks", "no --pid-file or --signal-socket to find script2json by; hooks must fall back to pkill")
+	}
+	return results
+}
+
+// hasSocket reports whether sockets includes one for item.
+func hasSocket(sockets [][2]string, item string) bool {
+	for _, socket := range sockets {
+		if socket[0] == item {
+			return true
+		}
+	}
+	return false
+}
+
+// checkInputPath checks a script or command input: a FIFO or named pipe, or a
+// Unix socket given as unix:<path>.
+func checkInputPath(path string) (string, error) {
+	if socketPath, ok := strings.CutPrefix(path, "unix:"); ok {
+		return checkSocketPath(socketPath)
+	}
+	return checkFifoPath(path)
+}
+
+// checkSocketPath checks that a Unix socket can be listened on at path, and that
+// no running server would be taken over, as listenUnixSocket replaces a stale
+// socket file.
+func checkSocketPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := checkWritableDir(filepath.Dir(path)); err != nil {
+			return "", err
+		}
+		return path + " will be created", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return "", fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return "", fmt.Errorf("%s is in use by a running process", path)
+	}
+	return path + " is a stale socket and will be replaced", nil
+}
+
+// checkFilePath checks that the file at path can be written, without creating it.
+func checkFilePath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := checkWritableDir(filepath.Dir(path)); err != nil {
+			return "", err
+		}
+		return path + " will be created", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return path + " is writable", nil
+}
+
+// checkWritableDir checks that files can be created in dir by creating one.
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".script2json-check-*")
+	if err != nil {
+		return fmt.Errorf("cannot create files in %s: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkStdout describes where records go, and fails if stdout isn't open.
+func checkStdout(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("records can't be written: %w", err)
+	}
+	switch mode := info.Mode(); {
+	case mode&os.ModeCharDevice != 0:
+		return "records go to a terminal", nil
+	case mode&os.ModeNamedPipe != 0:
+		return "records go to a pipe", nil
+	case mode&os.ModeSocket != 0:
+		return "records go to a socket", nil
+	case mode.IsRegular():
+		return "records go to a file", nil
+	}
+	return "stdout is open", nil
+}
+
+// writeCheckReport writes results to w as a table.
+func writeCheckReport(w io.Writer, results []checkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.status, result.item, result.detail)
+	}
+	return tw.Flush()
+}
+
+// checkFailures counts the failed checks in results.
+func checkFailures(results []checkResult) int {
+	failures := 0
+	for _, result := range results {
+		if result.status == checkFail {
+			failures++
+		}
+	}
+	return failures
+}
@@ -0,0 +1,122 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestRunChecks tests the readiness report of --check
+func TestRunChecks(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "script.fifo")
+	if err := syscall.Mkfifo(fifo, 0666); err != nil {
+		t.Fatalf("Failed to create FIFO: %v", err)
+	}
+	notFifo := filepath.Join(dir, "command.fifo")
+	if err := os.WriteFile(notFifo, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	busySocket := filepath.Join(dir, "busy.sock")
+	l, err := net.Listen("unix", busySocket)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	pidFile := filepath.Join(dir, "s2j.pid")
+	if err := os.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		t.Fatalf("Failed to write PID file: %v", err)
+	}
+
+	results := runChecks(checkOptions{
+		fifos: [][2]string{
+			{"script fifo", fifo},
+			{"command fifo", notFifo},
+			{"web script fifo", filepath.Join(dir, "web.fifo")},
+			{"web command fifo", "unix:" + filepath.Join(dir, "web.sock")},
+		},
+		sockets:    [][2]string{{"signal socket", busySocket}},
+		statusFile: filepath.Join(dir, "missing", "status.json"),
+		pidFile:    pidFile,
+		signals:    true,
+		stdout:     os.Stdout,
+	})
+	expected := map[string]string{
+		"config":           checkOK,
+		"script fifo":      checkOK,
+		"command fifo":     checkFail,
+		"web script fifo":  checkOK,
+		"web command fifo": checkOK,
+		"signal socket":    checkFail,
+		"stdout":           checkOK,
+		"status file":      checkFail,
+		"pid file":         checkWarn,
+		"shell hooks":      checkOK,
+	}
+	for _, result := range results {
+		if want, ok := expected[result.item]; !ok {
+			t.Errorf("Unexpected check %q", result.item)
+		} else if result.status != want {
+			t.Errorf("Check %q = %s (%s), want %s", result.item, result.status, result.detail, want)
+		}
+		delete(expected, result.item)
+	}
+	for item := range expected {
+		t.Errorf("Missing check %q", item)
+	}
+	if failures := checkFailures(results); failures != 3 {
+		t.Errorf("checkFailures() = %d, want 3", failures)
+	}
+
+	// Nothing the checks looked at was created
+	if _, err := os.Stat(filepath.Join(dir, "web.fifo")); err == nil {
+		t.Error("Checking created the FIFO")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 4 {
+		t.Errorf("Directory has %d entries after checking, want 4", len(entries))
+	}
+}
+
+// TestRunChecksShellHooks tests how the shell hooks can reach script2json
+func TestRunChecksShellHooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     checkOptions
+		expected string
+	}{
+		{"Markers", checkOptions{}, checkOK},
+		{"Signals without a PID file", checkOptions{signals: true}, checkWarn},
+		{"Signal socket", checkOptions{signals: true, sockets: [][2]string{{"signal socket", filepath.Join(t.TempDir(), "sig.sock")}}}, checkOK},
+		{"Control messages", checkOptions{signals: true, controlMessages: true}, checkOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.stdout = os.Stdout
+			results := runChecks(tt.opts)
+			hooks := results[len(results)-1]
+			if hooks.item != "shell hooks" || hooks.status != tt.expected {
+				t.Errorf("Last check = %+v, want shell hooks %s", hooks, tt.expected)
+			}
+		})
+	}
+}
+
+// TestWriteCheckReport tests the report layout
+func TestWriteCheckReport(t *testing.T) {
+	var out bytes.Buffer
+	writeCheckReport(&out, []checkResult{
+		{checkOK, "config", "valid"},
+		{checkFail, "script fifo", "not a FIFO"},
+	})
+	expected := "ok    config       valid\nfail  script fifo  not a FIFO\n"
+	if out.String() != expected {
+		t.Errorf("Report = %q, want %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// reloadableFlags are the flags that a reload applies to a running script2json.
+// Other flags, such as the FIFO paths, only take effect at startup.
+var reloadableFlags = []string{"log-level", "on-output-error", "fallback-file"}
+
+// runtimeLogLevel is the level of the default logger, which a reload can change.
+var runtimeLogLevel slog.LevelVar
+
+// parseLogLevel returns the slog level named by a --log-level value.
+func parseLogLevel(name string) (slog.Level, error) {
+	switch name {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level: %s. Must be debug, info, warn, or error", name)
+}
+
+// readConfigFile reads a config file of flag values, one "name = value" per line
+// with the names of the command-line flags. Blank lines and lines starting with #
+// are ignored.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s line %d: expected name = value", path, lineNum)
+		}
+		config[name] = strings.TrimSpace(value)
+	}
+	return config, scanner.Err()
+}
+
+// envPrefix starts the names of the environment variables that set flags, such as
+// S2J_SCRIPT_FIFO for --script-fifo.
+const envPrefix = "S2J_"
+
+// envListFlags are the repeatable flags, whose environment variables hold several
+// values separated by whitespace.
+var envListFlags = []string{"session"}
+
+// envName returns the name of the environment variable that sets the flag name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnvironment sets the flags in fs from the S2J_ variables in environ, a list
+// of "NAME=value" as returned by os.Environ, except those in set, which were given
+// on the command line and take precedence. It returns the names of the flags it
+// set, and the variables that match no flag, so they can be reported once logging
+// is set up.
+func applyEnvironment(fs *flag.FlagSet, environ []string, set map[string]bool) (applied, unknown []string, err error) {
+	names := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) { names[envName(f.Name)] = f.Name })
+
+	for _, entry := range environ {
+		key, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+		name, ok := names[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		if set[name] {
+			continue
+		}
+		values := []string{value}
+		if slices.Contains(envListFlags, name) {
+			values = strings.Fields(value)
+		}
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return nil, nil, fmt.Errorf("invalid value %q for %s: %w", v, key, err)
+			}
+		}
+		applied = append(applied, name)
+	}
+	return applied, unknown, nil
+}
+
+// applyConfig sets the flags in fs from config, except those in set, which were
+// given on the command line and take precedence.
+func applyConfig(fs *flag.FlagSet, config map[string]string, set map[string]bool) error {
+	for name, value := range config {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting in config file: %s", name)
+		}
+		if name == "config" {
+			return fmt.Errorf("config files cannot name another config file")
+		}
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s in config file: %w", value, name, err)
+		}
+	}
+	return nil
+}
+
+// reloadConfig re-reads the config file at path and applies the reloadable flags
+// to the running process: the log level, and the output failure policy of every
+// session's output. Flags given on the command line keep their values, and
+// reloadable flags missing from the file return to their defaults. Changes to
+// other flags are logged as needing a restart. Nothing is applied if the file or
+// any reloadable value is invalid.
+func reloadConfig(path string, fs *flag.FlagSet, set map[string]bool, logger *slog.Logger) error {
+	config, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{}
+	for _, name := range reloadableFlags {
+		f := fs.Lookup(name)
+		switch value, ok := config[name]; {
+		case set[name]:
+			values[name] = f.Value.String()
+		case ok:
+			values[name] = value
+		default:
+			values[name] = f.DefValue
+		}
+	}
+	for name, value := range config {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("unknown setting in config file: %s", name)
+		}
+		if !slices.Contains(reloadableFlags, name) && !set[name] && value != f.Value.String() {
+			logger.Warn("Setting changed in config file only takes effect after a restart", "setting", name, "value", value)
+		}
+	}
+
+	level, err := parseLogLevel(values["log-level"])
+	if err != nil {
+		return err
+	}
+	if err := validateFailurePolicy(values["on-output-error"], values["fallback-file"]); err != nil {
+		return err
+	}
+	for _, name := range reloadableFlags {
+		fs.Set(name, values[name])
+	}
+	runtimeLogLevel.Set(level)
+	setOutputConfig(values["on-output-error"], values["fallback-file"])
+	logger.Info("Reloaded config file", "path", path, "log_level", values["log-level"],
+		"on_output_error", values["on-output-error"], "fallback_file", values["fallback-file"])
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// newConfigFlagSet returns a flag set with some of script2json's flags
+func newConfigFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.String("log-level", "info", "")
+	fs.String("on-output-error", "exit", "")
+	fs.String("fallback-file", "", "")
+	fs.String("format", "json", "")
+	fs.Int("tab-width", pipeline.DefaultTabWidth, "")
+	return fs
+}
+
+// TestReadConfigFile tests parsing config files of flag values
+func TestReadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script2json.conf")
+	content := "# Output\nformat = pretty\n\n  --tab-width=4  \nfallback-file = /var/log/records.jsonl\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := readConfigFile(path)
+	if err != nil {
+		t.Fatalf("readConfigFile failed: %v", err)
+	}
+	expected := map[string]string{"format": "pretty", "tab-width": "4", "fallback-file": "/var/log/records.jsonl"}
+	if len(config) != len(expected) {
+		t.Errorf("Config = %q, want %q", config, expected)
+	}
+	for name, value := range expected {
+		if config[name] != value {
+			t.Errorf("Config[%q] = %q, want %q", name, config[name], value)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("format pretty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfigFile(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected line 1 parse error, got %v", err)
+	}
+}
+
+// TestApplyConfig tests that config values fill in flags not given on the command line
+func TestApplyConfig(t *testing.T) {
+	fs := newConfigFlagSet()
+	fs.Parse([]string{"-format", "json"})
+	set := map[string]bool{"format": true}
+
+	if err := applyConfig(fs, map[string]string{"format": "pretty", "tab-width": "4"}, set); err != nil {
+		t.Fatalf("applyConfig failed: %v", err)
+	}
+	if format := fs.Lookup("format").Value.String(); format != "json" {
+		t.Errorf("format = %q, want the command line's json", format)
+	}
+	if width := fs.Lookup("tab-width").Value.String(); width != "4" {
+		t.Errorf("tab-width = %q, want 4", width)
+	}
+
+	for _, config := range []map[string]string{{"colour": "always"}, {"tab-width": "wide"}, {"config": "other.conf"}} {
+		if err := applyConfig(fs, config, set); err == nil {
+			t.Errorf("applyConfig(%q) should fail", config)
+		}
+	}
+}
+
+// TestApplyEnvironment tests setting flags from S2J_ environment variables
+func TestApplyEnvironment(t *testing.T) {
+	fs := newConfigFlagSet()
+	var sessions sessionFlags
+	fs.Var(&sessions, "session", "")
+	fs.Parse([]string{"-format", "json"})
+	set := map[string]bool{"format": true}
+
+	environ := []string{
+		"HOME=/root",
+		"S2J_FORMAT=pretty",
+		"S2J_TAB_WIDTH=4",
+		"S2J_FALLBACK_FILE=/var/log/records.jsonl=x",
+		"S2J_SESSION=web:/tmp/web.fifo:/tmp/web.cmd  db:/tmp/db.fifo:/tmp/db.cmd",
+		"S2J_PROMPT=1",
+	}
+	applied, unknown, err := applyEnvironment(fs, environ, set)
+	if err != nil {
+		t.Fatalf("applyEnvironment failed: %v", err)
+	}
+	if got := fs.Lookup("format").Value.String(); got != "json" {
+		t.Errorf("format = %q, want the command line's json", got)
+	}
+	if got := fs.Lookup("tab-width").Value.String(); got != "4" {
+		t.Errorf("tab-width = %q, want 4", got)
+	}
+	if got := fs.Lookup("fallback-file").Value.String(); got != "/var/log/records.jsonl=x" {
+		t.Errorf("fallback-file = %q, want the whole value", got)
+	}
+	if len(sessions) != 2 || sessions[0].name != "web" || sessions[1].name != "db" {
+		t.Errorf("Sessions = %v, want web and db", sessions.String())
+	}
+	if strings.Join(applied, ",") != "tab-width,fallback-file,session" {
+		t.Errorf("Applied = %q", applied)
+	}
+	if strings.Join(unknown, ",") != "S2J_PROMPT" {
+		t.Errorf("Unknown = %q, want S2J_PROMPT", unknown)
+	}
+
+	if _, _, err := applyEnvironment(fs, []string{"S2J_TAB_WIDTH=wide"}, set); err == nil || !strings.Contains(err.Error(), "S2J_TAB_WIDTH") {
+		t.Errorf("Expected an error naming S2J_TAB_WIDTH, got %v", err)
+	}
+}
+
+// TestReloadConfig tests applying the reloadable flags from a changed config file
+func TestReloadConfig(t *testing.T) {
+	defer runtimeLogLevel.Set(runtimeLogLevel.Level())
+	defer setOutputConfig(failurePolicyExit, "")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "script2json.conf")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := newConfigFlagSet()
+	fs.Parse([]string{"-fallback-file", "/tmp/cli.jsonl"})
+	set := map[string]bool{"fallback-file": true}
+
+	write("log-level = debug\non-output-error = fallback\nfallback-file = /tmp/conf.jsonl\ntab-width = 2\n")
+	if err := reloadConfig(path, fs, set, logger); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if level := runtimeLogLevel.Level(); level != slog.LevelDebug {
+		t.Errorf("Log level = %v, want debug", level)
+	}
+	outputConfig.mu.Lock()
+	policy, fallbackPath := outputConfig.policy, outputConfig.fallbackPath
+	outputConfig.mu.Unlock()
+	if policy != failurePolicyFallback || fallbackPath != "/tmp/cli.jsonl" {
+		t.Errorf("Output config = (%s, %s), want (fallback, /tmp/cli.jsonl)", policy, fallbackPath)
+	}
+	if width := fs.Lookup("tab-width").Value.String(); width != "8" {
+		t.Errorf("tab-width = %q, want it unchanged until a restart", width)
+	}
+
+	// Removed settings return to their defaults, and invalid ones change nothing
+	write("on-output-error = spool\n")
+	if err := reloadConfig(path, fs, set, logger); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if level := runtimeLogLevel.Level(); level != slog.LevelInfo {
+		t.Errorf("Log level = %v, want info", level)
+	}
+	write("log-level = error\non-output-error = retry\n")
+	if err := reloadConfig(path, fs, set, logger); err == nil {
+		t.Error("Reloading an invalid policy should fail")
+	}
+	if level := runtimeLogLevel.Level(); level != slog.LevelInfo {
+		t.Errorf("Log level = %v after a failed reload, want info", level)
+	}
+}
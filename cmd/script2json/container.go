@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"script2json/pkg/pipeline"
+)
+
+// defaultContainerShell is the command started in the container if none is given.
+var defaultContainerShell = []string{"sh"}
+
+// runContainerExec implements the exec subcommand, which records a shell in a
+// running container: it runs "docker exec -it" (or podman's) on a local
+// pseudo-terminal and finds commands by matching prompts, as the ssh subcommand
+// does. Records are stamped with the container's ID and image.
+func runContainerExec(args []string) error {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	runtime := fs.String("runtime", "", "Container runtime to use (docker, podman); defaults to docker if it is installed, else podman")
+	flags := addPromptRecorderFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s exec [flags] [--] container [command [args ...]]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := flags.validate(); err != nil {
+		return err
+	}
+	if *runtime == "" {
+		*runtime = "podman"
+		if _, err := exec.LookPath("docker"); err == nil {
+			*runtime = "docker"
+		}
+	}
+	if *runtime != "docker" && *runtime != "podman" {
+		return fmt.Errorf("%w: invalid runtime: %s. Must be docker or podman", errConfig, *runtime)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("%w: exec requires a container", errConfig)
+	}
+	container := fs.Arg(0)
+	command := fs.Args()[1:]
+	if len(command) == 0 {
+		command = defaultContainerShell
+	}
+
+	info, err := inspectContainer(*runtime, container)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(*runtime, append([]string{"exec", "-it", container}, command...)...)
+	return recordWithPrompts(cmd, flags, func(sess *session) {
+		sess.container = info
+	})
+}
+
+// inspectContainer looks up the ID and image of a running container by name or ID.
+func inspectContainer(runtime, container string) (*pipeline.ContainerInfo, error) {
+	out, err := exec.Command(runtime, "inspect", "--type", "container", "--format", "{{.Id}} {{.Config.Image}}", container).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("could not inspect container %s: %s", container, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("could not inspect container %s: %w", container, err)
+	}
+	return parseContainerInspect(runtime, string(out))
+}
+
+// parseContainerInspect parses the "<id> <image>" output of inspectContainer.
+func parseContainerInspect(runtime, out string) (*pipeline.ContainerInfo, error) {
+	id, image, ok := strings.Cut(strings.TrimSpace(out), " ")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("unexpected output from %s inspect: %q", runtime, out)
+	}
+	return &pipeline.ContainerInfo{Runtime: runtime, ID: id, Image: image}, nil
+}
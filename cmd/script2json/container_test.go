@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestParseContainerInspect tests parsing the output of docker/podman inspect
+func TestParseContainerInspect(t *testing.T) {
+	info, err := parseContainerInspect("docker", "3f2a9c1d docker.io/library/nginx:1.27\n")
+	if err != nil {
+		t.Fatalf("parseContainerInspect failed: %v", err)
+	}
+	expected := pipeline.ContainerInfo{Runtime: "docker", ID: "3f2a9c1d", Image: "docker.io/library/nginx:1.27"}
+	if *info != expected {
+		t.Errorf("parseContainerInspect = %+v, want %+v", *info, expected)
+	}
+
+	if _, err := parseContainerInspect("podman", "\n"); err == nil {
+		t.Error("parseContainerInspect succeeded on empty output, want error")
+	}
+}
+
+// TestInspectContainer tests running the runtime's inspect command
+func TestInspectContainer(t *testing.T) {
+	runtime := filepath.Join(t.TempDir(), "docker")
+	script := "#!/bin/sh\n" +
+		"[ \"$6\" = web ] || { echo \"Error: no such container $6\" >&2; exit 1; }\n" +
+		"echo 'abc123 alpine:3.20'\n"
+	if err := os.WriteFile(runtime, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := inspectContainer(runtime, "web")
+	if err != nil {
+		t.Fatalf("inspectContainer failed: %v", err)
+	}
+	if info.ID != "abc123" || info.Image != "alpine:3.20" {
+		t.Errorf("inspectContainer = %+v, want abc123 alpine:3.20", *info)
+	}
+
+	if _, err := inspectContainer(runtime, "db"); err == nil {
+		t.Error("inspectContainer succeeded for a missing container, want error")
+	}
+}
+
+// TestContainerRecord tests that exec sessions stamp their records
+func TestContainerRecord(t *testing.T) {
+	sess := newSession("", "", "")
+	sess.container = &pipeline.ContainerInfo{Runtime: "podman", ID: "abc123", Image: "alpine:3.20"}
+	record := newCommandRecord("ls", pipeline.Output{Text: "bin\n"}, time.Time{}, recordOptions{session: sess})
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Container pipeline.ContainerInfo `json:"container"`
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Container != *sess.container {
+		t.Errorf("Container = %+v, want %+v", decoded.Container, *sess.container)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultControlSocket is where the register subcommand looks for the control socket.
+const defaultControlSocket = "/tmp/script2json.sock"
+
+// defaultSignalSocket is where the ctl subcommand looks for the signal socket.
+const defaultSignalSocket = "/tmp/script2json-signal.sock"
+
+// listenUnixSocket listens on a Unix stream socket at path with the permissions perm.
+// A socket left behind by a previous run is replaced.
+func listenUnixSocket(path string, perm os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode().Type() == os.ModeSocket {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// parseSocketMode returns the permissions of a Unix socket given in octal.
+func parseSocketMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode: %s. Must be permissions in octal, such as 0666", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// serveControlSocket accepts connections on l until it is closed. Each connection
+// sends messages of one line each, and every message is answered with "ok" or
+// "error <message>":
+//   - "register <name> <scriptfifo> <commandfifo>" starts a new session through start
+//   - "list" writes a line "<name> <scriptfifo> <commandfifo>" for each running
+//     session before the "ok"
+//   - "reload" re-reads the config file through reload
+//   - the commands of the signal socket (see handleSignalCommand)
+func serveControlSocket(l net.Listener, registry *sessionRegistry, start func(*session) error, reload func() error, logger *slog.Logger) {
+	serveLineSocket(l, "control", func(message string) []string {
+		return handleControlMessage(message, registry, start, reload)
+	}, logger)
+}
+
+// serveSignalSocket accepts connections on l until it is closed, and answers
+// their messages with handleSignalCommand.
+func serveSignalSocket(l net.Listener, registry *sessionRegistry, logger *slog.Logger) {
+	serveLineSocket(l, "signal", func(message string) []string {
+		return handleSignalCommand(message, registry)
+	}, logger)
+}
+
+// serveLineSocket accepts connections on l until it is closed, and answers each
+// line that they send with the lines that handle returns.
+func serveLineSocket(l net.Listener, kind string, handle func(string) []string, logger *slog.Logger) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("Error accepting "+kind+" connection", "error", err)
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				reply := handle(scanner.Text())
+				if _, err := conn.Write([]byte(strings.Join(reply, "\n") + "\n")); err != nil {
+					logger.Debug("Error writing "+kind+" reply", "error", err)
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handleControlMessage performs a single control message and returns the lines of
+// its reply.
+func handleControlMessage(message string, registry *sessionRegistry, start func(*session) error, reload func() error) []string {
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return []string{"error empty message"}
+	}
+	switch fields[0] {
+	case "register":
+		if len(fields) != 4 {
+			return []string{"error usage: register <name> <scriptfifo> <commandfifo>"}
+		}
+		if err := start(newSession(fields[1], fields[2], fields[3])); err != nil {
+			return []string{"error " + err.Error()}
+		}
+		return []string{"ok"}
+	case "list":
+		var reply []string
+		for _, sess := range registry.list() {
+			reply = append(reply, fmt.Sprintf("%s %s %s", sess.name, sess.scriptFifoPath, sess.commandFifoPath))
+		}
+		return append(reply, "ok")
+	case "reload":
+		if len(fields) != 1 {
+			return []string{"error usage: reload"}
+		}
+		if err := reload(); err != nil {
+			return []string{"error " + err.Error()}
+		}
+		return []string{"ok"}
+	default:
+		return handleSignalCommand(message, registry)
+	}
+}
+
+// handleSignalCommand performs a message of the signal socket, a robust
+// alternative to the signals that can't get lost under load and can carry
+// arguments, and returns the lines of its reply:
+//   - "start" and "stop" start and stop reading, like SIGUSR1 and SIGUSR2
+//   - "flush" turns the output read so far into a record without stopping
+//   - "reset" resets the pipeline state, like SIGHUP
+//   - "annotate <text>" writes an annotation record
+//   - "status" writes a line with the StatusResponse, as JSON, before the "ok"
+//   - "sink stdout" and "sink file <path>" switch the output that records are
+//     written to, and "reopen" reopens the output file, e.g. after rotation
+//
+// A message prefixed with "@<session> " applies to that session only. Otherwise,
+// start, stop and flush apply to the signal-controlled sessions and reset and
+// status to all of them, as the signals do, and annotate requires that only one
+// session runs. sink and reopen apply to the output that all sessions share, so
+// they take no session.
+func handleSignalCommand(message string, registry *sessionRegistry) []string {
+	var name *string
+	message = strings.TrimSpace(message)
+	if target, rest, ok := strings.Cut(message, " "); ok && strings.HasPrefix(target, "@") {
+		target = target[1:]
+		name, message = &target, strings.TrimSpace(rest)
+	}
+	command, args, _ := strings.Cut(message, " ")
+	args = strings.TrimSpace(args)
+	if command == "" {
+		return []string{"error empty message"}
+	}
+
+	var action func(*session)
+	signalOnly := true
+	switch command {
+	case "start":
+		action = startReading
+	case "stop":
+		action = stopReading
+	case "flush":
+		action = flushReading
+	case "reset":
+		action, signalOnly = resetSession, false
+	case "sink", "reopen":
+		if name != nil {
+			return []string{"error " + command + " applies to all sessions"}
+		}
+		return handleSinkCommand(command, args)
+	case "annotate", "status":
+	default:
+		return []string{"error unknown message: " + command}
+	}
+	if command != "annotate" && args != "" {
+		return []string{"error usage: " + command}
+	}
+
+	sessions, err := selectSessions(registry, name, nil)
+	if err != nil {
+		return []string{"error " + err.Error()}
+	}
+	if command == "status" {
+		data, err := json.Marshal(statusOf(sessions))
+		if err != nil {
+			return []string{"error " + err.Error()}
+		}
+		return []string{string(data), "ok"}
+	}
+	if command == "annotate" {
+		if args == "" {
+			return []string{"error usage: annotate <text>"}
+		}
+		if len(sessions) != 1 {
+			return []string{fmt.Sprintf("error %d sessions are running; choose one with @<session>", len(sessions))}
+		}
+		if err := annotateSessions(sessions, args); err != nil {
+			return []string{"error " + err.Error()}
+		}
+		return []string{"ok"}
+	}
+	controlSessions(sessions, name != nil, signalOnly, action)
+	return []string{"ok"}
+}
+
+// handleSinkCommand performs a sink or reopen message of the signal socket.
+func handleSinkCommand(command, args string) []string {
+	if command == "reopen" {
+		if args != "" {
+			return []string{"error usage: reopen"}
+		}
+		if err := reopenSink(); err != nil {
+			return []string{"error " + err.Error()}
+		}
+		slog.Info("Reopened output", "sink", sinkName())
+		return []string{"ok"}
+	}
+	path, err := parseSinkTarget(args)
+	if err != nil {
+		return []string{"error " + err.Error()}
+	}
+	if err := switchSink(path); err != nil {
+		return []string{"error " + err.Error()}
+	}
+	slog.Info("Switched output", "sink", sinkName())
+	return []string{"ok"}
+}
+
+// runRegister implements the register subcommand, which asks a running script2json
+// to start recording a new session, so shells can register themselves on startup.
+func runRegister(args []string) error {
+	fs := flag.NewFlagSet("register", flag.ExitOnError)
+	socket := fs.String("socket", defaultControlSocket, "Path to the control socket of the running script2json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s register [-socket path] <name> <scriptfifo> <commandfifo>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return fmt.Errorf("%w: register takes a name, a script FIFO and a command FIFO", errConfig)
+	}
+	for _, arg := range fs.Args() {
+		if arg == "" || strings.ContainsAny(arg, " \t\n") {
+			return fmt.Errorf("%w: session names and FIFO paths must not be empty or contain whitespace: %q", errConfig, arg)
+		}
+	}
+
+	if err := sendControlMessage(*socket, "register "+strings.Join(fs.Args(), " ")); err != nil {
+		return fmt.Errorf("registration failed: %w", err)
+	}
+	return nil
+}
+
+// runReload implements the reload subcommand, which asks a running script2json to
+// re-read its config file.
+func runReload(args []string) error {
+	fs := flag.NewFlagSet("reload", flag.ExitOnError)
+	socket := fs.String("socket", defaultControlSocket, "Path to the control socket of the running script2json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s reload [-socket path]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("%w: reload takes no arguments", errConfig)
+	}
+	if err := sendControlMessage(*socket, "reload"); err != nil {
+		return fmt.Errorf("reload failed: %w", err)
+	}
+	return nil
+}
+
+// runCtl implements the ctl subcommand, which sends a single message to the
+// signal or control socket of a running script2json, such as "start" or
+// "annotate deploying v2".
+func runCtl(args []string) error {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := fs.String("socket", defaultSignalSocket, "Path to the signal or control socket of the running script2json")
+	session := fs.String("session", "", "Apply the message to this session only")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ctl [-socket path] [-session name] start|stop|flush|reset|status|annotate <text>|sink stdout|sink file <path>|reopen\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("%w: ctl requires a message", errConfig)
+	}
+	message := strings.Join(fs.Args(), " ")
+	if strings.ContainsAny(message, "\n\r") {
+		return fmt.Errorf("%w: messages must be a single line", errConfig)
+	}
+	if *session != "" {
+		message = "@" + *session + " " + message
+	}
+	reply, err := requestControlSocket(*socket, message)
+	for _, line := range reply {
+		fmt.Println(line)
+	}
+	return err
+}
+
+// sendControlMessage sends a single message to the control socket at socket and
+// returns the error that it was answered with, if any.
+func sendControlMessage(socket, message string) error {
+	_, err := requestControlSocket(socket, message)
+	return err
+}
+
+// requestControlSocket sends a single message to the control socket at socket
+// and returns the lines of its reply before the final "ok", or the error that it
+// was answered with.
+func requestControlSocket(socket, message string) ([]string, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to control socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintf(conn, "%s\n", message); err != nil {
+		return nil, fmt.Errorf("could not send message: %w", err)
+	}
+	var lines []string
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("could not read reply: %w", err)
+		}
+		reply = strings.TrimSpace(reply)
+		if reply == "ok" {
+			return lines, nil
+		}
+		if strings.HasPrefix(reply, "error ") {
+			return nil, errors.New(strings.TrimPrefix(reply, "error "))
+		}
+		lines = append(lines, reply)
+	}
+}
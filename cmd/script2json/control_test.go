@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestHandleControlMessage tests the replies to control socket messages
+func TestHandleControlMessage(t *testing.T) {
+	registry := newSessionRegistry()
+	start := func(sess *session) error { return registry.add(sess) }
+	reloads := 0
+	reload := func() error {
+		if reloads++; reloads > 1 {
+			return errors.New("invalid log level: loud")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		message  string
+		expected []string
+	}{
+		{message: "register web /tmp/web.fifo /tmp/web.cmd", expected: []string{"ok"}},
+		{message: "register db /tmp/db.fifo /tmp/db.cmd", expected: []string{"ok"}},
+		{message: "register web /tmp/other.fifo /tmp/other.cmd", expected: []string{"error duplicate session name: web"}},
+		{message: "register web /tmp/web.fifo", expected: []string{"error usage: register <name> <scriptfifo> <commandfifo>"}},
+		{message: "list", expected: []string{"web /tmp/web.fifo /tmp/web.cmd", "db /tmp/db.fifo /tmp/db.cmd", "ok"}},
+		{message: "reload", expected: []string{"ok"}},
+		{message: "reload", expected: []string{"error invalid log level: loud"}},
+		{message: "reload now", expected: []string{"error usage: reload"}},
+		{message: "unregister web", expected: []string{"error unknown message: unregister"}},
+		{message: "  ", expected: []string{"error empty message"}},
+	}
+
+	for _, tt := range tests {
+		if reply := handleControlMessage(tt.message, registry, start, reload); !slices.Equal(reply, tt.expected) {
+			t.Errorf("handleControlMessage(%q) = %q, want %q", tt.message, reply, tt.expected)
+		}
+	}
+}
+
+// TestHandleSignalCommand tests the signal socket's messages and their replies
+func TestHandleSignalCommand(t *testing.T) {
+	signalled := newSession("signalled", "", "")
+	signalled.markers = false
+	marked := newSession("marked", "", "")
+	registry := newSessionRegistry(signalled, marked)
+
+	tests := []struct {
+		message  string
+		expected string
+		// reading is the expected state of signalled and marked afterwards
+		reading [2]bool
+	}{
+		{"start", "ok", [2]bool{true, false}},
+		{"@marked start", "ok", [2]bool{true, true}},
+		{"flush", "ok", [2]bool{true, true}},
+		{"stop now", "error usage: stop", [2]bool{true, true}},
+		{"@db stop", "error unknown session: db", [2]bool{true, true}},
+		{"stop", "ok", [2]bool{false, true}},
+		{"reset", "ok", [2]bool{false, false}},
+		{"annotate deploying v2", "error 2 sessions are running; choose one with @<session>", [2]bool{false, false}},
+		{"@marked annotate   deploying  v2 ", "ok", [2]bool{false, false}},
+		{"@marked annotate", "error usage: annotate <text>", [2]bool{false, false}},
+		{"sink stdout", "ok", [2]bool{false, false}},
+		{"@marked sink stdout", "error sink applies to all sessions", [2]bool{false, false}},
+		{"sink file", "error usage: sink stdout|file <path>", [2]bool{false, false}},
+		{"reopen", "ok", [2]bool{false, false}},
+		{"reopen now", "error usage: reopen", [2]bool{false, false}},
+		{"pause", "error unknown message: pause", [2]bool{false, false}},
+		{"", "error empty message", [2]bool{false, false}},
+	}
+
+	for _, tt := range tests {
+		if reply := handleSignalCommand(tt.message, registry); !slices.Equal(reply, []string{tt.expected}) {
+			t.Errorf("handleSignalCommand(%q) = %q, want %q", tt.message, reply, tt.expected)
+		}
+		if reading := [2]bool{signalled.recording(), marked.recording()}; reading != tt.reading {
+			t.Errorf("After %q, reading = %v, want %v", tt.message, reading, tt.reading)
+		}
+	}
+
+	// flush and stop sent EOF to signalled; marked only got the one of its reset
+	if len(signalled.scriptFifoByteChan) != 2 || len(marked.scriptFifoByteChan) != 1 {
+		t.Errorf("EOFs sent = (%d, %d), want (2, 1)", len(signalled.scriptFifoByteChan), len(marked.scriptFifoByteChan))
+	}
+	if text := <-marked.annotations; text != "deploying  v2" {
+		t.Errorf("Annotation = %q, want %q", text, "deploying  v2")
+	}
+}
+
+// endSession ends sess as its terminal would, by opening and closing its script
+// FIFO, and waits until it has been removed
+func endSession(t *testing.T, sess *session) {
+	t.Helper()
+	f, err := os.OpenFile(sess.scriptFifoPath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open script FIFO: %v", err)
+	}
+	f.Close()
+	select {
+	case <-sess.done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for the session to end")
+	}
+}
+
+// TestControlSocketSessionLifecycle tests registering a session at runtime and its
+// removal once its script FIFO is closed
+func TestControlSocketSessionLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "control.sock")
+	scriptFifo := filepath.Join(dir, "web.fifo")
+	commandFifo := filepath.Join(dir, "web.cmd")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	l, err := listenUnixSocket(socket, 0600)
+	if err != nil {
+		t.Fatalf("listenUnixSocket failed: %v", err)
+	}
+	defer l.Close()
+	registry := newSessionRegistry()
+	go serveControlSocket(l, registry, func(sess *session) error {
+		return startSession(sess, registry, commandReaderOptions{framing: commandFramingNewline}, editorOptions{}, recordOptions{stdout: io.Discard}, logger)
+	}, func() error { return nil }, logger)
+	// End the sessions still running, so their pipelines don't outlive the test
+	t.Cleanup(func() {
+		for _, sess := range registry.list() {
+			endSession(t, sess)
+		}
+	})
+
+	if err := runRegister([]string{"-socket", socket, "web", scriptFifo, commandFifo}); err != nil {
+		t.Fatalf("runRegister failed: %v", err)
+	}
+	if err := runRegister([]string{"-socket", socket, "web", scriptFifo, commandFifo}); err == nil {
+		t.Error("Registering a running session's name should fail")
+	}
+	if sessions := registry.list(); len(sessions) != 1 || sessions[0].name != "web" {
+		t.Fatalf("Sessions = %v, want only web", sessions)
+	}
+	if info, err := os.Stat(scriptFifo); err != nil || info.Mode().Type() != os.ModeNamedPipe {
+		t.Fatalf("Script FIFO was not created: %v", err)
+	}
+
+	// The session ends when the terminal closes its script FIFO
+	endSession(t, registry.list()[0])
+	if sessions := registry.list(); len(sessions) != 0 {
+		t.Fatalf("Sessions = %v after the session ended, want none", sessions)
+	}
+	if err := runRegister([]string{"-socket", socket, "web", scriptFifo, commandFifo}); err != nil {
+		t.Errorf("Re-registering an ended session failed: %v", err)
+	}
+}
+
+// TestParseSocketMode tests parsing --grpc-socket-mode
+func TestParseSocketMode(t *testing.T) {
+	if mode, err := parseSocketMode("0666"); err != nil || mode != 0666 {
+		t.Errorf("parseSocketMode(0666) = %o, %v", mode, err)
+	}
+	for _, value := range []string{"", "666x", "1777", "rw"} {
+		if _, err := parseSocketMode(value); err == nil {
+			t.Errorf("parseSocketMode(%q) succeeded, want an error", value)
+		}
+	}
+}
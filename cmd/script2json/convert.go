@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// defaultPromptPattern matches common single-line shell prompts, such as
+// "user@host:~$ ", "[user@host dir]# " and "host% ". PS2 continuation prompts
+// ("> ") are deliberately not matched, so multi-line commands stay together.
+const defaultPromptPattern = `^(\S*|\[[^\]]*\])[$#%] `
+
+// scriptHeaderLayouts are the timestamp formats found after "Script started on " in
+// typescripts written by util-linux (current and older versions) and BSD script.
+var scriptHeaderLayouts = []string{
+	"2006-01-02 15:04:05-07:00",
+	"Mon 02 Jan 2006 03:04:05 PM MST",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+// convertOptions controls how a typescript is split into commands and cleaned.
+type convertOptions struct {
+	// prompt matches the cleaned text of a prompt line up to where the command starts
+	prompt *regexp.Regexp
+	editor editorOptions
+	record recordOptions
+	// timing, if set, gives each record start_timestamp and duration_ms fields
+	timing *timingLog
+	// asciicast adds the output's timed chunks as output_events (requires timing)
+	asciicast bool
+	// castMarkers splits asciicast recordings at their markers rather than at prompts
+	castMarkers bool
+}
+
+// runConvert implements the convert subcommand, which turns existing script(1)
+// typescript files, or asciinema recordings, into records without FIFOs or signals.
+// Inputs are read from the files named in args, or from stdin if none are given, or
+// are found under the -dir directory.
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	prompt := fs.String("prompt", defaultPromptPattern, "Regular expression matching a prompt line up to the start of the command")
+	marker := fs.String("marker", "", "Literal string that ends the prompt; overrides -prompt")
+	parseArgv := fs.Bool("parse-argv", false, "Tokenize each command with shell quoting rules into an argv field")
+	keepColors := fs.Bool("keep-colors", false, "Keep SGR color sequences in a styled_output field alongside the plain output")
+	collapseProgress := fs.Bool("collapse-progress", false, "Collapse runs of progress lines in output into their final line")
+	newline := fs.String("newline", pipeline.NewlineRaw, "Line endings in output (lf, crlf, raw)")
+	tabWidth := fs.Int("tab-width", pipeline.DefaultTabWidth, "Distance between tab stops used to expand tabs into spaces")
+	altScreen := fs.String("alt-screen", pipeline.AltScreenDiscard, "What to do with full-screen programs' alternate screen: discard it, or keep its last contents in the output (discard, keep)")
+	timingPath := fs.String("timing", "", "Timing file written by script --log-timing, for start times and durations")
+	asciicast := fs.Bool("asciicast", false, "Include each command's timed output chunks as asciicast-style output_events (requires -timing for typescripts)")
+	castMarkers := fs.Bool("cast-markers", false, "Split asciicast recordings into commands at their marker events, labelled with the markers, instead of at prompts")
+	dir := fs.String("dir", "", "Convert every typescript and recording under this directory into its own JSONL file under -out")
+	outDir := fs.String("out", "", "Directory for the JSONL files and manifest of -dir")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Number of files that -dir converts at once")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s convert [-prompt regexp | -marker string] [-timing file] [flags] [typescript | recording.cast ...]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s convert -dir directory -out directory [-jobs n] [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	promptRe, err := promptPattern(*prompt, *marker)
+	if err != nil {
+		return err
+	}
+	if *newline != pipeline.NewlineLF && *newline != pipeline.NewlineCRLF && *newline != pipeline.NewlineRaw {
+		return fmt.Errorf("%w: invalid newline mode: %s. Must be lf, crlf, or raw", errConfig, *newline)
+	}
+	if *tabWidth < 1 {
+		return fmt.Errorf("%w: invalid tab width: %d. Must be at least 1", errConfig, *tabWidth)
+	}
+
+	// A timing file describes a single session
+	if err := validateAltScreen(*altScreen); err != nil {
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+	if *timingPath != "" && fs.NArg() > 1 {
+		return fmt.Errorf("%w: -timing requires a single typescript", errConfig)
+	}
+	if *dir != "" {
+		if fs.NArg() > 0 || *timingPath != "" {
+			return fmt.Errorf("%w: -dir cannot be combined with input files or -timing", errConfig)
+		}
+		if *outDir == "" {
+			return fmt.Errorf("%w: -dir requires -out", errConfig)
+		}
+		if *jobs < 1 {
+			return fmt.Errorf("%w: invalid number of jobs: %d. Must be at least 1", errConfig, *jobs)
+		}
+	} else if *outDir != "" {
+		return fmt.Errorf("%w: -out requires -dir", errConfig)
+	}
+
+	opts := convertOptions{
+		prompt:      promptRe,
+		editor:      editorOptions{EditorOptions: pipeline.EditorOptions{TabWidth: *tabWidth, KeepColors: *keepColors, AltScreen: *altScreen}},
+		record:      recordOptions{parseArgv: *parseArgv, collapseProgress: *collapseProgress, newline: *newline},
+		asciicast:   *asciicast,
+		castMarkers: *castMarkers,
+	}
+	if *timingPath != "" {
+		f, err := os.Open(*timingPath)
+		if err != nil {
+			return fmt.Errorf("could not open timing file: %w", err)
+		}
+		opts.timing, err = readTimingLog(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", *timingPath, err)
+		}
+	}
+
+	if *dir != "" {
+		return convertDir(*dir, *outDir, *jobs, opts)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if fs.NArg() == 0 {
+		return convertInput(os.Stdin, out, opts)
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open typescript: %w", err)
+		}
+		err = convertInput(f, out, opts)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// promptPattern compiles the prompt pattern given by the -prompt and -marker flags;
+// a marker, if given, matches everything up to and including the literal string.
+func promptPattern(prompt, marker string) (*regexp.Regexp, error) {
+	if marker != "" {
+		prompt = "^.*" + regexp.QuoteMeta(marker)
+	}
+	re, err := regexp.Compile(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid prompt pattern: %v", errConfig, err)
+	}
+	return re, nil
+}
+
+// convertInput writes the records of r, which holds a typescript or, if it starts
+// with an asciicast header, an asciinema recording.
+func convertInput(r io.Reader, w io.Writer, opts convertOptions) error {
+	reader := bufio.NewReader(r)
+	first, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("could not read input: %w", err)
+	}
+	r = io.MultiReader(bytes.NewReader(first), reader)
+	if _, ok := parseCastHeader(first); ok {
+		if opts.timing != nil {
+			return fmt.Errorf("%w: -timing does not apply to asciicast recordings, which carry their own timing", errConfig)
+		}
+		return convertCast(r, w, opts)
+	}
+	if opts.asciicast && opts.timing == nil {
+		return fmt.Errorf("%w: -asciicast requires -timing for typescripts", errConfig)
+	}
+	return convertTypescript(r, w, opts)
+}
+
+// convertTypescript reads a script(1) typescript from r and writes one JSONL record
+// per command to w. Each line is cleaned on its own to find prompts: a line whose
+// cleaned text matches opts.prompt starts a new command, made up of the rest of the
+// line, and the lines up to the next prompt are its output. Output before the first
+// prompt is kept as a record without a command; blank records are skipped.
+//
+// Without a timing log, every record's return_timestamp is the start time from the
+// "Script started on" header (or the zero time if there is none). With one, a command
+// starts when its prompt line ends and returns when the next prompt line begins.
+func convertTypescript(r io.Reader, w io.Writer, opts convertOptions) error {
+	reader := bufio.NewReader(r)
+	// lines cleans each line separately to look for prompts, while output cleans
+	// whole commands so that multi-line redraws work. A kept alternate screen would
+	// run into the prompt line that follows it, so lines always discards it
+	lineOpts := opts.editor.EditorOptions
+	lineOpts.AltScreen = pipeline.AltScreenDiscard
+	lines := pipeline.NewLineEditor(lineOpts, slog.Default(), nil)
+	output := pipeline.NewLineEditor(opts.editor.EditorOptions, slog.Default(), nil)
+
+	var started time.Time
+	command := ""
+	// offset is the position in the typescript after the header, as used by the
+	// timing log; commandOffset is where the current command's output begins
+	var offset, commandOffset int64
+	var raw []byte
+	flush := func() error {
+		out := output.Finish()
+		data := raw
+		raw = nil
+		if command == "" && strings.TrimSpace(out.Text) == "" {
+			return nil
+		}
+
+		// The command was submitted when the newline ending its prompt line was echoed
+		var start, end time.Duration
+		if opts.timing != nil {
+			if commandOffset > 0 {
+				start = opts.timing.at(commandOffset - 1)
+			}
+			end = opts.timing.at(offset)
+		}
+		return writeConvertedRecord(w, command, out, data, commandOffset, start, end, started, opts)
+	}
+
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("line %d: could not read typescript: %w", lineNum, readErr)
+		}
+
+		if lineNum == 1 {
+			if t, ok := parseScriptHeader(line); ok {
+				started = t
+				line = nil
+			} else if opts.timing != nil {
+				started = opts.timing.startTime
+			}
+		}
+		if bytes.HasPrefix(line, []byte("Script done on ")) {
+			line = nil
+		}
+
+		for _, b := range line {
+			lines.WriteByte(b)
+		}
+		cleaned := strings.TrimRight(lines.Finish().Text, "\r\n")
+		if loc := opts.prompt.FindStringIndex(cleaned); loc != nil {
+			if err := flush(); err != nil {
+				return err
+			}
+			command = strings.TrimSpace(cleaned[loc[1]:])
+			commandOffset = offset + int64(len(line))
+		} else {
+			for _, b := range line {
+				output.WriteByte(b)
+			}
+			if opts.asciicast {
+				raw = append(raw, line...)
+			}
+		}
+		offset += int64(len(line))
+
+		if readErr == io.EOF {
+			return flush()
+		}
+	}
+}
+
+// writeConvertedRecord writes the record of a converted command. data is the
+// command's raw output, which starts at offset in the typescript, and start and end
+// are the times since the start of the session when the command was submitted and
+// returned; they are only used if opts.timing is set.
+func writeConvertedRecord(w io.Writer, command string, out pipeline.Output, data []byte, offset int64, start, end time.Duration, started time.Time, opts convertOptions) error {
+	record := newCommandRecord(command, out, started, opts.record)
+	if opts.timing != nil {
+		record.DurationMs = (end - start).Milliseconds()
+		if !started.IsZero() {
+			startTime := started.Add(start)
+			record.StartTimestamp = &startTime
+			record.ReturnTimestamp = started.Add(end)
+		}
+		if opts.asciicast {
+			record.OutputEvents = opts.timing.events(data, offset, start)
+		}
+	}
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not marshal record: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", encoded); err != nil {
+		return fmt.Errorf("could not write record: %w", err)
+	}
+	return nil
+}
+
+// parseScriptHeader reports whether line is the "Script started on" header of a
+// typescript, and returns the start time it records if it can be parsed.
+func parseScriptHeader(line []byte) (time.Time, bool) {
+	rest, ok := bytes.CutPrefix(line, []byte("Script started on "))
+	if !ok {
+		return time.Time{}, false
+	}
+	// util-linux appends the terminal and command details in brackets
+	stamp, _, _ := strings.Cut(strings.TrimSpace(string(rest)), " [")
+	t, _ := parseScriptTimestamp(stamp)
+	return t, true
+}
+
+// parseScriptTimestamp parses a session start time as written by script(1).
+func parseScriptTimestamp(stamp string) (time.Time, bool) {
+	for _, layout := range scriptHeaderLayouts {
+		if t, err := time.Parse(layout, stamp); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
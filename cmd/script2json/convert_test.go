@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestConvertTypescript tests splitting a typescript into command records
+func TestConvertTypescript(t *testing.T) {
+	typescript := "Script started on 2025-09-29 13:20:00-04:00 [TERM=\"xterm\" TTY=\"/dev/pts/1\" COLUMNS=\"80\" LINES=\"24\"]\n" +
+		"Last login: Mon Sep 29 13:19:00\r\n" +
+		"\x1b]0;user@host:~\x07user@host:~$ ls\b\bls -l\r\n" +
+		"total 0\r\n" +
+		"-rw-r--r-- 1 user user 0 a.txt\r\n" +
+		"\x1b[01;32muser@host\x1b[00m:~$ \r\n" +
+		"user@host:~$ cat <<EOF\r\n" +
+		"> one\r\n" +
+		"> EOF\r\n" +
+		"one\r\n" +
+		"user@host:~$ exit\r\n" +
+		"exit\r\n" +
+		"\nScript done on 2025-09-29 13:25:00-04:00 [COMMAND_EXIT_CODE=\"0\"]\n"
+
+	var out bytes.Buffer
+	opts := convertOptions{prompt: regexp.MustCompile(defaultPromptPattern)}
+	if err := convertTypescript(strings.NewReader(typescript), &out, opts); err != nil {
+		t.Fatalf("convertTypescript failed: %v", err)
+	}
+
+	expected := []struct {
+		command string
+		output  string
+	}{
+		{"", "Last login: Mon Sep 29 13:19:00\r\n"},
+		{"ls -l", "total 0\r\n-rw-r--r-- 1 user user 0 a.txt\r\n"},
+		{"cat <<EOF", "> one\r\n> EOF\r\none\r\n"},
+		{"exit", "exit\r\n\n"},
+	}
+	started := time.Date(2025, 9, 29, 13, 20, 0, 0, time.FixedZone("", -4*60*60))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d records, want %d:\n%s", len(lines), len(expected), out.String())
+	}
+	for i, line := range lines {
+		var record pipeline.CommandRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse record %d: %v", i, err)
+		}
+		if record.Command != expected[i].command || record.Output != expected[i].output {
+			t.Errorf("Record %d = (%q, %q), want (%q, %q)", i, record.Command, record.Output, expected[i].command, expected[i].output)
+		}
+		if !record.ReturnTimestamp.Equal(started) {
+			t.Errorf("Record %d timestamp = %v, want %v", i, record.ReturnTimestamp, started)
+		}
+	}
+}
+
+// TestConvertTypescriptMarker tests splitting on a custom prompt pattern
+func TestConvertTypescriptMarker(t *testing.T) {
+	typescript := "myhost >>> uptime\r\n up 3 days\r\nmyhost >>> \r\n"
+
+	var out bytes.Buffer
+	opts := convertOptions{
+		prompt: regexp.MustCompile("^.*" + regexp.QuoteMeta(">>>")),
+		record: recordOptions{newline: pipeline.NewlineLF},
+	}
+	if err := convertTypescript(strings.NewReader(typescript), &out, opts); err != nil {
+		t.Fatalf("convertTypescript failed: %v", err)
+	}
+
+	var record pipeline.CommandRecord
+	if err := json.Unmarshal(bytes.TrimSpace(out.Bytes()), &record); err != nil {
+		t.Fatalf("Expected a single record, got %q: %v", out.String(), err)
+	}
+	if record.Command != "uptime" || record.Output != " up 3 days\n" {
+		t.Errorf("Record = (%q, %q), want (%q, %q)", record.Command, record.Output, "uptime", " up 3 days\n")
+	}
+	if !record.ReturnTimestamp.IsZero() {
+		t.Errorf("Timestamp = %v, want the zero time without a header", record.ReturnTimestamp)
+	}
+}
+
+// TestParseScriptHeader tests parsing of typescript header timestamps
+func TestParseScriptHeader(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		isHeader bool
+	}{
+		{line: "Script started on 2025-09-29 13:20:00-04:00 [TERM=\"xterm\"]\n", expected: "2025-09-29T13:20:00-04:00", isHeader: true},
+		{line: "Script started on Mon Sep 29 13:20:00 2025\n", expected: "2025-09-29T13:20:00Z", isHeader: true},
+		{line: "Script started on sometime\n", isHeader: true},
+		{line: "user@host:~$ ls\r\n"},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseScriptHeader([]byte(tt.line))
+		if ok != tt.isHeader {
+			t.Errorf("parseScriptHeader(%q) header = %v, want %v", tt.line, ok, tt.isHeader)
+		}
+		if tt.expected != "" && got.Format(time.RFC3339) != tt.expected {
+			t.Errorf("parseScriptHeader(%q) = %v, want %s", tt.line, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestName is the file that convert -dir writes next to its outputs.
+const manifestName = "manifest.json"
+
+// ConvertManifest describes the outputs of a convert -dir run.
+type ConvertManifest struct {
+	Source    string               `json:"source"`
+	Timestamp time.Time            `json:"timestamp"`
+	Files     []ConvertedFileEntry `json:"files"`
+}
+
+// ConvertedFileEntry is the manifest entry of one input file. Paths are relative to
+// the source and output directories; Output is empty if the conversion failed.
+type ConvertedFileEntry struct {
+	Input   string `json:"input"`
+	Timing  string `json:"timing,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Records int    `json:"records"`
+	Error   string `json:"error,omitempty"`
+}
+
+// findConvertInputs returns the typescripts and recordings under dir, relative to it
+// and in lexical order. Hidden files and directories, timing files, and anything
+// under skip (the output directory, if it is inside dir) are left out.
+func findConvertInputs(dir, skip string) ([]string, error) {
+	var inputs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if (path != dir && strings.HasPrefix(d.Name(), ".")) || path == skip {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(d.Name(), ".timing") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, rel)
+		return nil
+	})
+	return inputs, err
+}
+
+// convertDir converts every input under dir into a JSONL file of the same relative
+// path plus ".jsonl" under outDir, with jobs conversions running at once, and writes
+// a manifest of the results. A typescript's timing file is used if it sits next to
+// it as "<name>.timing". It fails if any input could not be converted, after
+// converting the rest.
+func convertDir(dir, outDir string, jobs int, opts convertOptions) error {
+	skip := ""
+	if abs, err := filepath.Abs(outDir); err == nil {
+		if absDir, err := filepath.Abs(dir); err == nil && strings.HasPrefix(abs, absDir+string(filepath.Separator)) {
+			skip = filepath.Join(dir, strings.TrimPrefix(abs, absDir+string(filepath.Separator)))
+		}
+	}
+	inputs, err := findConvertInputs(dir, skip)
+	if err != nil {
+		return fmt.Errorf("could not list %s: %w", dir, err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("could not create output directory: %w", err)
+	}
+
+	entries := make([]ConvertedFileEntry, len(inputs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				entries[i] = convertDirFile(dir, outDir, inputs[i], opts)
+				if entries[i].Error != "" {
+					slog.Warn("Could not convert file", "input", inputs[i], "error", entries[i].Error)
+				}
+			}
+		}()
+	}
+	for i := range inputs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	manifest := ConvertManifest{Source: dir, Timestamp: time.Now(), Files: entries}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, manifestName), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	failed := 0
+	for _, entry := range entries {
+		if entry.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be converted; see %s", failed, len(entries), filepath.Join(outDir, manifestName))
+	}
+	return nil
+}
+
+// convertDirFile converts the input at rel under dir and returns its manifest entry.
+func convertDirFile(dir, outDir, rel string, opts convertOptions) ConvertedFileEntry {
+	entry := ConvertedFileEntry{Input: rel}
+	fail := func(err error) ConvertedFileEntry {
+		entry.Output = ""
+		entry.Error = err.Error()
+		return entry
+	}
+
+	path := filepath.Join(dir, rel)
+	if f, err := os.Open(path + ".timing"); err == nil {
+		opts.timing, err = readTimingLog(f)
+		f.Close()
+		if err != nil {
+			return fail(fmt.Errorf("%s.timing: %w", rel, err))
+		}
+		entry.Timing = rel + ".timing"
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return fail(err)
+	}
+	defer in.Close()
+
+	entry.Output = rel + ".jsonl"
+	outPath := filepath.Join(outDir, entry.Output)
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return fail(err)
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return fail(err)
+	}
+	counter := &lineCounter{w: out}
+	w := bufio.NewWriter(counter)
+	err = convertInput(in, w, opts)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// A partial output would look like a complete one
+		os.Remove(outPath)
+		return fail(err)
+	}
+	entry.Records = counter.lines
+	return entry
+}
+
+// lineCounter counts the lines written through it, which are records in JSONL.
+type lineCounter struct {
+	w     io.Writer
+	lines int
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.lines += bytes.Count(p, []byte{'\n'})
+	return c.w.Write(p)
+}
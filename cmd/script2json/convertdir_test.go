@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestConvertDir tests converting a directory of typescripts and recordings into
+// per-file outputs and a manifest
+func TestConvertDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.log":            "user@host:~$ ls\r\na  b\r\nuser@host:~$ pwd\r\n/home/user\r\n",
+		"a.log.timing":     "0.5 17\n0.5 6\n0.5 18\n0.5 12\n",
+		"2024/b.cast":      testCast,
+		"2024/broken.cast": `{"version": 2}` + "\n[-1, \"o\", \"a\"]\n",
+		".hidden/c.log":    "user@host:~$ ls\r\n",
+		"out/old.log":      "user@host:~$ ls\r\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The output directory inside the source is not read back as input
+	outDir := filepath.Join(dir, "out")
+	opts := convertOptions{prompt: regexp.MustCompile(defaultPromptPattern)}
+	err := convertDir(dir, outDir, 2, opts)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 files") {
+		t.Errorf("convertDir error = %v, want 1 of 3 files failing", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, manifestName))
+	if err != nil {
+		t.Fatalf("Manifest not written: %v", err)
+	}
+	var manifest ConvertManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v", err)
+	}
+	expected := []ConvertedFileEntry{
+		{Input: "2024/b.cast", Output: "2024/b.cast.jsonl", Records: 2},
+		{Input: "2024/broken.cast"},
+		{Input: "a.log", Timing: "a.log.timing", Output: "a.log.jsonl", Records: 2},
+	}
+	if len(manifest.Files) != len(expected) {
+		t.Fatalf("Manifest files = %+v, want %+v", manifest.Files, expected)
+	}
+	for i, entry := range manifest.Files {
+		want := expected[i]
+		if entry.Input != want.Input || entry.Timing != want.Timing || entry.Output != want.Output || entry.Records != want.Records {
+			t.Errorf("Manifest entry %d = %+v, want %+v", i, entry, want)
+		}
+		if (entry.Error != "") != (want.Output == "") {
+			t.Errorf("Manifest entry %d error = %q", i, entry.Error)
+		}
+	}
+
+	// The timing file gives the typescript's records durations
+	records, err := os.ReadFile(filepath.Join(outDir, "a.log.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first pipeline.CommandRecord
+	if err := json.Unmarshal([]byte(strings.SplitN(string(records), "\n", 2)[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Command != "ls" || first.DurationMs != 1000 {
+		t.Errorf("First record = (%q, %d ms), want (ls, 1000 ms)", first.Command, first.DurationMs)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "2024/broken.cast.jsonl")); !os.IsNotExist(err) {
+		t.Error("Failed conversion left an output behind")
+	}
+}
+
+// TestFindConvertInputs tests which files are taken as inputs
+func TestFindConvertInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"x.log", "x.log.timing", ".y.log", "sub/z.cast"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inputs, err := findConvertInputs(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"sub/z.cast", "x.log"}; !slices.Equal(inputs, expected) {
+		t.Errorf("Inputs = %q, want %q", inputs, expected)
+	}
+}
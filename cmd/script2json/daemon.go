@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// daemonChildEnv is set in the environment of the process that --daemon starts to
+// run the capture. It is outside the S2J_ prefix, so that it doesn't set --daemon.
+const daemonChildEnv = "SCRIPT2JSON_DAEMON_CHILD"
+
+// daemonReadyFd is the descriptor of the pipe on which the daemon reports that it
+// has started, as the first of the child's ExtraFiles.
+const daemonReadyFd = 3
+
+// daemonStartTimeout is how long --daemon waits for the daemon to start.
+const daemonStartTimeout = 10 * time.Second
+
+// startDaemon starts script2json again with args in a session of its own, with
+// stdin from the null device, records to the current stdout, and logs to logFile,
+// or nowhere. It returns once the daemon has started, or with its failure.
+func startDaemon(args []string, pidFile, logFile string, logger *slog.Logger) error {
+	attr, err := daemonProcAttr()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+	if isTerminal(os.Stdout) {
+		return fmt.Errorf("%w: --daemon needs stdout redirected to where the records should go", errConfig)
+	}
+	if pidFile != "" {
+		if err := claimPidFile(pidFile, logger); err != nil {
+			return err
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the script2json executable: %w", err)
+	}
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer stdin.Close()
+	logPath := os.DevNull
+	if logFile != "" {
+		logPath = logFile
+	}
+	stderr, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("%w: could not open daemon log: %v", errConfig, err)
+	}
+	defer stderr.Close()
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), daemonChildEnv+"=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, os.Stdout, stderr
+	cmd.ExtraFiles = []*os.File{readyWriter}
+	cmd.SysProcAttr = attr
+	err = cmd.Start()
+	// Only the daemon may hold the pipe open, so that its exit ends the read below
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("could not start daemon: %w", err)
+	}
+
+	started := make(chan bool, 1)
+	go func() {
+		n, _ := ready.Read(make([]byte, 1))
+		started <- n == 1
+	}()
+	select {
+	case ok := <-started:
+		if !ok {
+			return daemonStartError(cmd.Wait())
+		}
+	case <-time.After(daemonStartTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("daemon did not start within %s; see --daemon-log", daemonStartTimeout)
+	}
+	logger.Info("Daemon started", "pid", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+// daemonStartError returns the error for a daemon that exited while starting with
+// err, in the class of its exit code, so that it is reported with the same code.
+func daemonStartError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		for _, class := range errorClasses {
+			if class.code == exitErr.ExitCode() {
+				return fmt.Errorf("%w: daemon exited while starting; see --daemon-log", class.err)
+			}
+		}
+	}
+	return fmt.Errorf("daemon exited while starting (%v); see --daemon-log", err)
+}
+
+// daemonChild is set in the process that --daemon started, by takeDaemonChildEnv.
+var daemonChild bool
+
+// takeDaemonChildEnv reports whether this process was started by --daemon, and
+// removes daemonChildEnv from the environment, so that the processes the daemon
+// starts (such as the shell of run or --transform-cmd) don't inherit it. A
+// script2json --daemon among them would otherwise take itself for the daemon.
+func takeDaemonChildEnv() bool {
+	if os.Getenv(daemonChildEnv) != "" {
+		daemonChild = true
+		os.Unsetenv(daemonChildEnv)
+	}
+	return daemonChild
+}
+
+// notifyDaemonReady tells the process that started this one with --daemon, if any,
+// that the capture is running.
+func notifyDaemonReady() {
+	if !daemonChild {
+		return
+	}
+	f := os.NewFile(daemonReadyFd, "daemon-ready")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+// claimPidFile fails if the PID file at path names a running process, and removes
+// it if that process is gone, so that a daemon that crashed doesn't block the next.
+func claimPidFile(path string, logger *slog.Logger) error {
+	pid, err := readPidFile(path)
+	if errors.Is(err, errNotRunning) {
+		return nil
+	}
+	if err != nil {
+		logger.Warn("Replacing unreadable PID file", "path", path, "error", err)
+		return os.Remove(path)
+	}
+	if processAlive(pid) {
+		return fmt.Errorf("script2json is already running as process %d, according to %s", pid, path)
+	}
+	logger.Warn("Removing stale PID file", "path", path, "pid", pid)
+	return os.Remove(path)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestClaimPidFile tests the stale PID file detection of --daemon
+func TestClaimPidFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  bool
+		removed  bool
+	}{
+		{"Missing", "", false, true},
+		{"Running", fmt.Sprintf("%d\n", os.Getpid()), true, false},
+		{"Stale", "999999999\n", false, true},
+		{"Invalid", "garbage\n", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "s2j.pid")
+			if tt.contents != "" {
+				if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+					t.Fatalf("Failed to write PID file: %v", err)
+				}
+			}
+			err := claimPidFile(path, logger)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("claimPidFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) != tt.removed {
+				t.Errorf("PID file removed = %v, want %v", !tt.removed, tt.removed)
+			}
+		})
+	}
+}
+
+// TestTakeDaemonChildEnv tests that the daemon removes the variable that marks it
+// from its environment, so that the processes it starts don't inherit it
+func TestTakeDaemonChildEnv(t *testing.T) {
+	defer func() { daemonChild = false }()
+	t.Setenv(daemonChildEnv, "1")
+	if !takeDaemonChildEnv() || !daemonChild {
+		t.Error("takeDaemonChildEnv() = false, want the daemon recognized")
+	}
+	if value, ok := os.LookupEnv(daemonChildEnv); ok {
+		t.Errorf("%s = %q after takeDaemonChildEnv, want it unset", daemonChildEnv, value)
+	}
+	if !takeDaemonChildEnv() {
+		t.Error("takeDaemonChildEnv() = false a second time, want the daemon still recognized")
+	}
+}
+
+// TestDaemonStartError tests that a daemon's exit status keeps its error class
+func TestDaemonStartError(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	// A test binary given a bad flag exits with status 2, the config class
+	cmd.Args = append(cmd.Args, "-no-such-flag")
+	cmd.Stderr = io.Discard
+	err := daemonStartError(cmd.Run())
+	if code, name := classifyError(err); code != exitConfig || name != "config" {
+		t.Errorf("classifyError() = (%d, %s), want (%d, config): %v", code, name, exitConfig, err)
+	}
+	if code, _ := classifyError(daemonStartError(errors.New("killed"))); code != exitRuntime {
+		t.Errorf("classifyError() = %d for a non-exit error, want %d", code, exitRuntime)
+	}
+}
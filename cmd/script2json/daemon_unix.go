@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// daemonProcAttr starts the daemon in a new session, which detaches it from the
+// controlling terminal, so that closing the terminal doesn't hang it up.
+func daemonProcAttr() (*syscall.SysProcAttr, error) {
+	return &syscall.SysProcAttr{Setsid: true}, nil
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// daemonProcAttr fails on Windows, where a child can't be handed the pipe that it
+// reports its start on.
+func daemonProcAttr() (*syscall.SysProcAttr, error) {
+	return nil, errors.New("--daemon is not supported on Windows; run script2json as a service instead")
+}
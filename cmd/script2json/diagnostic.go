@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DiagnosticRecord is a snapshot of lineEditor's reconstruction state, written on
+// request to investigate garbled output without attaching a debugger.
+type DiagnosticRecord struct {
+	Type            string    `json:"type"`
+	Timestamp       time.Time `json:"timestamp"`
+	Session         string    `json:"session,omitempty"`
+	Reading         bool      `json:"reading"`
+	State           string    `json:"state"`
+	TermEmulation   string    `json:"term_emulation"`
+	Buffer          string    `json:"buffer"`
+	CursorRow       int       `json:"cursor_row"`
+	CursorCol       int       `json:"cursor_col"`
+	Overwrite       bool      `json:"overwrite"`
+	ScrollRegion    []int     `json:"scroll_region,omitempty"`
+	AlternateScreen bool      `json:"alternate_screen"`
+	PendingCR       bool      `json:"pending_cr"`
+	ParserState     string    `json:"parser_state"`
+	PendingSequence string    `json:"pending_sequence,omitempty"`
+	ParseErrors     uint64    `json:"parse_errors"`
+}
+
+// writeDiagnosticRecord writes record to w as a single JSON line.
+func writeDiagnosticRecord(w io.Writer, record DiagnosticRecord) error {
+	record.Type = "diagnostic"
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// WarningRecord reports a problem that script2json recovered from on its own, such
+// as a FIFO that was deleted while it was running. It is written to stderr, next to
+// the logs, so the record stream on stdout only carries records of commands.
+type WarningRecord struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Session   string    `json:"session,omitempty"`
+	// Warning is the kind of problem, such as "fifo_deleted" or "fifo_replaced"
+	Warning string `json:"warning"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeWarningRecord writes record to w as a single JSON line.
+func writeWarningRecord(w io.Writer, record WarningRecord) error {
+	record.Type = "warning"
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log/slog"
+
+	"script2json/pkg/pipeline"
+)
+
+// events are the lifecycle hooks of the command's sessions, the same pipeline.Hooks
+// that embedders of the library register on. startSession, serveInputSocket and
+// the single-session mode fire session starts and resetSession resets, and
+// recordCreator fires records and drops through recordOptions.hooks, which main
+// points here.
+var events pipeline.Hooks
+
+// logEvents registers the hooks that log the events not logged where they happen:
+// resets, which the signals, sockets and APIs all request, and the records that a
+// processor drops.
+func logEvents(hooks *pipeline.Hooks, logger *slog.Logger) {
+	hooks.OnReset(func(session string) {
+		logger.Debug("Session reset", "session", session)
+	})
+	hooks.OnDrop(func(record pipeline.CommandRecord, reason string) {
+		logger.Debug("Record dropped", "session", record.Session, "command", record.Command, "reason", reason)
+	})
+}
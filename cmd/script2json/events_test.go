@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestRecordCreatorHooks tests that recordCreator fires its hooks with the records
+// it writes and those a processor drops
+func TestRecordCreatorHooks(t *testing.T) {
+	commandOutputChan := make(chan commandOutput, 1)
+	commandChan := make(chan commandInfo, 1)
+
+	var recorded, dropped []string
+	hooks := &pipeline.Hooks{}
+	hooks.OnRecord(func(record pipeline.CommandRecord) { recorded = append(recorded, record.Command) })
+	hooks.OnDrop(func(record pipeline.CommandRecord, reason string) {
+		dropped = append(dropped, record.Command+" "+reason)
+	})
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		recordCreator(commandOutputChan, commandChan, recordOptions{
+			processors: pipeline.Chain{pipeline.ExcludeCommands(regexp.MustCompile(`^pwd$`))},
+			hooks:      hooks,
+			stdout:     &buf,
+		})
+		close(done)
+	}()
+	for _, command := range []string{"ls", "pwd"} {
+		commandChan <- commandInfo{command: command}
+		commandOutputChan <- commandOutput{Output: pipeline.Output{Text: "out"}}
+	}
+	close(commandOutputChan)
+	<-done
+
+	if !slices.Equal(recorded, []string{"ls"}) || !slices.Equal(dropped, []string{"pwd filtered"}) {
+		t.Errorf("Recorded %q and dropped %q, want ls and pwd", recorded, dropped)
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("Output = %q, want one record", buf.String())
+	}
+}
+
+// TestResetSessionEvent tests that resetSession fires the reset hooks
+func TestResetSessionEvent(t *testing.T) {
+	var resets int
+	events.OnReset(func(session string) {
+		if session == "events-test" {
+			resets++
+		}
+	})
+	resetSession(newSession("events-test", "", ""))
+	if resets != 1 {
+		t.Errorf("Reset hooks ran %d times, want 1", resets)
+	}
+}
+
+// TestLogEvents tests that the logging hooks log resets and drops
+func TestLogEvents(t *testing.T) {
+	var buf bytes.Buffer
+	hooks := &pipeline.Hooks{}
+	logEvents(hooks, slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	hooks.FireReset("web")
+	hooks.FireDrop(pipeline.CommandRecord{Session: "web", Command: "pwd"}, pipeline.DropFiltered)
+
+	logged := buf.String()
+	for _, want := range []string{`msg="Session reset" session=web`, `msg="Record dropped" session=web command=pwd reason=filtered`} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("Log %q doesn't contain %q", logged, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Process exit codes. Supervisors and scripts can use these to tell a
+// misconfiguration apart from an environment or downstream failure.
+const (
+	exitOK            = 0
+	exitRuntime       = 1 // Unclassified runtime failure
+	exitConfig        = 2 // Invalid flags or configuration (also used by flag parsing)
+	exitFIFOSetup     = 3 // A FIFO could not be created or opened
+	exitSink          = 4 // Records could not be delivered to stdout or the fallback file
+	exitProtocol      = 5 // Protocol violation in strict mode
+	exitCommandFailed = 6 // The wrapped command failed
+)
+
+// Error classes, wrapped with %w by the code that detects them so that fatal can
+// pick the matching exit code. errOutputFailed (output.go) is the sink class.
+var (
+	errConfig        = errors.New("invalid configuration")
+	errFIFOSetup     = errors.New("FIFO setup failed")
+	errProtocol      = errors.New("protocol violation")
+	errCommandFailed = errors.New("wrapped command failed")
+)
+
+// errorClasses maps each error class to its exit code and the name reported in
+// the final error line.
+var errorClasses = []struct {
+	err  error
+	code int
+	name string
+}{
+	{errConfig, exitConfig, "config"},
+	{errFIFOSetup, exitFIFOSetup, "fifo_setup"},
+	{errOutputFailed, exitSink, "sink"},
+	{errProtocol, exitProtocol, "protocol"},
+	{errCommandFailed, exitCommandFailed, "command_failed"},
+}
+
+// ErrorRecord is the machine-readable line written to stderr before exiting on a fatal error.
+type ErrorRecord struct {
+	Type     string `json:"type"`
+	Error    string `json:"error"`
+	ExitCode int    `json:"exit_code"`
+	Message  string `json:"message"`
+}
+
+// classifyError returns the exit code and class name for err.
+// Errors that don't wrap a known class are runtime errors.
+func classifyError(err error) (int, string) {
+	for _, class := range errorClasses {
+		if errors.Is(err, class.err) {
+			return class.code, class.name
+		}
+	}
+	return exitRuntime, "runtime"
+}
+
+// writeErrorRecord writes the final error line for err to w and returns the exit code to use.
+func writeErrorRecord(w io.Writer, err error) int {
+	code, name := classifyError(err)
+	data, _ := json.Marshal(ErrorRecord{
+		Type:     "error",
+		Error:    name,
+		ExitCode: code,
+		Message:  err.Error(),
+	})
+	fmt.Fprintf(w, "%s\n", data)
+	return code
+}
+
+// fatal reports err as a final error line on stderr and exits with its class's exit code.
+func fatal(err error) {
+	os.Exit(writeErrorRecord(os.Stderr, err))
+}
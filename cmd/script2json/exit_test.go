@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestClassifyError tests mapping of wrapped error classes to exit codes
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedCode int
+		expectedName string
+	}{
+		{name: "Config", err: fmt.Errorf("%w: invalid log level", errConfig), expectedCode: exitConfig, expectedName: "config"},
+		{name: "FIFO setup", err: fmt.Errorf("%w: permission denied", errFIFOSetup), expectedCode: exitFIFOSetup, expectedName: "fifo_setup"},
+		{name: "Sink", err: fmt.Errorf("%w: broken pipe", errOutputFailed), expectedCode: exitSink, expectedName: "sink"},
+		{name: "Protocol", err: errProtocol, expectedCode: exitProtocol, expectedName: "protocol"},
+		{name: "Command failed", err: errCommandFailed, expectedCode: exitCommandFailed, expectedName: "command_failed"},
+		{name: "Doubly wrapped", err: fmt.Errorf("error exporting history: %w", fmt.Errorf("%w: bad format", errConfig)), expectedCode: exitConfig, expectedName: "config"},
+		{name: "Unclassified", err: errors.New("something broke"), expectedCode: exitRuntime, expectedName: "runtime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, name := classifyError(tt.err)
+			if code != tt.expectedCode || name != tt.expectedName {
+				t.Errorf("classifyError(%v) = (%d, %q), want (%d, %q)", tt.err, code, name, tt.expectedCode, tt.expectedName)
+			}
+		})
+	}
+}
+
+// TestWriteErrorRecord tests the final machine-readable error line
+func TestWriteErrorRecord(t *testing.T) {
+	var buf bytes.Buffer
+	err := fmt.Errorf("%w: could not open /tmp/script.fifo", errFIFOSetup)
+
+	code := writeErrorRecord(&buf, err)
+	if code != exitFIFOSetup {
+		t.Errorf("Exit code = %d, want %d", code, exitFIFOSetup)
+	}
+
+	line := buf.Bytes()
+	if !bytes.HasSuffix(line, []byte("\n")) || bytes.Count(line, []byte("\n")) != 1 {
+		t.Errorf("Error record is not a single line: %q", line)
+	}
+
+	var record ErrorRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		t.Fatalf("Failed to unmarshal error record: %v", err)
+	}
+	expected := ErrorRecord{
+		Type:     "error",
+		Error:    "fifo_setup",
+		ExitCode: exitFIFOSetup,
+		Message:  "FIFO setup failed: could not open /tmp/script.fifo",
+	}
+	if record != expected {
+		t.Errorf("Error record = %+v, want %+v", record, expected)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"script2json/pkg/records"
+)
+
+// runExport implements the export subcommand, which converts captured JSONL records
+// into shell history entries that history search tools can import.
+// Records are read from the files named in args, or from stdin if none are given.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "zsh", "History format (zsh, bash)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export [-format zsh|bash] [records.jsonl ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *format != "zsh" && *format != "bash" {
+		return fmt.Errorf("%w: invalid history format: %s. Must be zsh or bash", errConfig, *format)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if fs.NArg() == 0 {
+		return exportHistory(os.Stdin, out, *format)
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open records file: %w", err)
+		}
+		err = exportHistory(f, out, *format)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// exportHistory reads JSONL CommandRecords from r and writes one history entry per
+// record to w. Records without a command are skipped.
+//   - zsh: extended history format (": <epoch>:0;<command>"), which Atuin imports
+//     with `atuin import zsh`
+//   - bash: timestamped history ("#<epoch>" followed by the command), as written by
+//     bash when HISTTIMEFORMAT is set
+func exportHistory(r io.Reader, w io.Writer, format string) error {
+	for record, err := range records.NewReader(r).All() {
+		if err != nil {
+			return err
+		}
+		if record.Command == "" {
+			continue
+		}
+
+		// Records without a timestamp are exported as undated entries
+		var epoch int64
+		if !record.ReturnTimestamp.IsZero() {
+			epoch = record.ReturnTimestamp.Unix()
+		}
+
+		var err error
+		switch format {
+		case "zsh":
+			// zsh escapes embedded newlines with a trailing backslash
+			command := strings.ReplaceAll(record.Command, "\n", "\\\n")
+			_, err = fmt.Fprintf(w, ": %d:0;%s\n", epoch, command)
+		case "bash":
+			if epoch != 0 {
+				_, err = fmt.Fprintf(w, "#%d\n", epoch)
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(w, "%s\n", record.Command)
+			}
+		default:
+			return fmt.Errorf("invalid history format: %s", format)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write history entry: %w", err)
+		}
+	}
+	return nil
+}
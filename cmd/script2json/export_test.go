@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestExportHistory tests conversion of JSONL records into shell history entries
+func TestExportHistory(t *testing.T) {
+	input := `{"id":"1","command":"echo hello","output":"hello\r\n","return_timestamp":"2025-09-29T13:24:41.027649619-04:00"}
+
+{"id":"2","command":"","output":"orphan output\r\n","return_timestamp":"2025-09-29T13:24:42-04:00"}
+{"id":"3","command":"ls -la","output":"","return_timestamp":"2025-09-29T13:24:45-04:00"}
+`
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   "zsh",
+			expected: ": 1759166681:0;echo hello\n: 1759166685:0;ls -la\n",
+		},
+		{
+			format:   "bash",
+			expected: "#1759166681\necho hello\n#1759166685\nls -la\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := exportHistory(strings.NewReader(input), &out, tt.format); err != nil {
+				t.Fatalf("exportHistory failed: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Output = %q, want %q", out.String(), tt.expected)
+			}
+		})
+	}
+
+	// Malformed records should be reported with their line number
+	var out bytes.Buffer
+	err := exportHistory(strings.NewReader("{\"id\":\"1\"}\nnot json\n"), &out, "zsh")
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected line 2 parse error, got %v", err)
+	}
+}
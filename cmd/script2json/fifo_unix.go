@@ -0,0 +1,33 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Default paths of the script and command FIFOs.
+const (
+	defaultScriptFifoPath  = "/tmp/script.fifo"
+	defaultCommandFifoPath = "/tmp/command.fifo"
+)
+
+// checkFifoPath checks that path is a FIFO, or that one can be created there.
+func checkFifoPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if err := checkWritableDir(filepath.Dir(path)); err != nil {
+			return "", err
+		}
+		return path + " will be created", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Type() != os.ModeNamedPipe {
+		return "", fmt.Errorf("%s exists and is not a FIFO", path)
+	}
+	return path + " is a FIFO", nil
+}
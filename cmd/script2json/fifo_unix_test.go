@@ -0,0 +1,108 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestCreateScriptFifo tests FIFO creation
+func TestCreateScriptFifo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Create temp directory
+	tmpDir, err := os.MkdirTemp("", "script2json-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fifoPath := fmt.Sprintf("%s/test.fifo", tmpDir)
+
+	// Create FIFO
+	first := newFifoTransport(fifoPath)
+	err = first.Create(logger)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Verify it exists and is a FIFO
+	info, err := os.Stat(fifoPath)
+	if err != nil {
+		t.Fatalf("FIFO stat failed: %v", err)
+	}
+
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		t.Error("Created file is not a FIFO")
+	}
+
+	// Call again once the first reader is done - should not error (already exists)
+	first.Close()
+	err = newFifoTransport(fifoPath).Create(logger)
+	if err != nil {
+		t.Errorf("Create should not error on existing FIFO: %v", err)
+	}
+}
+
+// TestCreateCommandFifo tests command FIFO creation
+func TestCreateCommandFifo(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Create temp directory
+	tmpDir, err := os.MkdirTemp("", "script2json-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fifoPath := fmt.Sprintf("%s/command.fifo", tmpDir)
+
+	// Create FIFO
+	err = newFifoTransport(fifoPath).Create(logger)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Verify it exists and is a FIFO
+	info, err := os.Stat(fifoPath)
+	if err != nil {
+		t.Fatalf("FIFO stat failed: %v", err)
+	}
+
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		t.Error("Created file is not a FIFO")
+	}
+}
+
+// TestFifoTransportClose tests that closing the transport wakes an Open waiting for a writer
+func TestFifoTransportClose(t *testing.T) {
+	transport := newFifoTransport(fmt.Sprintf("%s/command.fifo", t.TempDir()))
+	if err := transport.Create(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	opened := make(chan error)
+	go func() {
+		_, err := transport.Open()
+		opened <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	transport.Close()
+
+	select {
+	case err := <-opened:
+		if err != errTransportClosed {
+			t.Errorf("Open = %v, want errTransportClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Open did not return after Close")
+	}
+}
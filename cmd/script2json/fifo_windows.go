@@ -0,0 +1,23 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default paths of the script and command pipes. Windows has no FIFOs in the file
+// system, so named pipes take their place.
+const (
+	defaultScriptFifoPath  = `\\.\pipe\script2json`
+	defaultCommandFifoPath = `\\.\pipe\script2json-command`
+)
+
+// checkFifoPath only checks that path names a pipe, as pipeline.OpenFifo creates it.
+func checkFifoPath(path string) (string, error) {
+	if !strings.HasPrefix(path, `\\.\pipe\`) {
+		return "", fmt.Errorf("%s is not a named pipe path, such as %s", path, defaultScriptFifoPath)
+	}
+	return path + " will be created", nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// errFifoLocked is returned when another instance of script2json holds the lock of
+// a FIFO. Two readers of one FIFO each get part of its bytes, which garbles both
+// of their records without any error.
+var errFifoLocked = errors.New("FIFO is in use")
+
+// forceFifoLocks makes script2json read FIFOs whose lock another instance holds
+// (--force).
+var forceFifoLocks bool
+
+// fifoLocks are the FIFO locks that this process holds, by FIFO path, with the
+// functions that release them.
+var fifoLocks = struct {
+	mu   sync.Mutex
+	held map[string]func()
+}{held: map[string]func(){}}
+
+// acquireFifoLock takes the lock of the FIFO at path, failing with errFifoLocked
+// if another process holds it, unless forceFifoLocks is set.
+func acquireFifoLock(path string, logger *slog.Logger) error {
+	release, err := lockFifo(path)
+	if errors.Is(err, errFifoLocked) && forceFifoLocks {
+		logger.Warn("Reading a FIFO that another instance reads, as --force is set", "path", path, "error", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fifoLocks.mu.Lock()
+	fifoLocks.held[path] = release
+	fifoLocks.mu.Unlock()
+	return nil
+}
+
+// releaseFifoLock releases the lock of the FIFO at path, if this process holds it.
+func releaseFifoLock(path string) {
+	fifoLocks.mu.Lock()
+	release := fifoLocks.held[path]
+	delete(fifoLocks.held, path)
+	fifoLocks.mu.Unlock()
+	if release != nil {
+		release()
+	}
+}
+
+// releaseFifoLocks releases every FIFO lock that this process holds, before it exits.
+func releaseFifoLocks() {
+	fifoLocks.mu.Lock()
+	held := fifoLocks.held
+	fifoLocks.held = map[string]func(){}
+	fifoLocks.mu.Unlock()
+	for _, release := range held {
+		release()
+	}
+}
+
+// fifoLockedError describes the instance that holds the lock file at lockPath of
+// the FIFO at path.
+func fifoLockedError(path, lockPath string) error {
+	holder := "another instance of script2json"
+	if pid, err := readPidFile(lockPath); err == nil {
+		holder = fmt.Sprintf("process %d", pid)
+	}
+	return fmt.Errorf("%w: %s is being read by %s, according to %s; use --force to read it anyway", errFifoLocked, path, holder, lockPath)
+}
+
+// writeLockPid records the process ID in the lock file f, for fifoLockedError.
+func writeLockPid(f *os.File) {
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+}
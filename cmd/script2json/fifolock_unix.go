@@ -0,0 +1,56 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fifoLockPath returns the path of the lock file of the FIFO at path, beside it.
+func fifoLockPath(path string) string {
+	return path + ".lock"
+}
+
+// lockFifo takes an flock on the lock file of the FIFO at path, and returns the
+// function that releases it and removes the lock file. The kernel releases the
+// lock if the process dies, so a lock file left behind doesn't block the next
+// instance.
+func lockFifo(path string) (func(), error) {
+	lockPath := fifoLockPath(path)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open lock file: %w", err)
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, fifoLockedError(path, lockPath)
+			}
+			return nil, fmt.Errorf("could not lock %s: %w", lockPath, err)
+		}
+		// The instance that held the lock may have removed the file meanwhile, in
+		// which case the lock is on a file that the next instance won't see
+		opened, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s: %w", lockPath, err)
+		}
+		current, err := os.Stat(lockPath)
+		if err == nil && os.SameFile(opened, current) {
+			writeLockPid(f)
+			return func() {
+				os.Remove(lockPath)
+				f.Close()
+			}, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s: %w", lockPath, err)
+		}
+		f.Close()
+	}
+}
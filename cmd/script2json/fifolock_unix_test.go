@@ -0,0 +1,57 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestFifoLock tests that a FIFO can only be read by one instance at a time,
+// unless --force is set
+func TestFifoLock(t *testing.T) {
+	defer func() { forceFifoLocks = false }()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "script.fifo")
+
+	first := newFifoTransport(path)
+	if err := first.Create(logger); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	err := newFifoTransport(path).Create(logger)
+	if !errors.Is(err, errFifoLocked) || !strings.Contains(err.Error(), "process "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("Expected the FIFO to be locked by this process, got %v", err)
+	}
+
+	forceFifoLocks = true
+	if err := newFifoTransport(path).Create(logger); err != nil {
+		t.Errorf("Create with --force failed: %v", err)
+	}
+	forceFifoLocks = false
+
+	// Closing the first reader releases the lock and removes its file
+	first.Close()
+	if _, err := os.Stat(fifoLockPath(path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("The lock file was not removed: %v", err)
+	}
+	second := newFifoTransport(path)
+	if err := second.Create(logger); err != nil {
+		t.Fatalf("Create after the lock was released failed: %v", err)
+	}
+	second.Close()
+
+	// A lock file left behind by a process that died doesn't block
+	if err := os.WriteFile(fifoLockPath(path), []byte("999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := acquireFifoLock(path, logger); err != nil {
+		t.Errorf("A stale lock file blocked the lock: %v", err)
+	}
+	releaseFifoLocks()
+}
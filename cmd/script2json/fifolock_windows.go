@@ -0,0 +1,55 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32       = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx = kernel32.NewProc("LockFileEx")
+)
+
+// Flags and errors of LockFileEx.
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// fifoLockPath returns the path of the lock file of the named pipe at path. A
+// pipe is not in the file system, so its lock file is in the temporary directory.
+func fifoLockPath(path string) string {
+	name := strings.NewReplacer(`\`, "_", "/", "_", ":", "_").Replace(strings.TrimPrefix(path, `\\.\pipe\`))
+	return filepath.Join(os.TempDir(), "script2json-"+name+".lock")
+}
+
+// lockFifo locks the lock file of the named pipe at path with LockFileEx, and
+// returns the function that releases it. The lock file stays, since Windows
+// doesn't remove a file that another process has open.
+func lockFifo(path string) (func(), error) {
+	lockPath := fifoLockPath(path)
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file: %w", err)
+	}
+	// The locked byte is far past the PID, which other instances read for their error
+	overlapped := syscall.Overlapped{OffsetHigh: 1}
+	r, _, callErr := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		f.Close()
+		if errors.Is(callErr, errorLockViolation) {
+			return nil, fifoLockedError(path, lockPath)
+		}
+		return nil, fmt.Errorf("could not lock %s: %w", lockPath, callErr)
+	}
+	writeLockPid(f)
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// oPath is Linux's O_PATH, which the syscall package does not define. A file opened
+// with it refers to the inode without opening it, so opening a FIFO this way
+// neither blocks nor counts as a reader or writer.
+const oPath = 0x200000
+
+// watchFifo watches the FIFO at path with inotify, and recreates it if it is deleted
+// or replaced while script2json is running, writing a WarningRecord to stderr. A
+// reader that is waiting for a writer on the old FIFO is woken up, so it opens the
+// new one instead (see pipeline.OpenFifo); otherwise writers would open a FIFO that
+// nobody reads, or create a regular file in its place. It returns a function that
+// stops watching.
+func watchFifo(path, sessionName string, logger *slog.Logger) (func(), error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("could not start inotify: %w", err)
+	}
+	// The directory is watched rather than the FIFO, which may not exist
+	mask := uint32(syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO)
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("could not watch %s: %w", filepath.Dir(path), err)
+	}
+	anchor, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	// A non-blocking descriptor goes through the runtime poller, so Close ends Read
+	events := os.NewFile(uintptr(fd), "inotify")
+
+	go func() {
+		defer func() { syscall.Close(anchor) }()
+		name := filepath.Base(path)
+		buf := make([]byte, 4096)
+		for {
+			n, err := events.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + syscall.SizeofInotifyEvent
+				offset = start + int(event.Len)
+				if string(bytes.TrimRight(buf[start:offset], "\x00")) == name {
+					anchor = checkFifo(path, sessionName, anchor, logger)
+				}
+			}
+		}
+	}()
+
+	return func() { events.Close() }, nil
+}
+
+// checkFifo makes sure that the FIFO at path is still the one that anchor refers
+// to, and recreates it if not. It returns the anchor of the FIFO now at path.
+func checkFifo(path, sessionName string, anchor int, logger *slog.Logger) int {
+	var want syscall.Stat_t
+	if err := syscall.Fstat(anchor, &want); err != nil {
+		return anchor
+	}
+	var got syscall.Stat_t
+	err := syscall.Stat(path, &got)
+	if err == nil && got.Dev == want.Dev && got.Ino == want.Ino {
+		return anchor
+	}
+
+	warning := WarningRecord{
+		Timestamp: time.Now(),
+		Session:   sessionName,
+		Warning:   "fifo_deleted",
+		Path:      path,
+		Message:   "FIFO was deleted; recreated it",
+	}
+	switch {
+	case err == nil && got.Mode&syscall.S_IFMT == syscall.S_IFIFO:
+		// Someone made a new FIFO, which is just as good
+		warning.Warning, warning.Message = "fifo_replaced", "FIFO was replaced by another FIFO; reading that one instead"
+	case err == nil:
+		warning.Warning, warning.Message = "fifo_replaced", "FIFO was replaced by a file that is not a FIFO; recreated it"
+		if err := os.Remove(path); err != nil {
+			logger.Error("Could not remove the file that replaced a FIFO", "path", path, "error", err)
+			return anchor
+		}
+		fallthrough
+	default:
+		if err := syscall.Mkfifo(path, 0666); err != nil && err != syscall.EEXIST {
+			logger.Error("Could not recreate FIFO", "path", path, "error", err)
+			return anchor
+		}
+	}
+	logger.Warn(warning.Message, "path", path)
+	writeWarningRecord(os.Stderr, warning)
+
+	next, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		logger.Error("Could not open recreated FIFO", "path", path, "error", err)
+		return anchor
+	}
+	// Opening the old FIFO for writing wakes a reader waiting on it; this fails with
+	// ENXIO if nobody is waiting, which is fine
+	if w, err := syscall.Open(fmt.Sprintf("/proc/self/fd/%d", anchor), syscall.O_WRONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0); err == nil {
+		syscall.Close(w)
+	}
+	syscall.Close(anchor)
+	return next
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWatchFifoRecreates tests that a deleted or replaced command FIFO is recreated
+// and that the reader waiting on the old one moves to the new one
+func TestWatchFifoRecreates(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace func(path string) error
+		warning string
+	}{
+		{"deleted", os.Remove, "fifo_deleted"},
+		{"replaced by a file", func(path string) error {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte("stray\n"), 0644)
+		}, "fifo_replaced"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, _ := os.Pipe()
+			oldStderr := os.Stderr
+			os.Stderr = w
+			defer func() { os.Stderr = oldStderr }()
+
+			path := filepath.Join(t.TempDir(), "command.fifo")
+			transport := newFifoTransport(path)
+			if err := transport.Create(slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			defer transport.Close()
+
+			commandChan := make(chan commandInfo, 1)
+			go commandFifoReader(transport, commandChan, commandReaderOptions{framing: commandFramingNewline}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			time.Sleep(50 * time.Millisecond)
+
+			if err := tt.replace(path); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			info, err := os.Stat(path)
+			if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+				t.Fatalf("FIFO was not recreated: %v", err)
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write([]byte("ls\n"))
+			f.Close()
+
+			select {
+			case command := <-commandChan:
+				if command.command != "ls" {
+					t.Errorf("Command = %q, want %q", command.command, "ls")
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Reader did not read from the recreated FIFO")
+			}
+
+			w.Close()
+			var stderr bytes.Buffer
+			io.Copy(&stderr, r)
+			var warning WarningRecord
+			if err := json.Unmarshal(bytes.TrimSpace(stderr.Bytes()), &warning); err != nil {
+				t.Fatalf("Expected a warning record on stderr, got %q: %v", stderr.String(), err)
+			}
+			if warning.Type != "warning" || warning.Warning != tt.warning || warning.Path != path {
+				t.Errorf("Warning = %+v, want a %s warning for %s", warning, tt.warning, path)
+			}
+		})
+	}
+}
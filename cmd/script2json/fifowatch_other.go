@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "log/slog"
+
+// watchFifo does nothing on platforms without inotify.
+func watchFifo(path, sessionName string, logger *slog.Logger) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Framings of the commands written to the command FIFO, for --command-framing
+const (
+	// commandFramingNewline ends each command with a newline
+	commandFramingNewline = "newline"
+	// commandFramingNUL ends each command with a NUL byte, so commands can span lines
+	commandFramingNUL = "nul"
+	// commandFramingLen prefixes each command with its length in bytes and a colon
+	// ("<length>:<command>"), so commands can contain any byte
+	commandFramingLen = "len"
+)
+
+// maxFramedCommandLength bounds the length that a length-prefixed command may claim,
+// so that a garbled prefix can't make the decoder buffer without end.
+const maxFramedCommandLength = 1 << 20
+
+// validateCommandFraming checks a --command-framing value.
+func validateCommandFraming(framing string) error {
+	switch framing {
+	case commandFramingNewline, commandFramingNUL, commandFramingLen:
+		return nil
+	}
+	return fmt.Errorf("invalid command framing: %s. Must be newline, nul, or len", framing)
+}
+
+// commandDecoder splits the bytes read from the command FIFO into commands. A
+// command that is only partly written when its writer closes the FIFO is completed
+// by the next writer.
+type commandDecoder struct {
+	framing string
+	buf     []byte
+}
+
+// newCommandDecoder returns a decoder for the given framing.
+func newCommandDecoder(framing string) *commandDecoder {
+	return &commandDecoder{framing: framing}
+}
+
+// decode adds p to the buffered bytes and returns the commands that are complete.
+// Newline and NUL framed commands are trimmed of surrounding white space, and empty
+// commands are dropped. If a length prefix is malformed, the commands decoded
+// before it are returned along with an error, and the buffered bytes are discarded.
+func (d *commandDecoder) decode(p []byte) ([]string, error) {
+	d.buf = append(d.buf, p...)
+	if d.framing == commandFramingLen {
+		return d.decodeLen()
+	}
+
+	delim := byte('\n')
+	if d.framing == commandFramingNUL {
+		delim = 0
+	}
+	var commands []string
+	for {
+		i := bytes.IndexByte(d.buf, delim)
+		if i < 0 {
+			break
+		}
+		// Shells differ in the spacing around the command: bash's history keeps its
+		// own, and zsh's preexec passes the line as typed
+		if command := bytes.TrimSpace(d.buf[:i]); len(command) > 0 {
+			commands = append(commands, string(command))
+		}
+		d.buf = d.buf[i+1:]
+	}
+	return commands, nil
+}
+
+// decodeLen returns the complete length-prefixed commands in the buffer. Newlines
+// between commands are ignored, so writers may end each one with a newline.
+func (d *commandDecoder) decodeLen() ([]string, error) {
+	var commands []string
+	for {
+		d.buf = bytes.TrimLeft(d.buf, "\r\n")
+		colon := bytes.IndexByte(d.buf, ':')
+		if colon < 0 {
+			// The prefix is incomplete, unless it is already too long to be one
+			if len(d.buf) > len(strconv.Itoa(maxFramedCommandLength)) {
+				return commands, d.discard("missing length prefix")
+			}
+			return commands, nil
+		}
+		n, err := strconv.Atoi(string(d.buf[:colon]))
+		if err != nil || n < 0 || n > maxFramedCommandLength {
+			return commands, d.discard(fmt.Sprintf("invalid length prefix %q", d.buf[:colon]))
+		}
+		if len(d.buf) < colon+1+n {
+			return commands, nil
+		}
+		if n > 0 {
+			commands = append(commands, string(d.buf[colon+1:colon+1+n]))
+		}
+		d.buf = d.buf[colon+1+n:]
+	}
+}
+
+// discard drops the buffered bytes, which can't be framed, and returns an error
+// describing why.
+func (d *commandDecoder) discard(reason string) error {
+	n := len(d.buf)
+	d.buf = nil
+	return fmt.Errorf("%s, discarded %d bytes", reason, n)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestCommandDecoder tests splitting command FIFO data into commands, including
+// commands split across reads
+func TestCommandDecoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		framing  string
+		reads    []string
+		expected []string
+	}{
+		{"newline", commandFramingNewline, []string{"ls\n\npw", "d\ncat <<EOF\n"}, []string{"ls", "pwd", "cat <<EOF"}},
+		{"newline unterminated", commandFramingNewline, []string{"ls\necho"}, []string{"ls"}},
+		{"newline spacing", commandFramingNewline, []string{"  ls -l \r\n \t\n"}, []string{"ls -l"}},
+		{"nul", commandFramingNUL, []string{"cat <<EOF\nhi\nEOF\x00", "\x00ls\x00"}, []string{"cat <<EOF\nhi\nEOF", "ls"}},
+		{"nul spacing", commandFramingNUL, []string{"for f in *; do\n  echo $f\ndone\n\x00"}, []string{"for f in *; do\n  echo $f\ndone"}},
+		{"len", commandFramingLen, []string{"16:cat <<EOF\nhi\nEOF2:", "ls\n0:5:a\x00b:c"}, []string{"cat <<EOF\nhi\nEOF", "ls", "a\x00b:c"}},
+		{"len split prefix", commandFramingLen, []string{"1", "0:echo", " hello"}, []string{"echo hello"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newCommandDecoder(tt.framing)
+			var got []string
+			for _, read := range tt.reads {
+				commands, err := d.decode([]byte(read))
+				if err != nil {
+					t.Fatalf("decode(%q) failed: %v", read, err)
+				}
+				got = append(got, commands...)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("Commands = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestCommandDecoderMalformed tests that bad length prefixes are discarded without
+// losing the commands before them or stopping the decoder
+func TestCommandDecoderMalformed(t *testing.T) {
+	for _, data := range []string{"2:lsx:pwd", "2:ls-1:pwd", "2:ls99999999:", "2:ls" + strings.Repeat("1", 20)} {
+		d := newCommandDecoder(commandFramingLen)
+		commands, err := d.decode([]byte(data))
+		if err == nil {
+			t.Errorf("decode(%q) succeeded, want error", data)
+		}
+		if !slices.Equal(commands, []string{"ls"}) {
+			t.Errorf("decode(%q) = %q, want [ls]", data, commands)
+		}
+		if commands, err := d.decode([]byte("3:pwd")); err != nil || !slices.Equal(commands, []string{"pwd"}) {
+			t.Errorf("decode after %q = %q, %v, want [pwd]", data, commands, err)
+		}
+	}
+}
+
+// TestValidateCommandFraming tests checking --command-framing values
+func TestValidateCommandFraming(t *testing.T) {
+	for _, framing := range []string{commandFramingNewline, commandFramingNUL, commandFramingLen} {
+		if err := validateCommandFraming(framing); err != nil {
+			t.Errorf("validateCommandFraming(%q) failed: %v", framing, err)
+		}
+	}
+	if err := validateCommandFraming("netstring"); err == nil {
+		t.Error("validateCommandFraming(\"netstring\") succeeded, want error")
+	}
+}
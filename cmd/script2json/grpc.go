@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"script2json/controlpb"
+	"script2json/pkg/pipeline"
+)
+
+// feedBufferSize is the number of records a StreamRecords subscriber can fall
+// behind by before records are dropped for it.
+const feedBufferSize = 256
+
+// feedRecord is a record as published to subscribers of the recordFeed.
+type feedRecord struct {
+	session string
+	json    []byte
+}
+
+// feedFilter selects the records a subscriber receives: those of the session
+// called session, or of all sessions if it is nil, that are visible in scope.
+type feedFilter struct {
+	session *string
+	scope   *int
+}
+
+// recordFeed fans out the records that recordCreator writes to StreamRecords
+// subscribers. A subscriber that falls behind misses records rather than holding
+// up the pipeline. It is safe for concurrent use.
+type recordFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan feedRecord]feedFilter
+	// count is the number of subscribers, so publishers can skip marshaling without one
+	count   atomic.Int64
+	dropped atomic.Uint64
+}
+
+// liveRecords is the feed of all sessions' records.
+var liveRecords recordFeed
+
+// subscribe returns a channel of the records that filter selects.
+func (f *recordFeed) subscribe(filter feedFilter) chan feedRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subscribers == nil {
+		f.subscribers = map[chan feedRecord]feedFilter{}
+	}
+	ch := make(chan feedRecord, feedBufferSize)
+	f.subscribers[ch] = filter
+	f.count.Add(1)
+	return ch
+}
+
+// unsubscribe stops sending records to ch.
+func (f *recordFeed) unsubscribe(ch chan feedRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subscribers[ch]; ok {
+		delete(f.subscribers, ch)
+		f.count.Add(-1)
+	}
+}
+
+// active reports whether anyone is subscribed.
+func (f *recordFeed) active() bool {
+	return f.count.Load() > 0
+}
+
+// publish sends a record of the session called session, which belongs to owner,
+// as JSON, to its subscribers.
+func (f *recordFeed) publish(session string, owner *int, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch, filter := range f.subscribers {
+		if filter.session != nil && *filter.session != session {
+			continue
+		}
+		if filter.scope != nil && (owner == nil || *owner != *filter.scope) {
+			continue
+		}
+		select {
+		case ch <- feedRecord{session: session, json: data}:
+		default:
+			f.dropped.Add(1)
+		}
+	}
+}
+
+// controlServer implements the gRPC ControlService on the sessions in registry.
+type controlServer struct {
+	controlpb.UnimplementedControlServiceServer
+	registry *sessionRegistry
+	logger   *slog.Logger
+}
+
+// errOtherUser is returned to users other than root and the user running
+// script2json for the calls that affect every session.
+var errOtherUser = status.Error(codes.PermissionDenied, "only the user running script2json may change the output")
+
+// scope returns the owner whose sessions the caller of ctx may see and control, as
+// scopeFor does for the uid that peerCheckListener found, or nil for every
+// session.
+func scope(ctx context.Context) *int {
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, ok := p.Addr.(peerAddr); ok {
+			return scopeFor(addr.peer.UID)
+		}
+	}
+	return nil
+}
+
+// control applies action to the sessions that req selects, as the HTTP API does,
+// and returns their status.
+func (s *controlServer) control(ctx context.Context, name string, req *controlpb.ControlRequest, signalOnly bool, action func(*session)) (*controlpb.StatusResponse, error) {
+	sessions, err := selectSessions(s.registry, req.Session, scope(ctx))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if action != nil {
+		s.logger.Debug("gRPC control request", "action", name, "session", req.GetSession())
+		controlSessions(sessions, req.Session != nil, signalOnly, action)
+	}
+	return statusProto(statusOf(sessions)), nil
+}
+
+func (s *controlServer) Start(ctx context.Context, req *controlpb.ControlRequest) (*controlpb.StatusResponse, error) {
+	return s.control(ctx, "start", req, true, startReading)
+}
+
+func (s *controlServer) Stop(ctx context.Context, req *controlpb.ControlRequest) (*controlpb.StatusResponse, error) {
+	return s.control(ctx, "stop", req, true, stopReading)
+}
+
+func (s *controlServer) Reset(ctx context.Context, req *controlpb.ControlRequest) (*controlpb.StatusResponse, error) {
+	return s.control(ctx, "reset", req, false, resetSession)
+}
+
+func (s *controlServer) Status(ctx context.Context, req *controlpb.ControlRequest) (*controlpb.StatusResponse, error) {
+	return s.control(ctx, "status", req, false, nil)
+}
+
+// Annotate writes an annotation record for the session that req selects, which
+// may be left out if only one runs.
+func (s *controlServer) Annotate(ctx context.Context, req *controlpb.AnnotateRequest) (*controlpb.StatusResponse, error) {
+	sessions, err := selectSessions(s.registry, req.Session, scope(ctx))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if len(req.Text) > maxAnnotationBytes {
+		return nil, status.Errorf(codes.InvalidArgument, "annotation is longer than %d bytes", maxAnnotationBytes)
+	}
+	s.logger.Debug("gRPC control request", "action", "annotate", "session", req.GetSession())
+	if err := annotateSessions(sessions, req.Text); err != nil {
+		if errors.Is(err, errAnnotationQueueFull) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return statusProto(statusOf(sessions)), nil
+}
+
+// SwitchSink switches the output of all sessions to the file at req.Path, or to
+// stdout if it is empty.
+func (s *controlServer) SwitchSink(ctx context.Context, req *controlpb.SwitchSinkRequest) (*controlpb.StatusResponse, error) {
+	if scope(ctx) != nil {
+		return nil, errOtherUser
+	}
+	s.logger.Debug("gRPC control request", "action", "sink", "path", req.Path)
+	if err := switchSink(req.Path); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	s.logger.Info("Switched output", "sink", sinkName())
+	return statusProto(statusOf(s.registry.list())), nil
+}
+
+// ReopenSink reopens the output file under its path.
+func (s *controlServer) ReopenSink(ctx context.Context, req *controlpb.ReopenSinkRequest) (*controlpb.StatusResponse, error) {
+	if scope(ctx) != nil {
+		return nil, errOtherUser
+	}
+	s.logger.Debug("gRPC control request", "action", "reopen")
+	if err := reopenSink(); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	s.logger.Info("Reopened output", "sink", sinkName())
+	return statusProto(statusOf(s.registry.list())), nil
+}
+
+// StreamRecords sends the records written from now on until the client goes away.
+// Unlike the other calls, it accepts the name of a session that hasn't started yet.
+func (s *controlServer) StreamRecords(req *controlpb.StreamRecordsRequest, stream grpc.ServerStreamingServer[controlpb.Record]) error {
+	records := liveRecords.subscribe(feedFilter{session: req.Session, scope: scope(stream.Context())})
+	defer liveRecords.unsubscribe(records)
+	for {
+		select {
+		case record := <-records:
+			if err := stream.Send(&controlpb.Record{Session: record.session, Json: record.json}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// statusProto converts a StatusResponse into its protobuf message.
+func statusProto(response StatusResponse) *controlpb.StatusResponse {
+	msg := &controlpb.StatusResponse{
+		Output: &controlpb.OutputStatus{
+			Sink:           response.Output.Sink,
+			WriteErrors:    response.Output.WriteErrors,
+			DroppedRecords: response.Output.DroppedRecords,
+			SpooledRecords: response.Output.SpooledRecords,
+			UsingFallback:  response.Output.UsingFallback,
+		},
+		ParseErrors: response.ParseErrors,
+		Errors:      response.Errors,
+		Pid:         int64(response.PID),
+		StartedAt:   timestamppb.New(response.StartedAt),
+	}
+	for _, sess := range response.Sessions {
+		status := &controlpb.SessionStatus{
+			Name:            sess.Name,
+			Reading:         sess.Reading,
+			State:           sess.State,
+			Markers:         sess.Markers,
+			Records:         sess.Records,
+			BufferBytes:     sess.BufferBytes,
+			BytesProcessed:  sess.BytesProcessed,
+			DroppedOutputs:  sess.DroppedOutputs,
+			DroppedCommands: sess.DroppedCommands,
+		}
+		if sess.OwnerUID != nil {
+			status.OwnerUid = proto.Int64(int64(*sess.OwnerUID))
+		}
+		if sess.ReadingSince != nil {
+			status.ReadingSince = timestamppb.New(*sess.ReadingSince)
+		}
+		if sess.LastRecord != nil {
+			status.LastRecord = timestamppb.New(*sess.LastRecord)
+		}
+		msg.Sessions = append(msg.Sessions, status)
+	}
+	return msg
+}
+
+// peerAddr is the address of a connection accepted by peerCheckListener, along
+// with the credentials of the process at its other end, so the calls on it can be
+// scoped to its user's sessions.
+type peerAddr struct {
+	net.Addr
+	peer *pipeline.PeerIdentity
+}
+
+// peerConn is a connection whose RemoteAddr is a peerAddr.
+type peerConn struct {
+	net.Conn
+	addr peerAddr
+}
+
+func (c peerConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// peerCheckListener tags connections with the peer's credentials, where the kernel
+// reports them, so that users other than root and the user running script2json
+// only see and control their own sessions. Without credentials, a connection is
+// only accepted if the socket is private to that user.
+type peerCheckListener struct {
+	net.Listener
+	private bool
+	logger  *slog.Logger
+}
+
+func (l peerCheckListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		unixConn, ok := conn.(*net.UnixConn)
+		if !ok {
+			return conn, nil
+		}
+		peer, err := peerIdentity(unixConn)
+		if err == nil {
+			return peerConn{Conn: conn, addr: peerAddr{Addr: conn.RemoteAddr(), peer: peer}}, nil
+		}
+		if l.private {
+			// The socket's permissions are the only check
+			return conn, nil
+		}
+		l.logger.Warn("Rejected gRPC connection without peer credentials", "error", err)
+		conn.Close()
+	}
+}
+
+// serveGRPC serves the ControlService on the Unix socket listener l until it is
+// closed. Unless private is set, other users can connect, and only see and control
+// the sessions they own.
+func serveGRPC(l net.Listener, registry *sessionRegistry, private bool, logger *slog.Logger) {
+	server := grpc.NewServer()
+	controlpb.RegisterControlServiceServer(server, &controlServer{registry: registry, logger: logger})
+	if err := server.Serve(peerCheckListener{Listener: l, private: private, logger: logger}); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		logger.Error("Error serving gRPC API", "error", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"script2json/controlpb"
+	"script2json/pkg/pipeline"
+)
+
+// TestControlService tests controlling sessions and streaming records over gRPC
+func TestControlService(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "grpc.sock")
+	l, err := listenUnixSocket(socket, 0600)
+	if err != nil {
+		t.Fatalf("listenUnixSocket failed: %v", err)
+	}
+	defer l.Close()
+	signalled := newSession("signalled", "", "")
+	signalled.markers = false
+	marked := newSession("marked", "", "")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	go serveGRPC(l, newSessionRegistry(signalled, marked), true, logger)
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := controlpb.NewControlServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Like SIGUSR1, Start leaves marker-controlled sessions alone unless named
+	resp, err := client.Start(ctx, &controlpb.ControlRequest{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if len(resp.Sessions) != 2 || !resp.Sessions[0].Reading || resp.Sessions[0].ReadingSince == nil || resp.Sessions[1].Reading {
+		t.Errorf("Start = %v, want only signalled reading", resp.Sessions)
+	}
+	if resp.Sessions[0].State != "recording" || resp.Sessions[1].State != "idle" {
+		t.Errorf("States = %q, %q, want recording, idle", resp.Sessions[0].State, resp.Sessions[1].State)
+	}
+	reportedErrors.Add(1)
+	defer reportedErrors.Add(^uint64(0))
+	if resp, err = client.Status(ctx, &controlpb.ControlRequest{}); err != nil || resp.Errors != reportedErrors.Load() || resp.Errors == 0 {
+		t.Errorf("Status = %v, %v, want the reported errors", resp, err)
+	}
+	if resp, err = client.Reset(ctx, &controlpb.ControlRequest{Session: proto.String("signalled")}); err != nil || len(resp.Sessions) != 1 {
+		t.Fatalf("Reset = %v, %v", resp, err)
+	}
+	if signalled.recording() {
+		t.Error("Reset should stop reading")
+	}
+	if _, err := client.Status(ctx, &controlpb.ControlRequest{Session: proto.String("db")}); status.Code(err) != codes.NotFound {
+		t.Errorf("Status of an unknown session = %v, want NotFound", err)
+	}
+
+	if _, err := client.Annotate(ctx, &controlpb.AnnotateRequest{Text: "deploying v2"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Annotate without a session = %v, want InvalidArgument", err)
+	}
+	if resp, err = client.Annotate(ctx, &controlpb.AnnotateRequest{Session: proto.String("marked"), Text: "deploying v2"}); err != nil || len(resp.Sessions) != 1 {
+		t.Fatalf("Annotate = %v, %v", resp, err)
+	}
+	if text := <-marked.annotations; text != "deploying v2" {
+		t.Errorf("Annotation = %q, want %q", text, "deploying v2")
+	}
+
+	stream, err := client.StreamRecords(ctx, &controlpb.StreamRecordsRequest{Session: proto.String("marked")})
+	if err != nil {
+		t.Fatalf("StreamRecords failed: %v", err)
+	}
+	// The subscription is made once the call reaches the server
+	for deadline := time.Now().Add(time.Second); !liveRecords.active(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the subscription")
+		}
+	}
+	liveRecords.publish("signalled", signalled.owner, []byte(`{"id":"1"}`))
+	liveRecords.publish("marked", marked.owner, []byte(`{"id":"2"}`))
+	record, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if record.Session != "marked" || string(record.Json) != `{"id":"2"}` {
+		t.Errorf("Record = %v, want marked's record 2", record)
+	}
+}
+
+// TestControlServiceOwnerScope tests that a user other than the one running
+// script2json only sees and controls the sessions they own
+func TestControlServiceOwnerScope(t *testing.T) {
+	other := processUID + 1000
+	web := newSession("web", "", "")
+	web.owner = &other
+	db := newSession("db", "", "")
+	server := &controlServer{registry: newSessionRegistry(web, db), logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: peerAddr{peer: &pipeline.PeerIdentity{UID: other}}})
+
+	resp, err := server.Status(ctx, &controlpb.ControlRequest{})
+	if err != nil || len(resp.Sessions) != 1 || resp.Sessions[0].Name != "web" || resp.Sessions[0].OwnerUid == nil || *resp.Sessions[0].OwnerUid != int64(other) {
+		t.Errorf("Status as the owner of web = %v, %v, want only web, owned by %d", resp, err, other)
+	}
+	if _, err := server.Reset(ctx, &controlpb.ControlRequest{Session: proto.String("db")}); status.Code(err) != codes.NotFound {
+		t.Errorf("Reset of another user's session = %v, want NotFound", err)
+	}
+	if _, err := server.ReopenSink(ctx, &controlpb.ReopenSinkRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("ReopenSink by another user = %v, want PermissionDenied", err)
+	}
+	if resp, err := server.Status(context.Background(), &controlpb.ControlRequest{}); err != nil || len(resp.Sessions) != 2 {
+		t.Errorf("Status without peer credentials = %v, %v, want every session", resp, err)
+	}
+
+	records := liveRecords.subscribe(feedFilter{scope: scopeFor(other)})
+	defer liveRecords.unsubscribe(records)
+	liveRecords.publish("db", db.owner, []byte(`{"id":"1"}`))
+	liveRecords.publish("web", web.owner, []byte(`{"id":"2"}`))
+	if record := <-records; record.session != "web" {
+		t.Errorf("Record = %s of %s, want only web's", record.json, record.session)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The lines around the hooks that install-hooks writes into a shell rc file, by
+// which they are found again to be replaced.
+const (
+	hooksBegin = "# >>> script2json hooks >>>"
+	hooksEnd   = "# <<< script2json hooks <<<"
+)
+
+// hooksEnv is the environment variable that turns the installed hooks on, so that
+// only the shells that are being recorded write to the command FIFO, which would
+// block without a reader.
+const hooksEnv = "SCRIPT2JSON_HOOKS"
+
+// hookOptions says how the generated hooks reach script2json.
+type hookOptions struct {
+	commandFifo string
+	// framing is the --command-framing that commands are written in
+	framing string
+	// protocol is the --command-protocol: with json, the hooks write control
+	// messages, which also start and end each command and carry its exit status,
+	// working directory and EUID, in place of signals or markers
+	protocol string
+	// markers writes integration markers to the terminal instead of signalling
+	markers bool
+	// pidFile names the process to signal; without it, every script2json is
+	pidFile string
+	// signalSocket takes the place of signals if set
+	signalSocket string
+}
+
+// hookCalls returns the shell commands that start and stop reading. With the JSON
+// protocol, the start is a message on the command FIFO and the stop is part of the
+// end message that commandSend writes.
+func hookCalls(opts hookOptions) (start, stop string) {
+	switch {
+	case opts.protocol == commandProtocolJSON:
+		fifo := shellQuote(opts.commandFifo)
+		return `local msg='{"event":"start"}'; [[ -p ` + fifo + ` ]] && ` + commandWrite(opts.framing, "msg", fifo), ""
+	case opts.markers:
+		return `printf '\033]6973;start\007'`, `printf '\033]6973;end\007'`
+	case opts.signalSocket != "":
+		ctl := "script2json ctl -socket " + shellQuote(opts.signalSocket)
+		return ctl + " start >/dev/null 2>&1", ctl + " stop >/dev/null 2>&1"
+	case opts.pidFile != "":
+		pid := `"$(< ` + shellQuote(opts.pidFile) + `)"`
+		return "kill -USR1 " + pid + " 2>/dev/null", "kill -USR2 " + pid + " 2>/dev/null"
+	}
+	return "pkill -USR1 -x script2json", "pkill -USR2 -x script2json"
+}
+
+// commandWrite returns the shell command that writes the command in variable to
+// the command FIFO in framing. Lengths are counted in bytes, in the C locale.
+func commandWrite(framing, variable, fifo string) string {
+	switch framing {
+	case commandFramingNUL:
+		return `printf '%s\0' "$` + variable + `" > ` + fifo
+	case commandFramingLen:
+		return `{ local LC_ALL=C; printf '%d:%s' "${#` + variable + `}" "$` + variable + `"; } > ` + fifo
+	}
+	return `printf '%s\n' "$` + variable + `" > ` + fifo
+}
+
+// jsonQuoteFunc is the shell function, for bash and zsh alike, that the JSON hooks
+// quote strings with: it sets REPLY to its argument as a JSON string. Control
+// characters that JSON has no short escape for are dropped.
+const jsonQuoteFunc = `  __script2json_json() {
+    local s=$1
+    s=${s//\\/\\\\}
+    s=${s//\"/\\\"}
+    s=${s//$'\n'/\\n}
+    s=${s//$'\r'/\\r}
+    s=${s//$'\t'/\\t}
+    REPLY="\"${s//[[:cntrl:]]/}\""
+  }
+`
+
+// commandSend returns the lines of the precmd hook, indented for it, that write
+// the command in variable to the command FIFO and stop reading. With the JSON
+// protocol, they write an end message with the exit status in statusVariable, the
+// working directory and the EUID instead.
+func commandSend(opts hookOptions, variable, statusVariable string) string {
+	fifo := shellQuote(opts.commandFifo)
+	if opts.protocol != commandProtocolJSON {
+		_, stop := hookCalls(opts)
+		return `[[ -p ` + fifo + ` ]] && ` + commandWrite(opts.framing, variable, fifo) + `
+      ` + stop
+	}
+	return `local msg REPLY
+      __script2json_json "$` + variable + `"
+      msg="{\"event\":\"end\",\"command\":$REPLY,\"exit_code\":$` + statusVariable + `"
+      __script2json_json "$PWD"
+      msg+=",\"cwd\":$REPLY,\"euid\":$EUID}"
+      [[ -p ` + fifo + ` ]] && ` + commandWrite(opts.framing, "msg", fifo)
+}
+
+// jsonFuncs returns the helper functions that the hooks for opts need.
+func jsonFuncs(opts hookOptions) string {
+	if opts.protocol != commandProtocolJSON {
+		return ""
+	}
+	return jsonQuoteFunc
+}
+
+// bashHooks returns the bash hooks for opts. A DEBUG trap starts reading before
+// the first command of each command line runs, and PROMPT_COMMAND writes the
+// command from the history to the command FIFO and then stops reading once it
+// returns. The prompt guard keeps the trap from firing for PROMPT_COMMAND itself,
+// as in bashIntegration, and holds the command's exit status, which setting it
+// would otherwise overwrite.
+func bashHooks(opts hookOptions) string {
+	start, _ := hookCalls(opts)
+	return hooksBegin + `
+if [[ -n $` + hooksEnv + ` ]]; then
+` + jsonFuncs(opts) + `  __script2json_in_prompt=1
+  __script2json_preexec() {
+    [[ -n $__script2json_in_prompt || -n $__script2json_running || -n $COMP_LINE ]] && return
+    [[ $BASH_COMMAND == '__script2json_in_prompt=$?' ]] && return
+    __script2json_running=1
+    ` + start + `
+  }
+  __script2json_precmd() {
+    local status=$__script2json_in_prompt
+    if [[ -n $__script2json_running ]]; then
+      local cmd
+      cmd=$(HISTTIMEFORMAT= builtin history 1 | sed '1s/^ *[0-9]*[* ] *//')
+      ` + commandSend(opts, "cmd", "status") + `
+    fi
+    __script2json_running=
+    return $status
+  }
+  trap '__script2json_preexec' DEBUG
+  PROMPT_COMMAND="__script2json_in_prompt=\$?; __script2json_precmd${PROMPT_COMMAND:+; $PROMPT_COMMAND}; __script2json_in_prompt="
+fi
+` + hooksEnd + "\n"
+}
+
+// zshHooks returns the zsh hooks for opts. The preexec hook starts reading and
+// keeps the command line, which zsh passes after history expansion, so it isn't
+// read back from the history, whose listing escapes newlines. The precmd hook
+// writes it to the command FIFO and stops reading. Both are added with
+// add-zsh-hook, next to any hooks of the user's.
+func zshHooks(opts hookOptions) string {
+	start, _ := hookCalls(opts)
+	return hooksBegin + `
+if [[ -n $` + hooksEnv + ` ]]; then
+  autoload -Uz add-zsh-hook
+` + jsonFuncs(opts) + `  __script2json_preexec() {
+    # $1 is empty when the history is off; $3 is the full text being run
+    __script2json_cmd=${1:-$3}
+    __script2json_running=1
+    ` + start + `
+  }
+  __script2json_precmd() {
+    local ret=$?
+    if [[ -n $__script2json_running ]]; then
+      ` + commandSend(opts, "__script2json_cmd", "ret") + `
+    fi
+    __script2json_running=
+    return $ret
+  }
+  add-zsh-hook preexec __script2json_preexec
+  add-zsh-hook precmd __script2json_precmd
+fi
+` + hooksEnd + "\n"
+}
+
+// hookShells maps each supported shell to its hook generator and rc file, relative
+// to the home directory.
+var hookShells = map[string]struct {
+	hooks func(hookOptions) string
+	rc    string
+}{
+	"bash": {bashHooks, ".bashrc"},
+	"zsh":  {zshHooks, ".zshrc"},
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// installRCBlock writes block into the rc file at path, in place of the hooks
+// installed before if there are any, or appended otherwise.
+func installRCBlock(path, block string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if rest, found := cutRCBlock(data); found {
+		data = rest
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if len(data) > 0 {
+		data = append(data, '\n')
+	}
+	data = append(data, block...)
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// cutRCBlock returns data without the installed hooks and the blank line before
+// them, and whether there were any.
+func cutRCBlock(data []byte) ([]byte, bool) {
+	begin := bytes.Index(data, []byte(hooksBegin))
+	if begin < 0 {
+		return data, false
+	}
+	end := bytes.Index(data[begin:], []byte(hooksEnd))
+	if end < 0 {
+		return data, false
+	}
+	end += begin + len(hooksEnd)
+	if end < len(data) && data[end] == '\n' {
+		end++
+	}
+	head := bytes.TrimSuffix(data[:begin], []byte("\n"))
+	return append(head[:len(head):len(head)], data[end:]...), true
+}
+
+// runInstallHooks implements the install-hooks subcommand, which prints the shell
+// hooks that start and stop reading and write each command to the command FIFO,
+// or installs them into the shell's rc file.
+func runInstallHooks(args []string) error {
+	fs := flag.NewFlagSet("install-hooks", flag.ExitOnError)
+	commandFifo := fs.String("command-fifo", defaultCommandFifoPath, "Path of the command FIFO that the hooks write commands to")
+	commandFraming := fs.String("command-framing", commandFramingNewline, "How the hooks delimit commands, matching script2json --command-framing (newline, nul, len)")
+	commandProtocol := fs.String("command-protocol", commandProtocolText, "What the hooks write, matching script2json --command-protocol: commands as text, or json control messages that also start and end them and carry the exit status, working directory and EUID")
+	markers := fs.Bool("markers", false, "Write integration markers to the terminal instead of signalling, for script2json --markers")
+	pidFile := fs.String("pid-file", "", "Signal the script2json in this PID file instead of every script2json")
+	signalSocket := fs.String("signal-socket", "", "Start and stop reading through this signal socket instead of signals")
+	install := fs.Bool("install", false, "Install the hooks into the shell's rc file instead of printing them")
+	rcFile := fs.String("rc", "", "The rc file to install into (default: the shell's rc file in the home directory)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s install-hooks [-command-fifo path] [-command-framing framing] [-command-protocol json | -markers | -pid-file path | -signal-socket path] [-install [-rc path]] bash|zsh\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("%w: install-hooks requires a shell", errConfig)
+	}
+	shell, ok := hookShells[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("%w: unsupported shell: %s. Must be bash or zsh", errConfig, fs.Arg(0))
+	}
+	if err := validateCommandFraming(*commandFraming); err != nil {
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+	if err := validateCommandProtocol(*commandProtocol); err != nil {
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+	if *markers && (*pidFile != "" || *signalSocket != "") || *pidFile != "" && *signalSocket != "" {
+		return fmt.Errorf("%w: -markers, -pid-file and -signal-socket cannot be combined", errConfig)
+	}
+	if *commandProtocol == commandProtocolJSON && (*markers || *pidFile != "" || *signalSocket != "") {
+		return fmt.Errorf("%w: -command-protocol json starts and ends commands itself, without -markers, -pid-file or -signal-socket", errConfig)
+	}
+	if *rcFile != "" && !*install {
+		return fmt.Errorf("%w: -rc requires -install", errConfig)
+	}
+	block := shell.hooks(hookOptions{
+		commandFifo:  *commandFifo,
+		framing:      *commandFraming,
+		protocol:     *commandProtocol,
+		markers:      *markers,
+		pidFile:      *pidFile,
+		signalSocket: *signalSocket,
+	})
+	if !*install {
+		fmt.Print(block)
+		return nil
+	}
+
+	path := *rcFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, shell.rc)
+	}
+	if err := installRCBlock(path, block); err != nil {
+		return fmt.Errorf("could not install hooks: %w", err)
+	}
+	fmt.Printf("Installed hooks into %s; they are active in shells started with %s=1\n", path, hooksEnv)
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBashHooks tests the generated bash hooks for each way of reaching script2json
+func TestBashHooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     hookOptions
+		expected []string
+	}{
+		{"Markers", hookOptions{commandFifo: "/tmp/command.fifo", markers: true},
+			[]string{`printf '\033]6973;start\007'`, `> '/tmp/command.fifo'`}},
+		{"PID file", hookOptions{commandFifo: "/tmp/command.fifo", pidFile: "/tmp/it's.pid"},
+			[]string{`kill -USR1 "$(< '/tmp/it'\''s.pid')"`, `kill -USR2`}},
+		{"Signal socket", hookOptions{commandFifo: "/tmp/command.fifo", signalSocket: "/tmp/s2j.sock"},
+			[]string{`script2json ctl -socket '/tmp/s2j.sock' start`, `script2json ctl -socket '/tmp/s2j.sock' stop`}},
+		{"Every process", hookOptions{commandFifo: "/tmp/command.fifo"},
+			[]string{"pkill -USR1 -x script2json", "pkill -USR2 -x script2json"}},
+		{"NUL framing", hookOptions{commandFifo: "/tmp/command.fifo", framing: commandFramingNUL},
+			[]string{`printf '%s\0' "$cmd" > '/tmp/command.fifo'`}},
+		{"Length framing", hookOptions{commandFifo: "/tmp/command.fifo", framing: commandFramingLen},
+			[]string{`local LC_ALL=C; printf '%d:%s' "${#cmd}" "$cmd"`}},
+		{"JSON protocol", hookOptions{commandFifo: "/tmp/command.fifo", protocol: commandProtocolJSON},
+			[]string{`local msg='{"event":"start"}'`, `__script2json_json "$cmd"`, `\"exit_code\":$status`, `\"euid\":$EUID}`, `printf '%s\n' "$msg" > '/tmp/command.fifo'`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hooks := bashHooks(tt.opts)
+			if !strings.HasPrefix(hooks, hooksBegin+"\n") || !strings.HasSuffix(hooks, hooksEnd+"\n") {
+				t.Errorf("Hooks are not enclosed in the begin and end lines:\n%s", hooks)
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(hooks, want) {
+					t.Errorf("Hooks lack %q:\n%s", want, hooks)
+				}
+			}
+			if bash, err := exec.LookPath("bash"); err == nil {
+				cmd := exec.Command(bash, "-n")
+				cmd.Stdin = strings.NewReader(hooks)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Errorf("bash -n failed: %v\n%s", err, out)
+				}
+			}
+		})
+	}
+}
+
+// TestZshHooks tests the generated zsh hooks
+func TestZshHooks(t *testing.T) {
+	hooks := zshHooks(hookOptions{commandFifo: "/tmp/command.fifo", framing: commandFramingNUL, markers: true})
+	for _, want := range []string{
+		"add-zsh-hook preexec __script2json_preexec",
+		"add-zsh-hook precmd __script2json_precmd",
+		"__script2json_cmd=${1:-$3}",
+		`printf '%s\0' "$__script2json_cmd" > '/tmp/command.fifo'`,
+		`printf '\033]6973;start\007'`,
+	} {
+		if !strings.Contains(hooks, want) {
+			t.Errorf("Hooks lack %q:\n%s", want, hooks)
+		}
+	}
+	if zsh, err := exec.LookPath("zsh"); err == nil {
+		cmd := exec.Command(zsh, "-n")
+		cmd.Stdin = strings.NewReader(hooks)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("zsh -n failed: %v\n%s", err, out)
+		}
+	}
+
+	// zsh keeps the exit status in ret, since status is read-only there
+	hooks = zshHooks(hookOptions{commandFifo: "/tmp/command.fifo", protocol: commandProtocolJSON})
+	for _, want := range []string{`__script2json_json "$__script2json_cmd"`, `\"exit_code\":$ret`, `\"euid\":$EUID}`} {
+		if !strings.Contains(hooks, want) {
+			t.Errorf("JSON hooks lack %q:\n%s", want, hooks)
+		}
+	}
+}
+
+// TestHookJSONQuote tests that the hooks' JSON quoting makes control messages that
+// parse back to the command, whatever characters it has
+func TestHookJSONQuote(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+	for _, command := range []string{
+		"ls",
+		`echo "it's" \"quoted\" \\n`,
+		"cat <<EOF\n\tindented\r\nEOF",
+		"printf '\x1b[31m'\x1b \u00e9",
+	} {
+		script := jsonQuoteFunc + `__script2json_json "$1"; printf '{"event":"end","command":%s,"euid":0}' "$REPLY"`
+		out, err := exec.Command(bash, "-c", script, "bash", command).Output()
+		if err != nil {
+			t.Fatalf("bash failed: %v", err)
+		}
+		msg, err := parseControlMessage(string(out))
+		if err != nil {
+			t.Errorf("Message %s for %q: %v", out, command, err)
+			continue
+		}
+		if want := strings.ReplaceAll(command, "\x1b", ""); msg.Command != want || msg.EUID == nil || *msg.EUID != 0 {
+			t.Errorf("Message %s = %+v, want command %q with EUID 0", out, msg, want)
+		}
+	}
+}
+
+// TestInstallRCBlock tests installing the hooks into an rc file, and replacing them
+func TestInstallRCBlock(t *testing.T) {
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read rc file: %v", err)
+		}
+		return string(data)
+	}
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	if err := os.WriteFile(path, []byte("alias ll='ls -l'"), 0600); err != nil {
+		t.Fatalf("Failed to write rc file: %v", err)
+	}
+	block := hooksBegin + "\nold\n" + hooksEnd + "\n"
+	if err := installRCBlock(path, block); err != nil {
+		t.Fatalf("installRCBlock failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(read(path)+"export EDITOR=vi\n"), 0600); err != nil {
+		t.Fatalf("Failed to write rc file: %v", err)
+	}
+	if err := installRCBlock(path, hooksBegin+"\nnew\n"+hooksEnd+"\n"); err != nil {
+		t.Fatalf("installRCBlock failed: %v", err)
+	}
+
+	expected := "alias ll='ls -l'\nexport EDITOR=vi\n\n" + hooksBegin + "\nnew\n" + hooksEnd + "\n"
+	if got := read(path); got != expected {
+		t.Errorf("rc file = %q, want %q", got, expected)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("rc file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// A missing rc file is created
+	missing := filepath.Join(t.TempDir(), ".bashrc")
+	if err := installRCBlock(missing, block); err != nil {
+		t.Fatalf("installRCBlock failed: %v", err)
+	}
+	if got := read(missing); got != block {
+		t.Errorf("rc file = %q, want %q", got, block)
+	}
+}
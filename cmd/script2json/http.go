@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// SessionStatus is the state of one session in a StatusResponse.
+type SessionStatus struct {
+	Name string `json:"name,omitempty"`
+	// OwnerUID is the uid of the user the session belongs to
+	OwnerUID *int `json:"owner_uid,omitempty"`
+	Reading  bool `json:"reading"`
+	// State is the session's state: idle, recording or flushing
+	State string `json:"state"`
+	// ReadingSince is when the current command started being read
+	ReadingSince *time.Time `json:"reading_since,omitempty"`
+	// Markers is set for sessions that integration markers start and stop
+	Markers bool   `json:"markers"`
+	Records uint64 `json:"records"`
+	// LastRecord is when the session's last record was written
+	LastRecord *time.Time `json:"last_record,omitempty"`
+	// BufferBytes is how much of the current command's output has been received
+	BufferBytes int64 `json:"buffer_bytes"`
+	// BytesProcessed is how many bytes of the terminal stream have been processed
+	BytesProcessed uint64 `json:"bytes_processed"`
+	// DroppedOutputs and DroppedCommands are what the overflow policy dropped
+	DroppedOutputs  uint64 `json:"dropped_outputs"`
+	DroppedCommands uint64 `json:"dropped_commands"`
+}
+
+// OutputStatus reports the output failures counted in outputStats, and the sink.
+type OutputStatus struct {
+	// Sink is "stdout" or the path of the output file
+	Sink           string `json:"sink,omitempty"`
+	WriteErrors    uint64 `json:"write_errors"`
+	DroppedRecords uint64 `json:"dropped_records"`
+	SpooledRecords int64  `json:"spooled_records"`
+	UsingFallback  bool   `json:"using_fallback"`
+}
+
+// StatusResponse is the body of every HTTP API response, and the source of the
+// gRPC API's and the status subcommand's.
+type StatusResponse struct {
+	Sessions    []SessionStatus `json:"sessions"`
+	Output      OutputStatus    `json:"output"`
+	ParseErrors uint64          `json:"parse_errors"`
+	Errors      uint64          `json:"errors"`
+	PID         int             `json:"pid"`
+	StartedAt   time.Time       `json:"started_at"`
+}
+
+// sessionStatus returns the current state of sess.
+func sessionStatus(sess *session) SessionStatus {
+	status := SessionStatus{
+		Name:            sess.name,
+		OwnerUID:        sess.owner,
+		Reading:         sess.recording(),
+		State:           sess.state.State().String(),
+		Markers:         sess.markers,
+		Records:         sess.stats.records.Load(),
+		BufferBytes:     sess.stats.bufferBytes.Load(),
+		BytesProcessed:  sess.stats.bytesProcessed.Load(),
+		DroppedOutputs:  sess.stats.droppedOutputs.Load(),
+		DroppedCommands: sess.stats.droppedCommands.Load(),
+	}
+	if start := sess.state.StartedAt(); status.Reading && !start.IsZero() {
+		status.ReadingSince = &start
+	}
+	if last := sess.stats.lastRecordAt.Load(); last != 0 {
+		at := time.Unix(0, last)
+		status.LastRecord = &at
+	}
+	return status
+}
+
+// errUnknownSession is returned by selectSessions for a name no session has.
+var errUnknownSession = errors.New("unknown session")
+
+// selectSessions returns the running session called name, or all of them if name
+// is nil, among those visible in scope, as returned by scopeFor. Sessions outside
+// of scope are unknown to it.
+func selectSessions(registry *sessionRegistry, name *string, scope *int) ([]*session, error) {
+	var sessions []*session
+	for _, sess := range registry.list() {
+		if sess.ownedBy(scope) {
+			sessions = append(sessions, sess)
+		}
+	}
+	if name == nil {
+		return sessions, nil
+	}
+	for _, sess := range sessions {
+		if sess.name == *name {
+			return []*session{sess}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errUnknownSession, *name)
+}
+
+// controlSessions applies action to sessions, as selected by selectSessions.
+// signalOnly leaves out marker-controlled sessions unless one was named, as the
+// signals do.
+func controlSessions(sessions []*session, named, signalOnly bool, action func(*session)) {
+	for _, sess := range sessions {
+		if !signalOnly || !sess.markers || named {
+			action(sess)
+		}
+	}
+}
+
+// statusOf returns the status of sessions along with the process-wide counters.
+func statusOf(sessions []*session) StatusResponse {
+	response := StatusResponse{
+		Sessions: make([]SessionStatus, 0, len(sessions)),
+		Output: OutputStatus{
+			Sink:           sinkName(),
+			WriteErrors:    outputStats.writeErrors.Load(),
+			DroppedRecords: outputStats.droppedRecords.Load(),
+			SpooledRecords: outputStats.spooledRecords.Load(),
+			UsingFallback:  outputStats.usingFallback.Load(),
+		},
+		ParseErrors: pipeline.ParseErrors(),
+		Errors:      reportedErrors.Load(),
+		PID:         os.Getpid(),
+		StartedAt:   processStartedAt,
+	}
+	for _, sess := range sessions {
+		response.Sessions = append(response.Sessions, sessionStatus(sess))
+	}
+	return response
+}
+
+// httpAuthorizer decides whether an HTTP API request is accepted, and which
+// sessions it may see and control. authorize returns the owner whose sessions
+// those are, as scopeFor does, or nil for every session; ok is false for a request
+// that isn't accepted.
+type httpAuthorizer interface {
+	authorize(r *http.Request) (scope *int, ok bool)
+}
+
+// httpToken is a bearer token of the --http-token-file, along with the owner whose
+// sessions it is limited to, or nil for every session.
+type httpToken struct {
+	token string
+	scope *int
+}
+
+// tokenAuthorizer accepts requests carrying one of its tokens as a bearer token.
+type tokenAuthorizer []httpToken
+
+func (a tokenAuthorizer) authorize(r *http.Request) (*int, bool) {
+	got := []byte(r.Header.Get("Authorization"))
+	var scope *int
+	found := false
+	// Every token is compared, so the time taken doesn't tell which one matched
+	for _, t := range a {
+		if subtle.ConstantTimeCompare(got, []byte("Bearer "+t.token)) == 1 {
+			scope, found = t.scope, true
+		}
+	}
+	return scope, found
+}
+
+// anyAuthorizer accepts a request that one of its authorizers accepts, with the
+// scope the first of them gives it.
+type anyAuthorizer []httpAuthorizer
+
+func (a anyAuthorizer) authorize(r *http.Request) (*int, bool) {
+	for _, auth := range a {
+		if scope, ok := auth.authorize(r); ok {
+			return scope, true
+		}
+	}
+	return nil, false
+}
+
+// readTokenFile reads the tokens of an --http-token-file, one per line. A token
+// followed by user=<user>, as a uid or a name, only sees and controls the sessions
+// that user owns; a token alone, or one of root or the user running script2json,
+// sees every session. Blank lines and lines starting with # are ignored. Anything
+// else after a token is an error rather than a user, so that a token containing
+// whitespace, which the file used to allow when it held a single token, can't be
+// mistaken for a token limited to a user.
+func readTokenFile(path string) (tokenAuthorizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens tokenAuthorizer
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var name string
+		if len(fields) > 1 {
+			var ok bool
+			if name, ok = strings.CutPrefix(fields[1], "user="); !ok || len(fields) > 2 {
+				return nil, fmt.Errorf("%s line %d: expected a token and an optional user=<user>; tokens can't contain whitespace", path, i+1)
+			}
+		}
+		token := httpToken{token: fields[0]}
+		if len(fields) > 1 {
+			uid, err := lookupUID(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %v", path, i+1, err)
+			}
+			token.scope = scopeFor(uid)
+		}
+		tokens = append(tokens, token)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s has no tokens", path)
+	}
+	return tokens, nil
+}
+
+// lookupUID returns the uid of a user given as a uid or a name.
+func lookupUID(name string) (int, error) {
+	if uid, err := strconv.Atoi(name); err == nil && uid >= 0 {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, fmt.Errorf("user %s has no numeric uid: %s", name, u.Uid)
+	}
+	return uid, nil
+}
+
+// scopeKey is the context key of the scope that the httpAuthorizer gave a request.
+type scopeKey struct{}
+
+// requestScope returns the owner whose sessions r may see and control, or nil for
+// every session.
+func requestScope(r *http.Request) *int {
+	scope, _ := r.Context().Value(scopeKey{}).(*int)
+	return scope
+}
+
+// newHTTPHandler returns the HTTP control and status API, an alternative to the
+// signals for orchestration tools:
+//   - POST /start and POST /stop start and stop reading, like SIGUSR1 and SIGUSR2
+//   - POST /reset resets the pipeline state, like SIGHUP
+//   - POST /annotate writes the request body as an annotation record
+//   - POST /sink switches the output to the request body, "stdout" or
+//     "file <path>", and POST /reopen reopens the output file; they are only
+//     served with an authorizer, since they write wherever the process can, and
+//     only to requests that see every session
+//   - GET /status reports the state without changing it
+//
+// Each answers with a StatusResponse. The session query parameter picks a single
+// session by name; without it, /start and /stop apply to the signal-controlled
+// sessions and /reset to all of them, as the signals do, and /annotate requires
+// that only one session runs. Unless auth is nil, it must accept each request,
+// which then only sees the sessions in the scope it was given.
+func newHTTPHandler(registry *sessionRegistry, auth httpAuthorizer, logger *slog.Logger) http.Handler {
+	// sessionsFor returns the sessions a request applies to and whether it named one
+	sessionsFor := func(w http.ResponseWriter, r *http.Request) ([]*session, bool, bool) {
+		var name *string
+		if r.URL.Query().Has("session") {
+			value := r.URL.Query().Get("session")
+			name = &value
+		}
+		sessions, err := selectSessions(registry, name, requestScope(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil, false, false
+		}
+		return sessions, name != nil, true
+	}
+	respond := func(w http.ResponseWriter, sessions []*session) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(statusOf(sessions)); err != nil {
+			logger.Debug("Error writing HTTP response", "error", err)
+		}
+	}
+	control := func(name string, signalOnly bool, action func(*session)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			sessions, named, ok := sessionsFor(w, r)
+			if !ok {
+				return
+			}
+			logger.Debug("HTTP control request", "action", name, "session", r.URL.Query().Get("session"))
+			controlSessions(sessions, named, signalOnly, action)
+			respond(w, sessions)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /start", control("start", true, startReading))
+	mux.Handle("POST /stop", control("stop", true, stopReading))
+	mux.Handle("POST /reset", control("reset", false, resetSession))
+	mux.HandleFunc("POST /annotate", func(w http.ResponseWriter, r *http.Request) {
+		sessions, _, ok := sessionsFor(w, r)
+		if !ok {
+			return
+		}
+		text, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAnnotationBytes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		logger.Debug("HTTP control request", "action", "annotate", "session", r.URL.Query().Get("session"))
+		if err := annotateSessions(sessions, string(text)); err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, errAnnotationQueueFull) {
+				code = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		respond(w, sessions)
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		if sessions, _, ok := sessionsFor(w, r); ok {
+			respond(w, sessions)
+		}
+	})
+	if auth == nil {
+		// Without a token, any local user or any web page the user visits could
+		// point the output at a file: a text/plain POST needs no CORS preflight
+		return mux
+	}
+	// allSessions refuses requests limited to some of the sessions, since the
+	// output is shared by all of them
+	allSessions := func(w http.ResponseWriter, r *http.Request) bool {
+		if requestScope(r) != nil {
+			http.Error(w, "only the user running script2json may change the output", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("POST /sink", func(w http.ResponseWriter, r *http.Request) {
+		if !allSessions(w, r) {
+			return
+		}
+		sessions, _, ok := sessionsFor(w, r)
+		if !ok {
+			return
+		}
+		target, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSinkTargetBytes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		path, err := parseSinkTarget(string(target))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Debug("HTTP control request", "action", "sink", "path", path)
+		if err := switchSink(path); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Switched output", "sink", sinkName())
+		respond(w, sessions)
+	})
+	mux.HandleFunc("POST /reopen", func(w http.ResponseWriter, r *http.Request) {
+		if !allSessions(w, r) {
+			return
+		}
+		sessions, _, ok := sessionsFor(w, r)
+		if !ok {
+			return
+		}
+		logger.Debug("HTTP control request", "action", "reopen")
+		if err := reopenSink(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logger.Info("Reopened output", "sink", sinkName())
+		respond(w, sessions)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := auth.authorize(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeKey{}, scope)))
+	})
+}
+
+// serveHTTP serves the HTTP API on l until it is closed.
+func serveHTTP(l net.Listener, registry *sessionRegistry, auth httpAuthorizer, logger *slog.Logger) {
+	server := &http.Server{Handler: newHTTPHandler(registry, auth, logger), ReadHeaderTimeout: 10 * time.Second}
+	if err := server.Serve(l); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Error("Error serving HTTP API", "error", err)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHTTPHandler tests controlling sessions and reading their status over HTTP
+func TestHTTPHandler(t *testing.T) {
+	signalled := newSession("signalled", "", "")
+	signalled.markers = false
+	marked := newSession("marked", "", "")
+	marked.stats.records.Store(3)
+	marked.stats.lastRecordAt.Store(time.Date(2025, 9, 29, 13, 24, 41, 0, time.UTC).UnixNano())
+	marked.stats.bufferBytes.Store(42)
+	registry := newSessionRegistry(signalled, marked)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := httptest.NewServer(newHTTPHandler(registry, nil, logger))
+	defer server.Close()
+
+	// request sends a request and returns the decoded status
+	request := func(method, path string, wantCode int) StatusResponse {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantCode {
+			t.Fatalf("%s %s = %d, want %d", method, path, resp.StatusCode, wantCode)
+		}
+		var status StatusResponse
+		if wantCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+			}
+		}
+		return status
+	}
+
+	// Like SIGUSR1, /start leaves marker-controlled sessions alone unless named
+	request("POST", "/start", http.StatusOK)
+	if !signalled.recording() || marked.recording() {
+		t.Errorf("After /start, reading = (%v, %v), want (true, false)", signalled.recording(), marked.recording())
+	}
+	status := request("POST", "/start?session=marked", http.StatusOK)
+	if len(status.Sessions) != 1 || !status.Sessions[0].Reading || status.Sessions[0].State != "recording" || status.Sessions[0].ReadingSince == nil {
+		t.Errorf("After /start?session=marked, status = %+v", status.Sessions)
+	}
+
+	status = request("GET", "/status", http.StatusOK)
+	if len(status.Sessions) != 2 {
+		t.Fatalf("Status sessions = %+v, want 2", status.Sessions)
+	}
+	got := status.Sessions[1]
+	if got.Name != "marked" || !got.Markers || got.Records != 3 || got.BufferBytes != 42 || got.LastRecord == nil || got.LastRecord.Year() != 2025 {
+		t.Errorf("Status of marked = %+v", got)
+	}
+
+	// Without a lineEditor to flush the output, the stopped session stays flushing
+	status = request("POST", "/stop?session=signalled", http.StatusOK)
+	if signalled.recording() || !marked.recording() {
+		t.Errorf("After /stop?session=signalled, reading = (%v, %v), want (false, true)", signalled.recording(), marked.recording())
+	}
+	if len(status.Sessions) != 1 || status.Sessions[0].State != "flushing" || status.Sessions[0].ReadingSince != nil {
+		t.Errorf("After /stop?session=signalled, status = %+v, want it flushing", status.Sessions)
+	}
+	request("POST", "/reset", http.StatusOK)
+	if marked.recording() {
+		t.Error("/reset should stop reading in every session")
+	}
+	select {
+	case <-marked.resetChan:
+	default:
+		t.Error("/reset did not reset the lineEditor of marked")
+	}
+
+	request("GET", "/status?session=db", http.StatusNotFound)
+	request("GET", "/start", http.StatusMethodNotAllowed)
+}
+
+// TestHTTPHandlerToken tests that a token is required once configured
+func TestHTTPHandlerToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := httptest.NewServer(newHTTPHandler(newSessionRegistry(), tokenAuthorizer{{token: "s3cret"}}, logger))
+	defer server.Close()
+
+	for auth, wantCode := range map[string]int{"": http.StatusUnauthorized, "Bearer wrong": http.StatusUnauthorized, "Bearer s3cret": http.StatusOK} {
+		req, _ := http.NewRequest("GET", server.URL+"/status", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != wantCode {
+			t.Errorf("Authorization %q = %d, want %d", auth, resp.StatusCode, wantCode)
+		}
+	}
+}
+
+// TestHTTPHandlerScopedToken tests that a token limited to a user only sees and
+// controls that user's sessions
+func TestHTTPHandlerScopedToken(t *testing.T) {
+	other := processUID + 1000
+	web := newSession("web", "", "")
+	web.owner = &other
+	registry := newSessionRegistry(web, newSession("db", "", ""))
+	auth := tokenAuthorizer{{token: "admin"}, {token: "webtoken", scope: scopeFor(other)}}
+	server := httptest.NewServer(newHTTPHandler(registry, auth, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer server.Close()
+
+	tests := []struct {
+		token    string
+		method   string
+		path     string
+		wantCode int
+		sessions []string
+	}{
+		{"admin", "GET", "/status", http.StatusOK, []string{"web", "db"}},
+		{"webtoken", "GET", "/status", http.StatusOK, []string{"web"}},
+		{"webtoken", "POST", "/reset?session=web", http.StatusOK, []string{"web"}},
+		{"webtoken", "GET", "/status?session=db", http.StatusNotFound, nil},
+		{"webtoken", "POST", "/reopen", http.StatusForbidden, nil},
+		{"webtoken", "POST", "/sink", http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader("stdout"))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var status StatusResponse
+		json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantCode {
+			t.Errorf("%s %s with %s = %d, want %d", tt.method, tt.path, tt.token, resp.StatusCode, tt.wantCode)
+			continue
+		}
+		var names []string
+		for _, sess := range status.Sessions {
+			names = append(names, sess.Name)
+		}
+		if !slices.Equal(names, tt.sessions) {
+			t.Errorf("%s %s with %s: sessions = %q, want %q", tt.method, tt.path, tt.token, names, tt.sessions)
+		}
+	}
+}
+
+// TestAnyAuthorizer tests that a request is accepted by the first authorizer that
+// accepts it, with its scope
+func TestAnyAuthorizer(t *testing.T) {
+	other := processUID + 1000
+	auth := anyAuthorizer{tokenAuthorizer{{token: "admin"}}, tokenAuthorizer{{token: "user", scope: &other}}}
+	for token, want := range map[string]*int{"admin": nil, "user": &other} {
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if scope, ok := auth.authorize(req); !ok || scope != want {
+			t.Errorf("authorize with %s = %v, %v, want %v", token, scope, ok, want)
+		}
+	}
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	if _, ok := auth.authorize(req); ok {
+		t.Error("A token that no authorizer accepts should be refused")
+	}
+}
+
+// TestReadTokenFile tests reading the tokens of --http-token-file
+func TestReadTokenFile(t *testing.T) {
+	other := processUID + 1000
+	path := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(path, []byte(fmt.Sprintf("# operators\nadmin\n\nalice user=%d\nroot user=0\n", other)), 0600)
+	tokens, err := readTokenFile(path)
+	if err != nil {
+		t.Fatalf("readTokenFile failed: %v", err)
+	}
+	if len(tokens) != 3 || tokens[0].token != "admin" || tokens[0].scope != nil || tokens[1].scope == nil || *tokens[1].scope != other || tokens[2].scope != nil {
+		t.Errorf("Tokens = %+v, want admin and root unlimited and alice limited to %d", tokens, other)
+	}
+
+	for _, content := range []string{"", "# nothing\n", "a b c\n", "a user=no-such-user-s2j\n", "a user=\n", "two words\n", "a 0\n"} {
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := readTokenFile(path); err == nil {
+			t.Errorf("readTokenFile(%q) succeeded, want an error", content)
+		}
+	}
+}
+
+// TestHTTPAnnotate tests writing annotations through POST /annotate
+func TestHTTPAnnotate(t *testing.T) {
+	web := newSession("web", "", "")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := httptest.NewServer(newHTTPHandler(newSessionRegistry(web, newSession("db", "", "")), nil, logger))
+	defer server.Close()
+
+	tests := []struct {
+		query    string
+		body     string
+		wantCode int
+	}{
+		{"", "starting maintenance window", http.StatusBadRequest},
+		{"?session=web", "  ", http.StatusBadRequest},
+		{"?session=cache", "note", http.StatusNotFound},
+		{"?session=web", "starting maintenance window\n", http.StatusOK},
+		{"?session=web", strings.Repeat("x", maxAnnotationBytes+1), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(server.URL+"/annotate"+tt.query, "text/plain", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantCode {
+			t.Errorf("POST /annotate%s = %d, want %d", tt.query, resp.StatusCode, tt.wantCode)
+		}
+	}
+	if len(web.annotations) != 1 || <-web.annotations != "starting maintenance window" {
+		t.Error("POST /annotate?session=web should queue a single annotation")
+	}
+}
+
+// TestHTTPSink tests switching the sink over HTTP, which requires a token
+func TestHTTPSink(t *testing.T) {
+	defer switchSink("")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+
+	open := httptest.NewServer(newHTTPHandler(newSessionRegistry(newSession("web", "", "")), nil, logger))
+	defer open.Close()
+	for _, endpoint := range []string{"/sink", "/reopen"} {
+		resp, err := http.Post(open.URL+endpoint, "text/plain", strings.NewReader("file "+path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("POST %s without a token = %d, want %d", endpoint, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+	if sinkName() != sinkStdout {
+		t.Fatalf("Sink = %q after requests without a token, want stdout", sinkName())
+	}
+
+	server := httptest.NewServer(newHTTPHandler(newSessionRegistry(newSession("web", "", "")), tokenAuthorizer{{token: "secret"}}, logger))
+	defer server.Close()
+
+	tests := []struct {
+		path     string
+		body     string
+		wantCode int
+		wantSink string
+	}{
+		{"/sink", "file " + path, http.StatusOK, path},
+		{"/reopen", "", http.StatusOK, path},
+		{"/sink", "file " + filepath.Join(path, "records.jsonl"), http.StatusInternalServerError, path},
+		{"/sink", "syslog", http.StatusBadRequest, path},
+		{"/sink", "stdout\n", http.StatusOK, sinkStdout},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var status StatusResponse
+		if tt.wantCode == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&status)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantCode {
+			t.Errorf("POST %s %q = %d, want %d", tt.path, tt.body, resp.StatusCode, tt.wantCode)
+		}
+		if tt.wantCode == http.StatusOK && status.Output.Sink != tt.wantSink {
+			t.Errorf("POST %s %q: sink = %q, want %q", tt.path, tt.body, status.Output.Sink, tt.wantSink)
+		}
+		if sinkName() != tt.wantSink {
+			t.Errorf("After POST %s %q, sink = %q, want %q", tt.path, tt.body, sinkName(), tt.wantSink)
+		}
+	}
+}
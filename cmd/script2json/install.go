@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// installManifest records what install set up, so that uninstall undoes exactly
+// that, wherever it was put.
+type installManifest struct {
+	// Fifos are the FIFOs that install created; ones that existed are left alone
+	Fifos []string `json:"fifos"`
+	// RCFile is the shell rc file that the hooks were installed into
+	RCFile string `json:"rc_file"`
+	// RCCreated is set if the rc file didn't exist before
+	RCCreated bool `json:"rc_created,omitempty"`
+	// Unit is the systemd user unit that was written, if any
+	Unit string `json:"unit,omitempty"`
+	// Enabled is set if the unit was enabled and started
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// unitName is the name of the systemd user unit that install writes.
+const unitName = "script2json.service"
+
+// manifestPath returns where install keeps its manifest.
+func manifestPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "script2json", "install.json"), nil
+}
+
+// dataDir returns the directory for the records of the installed service,
+// following the XDG base directory specification.
+func dataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "script2json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "script2json"), nil
+}
+
+// runInstall implements the install subcommand, which sets up capture on this host:
+// it creates the FIFOs, installs the shell hooks into the shell's rc file, and
+// writes a systemd user unit that runs script2json with its records appended to a
+// file. Everything is recorded in a manifest for uninstall. The hooks and the unit
+// use integration markers, so that they need no PID file.
+func runInstall(args []string) error {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	shellName := fs.String("shell", filepath.Base(os.Getenv("SHELL")), "Shell to install the hooks for (bash, zsh)")
+	scriptFifo := fs.String("script-fifo", defaultScriptFifoPath, "Path of the script FIFO to create")
+	commandFifo := fs.String("command-fifo", defaultCommandFifoPath, "Path of the command FIFO to create")
+	rcFile := fs.String("rc", "", "The rc file to install the hooks into (default: the shell's rc file in the home directory)")
+	output := fs.String("output", "", "File the service appends records to (default: records.jsonl in ~/.local/share/script2json)")
+	noSystemd := fs.Bool("no-systemd", false, "Don't write a systemd user unit")
+	enable := fs.Bool("enable", false, "Enable and start the systemd user unit")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s install [-shell bash|zsh] [-script-fifo path] [-command-fifo path] [-rc path] [-output path] [-no-systemd | -enable]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	shell, ok := hookShells[*shellName]
+	if !ok {
+		return fmt.Errorf("%w: unsupported shell: %s. Must be bash or zsh", errConfig, *shellName)
+	}
+	if *noSystemd && (*enable || *output != "") {
+		return fmt.Errorf("%w: -enable and -output require the systemd unit", errConfig)
+	}
+	path, err := manifestPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%w: already installed according to %s; run uninstall first", errConfig, path)
+	}
+	var manifest installManifest
+	// The manifest is written even if a step fails, so that uninstall can undo the others
+	defer func() {
+		if err := writeManifest(path, manifest); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not write the install manifest: %v\n", err)
+		}
+	}()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	for _, fifo := range []string{*scriptFifo, *commandFifo} {
+		if _, err := os.Stat(fifo); err == nil {
+			continue
+		}
+		if err := createFifo(fifo, logger); err != nil {
+			return fmt.Errorf("could not create FIFO: %w", err)
+		}
+		manifest.Fifos = append(manifest.Fifos, fifo)
+		fmt.Printf("Created %s\n", fifo)
+	}
+
+	manifest.RCFile = *rcFile
+	if manifest.RCFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		manifest.RCFile = filepath.Join(home, shell.rc)
+	}
+	if _, err := os.Stat(manifest.RCFile); errors.Is(err, os.ErrNotExist) {
+		manifest.RCCreated = true
+	}
+	hooks := shell.hooks(hookOptions{commandFifo: *commandFifo, framing: commandFramingNewline, markers: true})
+	if err := installRCBlock(manifest.RCFile, hooks); err != nil {
+		return fmt.Errorf("could not install hooks: %w", err)
+	}
+	fmt.Printf("Installed hooks into %s\n", manifest.RCFile)
+
+	if !*noSystemd {
+		if err := installUnit(&manifest, *scriptFifo, *commandFifo, *output, *enable); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Record a shell with: %s=1 script -f %s\n", hooksEnv, *scriptFifo)
+	return nil
+}
+
+// installUnit writes the systemd user unit, and enables and starts it if enable
+// is set, recording both in manifest.
+func installUnit(manifest *installManifest, scriptFifo, commandFifo, output string, enable bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the script2json executable: %w", err)
+	}
+	if output == "" {
+		dir, err := dataDir()
+		if err != nil {
+			return err
+		}
+		output = filepath.Join(dir, "records.jsonl")
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("could not create records directory: %w", err)
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+	unit := filepath.Join(configDir, "systemd", "user", unitName)
+	if err := os.MkdirAll(filepath.Dir(unit), 0755); err != nil {
+		return fmt.Errorf("could not create unit directory: %w", err)
+	}
+	opts := unitOptions{
+		name:    strings.TrimSuffix(unitName, ".service"),
+		exe:     exe,
+		args:    []string{"-markers", "-script-fifo", scriptFifo, "-command-fifo", commandFifo},
+		user:    true,
+		restart: "on-failure",
+		output:  output,
+	}
+	if err := os.WriteFile(unit, []byte(serviceUnit(opts)), 0644); err != nil {
+		return fmt.Errorf("could not write unit: %w", err)
+	}
+	manifest.Unit = unit
+	fmt.Printf("Wrote %s; records go to %s\n", unit, output)
+
+	if !enable {
+		fmt.Printf("Start it with: systemctl --user enable --now %s\n", unitName)
+		return nil
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", "--now", unitName); err != nil {
+		return err
+	}
+	manifest.Enabled = true
+	fmt.Printf("Enabled and started %s\n", unitName)
+	return nil
+}
+
+// systemctl runs systemctl --user with args.
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl --user %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// writeManifest writes manifest to path as JSON.
+func writeManifest(path string, manifest installManifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// runUninstall implements the uninstall subcommand, which undoes what install
+// recorded in its manifest: it stops and removes the unit, removes the hooks from
+// the rc file, and removes the FIFOs that install created. Records are kept.
+func runUninstall(args []string) error {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s uninstall\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path, err := manifestPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: not installed; no manifest at %s", errConfig, path)
+	}
+	if err != nil {
+		return err
+	}
+	var manifest installManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid install manifest %s: %w", path, err)
+	}
+
+	// Every step is attempted, so that one failure doesn't leave the rest behind
+	var errs []error
+	if manifest.Enabled {
+		if err := systemctl("disable", "--now", unitName); err != nil {
+			errs = append(errs, err)
+		} else {
+			fmt.Printf("Stopped and disabled %s\n", unitName)
+		}
+	}
+	if manifest.Unit != "" {
+		if err := os.Remove(manifest.Unit); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		} else {
+			fmt.Printf("Removed %s\n", manifest.Unit)
+		}
+		if manifest.Enabled {
+			if err := systemctl("daemon-reload"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if manifest.RCFile != "" {
+		if err := removeRCBlock(manifest.RCFile, manifest.RCCreated); err != nil {
+			errs = append(errs, fmt.Errorf("could not remove hooks: %w", err))
+		} else {
+			fmt.Printf("Removed hooks from %s\n", manifest.RCFile)
+		}
+	}
+	for _, fifo := range manifest.Fifos {
+		if err := removeFifo(fifo); err != nil {
+			errs = append(errs, err)
+		} else {
+			fmt.Printf("Removed %s\n", fifo)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	// The directory is only removed if nothing else was put in it
+	os.Remove(filepath.Dir(path))
+	return nil
+}
+
+// removeRCBlock removes the installed hooks from the rc file at path, if they are
+// there, and the file itself if it was created for them and nothing else was added.
+func removeRCBlock(path string, created bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rest, found := cutRCBlock(data)
+	if !found {
+		return nil
+	}
+	if created && len(bytes.TrimSpace(rest)) == 0 {
+		return os.Remove(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, rest, info.Mode().Perm())
+}
+
+// removeFifo removes the FIFO at path, unless something else has taken its place.
+func removeFifo(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != os.ModeNamedPipe {
+		return fmt.Errorf("not removing %s, which is no longer a FIFO", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,87 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestInstallUninstall tests that uninstall undoes install, keeping what was there
+// before
+func TestInstallUninstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+	rc := filepath.Join(home, ".bashrc")
+	if err := os.WriteFile(rc, []byte("alias ll='ls -l'\n"), 0644); err != nil {
+		t.Fatalf("Failed to write rc file: %v", err)
+	}
+	scriptFifo := filepath.Join(home, "script fifo")
+	commandFifo := filepath.Join(home, "command.fifo")
+	// A FIFO that already exists isn't install's to remove
+	if err := syscall.Mkfifo(commandFifo, 0666); err != nil {
+		t.Fatalf("Failed to create FIFO: %v", err)
+	}
+
+	args := []string{"-shell", "bash", "-script-fifo", scriptFifo, "-command-fifo", commandFifo}
+	if err := runInstall(args); err != nil {
+		t.Fatalf("runInstall failed: %v", err)
+	}
+	if info, err := os.Stat(scriptFifo); err != nil || info.Mode().Type() != os.ModeNamedPipe {
+		t.Errorf("Script FIFO was not created: %v", err)
+	}
+	data, err := os.ReadFile(rc)
+	if err != nil || !strings.Contains(string(data), hooksBegin) {
+		t.Errorf("Hooks were not installed: %v\n%s", err, data)
+	}
+	unit := filepath.Join(home, ".config", "systemd", "user", unitName)
+	data, err = os.ReadFile(unit)
+	if err != nil {
+		t.Fatalf("Unit was not written: %v", err)
+	}
+	records := filepath.Join(home, ".local", "share", "script2json", "records.jsonl")
+	for _, want := range []string{`-script-fifo "` + scriptFifo + `"`, "StandardOutput=append:" + records} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Unit lacks %q:\n%s", want, data)
+		}
+	}
+	if err := runInstall(args); err == nil {
+		t.Error("A second install succeeded")
+	}
+
+	if err := runUninstall(nil); err != nil {
+		t.Fatalf("runUninstall failed: %v", err)
+	}
+	for _, path := range []string{scriptFifo, unit} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was not removed: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(commandFifo); err != nil {
+		t.Errorf("The FIFO that existed before was removed: %v", err)
+	}
+	if data, _ := os.ReadFile(rc); string(data) != "alias ll='ls -l'\n" {
+		t.Errorf("rc file = %q after uninstall", data)
+	}
+	if err := runUninstall(nil); err == nil {
+		t.Error("A second uninstall succeeded")
+	}
+
+	// An rc file that install created goes again
+	zshrc := filepath.Join(home, ".zshrc")
+	if err := runInstall([]string{"-shell", "zsh", "-no-systemd", "-script-fifo", scriptFifo, "-command-fifo", commandFifo}); err != nil {
+		t.Fatalf("runInstall failed: %v", err)
+	}
+	if err := runUninstall(nil); err != nil {
+		t.Fatalf("runUninstall failed: %v", err)
+	}
+	if _, err := os.Stat(zshrc); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("The rc file that install created was not removed: %v", err)
+	}
+}
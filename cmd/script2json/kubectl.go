@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"script2json/pkg/pipeline"
+)
+
+// kubectlFlagsWithArgument are the kubectl exec and global flags that take an
+// argument, by long name; kubectlShortFlags maps their short names.
+var (
+	kubectlFlagsWithArgument = []string{
+		"namespace", "context", "cluster", "kubeconfig", "container", "filename",
+		"pod-running-timeout", "user", "server", "token", "as", "as-group", "as-uid",
+		"request-timeout", "certificate-authority", "client-certificate", "client-key",
+		"tls-server-name", "cache-dir", "username", "password", "profile",
+		"profile-output", "log-flush-frequency", "v", "vmodule",
+	}
+	kubectlShortFlags = map[byte]string{'n': "namespace", 'c': "container", 'f': "filename", 's': "server", 'v': "v"}
+)
+
+// kubectlExecArgs is what parseKubectlExecArgs finds among kubectl exec arguments.
+type kubectlExecArgs struct {
+	pod string
+	// flags holds the values of the flags that take an argument, by long name
+	flags map[string]string
+	// hasSeparator and hasCommand are set if the arguments end with "--" and a command
+	hasSeparator bool
+	hasCommand   bool
+}
+
+// runKubectl implements the kubectl subcommand, which records a shell in a pod: it
+// runs "kubectl exec -it" on a local pseudo-terminal and finds commands by matching
+// prompts, as the exec subcommand does. Records are stamped with the pod's cluster,
+// namespace and name.
+func runKubectl(args []string) error {
+	fs := flag.NewFlagSet("kubectl", flag.ExitOnError)
+	kubectl := fs.String("kubectl", "kubectl", "kubectl binary to run")
+	flags := addPromptRecorderFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s kubectl [flags] exec [kubectl exec flags] pod [-- command [args ...]]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := flags.validate(); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || fs.Arg(0) != "exec" {
+		fs.Usage()
+		return fmt.Errorf("%w: only kubectl exec can be recorded", errConfig)
+	}
+	execArgs := fs.Args()[1:]
+	parsed := parseKubectlExecArgs(execArgs)
+	if parsed.pod == "" {
+		fs.Usage()
+		return fmt.Errorf("%w: kubectl exec requires a pod", errConfig)
+	}
+
+	info := kubernetesInfo(*kubectl, parsed)
+	cmdArgs := append([]string{"exec", "-it"}, execArgs...)
+	if !parsed.hasCommand {
+		if !parsed.hasSeparator {
+			cmdArgs = append(cmdArgs, "--")
+		}
+		cmdArgs = append(cmdArgs, defaultContainerShell...)
+	}
+	return recordWithPrompts(exec.Command(*kubectl, cmdArgs...), flags, func(sess *session) {
+		sess.kubernetes = info
+	})
+}
+
+// parseKubectlExecArgs finds the pod and the values of the flags that take an
+// argument among the arguments of kubectl exec.
+func parseKubectlExecArgs(args []string) kubectlExecArgs {
+	parsed := kubectlExecArgs{flags: map[string]string{}}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// next returns the flag's value from the following argument
+		next := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+
+		switch {
+		case arg == "--":
+			parsed.hasSeparator = true
+			parsed.hasCommand = i+1 < len(args)
+			return parsed
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			if slices.Contains(kubectlFlagsWithArgument, name) {
+				if !hasValue {
+					value = next()
+				}
+				parsed.flags[name] = value
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			// Short flags can be combined ("-it", "-itn", "-nweb"); the first one that
+			// takes an argument ends the group
+			for j := 1; j < len(arg); j++ {
+				if name, ok := kubectlShortFlags[arg[j]]; ok {
+					value := strings.TrimPrefix(arg[j+1:], "=")
+					if value == "" {
+						value = next()
+					}
+					parsed.flags[name] = value
+					break
+				}
+			}
+		case parsed.pod == "":
+			parsed.pod = arg
+			for _, prefix := range []string{"pod/", "pods/"} {
+				parsed.pod = strings.TrimPrefix(parsed.pod, prefix)
+			}
+		}
+	}
+	return parsed
+}
+
+// kubernetesInfo returns the pod's details from the kubectl exec arguments, taking
+// the cluster and namespace from the kubeconfig context where the arguments don't
+// give them.
+func kubernetesInfo(kubectl string, parsed kubectlExecArgs) *pipeline.KubernetesInfo {
+	info := &pipeline.KubernetesInfo{
+		Cluster:   parsed.flags["cluster"],
+		Namespace: parsed.flags["namespace"],
+		Pod:       parsed.pod,
+		Container: parsed.flags["container"],
+	}
+	if info.Cluster == "" || info.Namespace == "" {
+		cluster, namespace, err := kubeconfigContext(kubectl, parsed.flags["kubeconfig"], parsed.flags["context"])
+		if err != nil {
+			// kubectl may still work without a kubeconfig, such as inside a cluster
+			slog.Warn("Could not read the kubeconfig context", "error", err)
+		}
+		if info.Cluster == "" {
+			info.Cluster = cluster
+		}
+		if info.Namespace == "" {
+			info.Namespace = namespace
+		}
+	}
+	if info.Namespace == "" {
+		info.Namespace = "default"
+	}
+	return info
+}
+
+// kubeconfigContext looks up the cluster and namespace of the current kubeconfig
+// context, or of the named one.
+func kubeconfigContext(kubectl, kubeconfig, context string) (cluster, namespace string, err error) {
+	var args []string
+	if kubeconfig != "" {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	if context != "" {
+		args = append(args, "--context", context)
+	}
+	args = append(args, "config", "view", "--minify", "--output",
+		`jsonpath={.contexts[0].context.cluster}{"\t"}{.contexts[0].context.namespace}`)
+	out, err := exec.Command(kubectl, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", "", fmt.Errorf("kubectl config view failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", "", fmt.Errorf("kubectl config view failed: %w", err)
+	}
+	cluster, namespace, _ = strings.Cut(strings.TrimRight(string(out), "\r\n"), "\t")
+	return cluster, namespace, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestParseKubectlExecArgs tests finding the pod and its flags among kubectl exec
+// arguments
+func TestParseKubectlExecArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		pod        string
+		namespace  string
+		container  string
+		context    string
+		hasCommand bool
+	}{
+		{[]string{"web-0"}, "web-0", "", "", "", false},
+		{[]string{"-it", "-n", "shop", "pod/web-0", "--", "bash"}, "web-0", "shop", "", "", true},
+		{[]string{"--namespace=shop", "-cnginx", "web-0", "--"}, "web-0", "shop", "nginx", "", false},
+		{[]string{"--context", "prod", "-itn", "shop", "deploy/web"}, "deploy/web", "shop", "", "prod", false},
+		{[]string{"-v=6", "-i", "web-0", "--", "sh", "-c", "id"}, "web-0", "", "", "", true},
+		{nil, "", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		parsed := parseKubectlExecArgs(tt.args)
+		if parsed.pod != tt.pod || parsed.flags["namespace"] != tt.namespace || parsed.flags["container"] != tt.container ||
+			parsed.flags["context"] != tt.context || parsed.hasCommand != tt.hasCommand {
+			t.Errorf("parseKubectlExecArgs(%q) = %+v, want pod %q, namespace %q, container %q, context %q, command %v",
+				tt.args, parsed, tt.pod, tt.namespace, tt.container, tt.context, tt.hasCommand)
+		}
+	}
+}
+
+// TestKubernetesInfo tests filling in the cluster and namespace from the kubeconfig
+// context
+func TestKubernetesInfo(t *testing.T) {
+	kubectl := filepath.Join(t.TempDir(), "kubectl")
+	script := "#!/bin/sh\n" +
+		"[ \"$2\" = staging ] && { printf 'staging-cluster\\t'; exit 0; }\n" +
+		"[ \"$2\" = broken ] && { echo 'error: context not found' >&2; exit 1; }\n" +
+		"printf 'prod-cluster\\tshop'\n"
+	if err := os.WriteFile(kubectl, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected pipeline.KubernetesInfo
+	}{
+		{[]string{"web-0"}, pipeline.KubernetesInfo{Cluster: "prod-cluster", Namespace: "shop", Pod: "web-0"}},
+		{[]string{"-n", "ops", "-c", "app", "web-0"}, pipeline.KubernetesInfo{Cluster: "prod-cluster", Namespace: "ops", Pod: "web-0", Container: "app"}},
+		{[]string{"--context", "staging", "web-0"}, pipeline.KubernetesInfo{Cluster: "staging-cluster", Namespace: "default", Pod: "web-0"}},
+		{[]string{"--context", "broken", "--cluster", "c1", "web-0"}, pipeline.KubernetesInfo{Cluster: "c1", Namespace: "default", Pod: "web-0"}},
+	}
+
+	for _, tt := range tests {
+		info := kubernetesInfo(kubectl, parseKubectlExecArgs(tt.args))
+		if *info != tt.expected {
+			t.Errorf("kubernetesInfo(%q) = %+v, want %+v", tt.args, *info, tt.expected)
+		}
+	}
+}
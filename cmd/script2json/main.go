@@ -0,0 +1,1381 @@
+package main
+
+// Generated-By: Gemini 2.5 Pro and Claude 4 Sonnet
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// commandOutput is the cleaned output of a single command, sent from lineEditor to recordCreator.
+type commandOutput struct {
+	pipeline.Output
+	// drained marks a drain request rather than an output; recordCreator closes it
+	// once everything before it has been recorded and the output flushed
+	drained chan struct{}
+}
+
+// commandInfo is a command as reported by the shell, sent to recordCreator.
+type commandInfo struct {
+	command string
+	// exitCode, cwd and euid are only known from JSON control messages on the
+	// command FIFO
+	exitCode *int
+	cwd      string
+	euid     *int
+}
+
+// editorOptions controls optional lineEditor behavior.
+type editorOptions struct {
+	// session is the pipeline's state; nil uses the single-session mode's package-level state
+	session *session
+	// progressThreshold is how long a command must run before its progress is sampled (0 disables sampling)
+	progressThreshold time.Duration
+	// progressInterval is how often the current line of a long-running command is sampled
+	progressInterval time.Duration
+	// EditorOptions controls how the output is reconstructed
+	pipeline.EditorOptions
+}
+
+// recordOptions controls the optional fields recordCreator adds to each CommandRecord.
+type recordOptions struct {
+	// session is the pipeline's state and tags records with its name; nil uses the
+	// single-session mode's package-level state
+	session *session
+	// parseArgv tokenizes the command into the Argv field using shell quoting rules
+	parseArgv bool
+	// format selects how records are written to stdout ("json" or "pretty")
+	format string
+	// color enables ANSI colors in the pretty format
+	color bool
+	// timeDisplay selects how timestamps are rendered in the pretty format
+	timeDisplay string
+	// summaryEvery emits a SummaryRecord after this many command records (0 disables)
+	summaryEvery int
+	// summaryInterval emits a SummaryRecord at this interval (0 disables)
+	summaryInterval time.Duration
+	// outputFailurePolicy selects how stdout write failures are handled (exit, spool, fallback)
+	outputFailurePolicy string
+	// fallbackFile is where records are written after a stdout failure under the fallback policy
+	fallbackFile string
+	// collapseProgress replaces runs of progress frames in Output with their final frame
+	collapseProgress bool
+	// newline selects how line endings in Output are normalized (lf, crlf, raw)
+	newline string
+	// countBells adds the number of terminal bells to each record
+	countBells bool
+	// recorderVersion is the version of script2json to tag each record with, if set
+	recorderVersion string
+	// processors filter and transform each record before it is written
+	processors pipeline.Chain
+	// hooks are fired with each record written and each record a processor drops
+	hooks *pipeline.Hooks
+	// stdout is where records are written while the sink is stdout; nil is os.Stdout
+	stdout io.Writer
+}
+
+// recordID is a monotonically increasing counter for CommandRecord IDs. Unlike the
+// rest of a session's state it is process-wide: all sessions write to one output
+// stream, in which IDs must be unique.
+var recordID atomic.Uint64
+
+func main() {
+	// Subcommands have flags of their own; without one, or with "capture", the flags
+	// below configure capture from the FIFOs
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if cmd := findSubcommand(args[0]); cmd != nil {
+			if err := cmd.run(args[1:]); err != nil {
+				fatal(fmt.Errorf("%s: %w", cmd.failure, err))
+			}
+			return
+		}
+		if args[0] == captureSubcommand {
+			args = args[1:]
+		}
+	}
+
+	scriptFifoPath := flag.String("script-fifo", defaultScriptFifoPath, "Path to the script FIFO to read from")
+	useStdin := flag.Bool("stdin", false, "Read the terminal byte stream from stdin instead of the script FIFO")
+	serialDevice := flag.String("serial", "", "Read the terminal byte stream from a serial device instead of the script FIFO, as path[,baud]")
+	var sessions sessionFlags
+	flag.Var(&sessions, "session", "Record a session from its own FIFOs, as name:scriptfifo:commandfifo (repeatable; replaces --script-fifo and --command-fifo)")
+	inputSocket := flag.String("input-socket", "", "Listen on this Unix socket for terminal byte streams, one session per connection (implies session mode)")
+	listenAddr := flag.String("listen", "", "Accept terminal byte streams over TCP on this address, e.g. :7070, one session per connection (implies session mode)")
+	tlsCert := flag.String("tls-cert", "", "Certificate file for TLS on --listen")
+	tlsKey := flag.String("tls-key", "", "Private key file for TLS on --listen")
+	tlsClientCA := flag.String("tls-client-ca", "", "Require --listen clients to present a certificate signed by this CA")
+	controlSocket := flag.String("control-socket", "", "Listen on this Unix socket for sessions registering at runtime (implies session mode)")
+	commandFifoPath := flag.String("command-fifo", defaultCommandFifoPath, "Path to the command FIFO to read from")
+	commandFraming := flag.String("command-framing", commandFramingNewline, "How commands are delimited in the command FIFO (newline, nul, len)")
+	commandProtocol := flag.String("command-protocol", commandProtocolText, "What the command FIFO carries: command text, or JSON control messages (text, json)")
+	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	pidFile := flag.String("pid-file", "", "Path to write PID file (optional)")
+	parseArgv := flag.Bool("parse-argv", false, "Tokenize each command with shell quoting rules into an argv field")
+	format := flag.String("format", "json", "Output format (json, pretty)")
+	colorMode := flag.String("color", "auto", "Colorize pretty output (always, never, auto)")
+	timeDisplay := flag.String("time-display", "clock", "Timestamp rendering in pretty output (clock, local, relative, rfc3339)")
+	summaryEvery := flag.Int("summary-every", 0, "Emit a summary record after every N commands (0 disables)")
+	summaryInterval := flag.Duration("summary-interval", 0, "Emit a summary record at this interval, e.g. 5m (0 disables)")
+	markers := flag.Bool("markers", false, "Start and stop reading on integration markers in the byte stream instead of SIGUSR1 and SIGUSR2")
+	pauseBufferWindow := flag.Duration("pause-buffer", 0, "Keep the bytes read in this long before reading starts, e.g. 250ms, so a late start doesn't lose a command's first output (0 discards them)")
+	byteBuffer := flag.Int("byte-buffer", byteBufferSize, "Capacity, in chunks, of the channel carrying terminal bytes to the line editor")
+	outputBuffer := flag.Int("output-buffer", outputBufferSize, "Capacity of the channel carrying command outputs to the record creator")
+	commandBuffer := flag.Int("command-buffer", commandBufferSize, "Capacity of the channel carrying commands to the record creator")
+	overflowPolicy := flag.String("overflow", overflowBlock, "What to do with an output or command when its channel is full (block, drop-oldest, drop-newest)")
+	progressThreshold := flag.Duration("progress-threshold", 0, "Sample the progress of commands running longer than this, e.g. 1m (0 disables)")
+	progressInterval := flag.Duration("progress-interval", 10*time.Second, "Interval between progress samples of long-running commands")
+	onOutputError := flag.String("on-output-error", "exit", "Policy when writing to stdout fails (exit, spool, fallback)")
+	keepColors := flag.Bool("keep-colors", false, "Keep SGR color sequences in a styled_output field alongside the plain output")
+	collapseProgress := flag.Bool("collapse-progress", false, "Collapse runs of progress lines in output into their final line")
+	countBells := flag.Bool("count-bells", false, "Add the number of terminal bells (BEL) rung by each command as a bell_count field")
+	tagVersion := flag.Bool("recorder-version", false, "Add the version of script2json to each record as a recorder_version field")
+	newline := flag.String("newline", pipeline.NewlineRaw, "Line endings in output (lf, crlf, raw)")
+	delMode := flag.String("del-mode", pipeline.DelModeBackspace, "How DEL (0x7F) edits the line (backspace, delete)")
+	termEmulation := flag.String("term-emulation", pipeline.TermEmulationHeuristic, "How terminal output is reconstructed (heuristic, full)")
+	termSize := flag.String("term-size", fmt.Sprintf("%dx%d", pipeline.DefaultTermCols, pipeline.DefaultTermRows), "Terminal size for -term-emulation=full, as COLSxROWS")
+	tabWidth := flag.Int("tab-width", pipeline.DefaultTabWidth, "Distance between tab stops used to expand tabs into spaces")
+	processorOrder := flag.String("processors", defaultProcessorOrder, "Order in which the enabled record processors run (filter, redact, wasm, transform, truncate)")
+	excludeCommand := flag.String("exclude-command", "", "Drop the records whose command matches this regular expression (optional)")
+	redact := flag.String("redact", "", "Replace matches of this regular expression in commands and output with [REDACTED] (optional)")
+	maxOutputBytes := flag.Int("max-output-bytes", 0, "Truncate output longer than this many bytes and mark the record output_truncated (0 disables)")
+	wasmFilter := flag.String("wasm-filter", "", "WebAssembly module that each record is run through in a sandbox; it may replace or drop the record, and is reloaded when the file changes (optional)")
+	transformCmd := flag.String("transform-cmd", "", "Shell command that each record is piped through as a JSON line; its JSON output replaces the record, and no output drops it (optional)")
+	transformTimeout := flag.Duration("transform-timeout", defaultTransformTimeout, "How long -transform-cmd may take over a record before the record is kept as it was")
+	altScreen := flag.String("alt-screen", pipeline.AltScreenDiscard, "What to do with full-screen programs' alternate screen: discard it, or keep its last contents in the output (discard, keep)")
+	outputFile := flag.String("output-file", "", "Append records to this file instead of stdout; the control APIs can switch or reopen it at runtime")
+	fallbackFile := flag.String("fallback-file", "", "File to write records to after a stdout failure with -on-output-error=fallback")
+	httpAddr := flag.String("http-addr", "", "Serve the HTTP control and status API on this address, e.g. 127.0.0.1:7071 (optional)")
+	httpOIDCIssuer := flag.String("http-oidc-issuer", "", "Accept HTTP API requests carrying a JWT from this OIDC issuer as a bearer token, checked against the keys it publishes (optional)")
+	httpOIDCAudience := flag.String("http-oidc-audience", "", "Audience that the tokens of -http-oidc-issuer must be issued for")
+	httpOIDCUserClaim := flag.String("http-oidc-user-claim", "sub", "Claim of the tokens of -http-oidc-issuer that names the local user, as a name or a uid, whose sessions a request sees")
+	httpTokenFile := flag.String("http-token-file", "", "Require HTTP API requests to carry one of the tokens in this file, one per line, as a bearer token; a token followed by user=<user> only sees that user's sessions")
+	signalSocket := flag.String("signal-socket", "", "Listen on this Unix socket for start, stop, flush, reset and annotate messages, in place of signals (optional)")
+	statusFile := flag.String("status-file", "", "Write the status, as reported by the status subcommand, to this file (optional)")
+	statusInterval := flag.Duration("status-interval", 5*time.Second, "Interval between rewrites of --status-file")
+	grpcSocket := flag.String("grpc-socket", "", "Serve the gRPC ControlService on this Unix socket (optional)")
+	grpcSocketMode := flag.String("grpc-socket-mode", "0600", "Permissions of -grpc-socket, in octal; other users that can connect only see and control the sessions they own")
+	daemon := flag.Bool("daemon", false, "Detach from the terminal and run in the background, writing records to the current stdout")
+	daemonLog := flag.String("daemon-log", "", "Append the log of --daemon to this file (default: discarded)")
+	drainTimeout := flag.Duration("shutdown-timeout", shutdownTimeout, "How long SIGINT and SIGTERM wait for the last records to be written before exiting (0 exits at once)")
+	check := flag.Bool("check", false, "Check the configuration, FIFOs, sinks and shell hook wiring, print a readiness report to stderr, and exit")
+	configFile := flag.String("config", "", "Read flag values from this file, one \"name = value\" per line; the reloadable ones are re-read on a reload control message")
+	profileName := flag.String("profile", "", "Preset of flag values: audit, dev, or minimal; other flags and the config file override its values (optional)")
+	force := flag.Bool("force", false, "Read the FIFOs even if another instance of script2json holds their locks")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	flag.Usage = captureUsage
+	flag.CommandLine.Parse(args)
+	if *showVersion {
+		fmt.Println(versionLine())
+		os.Exit(exitOK)
+	}
+
+	// Flags given on the command line take precedence over the environment, both
+	// over the config file, and all of them over the profile
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	envFlags, unknownEnv, err := applyEnvironment(flag.CommandLine, os.Environ(), setFlags)
+	if err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	for _, name := range envFlags {
+		setFlags[name] = true
+	}
+	var config map[string]string
+	if *configFile != "" {
+		if config, err = readConfigFile(*configFile); err != nil {
+			fatal(fmt.Errorf("%w: could not read config file: %v", errConfig, err))
+		}
+	}
+	if name, ok := config["profile"]; ok && !setFlags["profile"] {
+		*profileName = name
+	}
+	if *profileName != "" {
+		if err := applyProfile(flag.CommandLine, *profileName, setFlags); err != nil {
+			fatal(fmt.Errorf("%w: %v", errConfig, err))
+		}
+	}
+	if config != nil {
+		if err := applyConfig(flag.CommandLine, config, setFlags); err != nil {
+			fatal(fmt.Errorf("%w: %v", errConfig, err))
+		}
+	}
+
+	// Configure structured logging
+	level, err := parseLogLevel(*logLevel)
+	if err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	runtimeLogLevel.Set(level)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: &runtimeLogLevel,
+	}))
+	slog.SetDefault(logger)
+	for _, key := range unknownEnv {
+		logger.Warn("Ignoring environment variable that matches no flag", "variable", key)
+	}
+
+	if *format != "json" && *format != "pretty" {
+		fatal(fmt.Errorf("%w: invalid output format: %s. Must be json or pretty", errConfig, *format))
+	}
+	colorOut := os.Stdout
+	if *outputFile != "" {
+		// An output file is no terminal
+		colorOut = nil
+	}
+	color, err := colorEnabled(*colorMode, colorOut)
+	if err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	if err := validateTimeDisplay(*timeDisplay); err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	if err := validateFailurePolicy(*onOutputError, *fallbackFile); err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	setOutputConfig(*onOutputError, *fallbackFile)
+	if *delMode != pipeline.DelModeBackspace && *delMode != pipeline.DelModeDelete {
+		fatal(fmt.Errorf("%w: invalid DEL mode: %s. Must be backspace or delete", errConfig, *delMode))
+	}
+	if *newline != pipeline.NewlineLF && *newline != pipeline.NewlineCRLF && *newline != pipeline.NewlineRaw {
+		fatal(fmt.Errorf("%w: invalid newline mode: %s. Must be lf, crlf, or raw", errConfig, *newline))
+	}
+	if err := validateCommandFraming(*commandFraming); err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	if err := validateCommandProtocol(*commandProtocol); err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	if err := validateTermEmulation(*termEmulation); err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	if err := validateAltScreen(*altScreen); err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	termCols, termRows, err := parseTermSize(*termSize)
+	if err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	processors, err := buildProcessors(processorFlags{
+		order:            *processorOrder,
+		exclude:          *excludeCommand,
+		redact:           *redact,
+		maxOutputBytes:   *maxOutputBytes,
+		wasmFilter:       *wasmFilter,
+		transformCmd:     *transformCmd,
+		transformTimeout: *transformTimeout,
+	})
+	if err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	if *tabWidth < 1 {
+		fatal(fmt.Errorf("%w: invalid tab width: %d. Must be at least 1", errConfig, *tabWidth))
+	}
+	if *pauseBufferWindow < 0 {
+		fatal(fmt.Errorf("%w: invalid pause buffer: %s. Must not be negative", errConfig, *pauseBufferWindow))
+	}
+	if *drainTimeout < 0 {
+		fatal(fmt.Errorf("%w: invalid shutdown timeout: %s. Must not be negative", errConfig, *drainTimeout))
+	}
+	pauseWindow = *pauseBufferWindow
+	shutdownTimeout = *drainTimeout
+	markerBoundaries = *markers
+	forceFifoLocks = *force
+	for _, buffer := range []struct {
+		name string
+		size int
+	}{{"byte", *byteBuffer}, {"output", *outputBuffer}, {"command", *commandBuffer}} {
+		if err := validateBufferSize(buffer.name, buffer.size); err != nil {
+			fatal(fmt.Errorf("%w: %v", errConfig, err))
+		}
+	}
+	if err := validateOverflow(*overflowPolicy); err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+	byteBufferSize, outputBufferSize, commandBufferSize = *byteBuffer, *outputBuffer, *commandBuffer
+	overflow = *overflowPolicy
+	// The --session flags made their byte channels before the size was known
+	for _, sess := range sessions {
+		sess.scriptFifoByteChan = make(chan []byte, byteBufferSize)
+	}
+	if *statusFile != "" && *statusInterval <= 0 {
+		fatal(fmt.Errorf("%w: invalid status interval: %s. Must be positive", errConfig, *statusInterval))
+	}
+	grpcSocketPerm, err := parseSocketMode(*grpcSocketMode)
+	if err != nil {
+		fatal(fmt.Errorf("%w: %v", errConfig, err))
+	}
+
+	// In session mode, each session has its own pipeline instead of the FIFOs above
+	sessionMode := len(sessions) > 0 || *controlSocket != "" || *inputSocket != "" || *listenAddr != ""
+	if sessionMode && *useStdin {
+		fatal(fmt.Errorf("%w: --stdin cannot be combined with --session, --control-socket, --input-socket or --listen", errConfig))
+	}
+	var serialPath string
+	var serialBaud int
+	if *serialDevice != "" {
+		if sessionMode || *useStdin {
+			fatal(fmt.Errorf("%w: --serial cannot be combined with --stdin, --session, --control-socket, --input-socket or --listen", errConfig))
+		}
+		if serialPath, serialBaud, err = parseSerialSpec(*serialDevice); err != nil {
+			fatal(fmt.Errorf("%w: %v", errConfig, err))
+		}
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fatal(fmt.Errorf("%w: --tls-cert and --tls-key must be given together", errConfig))
+	}
+	if (*tlsCert != "" || *tlsClientCA != "") && *listenAddr == "" {
+		fatal(fmt.Errorf("%w: TLS flags require --listen", errConfig))
+	}
+	if *tlsClientCA != "" && *tlsCert == "" {
+		fatal(fmt.Errorf("%w: --tls-client-ca requires --tls-cert and --tls-key", errConfig))
+	}
+	if *httpTokenFile != "" && *httpAddr == "" {
+		fatal(fmt.Errorf("%w: --http-token-file requires --http-addr", errConfig))
+	}
+	if *httpOIDCIssuer != "" && *httpAddr == "" {
+		fatal(fmt.Errorf("%w: --http-oidc-issuer requires --http-addr", errConfig))
+	}
+	if (*httpOIDCIssuer == "") != (*httpOIDCAudience == "") {
+		fatal(fmt.Errorf("%w: --http-oidc-issuer and --http-oidc-audience must be given together", errConfig))
+	}
+	if *daemonLog != "" && !*daemon {
+		fatal(fmt.Errorf("%w: --daemon-log requires --daemon", errConfig))
+	}
+	var httpAuth httpAuthorizer
+	if *httpTokenFile != "" {
+		tokens, err := readTokenFile(*httpTokenFile)
+		if err != nil {
+			fatal(fmt.Errorf("%w: could not read HTTP tokens: %v", errConfig, err))
+		}
+		httpAuth = tokens
+	}
+	if *httpOIDCIssuer != "" {
+		oidc, err := newOIDCAuthorizer(*httpOIDCIssuer, *httpOIDCAudience, *httpOIDCUserClaim, &http.Client{Timeout: oidcTimeout}, logger)
+		if err != nil {
+			fatal(fmt.Errorf("%w: could not set up OIDC for the HTTP API: %v", errConfig, err))
+		}
+		if httpAuth != nil {
+			httpAuth = anyAuthorizer{httpAuth, oidc}
+		} else {
+			httpAuth = oidc
+		}
+	}
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		if tlsConfig, err = tlsListenerConfig(*tlsCert, *tlsKey, *tlsClientCA); err != nil {
+			fatal(fmt.Errorf("%w: %v", errConfig, err))
+		}
+	}
+
+	if *check {
+		opts := checkOptions{
+			stdin:           *useStdin,
+			serialPath:      serialPath,
+			pidFile:         *pidFile,
+			statusFile:      *statusFile,
+			outputFile:      *outputFile,
+			fallbackFile:    *fallbackFile,
+			force:           *force,
+			signals:         !sessionMode && !defaultSession(nil).markers,
+			controlMessages: *commandProtocol == commandProtocolJSON,
+			stdout:          os.Stdout,
+		}
+		if !sessionMode {
+			if !*useStdin && serialPath == "" {
+				opts.fifos = append(opts.fifos, [2]string{"script fifo", *scriptFifoPath})
+			}
+			opts.fifos = append(opts.fifos, [2]string{"command fifo", *commandFifoPath})
+		}
+		for _, sess := range sessions {
+			opts.fifos = append(opts.fifos, [2]string{sess.name + " script fifo", sess.scriptFifoPath}, [2]string{sess.name + " command fifo", sess.commandFifoPath})
+		}
+		for _, socket := range [][2]string{{"signal socket", *signalSocket}, {"control socket", *controlSocket}, {"input socket", *inputSocket}, {"grpc socket", *grpcSocket}} {
+			if socket[1] != "" {
+				opts.sockets = append(opts.sockets, socket)
+			}
+		}
+		for _, address := range [][2]string{{"http address", *httpAddr}, {"listen address", *listenAddr}} {
+			if address[1] != "" {
+				opts.addresses = append(opts.addresses, address)
+			}
+		}
+		results := runChecks(opts)
+		writeCheckReport(os.Stderr, results)
+		if failures := checkFailures(results); failures > 0 {
+			fatal(fmt.Errorf("%w: %d of %d checks failed", errConfig, failures, len(results)))
+		}
+		os.Exit(exitOK)
+	}
+	if !takeDaemonChildEnv() && *daemon {
+		if err := startDaemon(os.Args[1:], *pidFile, *daemonLog, logger); err != nil {
+			fatal(err)
+		}
+		os.Exit(exitOK)
+	}
+
+	if *outputFile != "" {
+		if err := switchSink(*outputFile); err != nil {
+			fatal(fmt.Errorf("%w: %v", errOutputFailed, err))
+		}
+	}
+
+	logger.Debug("Starting script2json", "script_fifo_path", *scriptFifoPath, "stdin", *useStdin, "serial", *serialDevice, "sessions", sessions.String())
+
+	var scriptTransport, commandTransport InputTransport
+	if !sessionMode {
+		scriptTransport = transportFor("", *scriptFifoPath)
+		if *useStdin {
+			scriptTransport = newMemoryTransport(os.Stdin)
+		}
+		if serialPath != "" {
+			scriptTransport = newSerialTransport(serialPath, serialBaud)
+		}
+		commandTransport = transportFor("", *commandFifoPath)
+		if err := scriptTransport.Create(logger); err != nil {
+			logger.Error("Error creating script FIFO", "error", err)
+			fatal(fmt.Errorf("%w: could not create script fifo: %v", errFIFOSetup, err))
+		}
+		if err := commandTransport.Create(logger); err != nil {
+			logger.Error("Error creating command FIFO", "error", err)
+			fatal(fmt.Errorf("%w: could not create command fifo: %v", errFIFOSetup, err))
+		}
+	}
+
+	// Write PID file if specified
+	if *pidFile != "" {
+		if err := writePidFile(*pidFile, logger); err != nil {
+			logger.Error("Error writing PID file", "error", err)
+			fatal(err)
+		}
+	}
+
+	editorOpts := editorOptions{
+		progressThreshold: *progressThreshold,
+		progressInterval:  *progressInterval,
+		EditorOptions: pipeline.EditorOptions{
+			TabWidth:      *tabWidth,
+			KeepColors:    *keepColors,
+			DelMode:       *delMode,
+			TermEmulation: *termEmulation,
+			TermCols:      termCols,
+			TermRows:      termRows,
+			AltScreen:     *altScreen,
+		},
+	}
+	recordOpts := recordOptions{
+		parseArgv:           *parseArgv,
+		format:              *format,
+		color:               color,
+		timeDisplay:         *timeDisplay,
+		summaryEvery:        *summaryEvery,
+		summaryInterval:     *summaryInterval,
+		outputFailurePolicy: *onOutputError,
+		fallbackFile:        *fallbackFile,
+		collapseProgress:    *collapseProgress,
+		newline:             *newline,
+		countBells:          *countBells,
+		processors:          processors,
+		hooks:               &events,
+	}
+	logEvents(&events, logger)
+	if *tagVersion {
+		recordOpts.recorderVersion = recorderVersion()
+	}
+
+	// startHTTP serves the HTTP API for the sessions in registry, if enabled
+	startHTTP := func(registry *sessionRegistry) {
+		if *httpAddr == "" {
+			return
+		}
+		l, err := activatedListener("http-addr", func() (net.Listener, error) { return net.Listen("tcp", *httpAddr) })
+		if err != nil {
+			logger.Error("Error listening for the HTTP API", "error", err)
+			fatal(err)
+		}
+		logger.Info("Serving HTTP API", "address", l.Addr().String(), "token", httpAuth != nil)
+		go serveHTTP(l, registry, httpAuth, logger)
+	}
+
+	// startSignalSocket listens for the signal socket's messages, if enabled
+	startSignalSocket := func(registry *sessionRegistry) {
+		if *signalSocket == "" {
+			return
+		}
+		l, err := activatedListener("signal-socket", func() (net.Listener, error) { return listenUnixSocket(*signalSocket, 0600) })
+		if err != nil {
+			logger.Error("Error listening on signal socket", "error", err)
+			fatal(err)
+		}
+		go serveSignalSocket(l, registry, logger)
+	}
+
+	// startGRPC serves the gRPC API for the sessions in registry, if enabled
+	startGRPC := func(registry *sessionRegistry) {
+		if *grpcSocket == "" {
+			return
+		}
+		l, err := activatedListener("grpc-socket", func() (net.Listener, error) { return listenUnixSocket(*grpcSocket, grpcSocketPerm) })
+		if err != nil {
+			logger.Error("Error listening for the gRPC API", "error", err)
+			fatal(err)
+		}
+		go serveGRPC(l, registry, grpcSocketPerm&0077 == 0, logger)
+	}
+
+	// startStatusFile keeps the status file of the sessions in registry current, if enabled
+	startStatusFile := func(registry *sessionRegistry) {
+		if *statusFile == "" {
+			return
+		}
+		go writeStatusFiles(*statusFile, *statusInterval, registry, logger)
+	}
+
+	// A reload leaves the sessions and their buffers running
+	reload := func() error {
+		if *configFile == "" {
+			return errors.New("no config file to reload; start with --config")
+		}
+		return reloadConfig(*configFile, flag.CommandLine, setFlags, logger)
+	}
+
+	// The pipelines run until a termination signal shuts them down
+	holdPipelines()
+	if sessionMode {
+		// Each session runs an independent pipeline; only their records share stdout
+		registry := newSessionRegistry()
+		start := func(sess *session) error {
+			return startSession(sess, registry, commandReaderOptions{framing: *commandFraming, protocol: *commandProtocol}, editorOpts, recordOpts, logger)
+		}
+		for _, sess := range sessions {
+			if err := start(sess); err != nil {
+				logger.Error("Error starting session", "session", sess.name, "error", err)
+				fatal(err)
+			}
+		}
+		if *controlSocket != "" {
+			// Only the current user may connect, since registered FIFOs are created with its permissions
+			l, err := activatedListener("control-socket", func() (net.Listener, error) { return listenUnixSocket(*controlSocket, 0600) })
+			if err != nil {
+				logger.Error("Error listening on control socket", "error", err)
+				fatal(err)
+			}
+			go serveControlSocket(l, registry, start, reload, logger)
+		}
+		if *inputSocket != "" {
+			// Anyone may connect; records identify the writer by its peer credentials
+			l, err := activatedListener("input-socket", func() (net.Listener, error) { return listenUnixSocket(*inputSocket, 0666) })
+			if err != nil {
+				logger.Error("Error listening on input socket", "error", err)
+				fatal(err)
+			}
+			go serveInputSocket(l, registry, editorOpts, recordOpts, logger)
+		}
+		if *listenAddr != "" {
+			l, err := activatedListener("listen", func() (net.Listener, error) { return net.Listen("tcp", *listenAddr) })
+			if err != nil {
+				logger.Error("Error listening for TCP input", "error", err)
+				fatal(err)
+			}
+			if tlsConfig != nil {
+				l = tls.NewListener(l, tlsConfig)
+			}
+			logger.Info("Listening for terminal byte streams", "address", l.Addr().String(), "tls", tlsConfig != nil)
+			go serveInputSocket(l, registry, editorOpts, recordOpts, logger)
+		}
+		startHTTP(registry)
+		startGRPC(registry)
+		startSignalSocket(registry)
+		startStatusFile(registry)
+		stopped := setupSignalHandling(registry, *pidFile, logger)
+		notifyDaemonReady()
+		<-stopped
+		cleanUp(*pidFile, logger)
+		return
+	}
+
+	// scriptFifoByteChan streams bytes from the script FIFO reader to the line editor.
+	scriptFifoByteChan := make(chan []byte, byteBufferSize)
+	// commandOutputChan sends the final, processed string from the line editor
+	// to the record creator.
+	commandOutputChan := make(chan commandOutput, outputBufferSize)
+	// commandChan streams command strings from the command FIFO reader to the record creator.
+	commandChan := make(chan commandInfo, commandBufferSize)
+
+	// Start the concurrent processing pipeline.
+	pipelines.run(func() { scriptFifoReader(scriptTransport, scriptFifoByteChan, logger) })
+	pipelines.run(func() {
+		commandFifoReader(commandTransport, commandChan, commandReaderOptions{
+			session:  defaultSession(scriptFifoByteChan),
+			framing:  *commandFraming,
+			protocol: *commandProtocol,
+		}, logger)
+	})
+	pipelines.run(func() { lineEditor(scriptFifoByteChan, commandOutputChan, editorOpts, logger) })
+	pipelines.run(func() { recordCreator(commandOutputChan, commandChan, recordOpts) })
+	events.FireSessionStart("")
+
+	sess := defaultSession(scriptFifoByteChan)
+	sess.scriptTransport, sess.commandTransport = scriptTransport, commandTransport
+	registry := newSessionRegistry(sess)
+	startHTTP(registry)
+	startGRPC(registry)
+	startSignalSocket(registry)
+	startStatusFile(registry)
+	stopped := setupSignalHandling(registry, *pidFile, logger)
+	notifyDaemonReady()
+
+	<-stopped
+	cleanUp(*pidFile, logger)
+}
+
+// cleanUp removes the PID file, if any, and releases the FIFOs' locks before exiting.
+func cleanUp(pidFilePath string, logger *slog.Logger) {
+	if pidFilePath != "" {
+		removePidFile(pidFilePath, logger)
+	}
+	releaseFifoLocks()
+}
+
+// writePidFile writes the current process ID to the specified file.
+// Returns an error if the file cannot be created or written to.
+func writePidFile(path string, logger *slog.Logger) error {
+	pid := os.Getpid()
+	pidStr := fmt.Sprintf("%d\n", pid)
+
+	if err := os.WriteFile(path, []byte(pidStr), 0644); err != nil {
+		return fmt.Errorf("could not write PID file: %w", err)
+	}
+
+	logger.Debug("PID file written", "path", path, "pid", pid)
+	return nil
+}
+
+// removePidFile removes the PID file at the specified path.
+// Logs a warning if the file cannot be removed, but does not return an error.
+func removePidFile(path string, logger *slog.Logger) {
+	if err := os.Remove(path); err != nil {
+		logger.Warn("Could not remove PID file", "path", path, "error", err)
+	} else {
+		logger.Debug("PID file removed", "path", path)
+	}
+}
+
+// setupSignalHandling sets up signal handlers for SIGUSR1, SIGUSR2, SIGHUP, and termination signals.
+// SIGUSR1 starts data processing by moving the session's state to Recording.
+// SIGUSR2 stops data processing by moving the state to Flushing and sends endOfOutput to scriptFifoByteChan.
+// SIGHUP resets the lineEditor state to recover from desync conditions.
+// SIGQUIT writes a DiagnosticRecord of the lineEditor state to stderr.
+// SIGUSR1 and SIGUSR2 only apply to signal-controlled sessions; SIGHUP and SIGQUIT apply to all sessions.
+// Termination signals (SIGINT, SIGTERM) shut the pipelines down (see shutdownPipelines) and
+// stop the handler, which closes the returned channel; a second one exits without waiting.
+// Windows has no SIGUSR1 or SIGUSR2 (see startReadingSignal), and only delivers SIGINT.
+// SIGPIPE is caught so that a closed stdout is reported as a write error instead of killing the process.
+func setupSignalHandling(registry *sessionRegistry, pidFilePath string, logger *slog.Logger) <-chan struct{} {
+	sigs := make(chan os.Signal, 1)
+	signals := []os.Signal{syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE}
+	if startReadingSignal != nil {
+		signals = append(signals, startReadingSignal, stopReadingSignal)
+	}
+	signal.Notify(sigs, signals...)
+
+	// exit cleans up and exits without waiting for the pipelines
+	exit := func() {
+		cleanUp(pidFilePath, logger)
+		os.Exit(exitOK)
+	}
+	shuttingDown := false
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for sig := range sigs {
+			switch sig {
+			case startReadingSignal:
+				logger.Debug("Received SIGUSR1, starting to process data")
+				for _, sess := range registry.list() {
+					// Marker-controlled sessions can't tell which one the signal is for
+					if !sess.markers {
+						startReading(sess)
+					}
+				}
+			case stopReadingSignal:
+				logger.Debug("Received SIGUSR2, stopping data processing")
+				for _, sess := range registry.list() {
+					if !sess.markers {
+						stopReading(sess)
+					}
+				}
+			case syscall.SIGHUP:
+				logger.Info("Received SIGHUP, resetting all pipeline state")
+				for _, sess := range registry.list() {
+					resetSession(sess)
+				}
+
+				logger.Info("Reset signals sent, all pipeline state will be cleared")
+			case syscall.SIGQUIT:
+				// Unlike Go's default SIGQUIT handling, keep running after the dump
+				logger.Info("Received SIGQUIT, writing diagnostic record to stderr")
+				for _, sess := range registry.list() {
+					select {
+					case sess.dumpChan <- os.Stderr:
+					default:
+						// Dump already pending
+					}
+				}
+			case syscall.SIGPIPE:
+				// Handling SIGPIPE turns broken pipe writes into errors for the output failure policy
+				logger.Debug("Received SIGPIPE, output consumer has gone away")
+			case syscall.SIGINT, syscall.SIGTERM:
+				if shuttingDown {
+					logger.Warn("Received second termination signal, exiting without draining", "signal", sig)
+					exit()
+				}
+				shuttingDown = true
+				logger.Debug("Received termination signal, shutting down", "signal", sig, "timeout", shutdownTimeout)
+				// Shutting down in the background lets a second signal cut it short
+				go func() {
+					if !shutdownPipelines(registry, shutdownTimeout) && shutdownTimeout > 0 {
+						logger.Warn("Timed out shutting down, exiting with records in flight", "timeout", shutdownTimeout)
+					}
+					// Ends the loop, since no more signals are sent
+					signal.Stop(sigs)
+					close(sigs)
+				}()
+			}
+		}
+	}()
+	return stopped
+}
+
+// startReading starts reading in sess, if it isn't already, along with the bytes
+// its pause buffer holds.
+func startReading(sess *session) {
+	sess.paused.start(sess)
+}
+
+// stopReading stops reading in sess and sends EOF to flush the current buffer. A
+// stop without a start is logged as an illegal transition, but still sends EOF, so
+// the command that the shell hooks write pairs with an empty output rather than
+// the next command's.
+func stopReading(sess *session) {
+	sess.state.Stop()
+	sess.scriptFifoByteChan <- endOfOutput
+}
+
+// flushReading sends EOF to sess, if it is reading, so that the output so far
+// becomes a record while reading continues.
+func flushReading(sess *session) {
+	if sess.recording() {
+		sess.scriptFifoByteChan <- endOfOutput
+	}
+}
+
+// resetSession clears the pipeline state of sess, such as after a desync.
+func resetSession(sess *session) {
+	// Stop reading to prevent corrupted data
+	wasReading := sess.state.Reset() == pipeline.StateRecording
+	sess.paused.discard()
+
+	// Send reset signal to lineEditor (non-blocking)
+	select {
+	case sess.resetChan <- struct{}{}:
+	default:
+		// Reset already pending
+	}
+
+	// Send reset signal to recordCreator (non-blocking)
+	select {
+	case sess.recordCreatorResetChan <- struct{}{}:
+	default:
+		// Reset already pending
+	}
+
+	// If we were reading, send EOF to flush current buffer
+	if wasReading {
+		sess.scriptFifoByteChan <- endOfOutput
+	}
+	events.FireReset(sess.name)
+}
+
+// scriptFifoReader opens the terminal byte stream of the script transport, usually
+// the script FIFO, reads it in chunks, and sends each chunk to the
+// scriptFifoByteChan when reading is enabled. When the writer closes it, such as
+// when script exits, the FIFO is reopened for the next writer, so a new script
+// session can be recorded without restarting. The scriptFifoByteChan is closed once
+// the transport is, such as at the end of --stdin.
+func scriptFifoReader(transport InputTransport, scriptFifoByteChan chan []byte, logger *slog.Logger) {
+	defer close(scriptFifoByteChan)
+
+	for {
+		f, err := transport.Open()
+		if errors.Is(err, errTransportClosed) {
+			return
+		}
+		if err != nil {
+			reportError(logger, pipeline.StageScript, fmt.Errorf("%w: %v", errFIFOSetup, err))
+			return
+		}
+
+		logger.Debug("Script FIFO opened for reading")
+		scriptStreamReader(f, scriptFifoByteChan, logger)
+		f.Close()
+		logger.Info("Script FIFO writer closed, will reopen")
+	}
+}
+
+// scriptStreamReader reads the terminal byte stream from r in chunks of up to
+// scriptReadSize and sends each to the scriptFifoByteChan when reading is enabled,
+// or to the pause buffer otherwise, until r is exhausted.
+func scriptStreamReader(r io.Reader, scriptFifoByteChan chan []byte, logger *slog.Logger) {
+	sess := defaultSession(scriptFifoByteChan)
+	// Without signals to start and stop reading, the stream carries integration markers
+	if sess.markers {
+		readMarkerStream(sess, r, io.Discard, nil, logger)
+		return
+	}
+
+	br := bufio.NewReaderSize(r, scriptReadSize)
+	for {
+		// Peek waits for a read, which fills as much of the buffer as is ready
+		if _, err := br.Peek(1); err != nil {
+			if err != io.EOF && !inputClosed(err) {
+				reportError(logger, pipeline.StageScript, fmt.Errorf("reading terminal byte stream: %w", err))
+			}
+			return
+		}
+		chunk, _ := br.Peek(br.Buffered())
+		sess.paused.feed(sess, chunk)
+		br.Discard(len(chunk))
+	}
+}
+
+// commandReaderOptions controls how commandFifoReader reads commands.
+type commandReaderOptions struct {
+	// session is the pipeline that JSON control messages start and stop reading for,
+	// and whose done channel stops the reader; it is required by the JSON protocol
+	session *session
+	// framing selects how commands are delimited (newline, nul, len)
+	framing string
+	// protocol selects whether each frame is a command or a ControlMessage (text, json)
+	protocol string
+}
+
+// commandFifoReader opens the command transport, usually the command FIFO, for each
+// writer in turn, splits what it reads into frames according to opts.framing, and
+// sends the command of each frame to the commandChan. With the JSON protocol, each
+// frame is a ControlMessage, which may also start or stop reading. It stops when the
+// transport is closed.
+func commandFifoReader(transport InputTransport, commandChan chan commandInfo, opts commandReaderOptions, logger *slog.Logger) {
+	defer close(commandChan)
+
+	logger.Debug("Command FIFO reader starting")
+
+	buf := make([]byte, 1024)
+	decoder := newCommandDecoder(opts.framing)
+	var done <-chan struct{}
+	stats := single.stats
+	if opts.session != nil {
+		done = opts.session.done
+		stats = opts.session.stats
+	}
+
+	for {
+		// Re-open the FIFO for each read session
+		f, err := transport.Open()
+		if errors.Is(err, errTransportClosed) {
+			logger.Debug("Command transport closed, command FIFO reader stopping")
+			break
+		}
+		if err != nil {
+			reportError(logger, pipeline.StageCommand, fmt.Errorf("opening command FIFO: %w", err))
+			break
+		}
+
+		logger.Debug("Command FIFO opened for reading")
+
+		// Read until EOF (writer closes)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				if err == io.EOF || inputClosed(err) {
+					logger.Debug("Command FIFO writer closed, will reopen")
+					break // Break inner loop to reopen FIFO
+				}
+				reportError(logger, pipeline.StageCommand, fmt.Errorf("reading command FIFO: %w", err))
+				f.Close()
+				return
+			}
+
+			frames, err := decoder.decode(buf[:n])
+			if err != nil {
+				logger.Warn("Malformed command framing", "framing", opts.framing, "error", err)
+			}
+			for _, frame := range frames {
+				if opts.protocol == commandProtocolJSON {
+					msg, err := parseControlMessage(frame)
+					if err != nil {
+						logger.Warn("Ignoring control message", "error", err)
+						continue
+					}
+					if !routeControlMessage(msg, opts.session, commandChan, done) {
+						f.Close()
+						return
+					}
+					logger.Debug("Routed control message", "event", msg.Event, "command", msg.Command)
+					continue
+				}
+				if !overflowSend(commandChan, commandInfo{command: frame}, &stats.droppedCommands, done) {
+					f.Close()
+					return
+				}
+				logger.Debug("Sent command to commandChan", "command", frame)
+			}
+		}
+
+		f.Close()
+		select {
+		case <-done:
+			logger.Debug("Session ended, command FIFO reader stopping")
+			return
+		default:
+			// Continue outer loop to reopen FIFO
+		}
+	}
+}
+
+// lineEditor reads chunks of bytes from scriptFifoByteChan and processes them into
+// a clean multi-line screen model, handling ANSI control sequences for cursor
+// movement, backspace, and alternate screen mode. When it receives endOfOutput, it
+// sends the cleaned screen contents to the commandOutputChan. If opts enables progress sampling,
+// the current line of long-running commands is sampled periodically and sent along
+// with the output. Can be reset via resetChan to recover from desync.
+func lineEditor(scriptFifoByteChan <-chan []byte, commandOutputChan chan commandOutput, opts editorOptions, logger *slog.Logger) {
+	var mu sync.Mutex
+	var progressSamples []pipeline.ProgressSample
+
+	sess := opts.session
+	if sess == nil {
+		sess = defaultSession(nil)
+	}
+
+	// emit sends a command's output along with its progress samples
+	emit := func(output pipeline.Output) {
+		output.ProgressSamples = progressSamples
+		// Not giving up on done: the output of a session's last command is still recorded
+		overflowSend(commandOutputChan, commandOutput{Output: output}, &sess.stats.droppedOutputs, nil)
+		progressSamples = nil
+	}
+	ed := pipeline.NewLineEditor(opts.EditorOptions, logger, emit)
+
+	// stop ends the helper goroutines when the byte stream ends, and lineEditor
+	// returns once they have
+	var helpers goroutines
+	defer helpers.Wait()
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// drainChannel drains all pending chunks from scriptFifoByteChan
+	drainChannel := func() {
+		drained := 0
+		for {
+			select {
+			case chunk := <-scriptFifoByteChan:
+				drained += len(chunk)
+			default:
+				logger.Debug("lineEditor channel drained", "bytes_discarded", drained)
+				return
+			}
+		}
+	}
+
+	// resetState clears all lineEditor state and drains input channel
+	resetState := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		ed.Reset()
+		progressSamples = nil
+		sess.stats.bufferBytes.Store(0)
+		logger.Debug("lineEditor state cleared")
+
+		// Drain any buffered bytes from the input channel
+		drainChannel()
+	}
+
+	// Start debug logging goroutine if debug level is enabled
+	helpers.run(func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+			mu.Lock()
+			state := ed.State()
+			mu.Unlock()
+
+			logger.Debug("lineEditor buffer state", "buffer", state.Buffer, "row", state.CursorRow, "col", state.CursorCol, "parse_errors", pipeline.ParseErrors())
+		}
+	})
+
+	// Start progress sampling goroutine if enabled
+	if opts.progressThreshold > 0 && opts.progressInterval > 0 {
+		helpers.run(func() {
+			ticker := time.NewTicker(opts.progressInterval)
+			defer ticker.Stop()
+			for {
+				var now time.Time
+				select {
+				case now = <-ticker.C:
+				case <-stop:
+					return
+				}
+				if !sess.recording() || now.Sub(sess.state.StartedAt()) < opts.progressThreshold {
+					continue
+				}
+
+				mu.Lock()
+				line := ed.ProgressLine()
+				if line != "" && (len(progressSamples) == 0 || progressSamples[len(progressSamples)-1].Line != line) {
+					progressSamples = append(progressSamples, pipeline.ProgressSample{Timestamp: now, Line: line})
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+	// Start goroutine to monitor for reset signals
+	helpers.run(func() {
+		for {
+			select {
+			case <-sess.resetChan:
+				resetState()
+			case <-stop:
+				return
+			}
+		}
+	})
+
+	// dumps is captured so that each lineEditor answers the requests made while it started
+	dumps := sess.dumpChan
+
+	// diagnose returns a snapshot of the reconstruction state
+	diagnose := func() DiagnosticRecord {
+		record := DiagnosticRecord{
+			Timestamp:     time.Now(),
+			Session:       sess.name,
+			Reading:       sess.recording(),
+			State:         sess.state.State().String(),
+			TermEmulation: cmp.Or(opts.TermEmulation, pipeline.TermEmulationHeuristic),
+			ParseErrors:   pipeline.ParseErrors(),
+		}
+		state := ed.State()
+		record.Buffer = state.Buffer
+		record.CursorRow, record.CursorCol = state.CursorRow, state.CursorCol
+		record.Overwrite = state.Overwrite
+		record.ScrollRegion = state.ScrollRegion
+		record.AlternateScreen = state.AlternateScreen
+		record.PendingCR = state.PendingCR
+		record.ParserState = state.ParserState
+		record.PendingSequence = state.PendingSequence
+		return record
+	}
+
+	// process hands chunk to the editor, or flushes the output at endOfOutput
+	process := func(chunk []byte) {
+		eof := len(chunk) == 0
+		if eof {
+			sess.stats.bufferBytes.Store(0)
+		} else {
+			sess.stats.bufferBytes.Add(int64(len(chunk)))
+			sess.stats.bytesProcessed.Add(uint64(len(chunk)))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !eof {
+			ed.Write(chunk)
+			return
+		}
+		ed.End()
+		sess.state.Flushed()
+	}
+
+	for {
+		select {
+		case w := <-dumps:
+			mu.Lock()
+			record := diagnose()
+			mu.Unlock()
+			if err := writeDiagnosticRecord(w, record); err != nil {
+				logger.Error("Error writing diagnostic record", "error", err)
+			}
+		case drained := <-sess.drainChan:
+			// The session has stopped reading, so the bytes still buffered are the last
+			for pending := true; pending; {
+				select {
+				case chunk, ok := <-scriptFifoByteChan:
+					if ok {
+						process(chunk)
+					}
+					pending = ok
+				default:
+					pending = false
+				}
+			}
+			// Unlike outputs, the request is never dropped
+			commandOutputChan <- commandOutput{drained: drained}
+		case chunk, ok := <-scriptFifoByteChan:
+			if !ok {
+				close(commandOutputChan)
+				return
+			}
+			process(chunk)
+		}
+	}
+}
+
+// recordCreator creates CommandRecord instances from output and command data.
+// It sets a monotonically increasing ID, return timestamp, copies data from commandOutputChan
+// into the Output field, and reads from commandChan into the Command field.
+// Optional fields are populated according to opts, and SummaryRecords are interleaved
+// every opts.summaryEvery records and/or every opts.summaryInterval.
+// Can be reset via recordCreatorResetChan to drain stale data. It flushes its output
+// and returns once commandOutputChan is closed.
+func recordCreator(commandOutputChan <-chan commandOutput, commandChan <-chan commandInfo, opts recordOptions) {
+	sess := opts.session
+	if sess == nil {
+		sess = defaultSession(nil)
+	}
+
+	// stop ends the reset goroutine when commandOutputChan is closed, and
+	// recordCreator returns once it has
+	var helpers goroutines
+	defer helpers.Wait()
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Start goroutine to monitor for reset signals
+	helpers.run(func() {
+	resets:
+		for {
+			select {
+			case <-sess.recordCreatorResetChan:
+			case <-stop:
+				return
+			}
+			// Drain commandOutputChan
+			outputDrained := 0
+			for {
+				select {
+				case <-commandOutputChan:
+					outputDrained++
+				default:
+					slog.Debug("recordCreator commandOutputChan drained", "items_discarded", outputDrained)
+					goto drainCommands
+				}
+			}
+
+		drainCommands:
+			// Drain commandChan
+			commandDrained := 0
+			for {
+				select {
+				case <-commandChan:
+					commandDrained++
+				default:
+					slog.Debug("recordCreator commandChan drained", "items_discarded", commandDrained)
+					slog.Info("recordCreator channels drained", "outputs_discarded", outputDrained, "commands_discarded", commandDrained)
+					continue resets
+				}
+			}
+		}
+	})
+
+	logger := slog.Default()
+	if sess.name != "" {
+		logger = logger.With("session", sess.name)
+	}
+	sink := newRecordSink(opts)
+	writeOutput := func(data []byte) {
+		if err := sink.write(data); err != nil {
+			reportError(logger, pipeline.StageSink, err)
+		}
+	}
+
+	summaries := newSummaryAggregator(time.Now())
+	emitSummary := func(now time.Time) {
+		summary := summaries.flush(now)
+		summary.Session = sess.name
+		if opts.format == "pretty" {
+			writeOutput([]byte(formatPrettySummary(summary, opts)))
+			return
+		}
+		jsonData, err := json.Marshal(summary)
+		if err != nil {
+			reportError(logger, pipeline.StageRecord, fmt.Errorf("marshaling summary: %w", err))
+			return
+		}
+		writeOutput(append(jsonData, '\n'))
+	}
+
+	var summaryTick <-chan time.Time
+	if opts.summaryInterval > 0 {
+		ticker := time.NewTicker(opts.summaryInterval)
+		defer ticker.Stop()
+		summaryTick = ticker.C
+	}
+
+	emitAnnotation := func(text string) {
+		annotation := AnnotationRecord{Type: "annotation", Timestamp: time.Now(), Session: sess.name, OwnerUID: sess.owner, Text: text}
+		if opts.format == "pretty" {
+			writeOutput([]byte(formatPrettyAnnotation(annotation, opts)))
+			return
+		}
+		jsonData, err := json.Marshal(annotation)
+		if err != nil {
+			reportError(logger, pipeline.StageRecord, fmt.Errorf("marshaling annotation: %w", err))
+			return
+		}
+		writeOutput(append(jsonData, '\n'))
+	}
+
+	// drain finishes up at shutdown: the commands left without output are reported,
+	// a summary of the records since the last one is written if summaries are on,
+	// and the output is flushed before drained is closed
+	drain := func(drained chan struct{}) {
+		commandsDiscarded := 0
+		for pending := true; pending; {
+			select {
+			case _, ok := <-commandChan:
+				if ok {
+					commandsDiscarded++
+				}
+				pending = ok
+			default:
+				pending = false
+			}
+		}
+		if commandsDiscarded > 0 {
+			slog.Warn("Commands without output discarded at shutdown", "session", sess.name, "commands", commandsDiscarded)
+		}
+		if (opts.summaryEvery > 0 || opts.summaryInterval > 0) && summaries.count > 0 {
+			emitSummary(time.Now())
+		}
+		sink.Flush()
+		close(drained)
+	}
+
+	for {
+		var output commandOutput
+		select {
+		case now := <-summaryTick:
+			emitSummary(now)
+			continue
+		case text := <-sess.annotations:
+			emitAnnotation(text)
+			continue
+		case out, ok := <-commandOutputChan:
+			if !ok {
+				sink.Flush()
+				return
+			}
+			output = out
+		}
+		if output.drained != nil {
+			drain(output.drained)
+			continue
+		}
+
+		// Read the corresponding command
+		var command commandInfo
+		select {
+		case command = <-commandChan:
+			// Got a command
+		default:
+			// No command available, use empty string
+		}
+
+		record := newCommandRecord(command.command, output.Output, time.Now(), opts)
+		record.ExitCode = command.exitCode
+		record.Cwd = command.cwd
+		if command.euid != nil && *command.euid == 0 {
+			record.Privileged = true
+		}
+		processed, ok := opts.processors.Process(record)
+		if !ok {
+			opts.hooks.FireDrop(record, pipeline.DropFiltered)
+			continue
+		}
+		record = processed
+
+		if err := sink.Emit(record); errors.Is(err, errOutputFailed) {
+			reportError(logger, pipeline.StageSink, err)
+			continue
+		} else if err != nil {
+			reportError(logger, pipeline.StageRecord, fmt.Errorf("marshaling record: %w", err))
+			continue
+		}
+
+		sess.stats.records.Add(1)
+		sess.stats.lastRecordAt.Store(record.ReturnTimestamp.UnixNano())
+		opts.hooks.FireRecord(record)
+
+		var duration time.Duration
+		if start := sess.state.StartedAt(); !start.IsZero() {
+			duration = record.ReturnTimestamp.Sub(start)
+		}
+		summaries.add(record, duration)
+		if opts.summaryEvery > 0 && summaries.count >= opts.summaryEvery {
+			emitSummary(time.Now())
+		}
+	}
+}
+
+// newCommandRecord builds the record for a command and its cleaned output with the
+// pipeline package's RecordCreator, and tags it with the session.
+func newCommandRecord(command string, output pipeline.Output, returned time.Time, opts recordOptions) pipeline.CommandRecord {
+	record := pipeline.NewRecordCreator(opts.pipelineOptions()).Create(command, output, returned)
+	if opts.session != nil {
+		record.Session = opts.session.name
+		record.Peer = opts.session.peer
+		record.OwnerUID = opts.session.owner
+		record.Host = opts.session.host
+		record.Container = opts.session.container
+		record.Kubernetes = opts.session.kubernetes
+	}
+	return record
+}
+
+// pipelineOptions returns the options of the RecordCreator that builds records,
+// numbering them with recordID.
+func (o recordOptions) pipelineOptions() pipeline.RecordOptions {
+	return pipeline.RecordOptions{
+		ParseArgv:        o.parseArgv,
+		CollapseProgress: o.collapseProgress,
+		Newline:          o.newline,
+		CountBells:       o.countBells,
+		RecorderVersion:  o.recorderVersion,
+		IDs:              &recordID,
+	}
+}
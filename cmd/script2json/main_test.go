@@ -0,0 +1,1705 @@
+package main
+
+// Generated-By: Claude 4 Sonnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestLineEditorBasicInput tests basic character input handling
+func TestLineEditorBasicInput(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError, // Suppress debug logs during tests
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// Send "hello" followed by EOF
+	scriptFifoByteChan <- []byte("hello")
+	scriptFifoByteChan <- endOfOutput
+
+	// Wait for output
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "hello" {
+			t.Errorf("Output = %q, want %q", output.Text, "hello")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorChunks tests that chunk boundaries don't split characters or
+// escape sequences, and that the session's bytes are counted per chunk
+func TestLineEditorChunks(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	sess := newSession("chunks", "", "")
+	commandOutputChan := make(chan commandOutput, 1)
+	go lineEditor(sess.scriptFifoByteChan, commandOutputChan, editorOptions{session: sess}, logger)
+
+	stream := "caf\xc3\xa9 \x1b[1mbold\x1b[0m"
+	sess.scriptFifoByteChan <- []byte(stream[:4])
+	sess.scriptFifoByteChan <- []byte(stream[4:8])
+	sess.scriptFifoByteChan <- []byte(stream[8:])
+	sess.scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "café bold" {
+			t.Errorf("Output = %q, want %q", output.Text, "café bold")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+	if got := sess.stats.bytesProcessed.Load(); got != uint64(len(stream)) {
+		t.Errorf("Bytes processed = %d, want %d", got, len(stream))
+	}
+	if got := sess.stats.bufferBytes.Load(); got != 0 {
+		t.Errorf("Buffered bytes = %d after the output, want 0", got)
+	}
+}
+
+// TestLineEditorEOFByte tests that only endOfOutput ends an output, not an EOF
+// byte in the data
+func TestLineEditorEOFByte(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	scriptFifoByteChan := make(chan []byte, 4)
+	commandOutputChan := make(chan commandOutput, 2)
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	scriptFifoByteChan <- []byte("before\x04after")
+	scriptFifoByteChan <- endOfOutput
+	close(scriptFifoByteChan)
+
+	var outputs []string
+	for output := range commandOutputChan {
+		outputs = append(outputs, output.Text)
+	}
+	if expected := []string{"beforeafter"}; !slices.Equal(outputs, expected) {
+		t.Errorf("Outputs = %q, want %q", outputs, expected)
+	}
+}
+
+// TestLineEditorBackspace tests backspace handling
+func TestLineEditorBackspace(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// Send "helloX" then DEL (delete last character)
+	scriptFifoByteChan <- []byte("helloX")
+	scriptFifoByteChan <- []byte{pipeline.DEL}
+	scriptFifoByteChan <- endOfOutput
+
+	// Wait for output
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "hello" {
+			t.Errorf("Output = %q, want %q", output.Text, "hello")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorAlternateScreen tests alternate screen mode filtering
+func TestLineEditorAlternateScreen(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// Send "before"
+	scriptFifoByteChan <- []byte("before")
+
+	// Enter alternate screen mode (ESC[?1049h)
+	scriptFifoByteChan <- []byte{pipeline.ESC}
+	scriptFifoByteChan <- []byte{pipeline.CSI}
+	scriptFifoByteChan <- []byte("?1049h")
+
+	// Send garbage that should be ignored
+	scriptFifoByteChan <- []byte("GARBAGE")
+
+	// Exit alternate screen mode (ESC[?1049l)
+	scriptFifoByteChan <- []byte{pipeline.ESC}
+	scriptFifoByteChan <- []byte{pipeline.CSI}
+	scriptFifoByteChan <- []byte("?1049l")
+
+	// Send "after"
+	scriptFifoByteChan <- []byte("after")
+
+	scriptFifoByteChan <- endOfOutput
+
+	// Wait for output
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "beforeafter" {
+			t.Errorf("Output = %q, want %q", output.Text, "beforeafter")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorCursorMovement tests arrow key cursor movement
+func TestLineEditorCursorMovement(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// Type "helo"
+	scriptFifoByteChan <- []byte("helo")
+
+	// Move left twice (ESC[D)
+	for i := 0; i < 2; i++ {
+		scriptFifoByteChan <- []byte{pipeline.ESC}
+		scriptFifoByteChan <- []byte{pipeline.CSI}
+		scriptFifoByteChan <- []byte{pipeline.ARROW_LEFT}
+	}
+
+	// Insert 'l'
+	scriptFifoByteChan <- []byte{'l'}
+
+	scriptFifoByteChan <- endOfOutput
+
+	// Wait for output
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "hello" {
+			t.Errorf("Output = %q, want %q", output.Text, "hello")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorParameterizedCursorMovement tests cursor moves with a count, as emitted by readline
+func TestLineEditorParameterizedCursorMovement(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// Type "hello world", jump back 5 columns and insert "big "
+	scriptFifoByteChan <- []byte("hello world\x1b[5Dbig ")
+	scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "hello big world" {
+			t.Errorf("Output = %q, want %q", output.Text, "hello big world")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorTabs tests expansion of tabs to the next tab stop
+func TestLineEditorTabs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		tabWidth int
+		expected string
+	}{
+		{name: "Default width", input: "a\tb", expected: "a       b"},
+		{name: "Already at a tab stop", input: "12345678\tx", expected: "12345678        x"},
+		{name: "Custom width", input: "ab\tc\td", tabWidth: 4, expected: "ab  c   d"},
+		{name: "Columns across lines", input: "PID\tCMD\n1\tinit", tabWidth: 4, expected: "PID CMD\n1   init"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{EditorOptions: pipeline.EditorOptions{TabWidth: tt.tabWidth}}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorMultiLineRedraw tests that redrawing earlier lines replaces them in place
+func TestLineEditorMultiLineRedraw(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// Draw two status lines, move up two lines, and fill in the results
+	// the way multi-line progress displays do
+	scriptFifoByteChan <- []byte("a: \nb: \n\x1b[2A\x1b[C\x1b[C\x1b[Cok\x1b[B\x1b[2;4Hfail\x1b[3;1Hend")
+	scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		expected := "a: ok\nb: fail\nend"
+		if output.Text != expected {
+			t.Errorf("Output = %q, want %q", output.Text, expected)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorEraseLine tests that text erased with CSI K does not reach the output
+func TestLineEditorEraseLine(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// A spinner that clears its line before printing the final status
+	scriptFifoByteChan <- []byte("Working...\r\x1b[KDone\n")
+	scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "Done\n" {
+			t.Errorf("Output = %q, want %q", output.Text, "Done\n")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorCarriageReturn tests that bare carriage returns redraw the current line
+func TestLineEditorCarriageReturn(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Progress bar collapses to final frame",
+			input:    "Downloading 10%\rDownloading 55%\rDownloading 100%\r\ndone\r\n",
+			expected: "Downloading 100%\r\ndone\r\n",
+		},
+		{
+			name:     "Shorter redraw leaves the tail like a terminal",
+			input:    "abcdef\rxy\r\n",
+			expected: "xycdef\r\n",
+		},
+		{
+			name:     "Bare newline is preserved",
+			input:    "one\ntwo\r\n",
+			expected: "one\ntwo\r\n",
+		},
+		{
+			name:     "Trailing carriage return",
+			input:    "50%\r100%\r",
+			expected: "100%",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+				Level: slog.LevelError,
+			}))
+
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorProgressSamples tests sampling the current line of a long-running command
+func TestLineEditorProgressSamples(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	// A command that has run past the threshold by the first sample
+	single.state.Start()
+	defer single.state.Reset()
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{
+		progressThreshold: time.Millisecond,
+		progressInterval:  20 * time.Millisecond,
+	}, logger)
+
+	for _, frame := range []string{"Downloading 10%", "\rDownloading 50%"} {
+		scriptFifoByteChan <- []byte(frame)
+		time.Sleep(100 * time.Millisecond)
+	}
+	scriptFifoByteChan <- []byte("\rDownloading 100%\r\n")
+	scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "Downloading 100%\r\n" {
+			t.Errorf("Output = %q, want %q", output.Text, "Downloading 100%\r\n")
+		}
+		// Repeated samples of an unchanged line are collapsed
+		var lines []string
+		for _, sample := range output.ProgressSamples {
+			lines = append(lines, sample.Line)
+		}
+		if len(lines) != 2 || lines[0] != "Downloading 10%" || lines[1] != "Downloading 50%" {
+			t.Errorf("Progress samples = %q, want %q", lines, []string{"Downloading 10%", "Downloading 50%"})
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorOSC tests that OSC strings are stripped and hyperlinks are extracted
+func TestLineEditorOSC(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      string
+		expectedLinks []string
+	}{
+		{
+			name:     "Window title terminated by BEL",
+			input:    "\x1b]0;user@host: ~\x07$ ls\r\n",
+			expected: "$ ls\r\n",
+		},
+		{
+			name:     "Window title terminated by ST",
+			input:    "\x1b]2;title\x1b\\done",
+			expected: "done",
+		},
+		{
+			name:          "Hyperlinks are extracted once each",
+			input:         "\x1b]8;;file:///tmp/a.txt\x1b\\a.txt\x1b]8;;\x1b\\ \x1b]8;id=1;https://example.com\x07site\x1b]8;;\x07 \x1b]8;;file:///tmp/a.txt\x07a\x1b]8;;\x07",
+			expected:      "a.txt site a",
+			expectedLinks: []string{"file:///tmp/a.txt", "https://example.com"},
+		},
+		{
+			name:     "Escape sequence aborts OSC string",
+			input:    "\x1b]0;title\x1b[32mgreen",
+			expected: "green",
+		},
+		{
+			name:     "Unterminated OSC string does not swallow EOF",
+			input:    "out\x1b]0;never terminated",
+			expected: "out",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+				Level: slog.LevelError,
+			}))
+
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+				if !slices.Equal(output.Links, tt.expectedLinks) {
+					t.Errorf("Links = %q, want %q", output.Links, tt.expectedLinks)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorNonASCII tests that bytes outside the ASCII range are preserved
+func TestLineEditorNonASCII(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// UTF-8 "café" followed by ISO-8859-1 "café"
+	scriptFifoByteChan <- []byte("caf\xc3\xa9 caf\xe9")
+	scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "caf\xc3\xa9 caf\xe9" {
+			t.Errorf("Output = %q, want %q", output.Text, "caf\xc3\xa9 caf\xe9")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorUTF8Editing tests that multibyte characters are edited as single characters
+func TestLineEditorUTF8Editing(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Backspace removes whole character", input: "na\u00efve\b\b\bive", expected: "naive"},
+		{name: "Cursor left over multibyte characters", input: "\u65e5\u672c\x1b[D\x1b[DX", expected: "X\u65e5\u672c"},
+		{name: "Counted cursor move", input: "\u00fcber\u00e9\x1b[5DZ", expected: "Z\u00fcber\u00e9"},
+		{name: "Carriage return overwrites characters", input: "\u2588\u2588\u2591\u2591\r\u2588\u2588\u2588", expected: "\u2588\u2588\u2588\u2591"},
+		{name: "Tab stops count characters", input: "\u00e9\tx", expected: "\u00e9       x"},
+		{name: "Erase to end of line", input: "d\u00e9j\u00e0\x1b[2D\x1b[K", expected: "d\u00e9"},
+		{name: "Emoji", input: "ok \U0001f44d\bdone", expected: "ok done"},
+		{name: "Invalid bytes are single characters", input: "caf\xe9\b\xe8s", expected: "caf\xe8s"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorKeepColors tests that SGR sequences are kept in the styled output only
+func TestLineEditorKeepColors(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		keepColors     bool
+		expected       string
+		expectedStyled string
+	}{
+		{
+			name:     "Colors stripped by default",
+			input:    "\x1b[31merror\x1b[0m: failed",
+			expected: "error: failed",
+		},
+		{
+			name:           "Colors kept",
+			input:          "\x1b[1;31merror\x1b[0m: failed\r\nok",
+			keepColors:     true,
+			expected:       "error: failed\r\nok",
+			expectedStyled: "\x1b[1;31merror\x1b[0m: failed\r\nok",
+		},
+		{
+			name:           "Backspace keeps colors of remaining text",
+			input:          "\x1b[32mab\x1b[0m\bX",
+			keepColors:     true,
+			expected:       "aX",
+			expectedStyled: "\x1b[32ma\x1b[0mX",
+		},
+		{
+			name:           "Colors overwritten by a redraw",
+			input:          "\x1b[33m50%\x1b[0m\r\x1b[32m100%\x1b[0m",
+			keepColors:     true,
+			expected:       "100%",
+			expectedStyled: "\x1b[33m\x1b[32m100\x1b[0m%\x1b[0m",
+		},
+		{
+			name:           "Alternate screen colors discarded",
+			input:          "before\x1b[?1049h\x1b[7mvim\x1b[?1049lafter",
+			keepColors:     true,
+			expected:       "beforeafter",
+			expectedStyled: "beforeafter",
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{EditorOptions: pipeline.EditorOptions{KeepColors: tt.keepColors}}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+				if output.Styled != tt.expectedStyled {
+					t.Errorf("Styled output = %q, want %q", output.Styled, tt.expectedStyled)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorBracketedPaste tests that paste markers are stripped and the paste is noted
+func TestLineEditorBracketedPaste(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	scriptFifoByteChan <- []byte("\x1b[200~echo one\necho two\x1b[201~")
+	scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "echo one\necho two" {
+			t.Errorf("Output = %q, want %q", output.Text, "echo one\necho two")
+		}
+		if !output.Pasted {
+			t.Error("Expected output to be marked as pasted")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+
+	// The flag does not carry over to the next command
+	scriptFifoByteChan <- []byte("typed")
+	scriptFifoByteChan <- endOfOutput
+
+	select {
+	case output := <-commandOutputChan:
+		if output.Pasted {
+			t.Error("Expected output without a paste not to be marked as pasted")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+}
+
+// TestLineEditorSaveRestoreCursor tests DECSC/DECRC and CSI s/u
+func TestLineEditorSaveRestoreCursor(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "DECSC and DECRC", input: "prompt \x1b7\x1b[3;1Hstatus\x1b8cmd", expected: "prompt cmd\n\nstatus"},
+		{name: "CSI s and u", input: "ab\x1b[s\r\nline 2\x1b[ucd", expected: "abcd\r\nline 2"},
+		{name: "Restore without save goes to origin", input: "world\x1b8hello ", expected: "hello world"},
+		{name: "CSI s with parameters is ignored", input: "ab\x1b[1;5s\x1b[Dx\x1b[u", expected: "axb"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorScrollRegion tests output that scrolls inside a fixed region
+func TestLineEditorScrollRegion(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			// A header on row 1 with a two-line log window below it
+			name:     "Newline scrolls region",
+			input:    "header\n\n\x1b[2;3r\x1b[2;1Hone\ntwo\nthree\nfour",
+			expected: "header\nthree\nfour",
+		},
+		{
+			name:     "Reverse index scrolls region down",
+			input:    "one\ntwo\nthree\x1b[2;3r\x1b[2;1H\x1bMzero",
+			expected: "one\nzero\ntwo",
+		},
+		{
+			name:     "Index keeps column",
+			input:    "ab\x1bDc",
+			expected: "ab\n  c",
+		},
+		{
+			name:     "Alternate screen does not move the cursor",
+			input:    "ab\x1b[?1049h\x1b[5;1H\x1b7\x1bMvim\x1b[?1049lc",
+			expected: "abc",
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorNonCSIEscapes tests that two- and three-byte escapes don't leak into the output
+func TestLineEditorNonCSIEscapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Charset selection", input: "\x1b(Bplain\x1b)0", expected: "plain"},
+		{name: "Keypad modes", input: "\x1b=app\x1b>", expected: "app"},
+		{name: "Save and restore cursor", input: "a\x1b7b\x1b8c", expected: "acb"},
+		{name: "OSC", input: "\x1b]0;title\x07text", expected: "text"},
+		{name: "Line size", input: "\x1b#8wide", expected: "wide"},
+		{name: "Output ending in an escape", input: "done\x1b(", expected: "done"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorDelete tests DEL modes and the CSI 3~ delete sequence
+func TestLineEditorDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		delMode  string
+		expected string
+	}{
+		{name: "DEL is backspace by default", input: "abc\x1b[D\x7f", expected: "ac"},
+		{name: "DEL as backspace", input: "abc\x1b[D\x7f", delMode: pipeline.DelModeBackspace, expected: "ac"},
+		{name: "DEL as forward delete", input: "abc\x1b[D\x7f", delMode: pipeline.DelModeDelete, expected: "ab"},
+		{name: "Forward delete at end of line", input: "abc\x7f", delMode: pipeline.DelModeDelete, expected: "abc"},
+		{name: "CSI 3~ deletes under the cursor", input: "abcd\x1b[D\x1b[D\x1b[D\x1b[3~", expected: "acd"},
+		{name: "CSI 3~ with modifier", input: "ab\x1b[D\x1b[D\x1b[3;5~", expected: "b"},
+		{name: "Other editing keys are ignored", input: "ab\x1b[D\x1b[2~\x1b[5~", expected: "ab"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{EditorOptions: pipeline.EditorOptions{DelMode: tt.delMode}}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorReadlineEditing tests mid-line edits as echoed by readline
+func TestLineEditorReadlineEditing(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		// Typing "X" in the middle of a line in overwrite-after-CR mode
+		{name: "Insert via CSI @", input: "git comit\r\x1b[7C\x1b[@m", expected: "git commit"},
+		// Deleting characters with the delete key
+		{name: "Delete via CSI P", input: "echo helllo\x1b[3D\x1b[P", expected: "echo hello"},
+		{name: "Delete word via CSI P", input: "ls -la /tmp\x1b[8D\x1b[4P", expected: "ls /tmp"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorKill tests the readline kill control characters
+func TestLineEditorKill(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Ctrl-U kills the whole line", input: "rm -rf /\x15ls", expected: "ls"},
+		{name: "Ctrl-U kills up to the cursor", input: "echo foo bar\x1b[3D\x15", expected: "bar"},
+		{name: "VT is a line feed rather than Ctrl-K", input: "echo foo bar\x1b[4D\x0bls", expected: "echo foo bar\nls"},
+		{name: "Ctrl-W kills a word", input: "git push --force\x17", expected: "git push "},
+		{name: "Ctrl-W skips trailing spaces", input: "git push  \x17\x17status", expected: "status"},
+		{name: "Ctrl-W mid-line", input: "cat foo.txt bar\x1b[4D\x17", expected: "cat  bar"},
+		{name: "Ctrl-W on UTF-8", input: "echo caf\xc3\xa9\x17x", expected: "echo x"},
+		{name: "Only the cursor line is affected", input: "first\r\nsecond\x15third", expected: "first\r\nthird"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorMouseReports tests that xterm mouse reports are dropped from output,
+// with the heuristic model and with full terminal emulation
+func TestLineEditorMouseReports(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "SGR press and release", input: "ls\x1b[<0;12;5M\x1b[<0;12;5m -l", expected: "ls -l"},
+		{name: "SGR wheel", input: "a\x1b[<64;1;1Mb", expected: "ab"},
+		{name: "Legacy report", input: "ls\x1b[M #! -l", expected: "ls -l"},
+		{name: "Legacy report with high bytes", input: "x\x1b[M\xc3\xa9\xffy", expected: "xy"},
+		{name: "Legacy report cut off by EOF", input: "done\x1b[M ", expected: "done"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, emulation := range []string{pipeline.TermEmulationHeuristic, pipeline.TermEmulationFull} {
+		for _, tt := range tests {
+			t.Run(emulation+"/"+tt.name, func(t *testing.T) {
+				scriptFifoByteChan := make(chan []byte, 1024)
+				commandOutputChan := make(chan commandOutput, 1)
+
+				opts := editorOptions{EditorOptions: pipeline.EditorOptions{KeepColors: true, TermEmulation: emulation}}
+				go lineEditor(scriptFifoByteChan, commandOutputChan, opts, logger)
+
+				scriptFifoByteChan <- []byte(tt.input)
+				scriptFifoByteChan <- endOfOutput
+
+				select {
+				case output := <-commandOutputChan:
+					if output.Text != tt.expected {
+						t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+					}
+					// The full emulator discards colors, so it has no styled output
+					if emulation == pipeline.TermEmulationHeuristic && output.Styled != tt.expected {
+						t.Errorf("Styled output = %q, want %q", output.Styled, tt.expected)
+					}
+				case <-time.After(1 * time.Second):
+					t.Fatal("Timeout waiting for output")
+				}
+				close(scriptFifoByteChan)
+			})
+		}
+	}
+}
+
+// TestLineEditorInlineImages tests that sixel and other image payloads are dropped from output
+func TestLineEditorInlineImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Sixel", input: "before\x1bPq#0;2;0;0;0#0~~@@vv@@~~-\x1b\\after", expected: "beforeafter"},
+		{name: "Sixel with parameters", input: "a\x1bP0;1;0q\"1;1;4;4#0!4~\x1b\\b", expected: "ab"},
+		{name: "iTerm2 image", input: "a\x1b]1337;File=inline=1:iVBORw0KGgo=\x07b", expected: "ab"},
+		{name: "Kitty graphics", input: "a\x1b_Gf=100,a=T;iVBORw0KGgo=\x1b\\b", expected: "ab"},
+		{name: "Escape aborts string", input: "a\x1bPq#0~~\x1b[31mb", expected: "ab"},
+		{name: "Unterminated string ends at EOF", input: "done\x1bPq#0~~", expected: "done"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorResumesAfterImage tests that commands after an image are unaffected
+func TestLineEditorResumesAfterImage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	for _, input := range []string{"\x1bPq#0~~-\x1b\\img\r\n", "next"} {
+		scriptFifoByteChan <- []byte(input)
+		scriptFifoByteChan <- endOfOutput
+	}
+
+	for _, expected := range []string{"img\r\n", "next"} {
+		select {
+		case output := <-commandOutputChan:
+			if output.Text != expected {
+				t.Errorf("Output = %q, want %q", output.Text, expected)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("Timeout waiting for output")
+		}
+	}
+	close(scriptFifoByteChan)
+}
+
+// TestLineEditorUnterminatedCSI tests recovery from CSI sequences that never terminate
+func TestLineEditorUnterminatedCSI(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	before := pipeline.ParseErrors()
+	inputs := []string{
+		// An overlong sequence is abandoned up to its final byte, and the following
+		// bytes are output
+		"\x1b[" + string(bytes.Repeat([]byte{';'}, pipeline.MaxCSILength)) + "mok",
+		// The end of the output ends a truncated sequence, so the next command is
+		// not swallowed
+		"abc\x1b[12",
+		"next",
+	}
+	for _, input := range inputs {
+		scriptFifoByteChan <- []byte(input)
+		scriptFifoByteChan <- endOfOutput
+	}
+
+	for _, expected := range []string{"ok", "abc", "next"} {
+		select {
+		case output := <-commandOutputChan:
+			if output.Text != expected {
+				t.Errorf("Output = %q, want %q", output.Text, expected)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("Timeout waiting for output")
+		}
+	}
+	close(scriptFifoByteChan)
+
+	if errors := pipeline.ParseErrors() - before; errors != 2 {
+		t.Errorf("Parse errors = %d, want 2", errors)
+	}
+}
+
+// TestLineEditorControlCharacters tests that BEL, FF, SO and SI are stripped and bells counted
+func TestLineEditorControlCharacters(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      string
+		expectedBells int
+	}{
+		{name: "Bell", input: "ls nosuch\x07\x07", expected: "ls nosuch", expectedBells: 2},
+		{name: "Form feed", input: "page1\x0cpage2", expected: "page1page2"},
+		{name: "Shift out and in", input: "\x0eqqq\x0f ok", expected: "qqq ok"},
+		{name: "OSC terminator is not a bell", input: "\x1b]0;title\x07prompt", expected: "prompt"},
+		{name: "Bells in the alternate screen are ignored", input: "\x1b[?1049h\x07\x1b[?1049lok\x07", expected: "ok", expectedBells: 1},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+				if output.Bells != tt.expectedBells {
+					t.Errorf("Bells = %d, want %d", output.Bells, tt.expectedBells)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorHomeEnd tests Home and End key sequence variants
+func TestLineEditorHomeEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "CSI H", input: "world\x1b[Hhello ", expected: "hello world"},
+		{name: "CSI 1~", input: "world\x1b[1~hello ", expected: "hello world"},
+		{name: "CSI 7~", input: "world\x1b[7~hello ", expected: "hello world"},
+		{name: "SS3 H", input: "world\x1bOHhello ", expected: "hello world"},
+		{name: "CSI F", input: "hello\x1b[1~\x1b[F world", expected: "hello world"},
+		{name: "CSI 4~", input: "hello\x1b[1~\x1b[4~ world", expected: "hello world"},
+		{name: "CSI 8~", input: "hello\x1b[1~\x1b[8~ world", expected: "hello world"},
+		{name: "SS3 F", input: "hello\x1bOH\x1bOF world", expected: "hello world"},
+		{name: "Home on a later line", input: "one\r\nworld\x1b[1~hello ", expected: "one\r\nhello world"},
+		{name: "CSI F with count is previous line", input: "one\r\ntwo\x1b[1Fzero ", expected: "zero one\r\ntwo"},
+		{name: "Other SS3 keys are dropped", input: "ab\x1bOA\x1bOPc", expected: "abc"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorC1CSI tests the 8-bit CSI introducer
+func TestLineEditorC1CSI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Colors", input: "\x9b31mred\x9b0m", expected: "red"},
+		{name: "Cursor movement", input: "helo\x9bDl", expected: "hello"},
+		{name: "Erase line", input: "Working\r\x9bKDone", expected: "Done"},
+		// U+011B (e with caron) is encoded as C4 9B
+		{name: "UTF-8 continuation byte", input: "\xc4\x9bx", expected: "\xc4\x9bx"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFifoByteChan := make(chan []byte, 1024)
+			commandOutputChan := make(chan commandOutput, 1)
+
+			go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+			scriptFifoByteChan <- []byte(tt.input)
+			scriptFifoByteChan <- endOfOutput
+
+			select {
+			case output := <-commandOutputChan:
+				if output.Text != tt.expected {
+					t.Errorf("Output = %q, want %q", output.Text, tt.expected)
+				}
+			case <-time.After(1 * time.Second):
+				t.Fatal("Timeout waiting for output")
+			}
+			close(scriptFifoByteChan)
+		})
+	}
+}
+
+// TestLineEditorReset tests the reset functionality
+func TestLineEditorReset(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 2)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+
+	// Send "garbage" and EOF to create first output
+	scriptFifoByteChan <- []byte("garbage")
+	scriptFifoByteChan <- endOfOutput
+
+	// Wait for first output to be processed
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "garbage" {
+			t.Errorf("First output = %q, want %q", output.Text, "garbage")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for first output")
+	}
+
+	// Now send reset signal to clear state for next command
+	select {
+	case single.resetChan <- struct{}{}:
+	default:
+		t.Fatal("Reset channel is full")
+	}
+
+	// Give the reset a moment to process
+	time.Sleep(100 * time.Millisecond)
+
+	// Send "hello" followed by EOF
+	scriptFifoByteChan <- []byte("hello")
+	scriptFifoByteChan <- endOfOutput
+
+	// Wait for second output - should only get "hello" (no garbage)
+	select {
+	case output := <-commandOutputChan:
+		if output.Text != "hello" {
+			t.Errorf("Second output = %q, want %q (reset did not clear buffer properly)", output.Text, "hello")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timeout waiting for second output")
+	}
+}
+
+// TestLineEditorDiagnostic tests the diagnostic record of the reconstruction state
+func TestLineEditorDiagnostic(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	// Use a fresh channel so that lineEditors left running by other tests don't answer
+	oldDumpChan := single.dumpChan
+	single.dumpChan = make(chan io.Writer, 1)
+	defer func() { single.dumpChan = oldDumpChan }()
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+	defer close(scriptFifoByteChan)
+
+	scriptFifoByteChan <- []byte("one\r\nabc\r\x1b[12")
+
+	// Give lineEditor a moment to process the input
+	time.Sleep(100 * time.Millisecond)
+
+	r, w, _ := os.Pipe()
+	defer r.Close()
+	single.dumpChan <- w
+	line := make([]byte, 4096)
+	n, err := r.Read(line)
+	w.Close()
+	if err != nil {
+		t.Fatalf("Failed to read diagnostic record: %v", err)
+	}
+
+	// The carriage return is still pending because the CSI sequence is incomplete
+	var record DiagnosticRecord
+	if err := json.Unmarshal(line[:n], &record); err != nil {
+		t.Fatalf("Failed to parse diagnostic record: %v\nOutput: %s", err, line[:n])
+	}
+	expected := DiagnosticRecord{
+		Type:            "diagnostic",
+		TermEmulation:   pipeline.TermEmulationHeuristic,
+		Buffer:          "one\r\nabc",
+		CursorRow:       1,
+		CursorCol:       3,
+		PendingCR:       true,
+		ParserState:     "csi_param",
+		PendingSequence: "12",
+	}
+	record.Timestamp, record.Reading, record.State, record.ParseErrors = time.Time{}, false, "", 0
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("Diagnostic record = %+v, want %+v", record, expected)
+	}
+}
+
+// TestRecordCreator tests the record creation pipeline
+func TestRecordCreator(t *testing.T) {
+	// Reset recordID counter for predictable test results
+	recordID.Store(0)
+
+	commandOutputChan := make(chan commandOutput, 1)
+	commandChan := make(chan commandInfo, 1)
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		recordCreator(commandOutputChan, commandChan, recordOptions{stdout: &buf})
+		close(done)
+	}()
+
+	// Send a command and output
+	commandChan <- commandInfo{command: "echo hello"}
+	commandOutputChan <- commandOutput{Output: pipeline.Output{Text: "hello\r\n"}}
+
+	close(commandOutputChan)
+	<-done
+	output := buf.String()
+
+	// Parse JSON
+	var record pipeline.CommandRecord
+	err := json.Unmarshal([]byte(output), &record)
+	if err != nil {
+		t.Fatalf("Failed to parse JSON output: %v\nOutput: %s", err, output)
+	}
+
+	// Verify fields
+	if record.ID != "1" {
+		t.Errorf("ID = %q, want %q", record.ID, "1")
+	}
+	if record.Command != "echo hello" {
+		t.Errorf("Command = %q, want %q", record.Command, "echo hello")
+	}
+	if record.Output != "hello\r\n" {
+		t.Errorf("Output = %q, want %q", record.Output, "hello\r\n")
+	}
+}
+
+// TestRecordCreatorSummaryEvery tests that summary records follow every N command records
+func TestRecordCreatorSummaryEvery(t *testing.T) {
+	recordID.Store(0)
+
+	commandOutputChan := make(chan commandOutput, 1)
+	commandChan := make(chan commandInfo, 1)
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		recordCreator(commandOutputChan, commandChan, recordOptions{summaryEvery: 2, stdout: &buf})
+		close(done)
+	}()
+
+	for _, output := range []string{"one\r\n", "two\r\n", "three\r\n"} {
+		commandOutputChan <- commandOutput{Output: pipeline.Output{Text: output}}
+	}
+
+	close(commandOutputChan)
+	<-done
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+
+	// Expect: record, record, summary, record
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 lines, got %d\nOutput: %s", len(lines), buf.String())
+	}
+
+	var summary SummaryRecord
+	if err := json.Unmarshal(lines[2], &summary); err != nil {
+		t.Fatalf("Failed to parse summary JSON: %v", err)
+	}
+	if summary.Type != "summary" {
+		t.Errorf("Line 3 type = %q, want %q", summary.Type, "summary")
+	}
+	if summary.CommandCount != 2 {
+		t.Errorf("CommandCount = %d, want 2", summary.CommandCount)
+	}
+	if summary.OutputBytes != len("one\r\ntwo\r\n") {
+		t.Errorf("OutputBytes = %d, want %d", summary.OutputBytes, len("one\r\ntwo\r\n"))
+	}
+
+	var record pipeline.CommandRecord
+	if err := json.Unmarshal(lines[3], &record); err != nil {
+		t.Fatalf("Failed to parse record JSON: %v", err)
+	}
+	if record.Output != "three\r\n" {
+		t.Errorf("Last record output = %q, want %q", record.Output, "three\r\n")
+	}
+}
+
+// TestRecordCreatorBellCount tests that bell_count is only set with countBells
+func TestRecordCreatorBellCount(t *testing.T) {
+	for _, countBells := range []bool{false, true} {
+		t.Run(strconv.FormatBool(countBells), func(t *testing.T) {
+			commandOutputChan := make(chan commandOutput, 1)
+			commandChan := make(chan commandInfo, 1)
+
+			var buf bytes.Buffer
+			done := make(chan struct{})
+			go func() {
+				recordCreator(commandOutputChan, commandChan, recordOptions{countBells: countBells, stdout: &buf})
+				close(done)
+			}()
+
+			commandChan <- commandInfo{command: "cd nosuch"}
+			commandOutputChan <- commandOutput{Output: pipeline.Output{Text: "no such directory\r\n", Bells: 1}}
+
+			close(commandOutputChan)
+			<-done
+
+			var record map[string]any
+			if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &record); err != nil {
+				t.Fatalf("Failed to parse record JSON: %v\nOutput: %s", err, buf.String())
+			}
+			bellCount, ok := record["bell_count"]
+			if ok != countBells {
+				t.Errorf("bell_count present = %v, want %v", ok, countBells)
+			}
+			if countBells && bellCount != 1.0 {
+				t.Errorf("bell_count = %v, want 1", bellCount)
+			}
+		})
+	}
+}
+
+// TestRecordCreatorCollapseProgress tests that progress frames are collapsed when enabled
+func TestRecordCreatorCollapseProgress(t *testing.T) {
+	commandOutputChan := make(chan commandOutput, 1)
+	commandChan := make(chan commandInfo, 1)
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		recordCreator(commandOutputChan, commandChan, recordOptions{collapseProgress: true, stdout: &buf})
+		close(done)
+	}()
+
+	commandChan <- commandInfo{command: "curl -O https://example.com/file"}
+	commandOutputChan <- commandOutput{Output: pipeline.Output{Text: "file  1%\r\nfile 50%\r\nfile 100%\r\nsaved\r\n"}}
+
+	close(commandOutputChan)
+	<-done
+
+	var record pipeline.CommandRecord
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &record); err != nil {
+		t.Fatalf("Failed to parse record JSON: %v\nOutput: %s", err, buf.String())
+	}
+	if record.Output != "file 100%\r\nsaved\r\n" {
+		t.Errorf("Output = %q, want %q", record.Output, "file 100%\r\nsaved\r\n")
+	}
+	if record.ProgressFramesCollapsed != 2 {
+		t.Errorf("ProgressFramesCollapsed = %d, want 2", record.ProgressFramesCollapsed)
+	}
+}
+
+// TestRecordCreatorReset tests that the recordCreator can be reset
+func TestRecordCreatorReset(t *testing.T) {
+	// This test verifies that sending a reset signal will drain the channels
+	commandOutputChan := make(chan commandOutput, 10)
+	commandChan := make(chan commandInfo, 10)
+
+	go recordCreator(commandOutputChan, commandChan, recordOptions{})
+
+	// Send stale data that should be drained
+	for i := 0; i < 5; i++ {
+		commandChan <- commandInfo{command: fmt.Sprintf("stale command %d", i)}
+		commandOutputChan <- commandOutput{Output: pipeline.Output{Text: fmt.Sprintf("stale output %d", i)}}
+	}
+
+	// Verify channels have data
+	if len(commandChan) == 0 {
+		t.Fatal("Test setup error: commandChan should have data")
+	}
+	if len(commandOutputChan) == 0 {
+		t.Fatal("Test setup error: commandOutputChan should have data")
+	}
+
+	// Send reset signal
+	select {
+	case single.recordCreatorResetChan <- struct{}{}:
+	default:
+		t.Fatal("single.recordCreatorResetChan is full")
+	}
+
+	// Give reset time to drain the channels
+	time.Sleep(200 * time.Millisecond)
+
+	// Verify channels were drained
+	commandChanLen := len(commandChan)
+	outputChanLen := len(commandOutputChan)
+
+	if commandChanLen > 0 {
+		t.Errorf("commandChan still has %d items after reset", commandChanLen)
+	}
+	if outputChanLen > 0 {
+		t.Errorf("commandOutputChan still has %d items after reset", outputChanLen)
+	}
+}
+
+// TestRecordIDIncrement tests the monotonic record ID counter
+func TestRecordIDIncrement(t *testing.T) {
+	recordID.Store(0)
+
+	var wg sync.WaitGroup
+	const goroutines = 10
+	const incrementsPerGoroutine = 100
+
+	// Increment from multiple goroutines concurrently
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrementsPerGoroutine; j++ {
+				recordID.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	expected := uint64(goroutines * incrementsPerGoroutine)
+	if recordID.Load() != expected {
+		t.Errorf("recordID = %d, want %d", recordID.Load(), expected)
+	}
+}
+
+// TestWritePidFile tests PID file creation
+func TestWritePidFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Create temp directory
+	tmpDir, err := os.MkdirTemp("", "script2json-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pidPath := fmt.Sprintf("%s/test.pid", tmpDir)
+
+	// Write PID file
+	err = writePidFile(pidPath, logger)
+	if err != nil {
+		t.Fatalf("writePidFile failed: %v", err)
+	}
+
+	// Read and verify
+	data, err := os.ReadFile(pidPath)
+	if err != nil {
+		t.Fatalf("Failed to read PID file: %v", err)
+	}
+
+	expectedPid := fmt.Sprintf("%d\n", os.Getpid())
+	if string(data) != expectedPid {
+		t.Errorf("PID file content = %q, want %q", string(data), expectedPid)
+	}
+}
+
+// TestRemovePidFile tests PID file removal
+func TestRemovePidFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	// Create temp directory
+	tmpDir, err := os.MkdirTemp("", "script2json-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pidPath := fmt.Sprintf("%s/test.pid", tmpDir)
+
+	// Write PID file
+	err = writePidFile(pidPath, logger)
+	if err != nil {
+		t.Fatalf("writePidFile failed: %v", err)
+	}
+
+	// Remove it
+	removePidFile(pidPath, logger)
+
+	// Verify it's gone
+	_, err = os.Stat(pidPath)
+	if !os.IsNotExist(err) {
+		t.Error("PID file should not exist after removal")
+	}
+}
+
+// TestSignalHandlingSetup tests that signal handling can be set up without panic
+func TestSignalHandlingSetup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+
+	// Create temp PID file
+	tmpDir, err := os.MkdirTemp("", "script2json-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pidPath := fmt.Sprintf("%s/test.pid", tmpDir)
+
+	// This should not panic
+	handleSignals(t, defaultSession(scriptFifoByteChan), pidPath, logger)
+}
+
+// handleSignals sets up signal handling for sess until the test ends. The handler
+// can't be stopped, so its registry is emptied then, and signals that later tests
+// send leave sess and its channels alone.
+func handleSignals(t *testing.T, sess *session, pidFilePath string, logger *slog.Logger) {
+	registry := newSessionRegistry(sess)
+	setupSignalHandling(registry, pidFilePath, logger)
+	t.Cleanup(func() {
+		registry.mu.Lock()
+		defer registry.mu.Unlock()
+		registry.sessions = nil
+	})
+}
+
+// TestScriptStreamReader tests that bytes are forwarded only while reading and the channel is closed at the end of the stream
+func TestScriptStreamReader(t *testing.T) {
+	defer single.state.Reset()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, enabled := range []bool{true, false} {
+		if single.state.Reset(); enabled {
+			single.state.Start()
+		}
+		scriptFifoByteChan := make(chan []byte, 16)
+		go func() {
+			scriptStreamReader(bytes.NewReader([]byte("hello\r\n")), scriptFifoByteChan, logger)
+			close(scriptFifoByteChan)
+		}()
+
+		var got []byte
+		timeout := time.After(1 * time.Second)
+	collect:
+		for {
+			select {
+			case chunk, ok := <-scriptFifoByteChan:
+				if !ok {
+					break collect
+				}
+				got = append(got, chunk...)
+			case <-timeout:
+				t.Fatal("Timed out waiting for the channel to close")
+			}
+		}
+
+		expected := ""
+		if enabled {
+			expected = "hello\r\n"
+		}
+		if string(got) != expected {
+			t.Errorf("Reading %v: got %q, want %q", enabled, got, expected)
+		}
+	}
+}
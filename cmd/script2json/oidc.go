@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcTimeout is how long fetching the discovery document or the keys of an OIDC
+// issuer may take.
+const oidcTimeout = 10 * time.Second
+
+// oidcLeeway is the clock skew allowed when checking a token's exp and nbf times.
+const oidcLeeway = time.Minute
+
+// oidcKeyRefreshInterval is how often a token signed with an unknown key can make
+// the issuer's keys be fetched again, so that keys are picked up after a rotation
+// without made-up key ids sending a request to the issuer each.
+const oidcKeyRefreshInterval = time.Minute
+
+// maxOIDCDocumentBytes limits the size of the discovery document and key set.
+const maxOIDCDocumentBytes = 1 << 20
+
+// errOIDCToken is wrapped by the reasons a bearer token is refused.
+var errOIDCToken = errors.New("invalid OIDC token")
+
+// oidcAuthorizer accepts requests carrying a JWT from an OIDC issuer as a bearer
+// token. The token must be signed with one of the keys the issuer publishes, be
+// issued by it for the audience, and be current. The user claim names the local
+// user, as a name or a uid, whose sessions the request is limited to, as for a
+// token of the --http-token-file; root and the user running script2json see every
+// session.
+type oidcAuthorizer struct {
+	issuer   string
+	audience string
+	claim    string
+	jwksURL  string
+	client   *http.Client
+	logger   *slog.Logger
+
+	mu sync.Mutex
+	// keys are the issuer's signing keys by key id
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// newOIDCAuthorizer returns an oidcAuthorizer for tokens of issuer, an https URL,
+// whose discovery document and keys it fetches with client.
+func newOIDCAuthorizer(issuer, audience, claim string, client *http.Client, logger *slog.Logger) (*oidcAuthorizer, error) {
+	if u, err := url.Parse(issuer); err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("issuer %q is not an https URL", issuer)
+	}
+	a := &oidcAuthorizer{issuer: issuer, audience: audience, claim: claim, client: client, logger: logger}
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := a.fetch(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	// The issuer of the document must be the one it was fetched from (OpenID
+	// Connect Discovery 1.0, section 4.3)
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, not %q", discovery.Issuer, issuer)
+	}
+	if u, err := url.Parse(discovery.JWKSURI); err != nil || u.Scheme != "https" {
+		return nil, fmt.Errorf("jwks_uri %q is not an https URL", discovery.JWKSURI)
+	}
+	a.jwksURL = discovery.JWKSURI
+	if err := a.refreshKeys(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *oidcAuthorizer) authorize(r *http.Request) (*int, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, false
+	}
+	uid, err := a.verify(token, time.Now())
+	if err != nil {
+		a.logger.Debug("Refused HTTP API request", "error", err)
+		return nil, false
+	}
+	return scopeFor(uid), true
+}
+
+// verify checks token at time now, and returns the uid of the user its claim names.
+func (a *oidcAuthorizer) verify(token string, now time.Time) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%w: not a signed JWT", errOIDCToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return 0, fmt.Errorf("%w: header: %v", errOIDCToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, fmt.Errorf("%w: signature: %v", errOIDCToken, err)
+	}
+	key, err := a.key(header.Kid)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return 0, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return 0, fmt.Errorf("%w: claims: %v", errOIDCToken, err)
+	}
+	if iss, _ := claims["iss"].(string); iss != a.issuer {
+		return 0, fmt.Errorf("%w: issued by %q", errOIDCToken, iss)
+	}
+	if !hasAudience(claims["aud"], a.audience) {
+		return 0, fmt.Errorf("%w: not issued for audience %q", errOIDCToken, a.audience)
+	}
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return 0, fmt.Errorf("%w: no exp claim", errOIDCToken)
+	}
+	if !now.Before(exp.Add(oidcLeeway)) {
+		return 0, fmt.Errorf("%w: expired at %s", errOIDCToken, exp.Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(oidcLeeway).Before(nbf) {
+		return 0, fmt.Errorf("%w: not valid before %s", errOIDCToken, nbf.Format(time.RFC3339))
+	}
+
+	var name string
+	switch value := claims[a.claim].(type) {
+	case string:
+		name = value
+	case json.Number:
+		name = value.String()
+	default:
+		return 0, fmt.Errorf("%w: no %s claim naming a user", errOIDCToken, a.claim)
+	}
+	uid, err := lookupUID(name)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s claim: %v", errOIDCToken, a.claim, err)
+	}
+	return uid, nil
+}
+
+// key returns the issuer's key with the given id, fetching the keys again if it is
+// unknown and they haven't been fetched in the last oidcKeyRefreshInterval.
+func (a *oidcAuthorizer) key(kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(a.fetchedAt) >= oidcKeyRefreshInterval {
+		if err := a.fetchKeys(); err != nil {
+			a.logger.Warn("Could not fetch the OIDC issuer's keys", "url", a.jwksURL, "error", err)
+		} else if key, ok := a.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", errOIDCToken, kid)
+}
+
+// refreshKeys fetches the issuer's keys.
+func (a *oidcAuthorizer) refreshKeys() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.fetchKeys()
+}
+
+// fetchKeys replaces the keys with the issuer's current key set. Keys that aren't
+// for signatures, or of an unsupported type, are left out. a.mu must be held.
+func (a *oidcAuthorizer) fetchKeys() error {
+	a.fetchedAt = time.Now()
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := a.fetch(a.jwksURL, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			a.logger.Debug("Skipping OIDC issuer key", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%s has no usable signing keys", a.jwksURL)
+	}
+	a.keys = keys
+	return nil
+}
+
+// fetch decodes the JSON document at url into v.
+func (a *oidcAuthorizer) fetch(url string, v any) error {
+	resp, err := a.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOIDCDocumentBytes)).Decode(v); err != nil {
+		return fmt.Errorf("%s: %v", url, err)
+	}
+	return nil
+}
+
+// jsonWebKey is an RSA or EC public key of a JSON Web Key Set (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// N and E are the modulus and exponent of an RSA key
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X and Y are the curve and point of an EC key
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey returns the key as an *rsa.PublicKey or an *ecdsa.PublicKey.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64BigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("modulus: %v", err)
+		}
+		e, err := base64BigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent %q", k.E)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve := jwkCurves[k.Crv]
+		if curve == nil {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64BigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %v", err)
+		}
+		y, err := base64BigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %v", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// jwkCurves are the curves of EC keys by their JWK name.
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// jwtAlgorithm is a signature algorithm of a JWT (RFC 7518, section 3): its hash
+// and, for ECDSA, the curve of the key it goes with.
+type jwtAlgorithm struct {
+	hash  crypto.Hash
+	curve string
+}
+
+// jwtAlgorithms are the accepted algorithms. Only the RSA and ECDSA ones are: "none"
+// needs no key, and an HMAC one would take the public key for a shared secret.
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"PS256": {hash: crypto.SHA256},
+	"PS384": {hash: crypto.SHA384},
+	"PS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, curve: "P-256"},
+	"ES384": {hash: crypto.SHA384, curve: "P-384"},
+	"ES512": {hash: crypto.SHA512, curve: "P-521"},
+}
+
+// verifyJWTSignature checks the signature of the signed part of a JWT made with
+// alg and key.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	algorithm, ok := jwtAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", errOIDCToken, alg)
+	}
+	h := algorithm.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	var err error
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case algorithm.curve != "":
+			return fmt.Errorf("%w: algorithm %q for an RSA key", errOIDCToken, alg)
+		case strings.HasPrefix(alg, "PS"):
+			err = rsa.VerifyPSS(pub, algorithm.hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			err = rsa.VerifyPKCS1v15(pub, algorithm.hash, digest, signature)
+		}
+	case *ecdsa.PublicKey:
+		if algorithm.curve != pub.Curve.Params().Name {
+			return fmt.Errorf("%w: algorithm %q for a %s key", errOIDCToken, alg, pub.Curve.Params().Name)
+		}
+		// The signature is r and s of the curve's size, one after the other
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("%w: signature of %d bytes", errOIDCToken, len(signature))
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			err = errors.New("verification error")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: signature: %v", errOIDCToken, err)
+	}
+	return nil
+}
+
+// decodeJWTPart decodes a base64url-encoded JSON part of a JWT into v, keeping
+// numbers as json.Number.
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(strings.NewReader(string(data)))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// base64BigInt decodes a base64url-encoded unsigned big-endian integer.
+func base64BigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// hasAudience reports whether the aud claim, a string or an array of them,
+// includes audience.
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// numericDate returns the time of a NumericDate claim, seconds since the epoch.
+func numericDate(value any) (time.Time, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	// Fractions of a second are dropped, and dates beyond the range of exact
+	// integers in a float64 are refused
+	seconds, err := n.Float64()
+	if err != nil || math.Abs(seconds) > 1<<53 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIssuer is an OIDC issuer serving its discovery document and keys over TLS,
+// and signing tokens with them.
+type testIssuer struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	mu     sync.Mutex
+	// jwks is the key set served, which tests may replace to rotate keys
+	jwks []map[string]string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	iss.jwks = []map[string]string{rsaJWK("rsa1", &rsaKey.PublicKey), ecJWK("ec1", &ecKey.PublicKey)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": iss.server.URL, "jwks_uri": iss.server.URL + "/keys"})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": iss.jwks})
+	})
+	iss.server = httptest.NewTLSServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// sign returns a JWT with the given header and claims, signed with key for alg.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestOIDCAuthorizer tests that tokens are checked against the issuer's keys and
+// claims, and limited to the sessions of the user they name
+func TestOIDCAuthorizer(t *testing.T) {
+	iss := newTestIssuer(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	auth, err := newOIDCAuthorizer(iss.server.URL, "script2json", "sub", iss.server.Client(), logger)
+	if err != nil {
+		t.Fatalf("newOIDCAuthorizer failed: %v", err)
+	}
+
+	other := processUID + 1000
+	now := time.Now()
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{"iss": iss.server.URL, "aud": "script2json", "sub": fmt.Sprint(other), "exp": now.Add(time.Hour).Unix()}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+		return c
+	}
+	valid := sign(t, "RS256", "rsa1", iss.rsaKey, claims(nil))
+	tests := []struct {
+		name  string
+		token string
+		scope *int
+		ok    bool
+	}{
+		{name: "RS256", token: valid, scope: &other, ok: true},
+		{name: "ES256", token: sign(t, "ES256", "ec1", iss.ecKey, claims(nil)), scope: &other, ok: true},
+		{name: "Audience in a list", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"aud": []string{"other", "script2json"}})), scope: &other, ok: true},
+		{name: "User running script2json sees every session", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"sub": processUID})), ok: true},
+		{name: "Expired", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()}))},
+		{name: "No expiry", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"exp": nil}))},
+		{name: "Not yet valid", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}))},
+		{name: "Other audience", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"aud": "other"}))},
+		{name: "Other issuer", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"iss": "https://evil.example"}))},
+		{name: "No user claim", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"sub": nil}))},
+		{name: "Unknown user", token: sign(t, "RS256", "rsa1", iss.rsaKey, claims(map[string]any{"sub": "no-such-user-s2j"}))},
+		{name: "Unknown key", token: sign(t, "RS256", "rsa2", iss.rsaKey, claims(nil))},
+		{name: "Key of the wrong type", token: sign(t, "ES256", "rsa1", iss.ecKey, claims(nil))},
+		{name: "Tampered claims", token: strings.Join([]string{strings.Split(valid, ".")[0], base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + iss.server.URL + `","aud":"script2json","sub":"0","exp":9999999999}`)), strings.Split(valid, ".")[2]}, ".")},
+		{name: "Unsigned", token: strings.Join(strings.Split(valid, ".")[:2], ".") + "."},
+		{name: "Not a JWT", token: "s3cret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/status", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			scope, ok := auth.authorize(req)
+			if ok != tt.ok || (scope == nil) != (tt.scope == nil) || (scope != nil && *scope != *tt.scope) {
+				t.Errorf("authorize = %v, %v, want %v, %v", scope, ok, tt.scope, tt.ok)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Authorization", "Basic "+valid)
+	if _, ok := auth.authorize(req); ok {
+		t.Error("A token that isn't a bearer token should be refused")
+	}
+}
+
+// TestOIDCAuthorizerKeyRotation tests that a token signed with a new key of the
+// issuer is accepted once the keys are fetched again
+func TestOIDCAuthorizerKeyRotation(t *testing.T) {
+	iss := newTestIssuer(t)
+	auth, err := newOIDCAuthorizer(iss.server.URL, "script2json", "sub", iss.server.Client(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("newOIDCAuthorizer failed: %v", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	iss.jwks = []map[string]string{rsaJWK("rsa2", &newKey.PublicKey)}
+	iss.mu.Unlock()
+	token := sign(t, "RS256", "rsa2", newKey, map[string]any{"iss": iss.server.URL, "aud": "script2json", "sub": fmt.Sprint(processUID), "exp": time.Now().Add(time.Hour).Unix()})
+
+	// Keys were fetched just now, so an unknown key doesn't fetch them again yet
+	if _, err := auth.verify(token, time.Now()); !errors.Is(err, errOIDCToken) {
+		t.Errorf("verify right after fetching the keys = %v, want an unknown key", err)
+	}
+	auth.fetchedAt = time.Now().Add(-oidcKeyRefreshInterval)
+	if _, err := auth.verify(token, time.Now()); err != nil {
+		t.Errorf("verify after the refresh interval = %v, want the new key accepted", err)
+	}
+}
+
+// TestNewOIDCAuthorizer tests that the issuer and its discovery document are checked
+func TestNewOIDCAuthorizer(t *testing.T) {
+	iss := newTestIssuer(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, issuer := range []string{"http://idp.example", "not a url", iss.server.URL + "/other"} {
+		if _, err := newOIDCAuthorizer(issuer, "script2json", "sub", iss.server.Client(), logger); err == nil {
+			t.Errorf("newOIDCAuthorizer(%q) succeeded, want an error", issuer)
+		}
+	}
+	iss.jwks = nil
+	if _, err := newOIDCAuthorizer(iss.server.URL, "script2json", "sub", iss.server.Client(), logger); err == nil {
+		t.Error("newOIDCAuthorizer with no keys succeeded, want an error")
+	}
+}
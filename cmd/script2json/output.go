@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Output failure policies
+const (
+	failurePolicyExit     = "exit"
+	failurePolicySpool    = "spool"
+	failurePolicyFallback = "fallback"
+)
+
+// spoolLimit is the maximum number of undelivered records held by the spool policy.
+// When the spool is full, the oldest record is dropped.
+const spoolLimit = 10000
+
+// errOutputFailed is returned by outputWriter.write when the failure policy cannot
+// keep records flowing and the process should exit.
+var errOutputFailed = errors.New("output failed")
+
+// outputStats counts output failures so they can be surfaced alongside other runtime state.
+var outputStats struct {
+	writeErrors    atomic.Uint64
+	droppedRecords atomic.Uint64
+	spooledRecords atomic.Int64
+	usingFallback  atomic.Bool
+}
+
+// outputConfig is the failure policy of live capture's outputs, which a config
+// reload can change. Each reloadable outputWriter picks up a new generation before
+// its next write.
+var outputConfig struct {
+	mu           sync.Mutex
+	policy       string
+	fallbackPath string
+	generation   atomic.Uint64
+}
+
+// setOutputConfig changes the failure policy of reloadable outputWriters.
+func setOutputConfig(policy, fallbackPath string) {
+	outputConfig.mu.Lock()
+	defer outputConfig.mu.Unlock()
+	outputConfig.policy = policy
+	outputConfig.fallbackPath = fallbackPath
+	outputConfig.generation.Add(1)
+}
+
+// validateFailurePolicy returns an error if policy is not a known output failure policy.
+func validateFailurePolicy(policy, fallbackPath string) error {
+	switch policy {
+	case failurePolicyExit, failurePolicySpool:
+		return nil
+	case failurePolicyFallback:
+		if fallbackPath == "" {
+			return errors.New("the fallback output policy requires -fallback-file")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid output failure policy: %s. Must be exit, spool, or fallback", policy)
+}
+
+// outputWriter writes formatted records to an output stream (normally stdout) and
+// applies a failure policy when a write fails, e.g. because the consumer of a pipe
+// has gone away:
+//   - exit: report errOutputFailed so the caller can exit non-zero
+//   - spool: hold undelivered records in memory (up to spoolLimit) and retry them,
+//     in order, before each subsequent record
+//   - fallback: switch permanently to appending to fallbackPath
+type outputWriter struct {
+	out          io.Writer
+	policy       string
+	fallbackPath string
+	spool        [][]byte
+	logger       *slog.Logger
+	// primary is the output the writer was created with, which out replaces with the
+	// fallback file
+	primary io.Writer
+	// reloadable writers follow outputConfig from generation on
+	reloadable bool
+	generation uint64
+}
+
+// newOutputWriter returns an outputWriter writing to out with the given failure policy.
+func newOutputWriter(out io.Writer, policy, fallbackPath string, logger *slog.Logger) *outputWriter {
+	if policy == "" {
+		policy = failurePolicyExit
+	}
+	return &outputWriter{out: out, primary: out, policy: policy, fallbackPath: fallbackPath, logger: logger}
+}
+
+// newReloadableOutputWriter returns an outputWriter writing to out that starts with
+// the given failure policy and follows changes to outputConfig.
+func newReloadableOutputWriter(out io.Writer, policy, fallbackPath string, logger *slog.Logger) *outputWriter {
+	w := newOutputWriter(out, policy, fallbackPath, logger)
+	w.reloadable = true
+	w.generation = outputConfig.generation.Load()
+	return w
+}
+
+// reload applies outputConfig if it changed since the writer last looked. A writer
+// that had switched to the fallback file returns to its primary output, so that a
+// reload can also recover from a consumer that has come back. Records still
+// spooled when the new policy is not spool get one more delivery attempt and are
+// dropped if it fails.
+func (w *outputWriter) reload() {
+	generation := outputConfig.generation.Load()
+	if generation == w.generation {
+		return
+	}
+	outputConfig.mu.Lock()
+	policy, fallbackPath := outputConfig.policy, outputConfig.fallbackPath
+	outputConfig.mu.Unlock()
+	w.generation = generation
+
+	if w.out != w.primary {
+		if c, ok := w.out.(io.Closer); ok {
+			c.Close()
+		}
+		w.out = w.primary
+		outputStats.usingFallback.Store(false)
+	}
+	w.policy, w.fallbackPath = policy, fallbackPath
+	if w.policy != failurePolicySpool && len(w.spool) > 0 && !w.flushSpool() {
+		outputStats.droppedRecords.Add(uint64(len(w.spool)))
+		w.spool = nil
+		outputStats.spooledRecords.Store(0)
+	}
+}
+
+// write writes a single formatted record, which must include its trailing newline.
+// It returns errOutputFailed only if the record could not be written or kept for
+// later delivery under the configured policy.
+func (w *outputWriter) write(data []byte) error {
+	if w.reloadable {
+		w.reload()
+	}
+	if w.policy == failurePolicySpool && len(w.spool) > 0 {
+		if !w.flushSpool() {
+			w.enqueue(data)
+			return nil
+		}
+	}
+
+	_, err := w.out.Write(data)
+	if err == nil {
+		return nil
+	}
+	outputStats.writeErrors.Add(1)
+
+	switch w.policy {
+	case failurePolicySpool:
+		w.logger.Warn("Error writing record, spooling for retry", "error", err)
+		w.enqueue(data)
+		return nil
+	case failurePolicyFallback:
+		w.logger.Warn("Error writing record, switching to fallback file", "error", err, "path", w.fallbackPath)
+		f, ferr := os.OpenFile(w.fallbackPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if ferr != nil {
+			w.logger.Error("Could not open fallback file", "path", w.fallbackPath, "error", ferr)
+			outputStats.droppedRecords.Add(1)
+			return fmt.Errorf("%w: %v", errOutputFailed, ferr)
+		}
+		w.out = f
+		// Further failures on the fallback file are fatal
+		w.policy = failurePolicyExit
+		outputStats.usingFallback.Store(true)
+		if _, err := w.out.Write(data); err != nil {
+			outputStats.writeErrors.Add(1)
+			outputStats.droppedRecords.Add(1)
+			return fmt.Errorf("%w: %v", errOutputFailed, err)
+		}
+		return nil
+	default:
+		w.logger.Error("Error writing record", "error", err)
+		outputStats.droppedRecords.Add(1)
+		return fmt.Errorf("%w: %v", errOutputFailed, err)
+	}
+}
+
+// enqueue adds a record to the spool, dropping the oldest record if it is full.
+func (w *outputWriter) enqueue(data []byte) {
+	if len(w.spool) >= spoolLimit {
+		w.spool = w.spool[1:]
+		outputStats.droppedRecords.Add(1)
+	}
+	w.spool = append(w.spool, append([]byte(nil), data...))
+	outputStats.spooledRecords.Store(int64(len(w.spool)))
+}
+
+// flushSpool retries spooled records in order, stopping at the first failure.
+// Returns true if the spool is now empty.
+func (w *outputWriter) flushSpool() bool {
+	for len(w.spool) > 0 {
+		if _, err := w.out.Write(w.spool[0]); err != nil {
+			outputStats.writeErrors.Add(1)
+			break
+		}
+		w.spool = w.spool[1:]
+	}
+	outputStats.spooledRecords.Store(int64(len(w.spool)))
+	if len(w.spool) == 0 {
+		w.logger.Info("Spooled records delivered")
+		return true
+	}
+	return false
+}
+
+// flush makes a last attempt to deliver the spooled records, and syncs the
+// fallback file if the writer has switched to it, before the process exits.
+func (w *outputWriter) flush() {
+	if len(w.spool) > 0 && !w.flushSpool() {
+		w.logger.Warn("Dropping spooled records at exit", "records", len(w.spool))
+		outputStats.droppedRecords.Add(uint64(len(w.spool)))
+		w.spool = nil
+		outputStats.spooledRecords.Store(0)
+	}
+	if f, ok := w.out.(*os.File); ok && w.out != w.primary {
+		if err := f.Sync(); err != nil {
+			w.logger.Warn("Could not sync fallback file", "path", w.fallbackPath, "error", err)
+		}
+	}
+}
+
+// stdoutMu serializes writes to the sink from the recordCreators of concurrent
+// sessions, so that records are never interleaved.
+var stdoutMu sync.Mutex
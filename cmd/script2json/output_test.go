@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// flakyWriter fails writes with EPIPE while broken is set
+type flakyWriter struct {
+	bytes.Buffer
+	broken bool
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.broken {
+		return 0, syscall.EPIPE
+	}
+	return w.Buffer.Write(p)
+}
+
+// TestOutputWriterPolicies tests the exit, spool, and fallback output failure policies
+func TestOutputWriterPolicies(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	t.Run("Exit", func(t *testing.T) {
+		out := &flakyWriter{broken: true}
+		w := newOutputWriter(out, failurePolicyExit, "", logger)
+
+		if err := w.write([]byte("one\n")); !errors.Is(err, errOutputFailed) {
+			t.Errorf("write error = %v, want %v", err, errOutputFailed)
+		}
+	})
+
+	t.Run("Spool", func(t *testing.T) {
+		out := &flakyWriter{}
+		w := newOutputWriter(out, failurePolicySpool, "", logger)
+
+		for _, line := range []string{"one\n", "two\n"} {
+			if err := w.write([]byte(line)); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+		}
+
+		// Records written while the output is broken are held, not lost
+		out.broken = true
+		for _, line := range []string{"three\n", "four\n"} {
+			if err := w.write([]byte(line)); err != nil {
+				t.Fatalf("write should spool instead of failing: %v", err)
+			}
+		}
+		if len(w.spool) != 2 {
+			t.Errorf("Spool length = %d, want 2", len(w.spool))
+		}
+
+		// Spooled records are delivered in order once the output recovers
+		out.broken = false
+		if err := w.write([]byte("five\n")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if out.String() != "one\ntwo\nthree\nfour\nfive\n" {
+			t.Errorf("Output = %q, want all five records in order", out.String())
+		}
+		if len(w.spool) != 0 {
+			t.Errorf("Spool length = %d, want 0", len(w.spool))
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		fallbackPath := filepath.Join(t.TempDir(), "fallback.jsonl")
+		out := &flakyWriter{}
+		w := newOutputWriter(out, failurePolicyFallback, fallbackPath, logger)
+
+		if err := w.write([]byte("one\n")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		out.broken = true
+		for _, line := range []string{"two\n", "three\n"} {
+			if err := w.write([]byte(line)); err != nil {
+				t.Fatalf("write should fall back instead of failing: %v", err)
+			}
+		}
+
+		data, err := os.ReadFile(fallbackPath)
+		if err != nil {
+			t.Fatalf("Failed to read fallback file: %v", err)
+		}
+		if string(data) != "two\nthree\n" {
+			t.Errorf("Fallback file = %q, want %q", string(data), "two\nthree\n")
+		}
+		if out.String() != "one\n" {
+			t.Errorf("Output = %q, want %q", out.String(), "one\n")
+		}
+		if !outputStats.usingFallback.Load() {
+			t.Error("usingFallback should be set after switching to the fallback file")
+		}
+	})
+}
+
+// TestOutputWriterReload tests that reloadable writers pick up a changed failure
+// policy and return from the fallback file to their primary output
+func TestOutputWriterReload(t *testing.T) {
+	defer setOutputConfig(failurePolicyExit, "")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	fallbackPath := filepath.Join(t.TempDir(), "fallback.jsonl")
+	out := &flakyWriter{broken: true}
+	w := newReloadableOutputWriter(out, failurePolicyExit, "", logger)
+	fixed := newOutputWriter(&flakyWriter{broken: true}, failurePolicyExit, "", logger)
+
+	setOutputConfig(failurePolicyFallback, fallbackPath)
+	if err := w.write([]byte("one\n")); err != nil {
+		t.Fatalf("write should use the reloaded fallback policy: %v", err)
+	}
+	if err := fixed.write([]byte("one\n")); !errors.Is(err, errOutputFailed) {
+		t.Errorf("Writers that aren't reloadable should keep their policy, got %v", err)
+	}
+
+	// Once the consumer is back, a reload returns to it
+	out.broken = false
+	setOutputConfig(failurePolicyExit, "")
+	if err := w.write([]byte("two\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if out.String() != "two\n" {
+		t.Errorf("Output = %q, want %q", out.String(), "two\n")
+	}
+	if data, _ := os.ReadFile(fallbackPath); string(data) != "one\n" {
+		t.Errorf("Fallback file = %q, want %q", string(data), "one\n")
+	}
+	if outputStats.usingFallback.Load() {
+		t.Error("usingFallback should be cleared after returning to the primary output")
+	}
+}
+
+// TestValidateFailurePolicy tests output failure policy validation
+func TestValidateFailurePolicy(t *testing.T) {
+	if err := validateFailurePolicy("exit", ""); err != nil {
+		t.Errorf("exit policy should be valid: %v", err)
+	}
+	if err := validateFailurePolicy("fallback", ""); err == nil {
+		t.Error("fallback policy without a fallback file should be invalid")
+	}
+	if err := validateFailurePolicy("ignore", ""); err == nil {
+		t.Error("unknown policy should be invalid")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Overflow policies for a full pipeline channel (--overflow)
+const (
+	overflowBlock      = "block"
+	overflowDropOldest = "drop-oldest"
+	overflowDropNewest = "drop-newest"
+)
+
+// Pipeline channel buffer sizes (--byte-buffer, --output-buffer, --command-buffer)
+var (
+	byteBufferSize    = 64
+	outputBufferSize  = 1
+	commandBufferSize = 1
+)
+
+// scriptReadSize is how much of the terminal byte stream is read at a time. Output
+// as fast as a cat of a large file takes one read per chunk rather than per byte.
+const scriptReadSize = 32 * 1024
+
+// overflow is what happens to a command's output or command when its channel is
+// full. The byte stream always blocks, as dropping bytes could lose the EOF that
+// ends a command.
+var overflow = overflowBlock
+
+// validateOverflow returns an error if policy is not a known overflow policy.
+func validateOverflow(policy string) error {
+	switch policy {
+	case overflowBlock, overflowDropOldest, overflowDropNewest:
+		return nil
+	}
+	return fmt.Errorf("invalid overflow policy: %s. Must be block, drop-oldest or drop-newest", policy)
+}
+
+// validateBufferSize returns an error if size is not a usable size for the named
+// channel buffer.
+func validateBufferSize(name string, size int) error {
+	if size < 1 {
+		return fmt.Errorf("invalid %s buffer size: %d. Must be at least 1", name, size)
+	}
+	return nil
+}
+
+// overflowSend sends v on ch. When ch is full, it waits under overflowBlock, and
+// otherwise drops v or the oldest value in ch, counting each drop in dropped. It
+// gives up and returns false once done is closed.
+func overflowSend[T any](ch chan T, v T, dropped *atomic.Uint64, done <-chan struct{}) bool {
+	if overflow == overflowBlock {
+		select {
+		case ch <- v:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	for {
+		select {
+		case ch <- v:
+			return true
+		case <-done:
+			return false
+		default:
+		}
+		if overflow == overflowDropNewest {
+			dropped.Add(1)
+			return true
+		}
+		// The receiver may have made room in the meantime, so only count a drop
+		select {
+		case <-ch:
+			dropped.Add(1)
+		default:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// TestOverflowSend tests each overflow policy on a full channel
+func TestOverflowSend(t *testing.T) {
+	defer func(policy string) { overflow = policy }(overflow)
+
+	tests := []struct {
+		policy   string
+		expected []int
+		dropped  uint64
+	}{
+		{overflowDropOldest, []int{3, 4}, 2},
+		{overflowDropNewest, []int{1, 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			overflow = tt.policy
+			ch := make(chan int, 2)
+			var dropped atomic.Uint64
+			for v := 1; v <= 4; v++ {
+				if !overflowSend(ch, v, &dropped, nil) {
+					t.Fatalf("overflowSend(%d) gave up", v)
+				}
+			}
+			close(ch)
+			var got []int
+			for v := range ch {
+				got = append(got, v)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("Channel holds %v, want %v", got, tt.expected)
+			}
+			if dropped.Load() != tt.dropped {
+				t.Errorf("Dropped %d, want %d", dropped.Load(), tt.dropped)
+			}
+		})
+	}
+
+	// Blocking gives up once done is closed, without counting a drop
+	overflow = overflowBlock
+	ch := make(chan int, 1)
+	ch <- 1
+	done := make(chan struct{})
+	close(done)
+	var dropped atomic.Uint64
+	if overflowSend(ch, 2, &dropped, done) {
+		t.Error("overflowSend on a full channel succeeded after done")
+	}
+	if dropped.Load() != 0 {
+		t.Errorf("Dropped %d, want 0", dropped.Load())
+	}
+}
+
+// TestValidateOverflow tests the accepted overflow policies and buffer sizes
+func TestValidateOverflow(t *testing.T) {
+	for _, policy := range []string{overflowBlock, overflowDropOldest, overflowDropNewest} {
+		if err := validateOverflow(policy); err != nil {
+			t.Errorf("validateOverflow(%q) failed: %v", policy, err)
+		}
+	}
+	if err := validateOverflow("drop"); err == nil {
+		t.Error("validateOverflow(\"drop\") succeeded, want an error")
+	}
+	if err := validateBufferSize("output", 0); err == nil {
+		t.Error("validateBufferSize(0) succeeded, want an error")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// pauseBufferLimit caps the bytes that a session holds while it isn't reading.
+const pauseBufferLimit = 64 * 1024
+
+// pauseWindow is how long bytes read while a session isn't reading are kept
+// (--pause-buffer). A start that comes that much later than a command's first
+// output, as a signal can under load, still gets it. Zero discards the bytes.
+var pauseWindow time.Duration
+
+// pausedByte is a byte read while its session wasn't reading.
+type pausedByte struct {
+	b byte
+	// at is when it was read, in Unix nanoseconds
+	at int64
+}
+
+// pauseBuffer holds a session's bytes while it isn't reading, so that a late start
+// can hand on what its command wrote before it. It also orders the bytes it hands
+// on before the ones read after the start. It is safe for concurrent use.
+type pauseBuffer struct {
+	mu    sync.Mutex
+	bytes []pausedByte
+	// closed keeps the session from reading again once it is shutting down
+	closed bool
+}
+
+// feed sends chunk to the session if it is reading, and holds it otherwise. The
+// whole chunk goes one way, under one lock, so a start can't split it. chunk isn't
+// kept, so the caller may reuse it.
+func (p *pauseBuffer) feed(sess *session, chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sess.recording() {
+		sess.scriptFifoByteChan <- bytes.Clone(chunk)
+		return
+	}
+	if pauseWindow <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	p.prune(now)
+	if len(chunk) > pauseBufferLimit {
+		chunk = chunk[len(chunk)-pauseBufferLimit:]
+	}
+	if excess := len(p.bytes) + len(chunk) - pauseBufferLimit; excess > 0 {
+		p.bytes = p.bytes[excess:]
+	}
+	for _, b := range chunk {
+		p.bytes = append(p.bytes, pausedByte{b: b, at: now})
+	}
+}
+
+// prune drops the bytes that are older than pauseWindow at now.
+func (p *pauseBuffer) prune(now int64) {
+	cutoff := now - int64(pauseWindow)
+	i := 0
+	for i < len(p.bytes) && p.bytes[i].at < cutoff {
+		i++
+	}
+	p.bytes = p.bytes[i:]
+	if len(p.bytes) == 0 {
+		// Let go of the backing array of what was pruned
+		p.bytes = nil
+	}
+}
+
+// start starts reading in sess, if it isn't already, and sends it the bytes read
+// within pauseWindow. They are assumed to start with the echo of the Enter that
+// ran the command, so everything up to the first line break is left out.
+func (p *pauseBuffer) start(sess *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || !sess.state.Start() {
+		return
+	}
+	p.prune(time.Now().UnixNano())
+	held := make([]byte, len(p.bytes))
+	for i, paused := range p.bytes {
+		held[i] = paused.b
+	}
+	p.bytes = nil
+	if i := bytes.IndexByte(held, '\n'); i >= 0 {
+		held = held[i+1:]
+	}
+	if len(held) > 0 {
+		sess.scriptFifoByteChan <- held
+	}
+}
+
+// discard drops the bytes held so far, such as when a start marker in the byte
+// stream itself shows where the command's output begins.
+func (p *pauseBuffer) discard() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes = nil
+}
+
+// close stops sess from reading for good, so that it takes no more bytes, and
+// reports whether it was reading. Bytes that feed is sending are sent first.
+func (p *pauseBuffer) close(sess *session) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.bytes = nil
+	return sess.state.Reset() == pipeline.StateRecording
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPauseBuffer tests handing on the bytes read before a late start
+func TestPauseBuffer(t *testing.T) {
+	defer func(window time.Duration) { pauseWindow = window }(pauseWindow)
+
+	// received drains what sess has been sent so far
+	received := func(sess *session) string {
+		var out []byte
+		for len(sess.scriptFifoByteChan) > 0 {
+			out = append(out, <-sess.scriptFifoByteChan...)
+		}
+		return string(out)
+	}
+	feed := func(sess *session, s string) {
+		sess.paused.feed(sess, []byte(s))
+	}
+
+	tests := []struct {
+		name     string
+		window   time.Duration
+		paused   string
+		expected string
+	}{
+		{"Discard", 0, "$ ls\r\nfile1\r\n", ""},
+		{"Late start", time.Minute, "$ ls\r\nfile1\r\nfil", "file1\r\nfil"},
+		{"No Enter echo", time.Minute, "file1", "file1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pauseWindow = tt.window
+			sess := newSession("web", "", "")
+			feed(sess, tt.paused)
+			startReading(sess)
+			feed(sess, "e2\r\n")
+			if got := received(sess); got != tt.expected+"e2\r\n" {
+				t.Errorf("Received %q, want %q", got, tt.expected+"e2\r\n")
+			}
+		})
+	}
+
+	// Bytes older than the window are dropped
+	pauseWindow = 20 * time.Millisecond
+	sess := newSession("web", "", "")
+	feed(sess, "x\ny\n")
+	time.Sleep(50 * time.Millisecond)
+	feed(sess, "z")
+	startReading(sess)
+	if got := received(sess); got != "z" {
+		t.Errorf("Received %q, want only the recent %q", got, "z")
+	}
+
+	// Neither a reset nor a start marker hands on what came before it
+	pauseWindow = time.Minute
+	stopReading(sess)
+	received(sess)
+	feed(sess, "\r\nlost")
+	resetSession(sess)
+	startReading(sess)
+	if got := received(sess); got != "" {
+		t.Errorf("Received %q after a reset, want nothing", got)
+	}
+	marked := newSession("marked", "", "")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	readMarkerStream(marked, strings.NewReader("$ ls\r\n\x1b]6973;start\afile1"), io.Discard, nil, logger)
+	if got := received(marked); got != "file1" {
+		t.Errorf("Received %q after a start marker, want %q", got, "file1")
+	}
+
+	// Chunks beyond the limit push out the oldest bytes, even their own
+	limited := newSession("limited", "", "")
+	feed(limited, "old")
+	feed(limited, strings.Repeat("x", pauseBufferLimit-1))
+	if held := limited.paused.bytes; len(held) != pauseBufferLimit || held[0].b != 'd' {
+		t.Errorf("Held %d bytes starting with %q, want %d starting with the last old byte", len(held), held[0].b, pauseBufferLimit)
+	}
+	feed(limited, strings.Repeat("y", pauseBufferLimit)+"z")
+	if held := limited.paused.bytes; len(held) != pauseBufferLimit || held[0].b != 'y' || held[len(held)-1].b != 'z' {
+		t.Errorf("Held %d bytes, want the last %d of the oversized chunk", len(held), pauseBufferLimit)
+	}
+}
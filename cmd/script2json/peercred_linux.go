@@ -0,0 +1,31 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"script2json/pkg/pipeline"
+)
+
+// peerIdentity returns the credentials of the process at the other end of conn, as
+// recorded by the kernel when it connected (SO_PEERCRED).
+func peerIdentity(conn *net.UnixConn) (*pipeline.PeerIdentity, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	return &pipeline.PeerIdentity{PID: int(cred.Pid), UID: int(cred.Uid), GID: int(cred.Gid)}, nil
+}
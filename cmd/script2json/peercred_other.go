@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+
+	"script2json/pkg/pipeline"
+)
+
+func peerIdentity(conn *net.UnixConn) (*pipeline.PeerIdentity, error) {
+	return nil, errors.New("peer credentials are only supported on Linux")
+}
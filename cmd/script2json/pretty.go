@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// SGR sequences used by the pretty formatter
+const (
+	sgrReset = "\x1b[0m"
+	sgrBold  = "\x1b[1m"
+	sgrDim   = "\x1b[2m"
+	sgrGreen = "\x1b[32m"
+)
+
+// colorEnabled decides whether human-readable output written to out should be colorized.
+// mode is one of "always", "never" or "auto". In auto mode, color is disabled by a
+// non-empty NO_COLOR, CLICOLOR=0, or a dumb/unset TERM, forced on by CLICOLOR_FORCE,
+// and otherwise enabled only when out is a terminal.
+func colorEnabled(mode string, out *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+	default:
+		return false, fmt.Errorf("invalid color mode: %s. Must be always, never, or auto", mode)
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false, nil
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true, nil
+	}
+	if os.Getenv("CLICOLOR") == "0" {
+		return false, nil
+	}
+	if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+		return false, nil
+	}
+	return isTerminal(out), nil
+}
+
+// isTerminal reports whether f refers to a character device such as a TTY.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Time display modes for human-readable output
+const (
+	timeDisplayClock    = "clock"
+	timeDisplayLocal    = "local"
+	timeDisplayRelative = "relative"
+	timeDisplayRFC3339  = "rfc3339"
+)
+
+// validateTimeDisplay returns an error if mode is not a known time display mode.
+func validateTimeDisplay(mode string) error {
+	switch mode {
+	case timeDisplayClock, timeDisplayLocal, timeDisplayRelative, timeDisplayRFC3339:
+		return nil
+	}
+	return fmt.Errorf("invalid time display: %s. Must be clock, local, relative, or rfc3339", mode)
+}
+
+// formatTime renders t for human review according to mode, relative to now.
+//   - clock: local time of day ("15:04:05")
+//   - local: local date and time in the layout customary for the user's locale
+//   - relative: age relative to now ("3m ago")
+//   - rfc3339: the same representation as the JSON output
+func formatTime(t time.Time, mode string, now time.Time) string {
+	switch mode {
+	case timeDisplayLocal:
+		return t.Local().Format(localeTimeLayout())
+	case timeDisplayRelative:
+		return formatRelative(now.Sub(t))
+	case timeDisplayRFC3339:
+		return t.Format(time.RFC3339)
+	default:
+		return t.Local().Format("15:04:05")
+	}
+}
+
+// localeTimeLayout returns a date/time layout matching the conventions of the locale
+// named by LC_ALL, LC_TIME or LANG (in that order of precedence), falling back to
+// an ISO 8601 style layout for the C/POSIX locale and unrecognized regions.
+func localeTimeLayout() string {
+	locale := ""
+	for _, key := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if locale = os.Getenv(key); locale != "" {
+			break
+		}
+	}
+
+	// Reduce e.g. "en_US.UTF-8@euro" to the region code "US"
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	_, region, _ := strings.Cut(locale, "_")
+
+	switch region {
+	case "US", "PH":
+		return "01/02/2006 3:04:05 PM"
+	case "DE", "AT", "CH", "RU", "PL", "CZ", "SK", "NO", "FI", "DK", "UA", "TR":
+		return "02.01.2006 15:04:05"
+	case "GB", "IE", "AU", "NZ", "IN", "FR", "BE", "ES", "IT", "PT", "BR", "MX", "AR", "GR":
+		return "02/01/2006 15:04:05"
+	case "JP", "CN", "TW", "KR", "HK":
+		return "2006/01/02 15:04:05"
+	default:
+		return "2006-01-02 15:04:05"
+	}
+}
+
+// formatRelative renders the age d as a compact relative time such as "3m ago",
+// using the largest whole unit.
+func formatRelative(d time.Duration) string {
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+	switch {
+	case d < 5*time.Second:
+		return "just now"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds %s", int(d/time.Second), suffix)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm %s", int(d/time.Minute), suffix)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %s", int(d/time.Hour), suffix)
+	default:
+		return fmt.Sprintf("%dd %s", int(d/(24*time.Hour)), suffix)
+	}
+}
+
+// formatPretty renders a CommandRecord for human review: a header line with the
+// record ID, completion time and command, followed by the output.
+// Colors and the time display mode are taken from opts.
+func formatPretty(record pipeline.CommandRecord, opts recordOptions) string {
+	style := func(sgr, s string) string {
+		if !opts.color {
+			return s
+		}
+		return sgr + s + sgrReset
+	}
+
+	timestamp := formatTime(record.ReturnTimestamp, opts.timeDisplay, time.Now())
+
+	var sb strings.Builder
+	sb.WriteString(style(sgrDim, fmt.Sprintf("[%s %s]", record.ID, timestamp)))
+	sb.WriteString(" ")
+	sb.WriteString(style(sgrBold+sgrGreen, "$ "+record.Command))
+	sb.WriteString("\n")
+
+	output := strings.ReplaceAll(record.Output, "\r\n", "\n")
+	if output != "" {
+		sb.WriteString(output)
+		if !strings.HasSuffix(output, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// formatPrettySummary renders a SummaryRecord for human review as a single line.
+func formatPrettySummary(summary SummaryRecord, opts recordOptions) string {
+	line := fmt.Sprintf("-- %s: %d commands, %d output bytes, avg %s --",
+		formatTime(summary.IntervalEnd, opts.timeDisplay, time.Now()),
+		summary.CommandCount,
+		summary.OutputBytes,
+		time.Duration(summary.AvgDurationMs)*time.Millisecond)
+	if opts.color {
+		line = sgrDim + line + sgrReset
+	}
+	return line + "\n"
+}
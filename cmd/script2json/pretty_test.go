@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestColorEnabled tests color mode selection and NO_COLOR/CLICOLOR handling
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		env      map[string]string
+		expected bool
+		wantErr  bool
+	}{
+		{name: "Always", mode: "always", env: map[string]string{"NO_COLOR": "1"}, expected: true},
+		{name: "Never", mode: "never", env: map[string]string{"CLICOLOR_FORCE": "1"}, expected: false},
+		{name: "Auto with NO_COLOR", mode: "auto", env: map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, expected: false},
+		{name: "Auto with CLICOLOR_FORCE", mode: "auto", env: map[string]string{"CLICOLOR_FORCE": "1"}, expected: true},
+		{name: "Auto with CLICOLOR=0", mode: "auto", env: map[string]string{"CLICOLOR": "0", "TERM": "xterm"}, expected: false},
+		{name: "Auto with dumb terminal", mode: "auto", env: map[string]string{"TERM": "dumb"}, expected: false},
+		{name: "Auto with non-terminal output", mode: "auto", env: map[string]string{"TERM": "xterm"}, expected: false},
+		{name: "Invalid mode", mode: "sometimes", wantErr: true},
+	}
+
+	// A regular file stands in for a pipe or redirected stdout
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer out.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE", "TERM"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			got, err := colorEnabled(tt.mode, out)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error for invalid mode")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("colorEnabled failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("colorEnabled(%q) = %v, want %v", tt.mode, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestFormatPretty tests human-readable record rendering
+func TestFormatPretty(t *testing.T) {
+	record := pipeline.CommandRecord{
+		ID:              "7",
+		Command:         "echo hello",
+		Output:          "hello\r\n",
+		ReturnTimestamp: time.Date(2025, 9, 29, 13, 24, 41, 0, time.UTC),
+	}
+
+	opts := recordOptions{timeDisplay: timeDisplayRFC3339}
+
+	expected := "[7 2025-09-29T13:24:41Z] $ echo hello\nhello\n"
+	if got := formatPretty(record, opts); got != expected {
+		t.Errorf("formatPretty without color = %q, want %q", got, expected)
+	}
+
+	opts.color = true
+	expectedColor := "\x1b[2m[7 2025-09-29T13:24:41Z]\x1b[0m \x1b[1m\x1b[32m$ echo hello\x1b[0m\nhello\n"
+	if got := formatPretty(record, opts); got != expectedColor {
+		t.Errorf("formatPretty with color = %q, want %q", got, expectedColor)
+	}
+
+	// Output without a trailing newline is terminated so records don't run together
+	opts.color = false
+	record.Output = "no newline"
+	if got := formatPretty(record, opts); got != "[7 2025-09-29T13:24:41Z] $ echo hello\nno newline\n" {
+		t.Errorf("formatPretty did not terminate output: %q", got)
+	}
+}
+
+// TestFormatTime tests timestamp rendering for each time display mode
+func TestFormatTime(t *testing.T) {
+	ts := time.Date(2025, 9, 29, 13, 24, 41, 0, time.Local)
+	now := ts.Add(3*time.Minute + 20*time.Second)
+
+	tests := []struct {
+		name     string
+		mode     string
+		locale   string
+		expected string
+	}{
+		{name: "Clock", mode: "clock", expected: "13:24:41"},
+		{name: "RFC3339", mode: "rfc3339", expected: ts.Format(time.RFC3339)},
+		{name: "Relative", mode: "relative", expected: "3m ago"},
+		{name: "Local in US locale", mode: "local", locale: "en_US.UTF-8", expected: "09/29/2025 1:24:41 PM"},
+		{name: "Local in German locale", mode: "local", locale: "de_DE.UTF-8", expected: "29.09.2025 13:24:41"},
+		{name: "Local in British locale", mode: "local", locale: "en_GB.UTF-8", expected: "29/09/2025 13:24:41"},
+		{name: "Local in C locale", mode: "local", locale: "C", expected: "2025-09-29 13:24:41"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", "")
+			t.Setenv("LC_TIME", tt.locale)
+			t.Setenv("LANG", "")
+			if got := formatTime(ts, tt.mode, now); got != tt.expected {
+				t.Errorf("formatTime(%q) = %q, want %q", tt.mode, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestFormatRelative tests relative age rendering
+func TestFormatRelative(t *testing.T) {
+	tests := []struct {
+		age      time.Duration
+		expected string
+	}{
+		{2 * time.Second, "just now"},
+		{42 * time.Second, "42s ago"},
+		{59 * time.Minute, "59m ago"},
+		{5*time.Hour + 59*time.Minute, "5h ago"},
+		{72 * time.Hour, "3d ago"},
+		{-10 * time.Minute, "10m from now"},
+	}
+
+	for _, tt := range tests {
+		if got := formatRelative(tt.age); got != tt.expected {
+			t.Errorf("formatRelative(%v) = %q, want %q", tt.age, got, tt.expected)
+		}
+	}
+}
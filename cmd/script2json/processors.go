@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// The record processors that --processors can order.
+const (
+	processorFilter    = "filter"
+	processorRedact    = "redact"
+	processorWasm      = "wasm"
+	processorTransform = "transform"
+	processorTruncate  = "truncate"
+)
+
+// defaultProcessorOrder drops records before redacting them, redacts them before
+// handing them to the WASM filter and the transform command, so secrets don't leave
+// the process, runs the sandboxed WASM filter before the transform command, so
+// records it drops never reach the command, and truncates last, so a secret cut in
+// half by truncation is still redacted and the output of both is bounded too.
+const defaultProcessorOrder = processorFilter + "," + processorRedact + "," + processorWasm + "," + processorTransform + "," + processorTruncate
+
+// processorFlags are the flags that configure the record processors.
+type processorFlags struct {
+	// order is the comma-separated order of the processors
+	order string
+	// exclude drops the records whose command matches it (--exclude-command)
+	exclude string
+	// redact is replaced in the command, argv and output of records (--redact)
+	redact string
+	// maxOutputBytes truncates output longer than this (0 disables)
+	maxOutputBytes int
+	// wasmFilter is the path of the WASM module each record is run through
+	// (--wasm-filter)
+	wasmFilter string
+	// transformCmd is run with the shell over each record (--transform-cmd)
+	transformCmd string
+	// transformTimeout bounds each run of transformCmd
+	transformTimeout time.Duration
+}
+
+// buildProcessors returns the chain of the processors that flags enables, in the
+// order it gives. A processor named in the order but not enabled is skipped.
+func buildProcessors(flags processorFlags) (pipeline.Chain, error) {
+	var exclude, redact *regexp.Regexp
+	var err error
+	if flags.exclude != "" {
+		if exclude, err = regexp.Compile(flags.exclude); err != nil {
+			return nil, fmt.Errorf("invalid --exclude-command pattern: %v", err)
+		}
+	}
+	if flags.redact != "" {
+		if redact, err = regexp.Compile(flags.redact); err != nil {
+			return nil, fmt.Errorf("invalid --redact pattern: %v", err)
+		}
+	}
+	if flags.maxOutputBytes < 0 {
+		return nil, fmt.Errorf("invalid max output bytes: %d. Must not be negative", flags.maxOutputBytes)
+	}
+	if flags.transformCmd != "" && flags.transformTimeout <= 0 {
+		return nil, fmt.Errorf("invalid transform timeout: %v. Must be positive", flags.transformTimeout)
+	}
+
+	var chain pipeline.Chain
+	var seen []string
+	for _, name := range strings.Split(flags.order, ",") {
+		name = strings.TrimSpace(name)
+		if slices.Contains(seen, name) {
+			return nil, fmt.Errorf("duplicate processor: %s", name)
+		}
+		seen = append(seen, name)
+		switch name {
+		case processorFilter:
+			if exclude != nil {
+				chain = append(chain, pipeline.ExcludeCommands(exclude))
+			}
+		case processorRedact:
+			if redact != nil {
+				chain = append(chain, pipeline.Redact(redact))
+			}
+		case processorWasm:
+			if flags.wasmFilter != "" {
+				module, err := newWasmFilter(flags.wasmFilter)
+				if err != nil {
+					return nil, err
+				}
+				chain = append(chain, wasmFilterProcessor(module, func(err error) {
+					reportError(slog.Default(), pipeline.StageRecord, err)
+				}))
+			}
+		case processorTransform:
+			if flags.transformCmd != "" {
+				chain = append(chain, transformProcessor(flags.transformCmd, flags.transformTimeout, func(err error) {
+					reportError(slog.Default(), pipeline.StageRecord, err)
+				}))
+			}
+		case processorTruncate:
+			if flags.maxOutputBytes > 0 {
+				chain = append(chain, pipeline.TruncateOutput(flags.maxOutputBytes))
+			}
+		default:
+			return nil, fmt.Errorf("invalid processor: %s. Must be filter, redact, wasm, transform or truncate", name)
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestBuildProcessors tests building the processor chain from the flags
+func TestBuildProcessors(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   processorFlags
+		wantLen int
+		wantErr bool
+	}{
+		{"None enabled", processorFlags{order: defaultProcessorOrder}, 0, false},
+		{"All enabled", processorFlags{order: defaultProcessorOrder, exclude: "^ls$", redact: "secret", maxOutputBytes: 10}, 3, false},
+		{"Not in order", processorFlags{order: "redact", exclude: "^ls$", redact: "secret"}, 1, false},
+		{"Unknown processor", processorFlags{order: "filter,enrich"}, 0, true},
+		{"Duplicate processor", processorFlags{order: "redact,redact"}, 0, true},
+		{"Invalid pattern", processorFlags{order: defaultProcessorOrder, redact: "("}, 0, true},
+		{"Negative max", processorFlags{order: defaultProcessorOrder, maxOutputBytes: -1}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := buildProcessors(tt.flags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildProcessors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(chain) != tt.wantLen {
+				t.Errorf("Chain has %d processors, want %d", len(chain), tt.wantLen)
+			}
+		})
+	}
+}
+
+// TestBuildProcessorsOrder tests that truncation after redaction leaves no secret behind
+func TestBuildProcessorsOrder(t *testing.T) {
+	record := pipeline.CommandRecord{Command: "cat key", Output: "key: hunter2"}
+	for order, want := range map[string]string{
+		"redact,truncate": "key: [REDA",
+		"truncate,redact": "key: hunte",
+	} {
+		chain, err := buildProcessors(processorFlags{order: order, redact: "hunter2", maxOutputBytes: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := chain.Process(record); got.Output != want {
+			t.Errorf("%s: Output = %q, want %q", order, got.Output, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// profile is a preset of capture flag values for a common use (--profile).
+type profile struct {
+	name    string
+	summary string
+	// values are the flag values of the preset, by flag name
+	values map[string]string
+}
+
+// profiles are the presets that --profile selects.
+var profiles = []profile{
+	{
+		name:    "audit",
+		summary: "complete records for later review: argv, bell counts, colors and the recorder version, hourly summaries, and records held rather than lost when the output fails",
+		values: map[string]string{
+			"parse-argv":       "true",
+			"count-bells":      "true",
+			"keep-colors":      "true",
+			"recorder-version": "true",
+			"summary-interval": "1h",
+			"on-output-error":  "spool",
+			"shutdown-timeout": "30s",
+		},
+	},
+	{
+		name:    "dev",
+		summary: "readable records while working in a terminal: pretty output with relative times, argv, and progress bars folded into their final line",
+		values: map[string]string{
+			"format":            "pretty",
+			"time-display":      "relative",
+			"parse-argv":        "true",
+			"collapse-progress": "true",
+			"newline":           "lf",
+		},
+	},
+	{
+		name:    "minimal",
+		summary: "small records: plain line endings, progress bars folded into their final line, and only warnings logged",
+		values: map[string]string{
+			"newline":           "lf",
+			"collapse-progress": "true",
+			"log-level":         "warn",
+		},
+	},
+}
+
+// findProfile returns the profile called name, or nil if there is none.
+func findProfile(name string) *profile {
+	for i := range profiles {
+		if profiles[i].name == name {
+			return &profiles[i]
+		}
+	}
+	return nil
+}
+
+// profileNames returns the names of the profiles, for messages.
+func profileNames() string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// applyProfile applies the values of the profile called name to the flags of fs
+// that aren't in set. The values become the flags' defaults, so the config file
+// still overrides them, and a reload returns to them rather than to the built-in
+// defaults.
+func applyProfile(fs *flag.FlagSet, name string, set map[string]bool) error {
+	p := findProfile(name)
+	if p == nil {
+		return fmt.Errorf("invalid profile: %s. Must be one of %s", name, profileNames())
+	}
+	for flagName, value := range p.values {
+		if set[flagName] {
+			continue
+		}
+		f := fs.Lookup(flagName)
+		if f == nil {
+			return fmt.Errorf("profile %s sets unknown flag %s", name, flagName)
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s in profile %s: %w", value, flagName, name, err)
+		}
+		f.DefValue = value
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestApplyProfile tests that a profile fills in the flags that weren't given,
+// and becomes their defaults
+func TestApplyProfile(t *testing.T) {
+	fs := newConfigFlagSet()
+	for _, name := range []string{"time-display", "parse-argv", "collapse-progress", "newline"} {
+		fs.String(name, "", "")
+	}
+	fs.Parse([]string{"-newline", "crlf"})
+	set := map[string]bool{"newline": true}
+
+	if err := applyProfile(fs, "dev", set); err != nil {
+		t.Fatalf("applyProfile failed: %v", err)
+	}
+	for name, want := range map[string]string{"format": "pretty", "time-display": "relative", "newline": "crlf", "log-level": "info"} {
+		if got := fs.Lookup(name).Value.String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if def := fs.Lookup("format").DefValue; def != "pretty" {
+		t.Errorf("Default of format = %q, want the profile's", def)
+	}
+
+	// The config file overrides the profile
+	if err := applyConfig(fs, map[string]string{"format": "json"}, set); err != nil {
+		t.Fatalf("applyConfig failed: %v", err)
+	}
+	if got := fs.Lookup("format").Value.String(); got != "json" {
+		t.Errorf("format = %q after the config file, want json", got)
+	}
+
+	if err := applyProfile(fs, "loud", set); err == nil || !strings.Contains(err.Error(), "audit, dev, minimal") {
+		t.Errorf("Expected an invalid profile error, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Protocols of the command FIFO, for --command-protocol
+const (
+	// commandProtocolText takes each frame as the text of a command
+	commandProtocolText = "text"
+	// commandProtocolJSON takes each frame as a ControlMessage
+	commandProtocolJSON = "json"
+)
+
+// Events of a ControlMessage
+const (
+	// controlEventStart starts reading a command's output, like SIGUSR1
+	controlEventStart = "start"
+	// controlEventEnd sends the command and ends its output, like writing the command
+	// and sending SIGUSR2
+	controlEventEnd = "end"
+	// controlEventCommand only sends the command, like writing it as text; reading is
+	// left to the signals or integration markers
+	controlEventCommand = "command"
+	// controlEventAnnotate writes its text as an annotation record
+	controlEventAnnotate = "annotate"
+)
+
+// ControlMessage is a JSON object written to the command FIFO by a shell hook with
+// --command-protocol=json, such as
+//
+//	{"event":"end","command":"ls","exit_code":0,"cwd":"/home/user","euid":1000}
+//
+// Unlike a signal, it can't arrive out of order with the command it is about, and
+// it carries what the shell knows about the command.
+type ControlMessage struct {
+	Event    string `json:"event"`
+	Command  string `json:"command,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Cwd      string `json:"cwd,omitempty"`
+	// EUID is the effective user ID of the shell that ran the command; 0 marks
+	// the record privileged
+	EUID *int `json:"euid,omitempty"`
+	// Text is the note of an annotate event
+	Text string `json:"text,omitempty"`
+}
+
+// validateCommandProtocol checks a --command-protocol value.
+func validateCommandProtocol(protocol string) error {
+	if protocol != commandProtocolText && protocol != commandProtocolJSON {
+		return fmt.Errorf("invalid command protocol: %s. Must be text or json", protocol)
+	}
+	return nil
+}
+
+// parseControlMessage decodes and validates a single ControlMessage.
+func parseControlMessage(data string) (ControlMessage, error) {
+	var msg ControlMessage
+	dec := json.NewDecoder(bytes.NewReader([]byte(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&msg); err != nil {
+		return msg, fmt.Errorf("invalid control message: %w", err)
+	}
+	if dec.More() {
+		return msg, fmt.Errorf("invalid control message: trailing data after the object")
+	}
+	switch msg.Event {
+	case controlEventStart:
+		if msg.Command != "" || msg.ExitCode != nil || msg.Cwd != "" || msg.EUID != nil || msg.Text != "" {
+			return msg, fmt.Errorf("invalid control message: a start event takes no other fields")
+		}
+	case controlEventAnnotate:
+		if msg.Command != "" || msg.ExitCode != nil || msg.Cwd != "" || msg.EUID != nil {
+			return msg, fmt.Errorf("invalid control message: an annotate event only takes text")
+		}
+		if strings.TrimSpace(msg.Text) == "" {
+			return msg, fmt.Errorf("invalid control message: an annotate event requires text")
+		}
+	case controlEventEnd, controlEventCommand:
+		if msg.Text != "" {
+			return msg, fmt.Errorf("invalid control message: only an annotate event takes text")
+		}
+	case "":
+		return msg, fmt.Errorf("invalid control message: missing event")
+	default:
+		return msg, fmt.Errorf("invalid control message: unknown event %q", msg.Event)
+	}
+	return msg, nil
+}
+
+// routeControlMessage acts on msg for sess: a start event starts reading, and an end
+// event sends the command to commandChan and, if a command was being read, ends its
+// output with an EOF. A command event only sends the command, and an annotate event
+// its text to the session's annotations. It returns false if done was closed while
+// sending either.
+func routeControlMessage(msg ControlMessage, sess *session, commandChan chan commandInfo, done <-chan struct{}) bool {
+	switch msg.Event {
+	case controlEventStart:
+		startReading(sess)
+		return true
+	case controlEventAnnotate:
+		// Unlike the sockets, the command FIFO can wait for recordCreator to catch up
+		select {
+		case sess.annotations <- strings.TrimSpace(msg.Text):
+			return true
+		case <-done:
+			return false
+		}
+	case controlEventEnd:
+		// As with a stray end marker, there is no output to pair the command with
+		if !sess.state.Stop() {
+			return true
+		}
+	}
+
+	// recordCreator takes the command once the output arrives, so it is sent first
+	if !overflowSend(commandChan, commandInfo{command: msg.Command, exitCode: msg.ExitCode, cwd: msg.Cwd, euid: msg.EUID}, &sess.stats.droppedCommands, done) {
+		return false
+	}
+	if msg.Event == controlEventEnd {
+		sess.scriptFifoByteChan <- endOfOutput
+	}
+	return true
+}
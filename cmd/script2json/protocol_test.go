@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestParseControlMessage tests decoding and validating control messages
+func TestParseControlMessage(t *testing.T) {
+	tests := []struct {
+		data  string
+		valid bool
+	}{
+		{`{"event":"start"}`, true},
+		{`{"event":"end","command":"ls","exit_code":0,"cwd":"/tmp"}`, true},
+		{`{"event":"end","command":"ls","euid":0}`, true},
+		{`{"event":"start","euid":0}`, false},
+		{`{"event":"annotate","text":"deploy","euid":0}`, false},
+		{`{"event":"end"}`, true},
+		{`{"event":"command","command":"cat <<EOF\nhi\nEOF"}`, true},
+		{`{"event":"annotate","text":"starting maintenance window"}`, true},
+		{`{"event":"annotate","text":"  "}`, false},
+		{`{"event":"annotate","text":"deploy","command":"ls"}`, false},
+		{`{"event":"end","command":"ls","text":"deploy"}`, false},
+		{`{"event":"start","command":"ls"}`, false},
+		{`{"command":"ls"}`, false},
+		{`{"event":"stop"}`, false},
+		{`{"event":"end","exitcode":1}`, false},
+		{`{"event":"end","exit_code":"1"}`, false},
+		{`{"event":"start"} {"event":"end"}`, false},
+		{`ls`, false},
+	}
+
+	for _, tt := range tests {
+		_, err := parseControlMessage(tt.data)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseControlMessage(%q) error = %v, want valid %v", tt.data, err, tt.valid)
+		}
+	}
+}
+
+// TestCommandFifoReaderJSON tests that JSON control messages start and stop reading,
+// carry the exit code, working directory and EUID to recordCreator, and annotate
+func TestCommandFifoReaderJSON(t *testing.T) {
+	sess := newSession("test", "", "")
+	messages := `{"event":"start"}
+{"event":"end","command":"false","exit_code":1,"cwd":"/tmp","euid":0}
+not json
+{"event":"end","command":"stray"}
+{"event":"command","command":"pwd"}
+{"event":"annotate","text":" deploying v2 "}
+`
+	commandChan := make(chan commandInfo, 4)
+	commandFifoReader(newMemoryTransport(strings.NewReader(messages)), commandChan, commandReaderOptions{
+		session:  sess,
+		framing:  commandFramingNewline,
+		protocol: commandProtocolJSON,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var commands []commandInfo
+	for command := range commandChan {
+		commands = append(commands, command)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("Got %d commands, want 2: %+v", len(commands), commands)
+	}
+	if c := commands[0]; c.command != "false" || c.exitCode == nil || *c.exitCode != 1 || c.cwd != "/tmp" || c.euid == nil || *c.euid != 0 {
+		t.Errorf("First command = %+v, want false with exit code 1 in /tmp as EUID 0", c)
+	}
+	if c := commands[1]; c.command != "pwd" || c.exitCode != nil {
+		t.Errorf("Second command = %+v, want pwd without exit code", c)
+	}
+	if sess.recording() {
+		t.Error("Reading should stop at the end event")
+	}
+	// Only the first end event was reading, so only it ends an output
+	if len(sess.scriptFifoByteChan) != 1 || <-sess.scriptFifoByteChan != nil {
+		t.Error("The end event should send a single endOfOutput")
+	}
+	if len(sess.annotations) != 1 || <-sess.annotations != "deploying v2" {
+		t.Error("The annotate event should queue its text as an annotation")
+	}
+}
+
+// TestRecordCreatorEUID tests that a command run as EUID 0 is privileged, whatever
+// its text
+func TestRecordCreatorEUID(t *testing.T) {
+	commandOutputChan := make(chan commandOutput, 1)
+	commandChan := make(chan commandInfo, 1)
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		recordCreator(commandOutputChan, commandChan, recordOptions{stdout: &buf})
+		close(done)
+	}()
+	root, user := 0, 1000
+	for _, euid := range []*int{&root, &user, nil} {
+		commandChan <- commandInfo{command: "systemctl restart nginx", euid: euid}
+		commandOutputChan <- commandOutput{}
+	}
+	close(commandOutputChan)
+	<-done
+
+	var privileged []bool
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record pipeline.CommandRecord
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("Failed to decode record: %v", err)
+		}
+		privileged = append(privileged, record.Privileged)
+	}
+	if want := []bool{true, false, false}; !slices.Equal(privileged, want) {
+		t.Errorf("Privileged = %v, want %v", privileged, want)
+	}
+}
@@ -0,0 +1,133 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// winsize is the kernel's struct winsize.
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// ioctl performs an ioctl on fd with a pointer argument.
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openPTY allocates a pseudo-terminal and returns its master and slave ends.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("could not unlock pty: %w", err)
+	}
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("could not get pty number: %w", err)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// makeRaw puts the terminal f into raw mode, as cfmakeraw(3) does, so that keys
+// reach the pty unprocessed. It returns a function that restores the previous mode.
+func makeRaw(f *os.File) (func() error, error) {
+	var old syscall.Termios
+	if err := ioctl(f.Fd(), syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f.Fd(), syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return ioctl(f.Fd(), syscall.TCSETS, unsafe.Pointer(&old))
+	}, nil
+}
+
+// copyWinsize sets the window size of the terminal to to that of from.
+func copyWinsize(from, to *os.File) error {
+	var ws winsize
+	if err := ioctl(from.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return err
+	}
+	return ioctl(to.Fd(), syscall.TIOCSWINSZ, unsafe.Pointer(&ws))
+}
+
+// startOnPTY starts cmd on a pseudo-terminal of its own, with the window size of
+// tty, and puts tty into raw mode so keys reach the pty unprocessed. It returns the
+// pty's master, which reads fail on once cmd has exited, and a function that
+// restores tty and stops following its window size.
+func startOnPTY(cmd *exec.Cmd, tty *os.File) (*os.File, func(), error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not allocate a pty: %w", err)
+	}
+	if err := copyWinsize(tty, master); err != nil {
+		slog.Debug("Could not copy the window size", "error", err)
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, nil, fmt.Errorf("%w: could not start %s: %v", errCommandFailed, cmd.Args[0], err)
+	}
+	// Only cmd keeps the slave open, so reads from master fail once it exits
+	slave.Close()
+
+	restore, err := makeRaw(tty)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("could not put the terminal into raw mode: %w", err)
+	}
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			if err := copyWinsize(tty, master); err != nil {
+				slog.Debug("Could not copy the window size", "error", err)
+			}
+		}
+	}()
+
+	return master, func() {
+		signal.Stop(winch)
+		close(winch)
+		restore()
+	}, nil
+}
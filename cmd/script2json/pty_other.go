@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// errNoPTY is returned by the pty functions on platforms where they are not implemented.
+var errNoPTY = errors.New("pseudo-terminals are only supported on Linux")
+
+func startOnPTY(cmd *exec.Cmd, tty *os.File) (*os.File, func(), error) {
+	return nil, nil, errNoPTY
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// queryFilter selects records for the query subcommand. Empty fields match any
+// record.
+type queryFilter struct {
+	// typ is the record type, as named by the schema subcommand, or "all"
+	typ     string
+	session string
+	command *regexp.Regexp
+	output  *regexp.Regexp
+	since   time.Time
+	until   time.Time
+	// failed selects command records with a non-zero exit code
+	failed bool
+	// fields projects matching records onto these fields
+	fields []string
+}
+
+// queryRecord holds the fields of a record that queryFilter looks at.
+type queryRecord struct {
+	Type     string `json:"type"`
+	Session  string `json:"session"`
+	Command  string `json:"command"`
+	Output   string `json:"output"`
+	ExitCode *int   `json:"exit_code"`
+	recordTimes
+}
+
+// runQuery implements the query subcommand, which prints the records that match
+// its filters. Records are read from the files named in args, or from stdin if
+// none are given, and written as they were unless -fields picks some of their
+// fields.
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	typ := fs.String("type", "command", "Record type to select (command, summary, annotation, diagnostic, warning, error, all)")
+	session := fs.String("session", "", "Only select records of this session")
+	command := fs.String("command", "", "Only select records whose command matches this regular expression")
+	output := fs.String("output", "", "Only select records whose output matches this regular expression")
+	since := fs.String("since", "", "Only select records from this time on, as RFC 3339 or a duration before now, e.g. 1h")
+	until := fs.String("until", "", "Only select records up to this time, as RFC 3339 or a duration before now")
+	failed := fs.Bool("failed", false, "Only select commands that exited with a non-zero code")
+	fields := fs.String("fields", "", "Print only these comma-separated fields of each record")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s query [flags] [records.jsonl ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	filter := queryFilter{typ: *typ, session: *session, failed: *failed}
+	if *typ != "all" && !knownRecordType(*typ) {
+		return fmt.Errorf("%w: unknown record type: %s", errConfig, *typ)
+	}
+	var err error
+	for _, re := range []struct {
+		pattern string
+		dest    **regexp.Regexp
+		flag    string
+	}{{*command, &filter.command, "-command"}, {*output, &filter.output, "-output"}} {
+		if re.pattern == "" {
+			continue
+		}
+		if *re.dest, err = regexp.Compile(re.pattern); err != nil {
+			return fmt.Errorf("%w: invalid %s pattern: %v", errConfig, re.flag, err)
+		}
+	}
+	now := time.Now()
+	if filter.since, err = parseQueryTime(*since, now); err != nil {
+		return fmt.Errorf("%w: invalid -since: %v", errConfig, err)
+	}
+	if filter.until, err = parseQueryTime(*until, now); err != nil {
+		return fmt.Errorf("%w: invalid -until: %v", errConfig, err)
+	}
+	if *fields != "" {
+		filter.fields = strings.Split(*fields, ",")
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if fs.NArg() == 0 {
+		return queryRecords(os.Stdin, out, filter)
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open records file: %w", err)
+		}
+		err = queryRecords(f, out, filter)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// knownRecordType reports whether name is one of recordTypes.
+func knownRecordType(name string) bool {
+	for _, t := range recordTypes {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQueryTime parses a -since or -until value, an RFC 3339 time or a duration
+// before now. An empty value is the zero time.
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+	}
+	return now.Add(-d), nil
+}
+
+// queryRecords reads JSONL records from r and writes those that match filter to w.
+func queryRecords(r io.Reader, w io.Writer, filter queryFilter) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record queryRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("line %d: could not parse record: %w", lineNum, err)
+		}
+		if !filter.matches(record) {
+			continue
+		}
+		if filter.fields != nil {
+			projected, err := projectFields(line, filter.fields)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			line = projected
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+			return fmt.Errorf("could not write record: %w", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// matches reports whether record passes the filter.
+func (f queryFilter) matches(record queryRecord) bool {
+	typ := record.Type
+	if typ == "" {
+		typ = "command"
+	}
+	if f.typ != "" && f.typ != "all" && f.typ != typ {
+		return false
+	}
+	if f.session != "" && f.session != record.Session {
+		return false
+	}
+	if f.command != nil && !f.command.MatchString(record.Command) {
+		return false
+	}
+	if f.output != nil && !f.output.MatchString(record.Output) {
+		return false
+	}
+	if f.failed && (record.ExitCode == nil || *record.ExitCode == 0) {
+		return false
+	}
+	if !f.since.IsZero() || !f.until.IsZero() {
+		// Records without a timestamp can't be placed in the range
+		at := record.at()
+		if at.IsZero() || (!f.since.IsZero() && at.Before(f.since)) || (!f.until.IsZero() && at.After(f.until)) {
+			return false
+		}
+	}
+	return true
+}
+
+// projectFields returns the JSON object in line with only the named fields, in
+// their original encoding and in the given order. Missing fields are left out.
+func projectFields(line []byte, fields []string) ([]byte, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, fmt.Errorf("could not parse record: %w", err)
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for _, field := range fields {
+		value, ok := record[field]
+		if !ok {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(field)
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestQueryRecords tests selecting records by type, session, command, output, time and exit code
+func TestQueryRecords(t *testing.T) {
+	input := `{"id":"1","session":"web","command":"ls -l","output":"total 0","exit_code":0,"return_timestamp":"2025-09-29T13:24:41Z"}
+
+{"type":"summary","interval_start":"2025-09-29T13:24:00Z","interval_end":"2025-09-29T13:24:45Z"}
+{"id":"2","session":"db","command":"make","output":"error: no rule","exit_code":2,"return_timestamp":"2025-09-29T13:25:45Z"}
+{"type":"annotation","timestamp":"2025-09-29T13:25:50Z","session":"db","text":"maintenance"}
+{"id":"3","command":"pwd","output":"/root"}
+`
+	lines := strings.Split(input, "\n")
+
+	tests := []struct {
+		name     string
+		filter   queryFilter
+		expected []string
+	}{
+		{"Commands", queryFilter{typ: "command"}, []string{lines[0], lines[3], lines[5]}},
+		{"All", queryFilter{typ: "all"}, []string{lines[0], lines[2], lines[3], lines[4], lines[5]}},
+		{"Annotations", queryFilter{typ: "annotation"}, []string{lines[4]}},
+		{"Session", queryFilter{typ: "all", session: "db"}, []string{lines[3], lines[4]}},
+		{"Command", queryFilter{typ: "command", command: regexp.MustCompile(`^ls\b`)}, []string{lines[0]}},
+		{"Output", queryFilter{typ: "command", output: regexp.MustCompile(`error`)}, []string{lines[3]}},
+		{"Failed", queryFilter{typ: "command", failed: true}, []string{lines[3]}},
+		{"Since", queryFilter{typ: "all", since: time.Date(2025, 9, 29, 13, 25, 0, 0, time.UTC)}, []string{lines[3], lines[4]}},
+		{"Until", queryFilter{typ: "all", until: time.Date(2025, 9, 29, 13, 25, 0, 0, time.UTC)}, []string{lines[0], lines[2]}},
+		{"Fields", queryFilter{typ: "command", failed: true, fields: []string{"exit_code", "command", "missing"}}, []string{`{"exit_code":2,"command":"make"}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := queryRecords(strings.NewReader(input), &out, tt.filter); err != nil {
+				t.Fatalf("queryRecords failed: %v", err)
+			}
+			if expected := strings.Join(tt.expected, "\n") + "\n"; out.String() != expected {
+				t.Errorf("Output = %q, want %q", out.String(), expected)
+			}
+		})
+	}
+
+	err := queryRecords(strings.NewReader(lines[0]+"\nnot json\n"), &bytes.Buffer{}, queryFilter{})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Error = %v, want one naming line 2", err)
+	}
+}
+
+// TestParseQueryTime tests parsing -since and -until as times or durations before now
+func TestParseQueryTime(t *testing.T) {
+	now := time.Date(2025, 9, 29, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{"", time.Time{}, false},
+		{"2025-09-29T13:24:41Z", time.Date(2025, 9, 29, 13, 24, 41, 0, time.UTC), false},
+		{"90m", time.Date(2025, 9, 29, 12, 30, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseQueryTime(tt.value, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.expected) {
+			t.Errorf("parseQueryTime(%q) = %v, %v, want %v", tt.value, got, err, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// replayOptions controls how replayRecords paces its output.
+type replayOptions struct {
+	// pace waits between records for the time that passed between them originally,
+	// divided by speed
+	pace  bool
+	speed float64
+	// maxDelay caps each wait (0 for no cap), so that idle stretches don't stall a replay
+	maxDelay time.Duration
+}
+
+// runReplay implements the replay subcommand, which re-emits captured JSONL records,
+// either at once or paced by their original timestamps, for testing consumers and
+// demoing dashboards. Records are read from the files named in args, or from stdin
+// if none are given, and written to stdout or to -output.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	pace := fs.Bool("pace", false, "Wait between records for as long as passed between them when they were captured")
+	speed := fs.Float64("speed", 1, "Speed-up factor for -pace, e.g. 2 to replay twice as fast")
+	maxDelay := fs.Duration("max-delay", 0, "Longest wait between records with -pace, e.g. 5s (0 for no limit)")
+	output := fs.String("output", "", "Write records to this file or FIFO instead of stdout")
+	onOutputError := fs.String("on-output-error", "exit", "Policy when writing records fails (exit, spool, fallback)")
+	fallbackFile := fs.String("fallback-file", "", "File to write records to after a write failure with -on-output-error=fallback")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [flags] [records.jsonl ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *speed <= 0 {
+		return fmt.Errorf("%w: -speed must be greater than 0", errConfig)
+	}
+	if *maxDelay < 0 {
+		return fmt.Errorf("%w: -max-delay must not be negative", errConfig)
+	}
+	if err := validateFailurePolicy(*onOutputError, *fallbackFile); err != nil {
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		// Opening a FIFO blocks until its consumer opens it for reading
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open output: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := newOutputWriter(out, *onOutputError, *fallbackFile, slog.Default())
+	opts := replayOptions{pace: *pace, speed: *speed, maxDelay: *maxDelay}
+
+	if fs.NArg() == 0 {
+		return replayRecords(os.Stdin, w, opts, time.Sleep)
+	}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("could not open records file: %w", err)
+		}
+		err = replayRecords(f, w, opts, time.Sleep)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// recordTimes holds the timestamps that place a record in time. Command records
+// have a return_timestamp, diagnostic and progress records a timestamp, and summary
+// records an interval_end.
+type recordTimes struct {
+	ReturnTimestamp time.Time `json:"return_timestamp"`
+	Timestamp       time.Time `json:"timestamp"`
+	IntervalEnd     time.Time `json:"interval_end"`
+}
+
+// at returns when the record was emitted, or the zero time if it has no timestamp.
+func (t recordTimes) at() time.Time {
+	switch {
+	case !t.ReturnTimestamp.IsZero():
+		return t.ReturnTimestamp
+	case !t.Timestamp.IsZero():
+		return t.Timestamp
+	}
+	return t.IntervalEnd
+}
+
+// replayRecords reads JSONL records from r and writes them to w unchanged, so that
+// fields from newer or older versions survive. With opts.pace, it calls sleep
+// before each record for the time since the previous one; records without a
+// timestamp, or older than the previous one, are written without waiting.
+func replayRecords(r io.Reader, w *outputWriter, opts replayOptions, sleep func(time.Duration)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var last time.Time
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var times recordTimes
+		if err := json.Unmarshal(line, &times); err != nil {
+			return fmt.Errorf("line %d: could not parse record: %w", lineNum, err)
+		}
+		if at := times.at(); opts.pace && !at.IsZero() {
+			if !last.IsZero() && at.After(last) {
+				delay := time.Duration(float64(at.Sub(last)) / opts.speed)
+				if opts.maxDelay > 0 && delay > opts.maxDelay {
+					delay = opts.maxDelay
+				}
+				sleep(delay)
+			}
+			if at.After(last) {
+				last = at
+			}
+		}
+
+		if err := w.write(append(line[:len(line):len(line)], '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
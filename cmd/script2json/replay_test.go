@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReplayRecords tests re-emitting records unchanged, paced by their timestamps
+func TestReplayRecords(t *testing.T) {
+	input := `{"id":"1","command":"ls","return_timestamp":"2025-09-29T13:24:41Z","extra":true}
+
+{"type":"summary","interval_start":"2025-09-29T13:24:00Z","interval_end":"2025-09-29T13:24:45Z"}
+{"id":"2","command":"make","return_timestamp":"2025-09-29T13:25:45Z"}
+{"type":"error","timestamp":"2025-09-29T13:25:44Z"}
+{"id":"3","command":"pwd","return_timestamp":"0001-01-01T00:00:00Z"}
+{"id":"4","command":"id","return_timestamp":"2025-09-29T13:25:46Z"}
+`
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	tests := []struct {
+		name     string
+		opts     replayOptions
+		expected []time.Duration
+	}{
+		{"Instant", replayOptions{speed: 1}, nil},
+		{"Paced", replayOptions{pace: true, speed: 1}, []time.Duration{4 * time.Second, time.Minute, time.Second}},
+		{"Faster", replayOptions{pace: true, speed: 2}, []time.Duration{2 * time.Second, 30 * time.Second, 500 * time.Millisecond}},
+		{"Capped", replayOptions{pace: true, speed: 1, maxDelay: 10 * time.Second}, []time.Duration{4 * time.Second, 10 * time.Second, time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			var delays []time.Duration
+			sleep := func(d time.Duration) { delays = append(delays, d) }
+			if err := replayRecords(strings.NewReader(input), newOutputWriter(&out, failurePolicyExit, "", logger), tt.opts, sleep); err != nil {
+				t.Fatalf("replayRecords failed: %v", err)
+			}
+			if expected := strings.ReplaceAll(input, "\n\n", "\n"); out.String() != expected {
+				t.Errorf("Output = %q, want %q", out.String(), expected)
+			}
+			if !slices.Equal(delays, tt.expected) {
+				t.Errorf("Delays = %v, want %v", delays, tt.expected)
+			}
+		})
+	}
+
+	// Malformed records should be reported with their line number
+	var out bytes.Buffer
+	err := replayRecords(strings.NewReader("{\"id\":\"1\"}\nnot json\n"), newOutputWriter(&out, failurePolicyExit, "", logger), replayOptions{speed: 1}, nil)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected line 2 parse error, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"script2json/pkg/pipeline"
+)
+
+// bashIntegration is sourced by the shell started by the run subcommand, after the
+// user's ~/.bashrc. A DEBUG trap writes a start marker before the first command of
+// each command line runs, and PROMPT_COMMAND writes an end marker with the
+// base64-encoded command from the history once it returns. The prompt guard keeps
+// the trap from firing for PROMPT_COMMAND itself.
+const bashIntegration = `[ -f ~/.bashrc ] && . ~/.bashrc
+__script2json_in_prompt=1
+__script2json_preexec() {
+  [[ -n $__script2json_in_prompt || -n $__script2json_running || -n $COMP_LINE ]] && return
+  [[ $BASH_COMMAND == "__script2json_in_prompt=1" ]] && return
+  __script2json_running=1
+  printf '\033]6973;start\007'
+}
+__script2json_precmd() {
+  local status=$?
+  if [[ -n $__script2json_running ]]; then
+    printf '\033]6973;end;%s\007' "$(HISTTIMEFORMAT= builtin history 1 | sed '1s/^ *[0-9]*[* ] *//' | base64 | tr -d '\n')"
+  fi
+  __script2json_running=
+  return $status
+}
+trap '__script2json_preexec' DEBUG
+PROMPT_COMMAND="__script2json_in_prompt=1; __script2json_precmd${PROMPT_COMMAND:+; $PROMPT_COMMAND}; __script2json_in_prompt="
+`
+
+// runRecorder implements the run subcommand, which records a shell without script,
+// FIFOs or signals: it starts the shell on a pseudo-terminal of its own, relays it
+// to the controlling terminal, and feeds its output straight into the pipeline.
+// Only bash is supported, since the shell integration relies on its DEBUG trap.
+func runRecorder(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	parseArgv := fs.Bool("parse-argv", false, "Tokenize each command with shell quoting rules into an argv field")
+	keepColors := fs.Bool("keep-colors", false, "Keep SGR color sequences in a styled_output field alongside the plain output")
+	collapseProgress := fs.Bool("collapse-progress", false, "Collapse runs of progress lines in output into their final line")
+	newline := fs.String("newline", pipeline.NewlineRaw, "Line endings in output (lf, crlf, raw)")
+	tabWidth := fs.Int("tab-width", pipeline.DefaultTabWidth, "Distance between tab stops used to expand tabs into spaces")
+	format := fs.String("format", "json", "Output format (json, pretty)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s run [flags] [-- bash [args ...]]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *newline != pipeline.NewlineLF && *newline != pipeline.NewlineCRLF && *newline != pipeline.NewlineRaw {
+		return fmt.Errorf("%w: invalid newline mode: %s. Must be lf, crlf, or raw", errConfig, *newline)
+	}
+	if *tabWidth < 1 {
+		return fmt.Errorf("%w: invalid tab width: %d. Must be at least 1", errConfig, *tabWidth)
+	}
+	if *format != "json" && *format != "pretty" {
+		return fmt.Errorf("%w: invalid format: %s. Must be json or pretty", errConfig, *format)
+	}
+	shell := []string{"bash"}
+	if fs.NArg() > 0 {
+		shell = fs.Args()
+	}
+	if filepath.Base(shell[0]) != "bash" {
+		return fmt.Errorf("%w: unsupported shell: %s. Only bash is supported", errConfig, shell[0])
+	}
+
+	// The session is shown on the controlling terminal, leaving stdout for records
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("could not open the controlling terminal: %w", err)
+	}
+	defer tty.Close()
+
+	rcfile, err := os.CreateTemp("", "script2json-rc-*.bash")
+	if err != nil {
+		return fmt.Errorf("could not write shell integration: %w", err)
+	}
+	defer os.Remove(rcfile.Name())
+	_, err = rcfile.WriteString(bashIntegration)
+	if closeErr := rcfile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write shell integration: %w", err)
+	}
+
+	cmd := exec.Command(shell[0], append([]string{"--rcfile", rcfile.Name()}, shell[1:]...)...)
+	master, stop, err := startOnPTY(cmd, tty)
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	defer stop()
+
+	scriptFifoByteChan := make(chan []byte, byteBufferSize)
+	commandOutputChan := make(chan commandOutput, outputBufferSize)
+	commandChan := make(chan commandInfo, commandBufferSize)
+
+	go io.Copy(master, tty)
+	sess := defaultSession(scriptFifoByteChan)
+	go markerStreamReader(sess, master, tty, commandChan, slog.Default())
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{
+		EditorOptions: pipeline.EditorOptions{TabWidth: *tabWidth, KeepColors: *keepColors},
+	}, slog.Default())
+	// recordCreator returns once the shell has exited and its last output is written
+	color, _ := colorEnabled("auto", os.Stdout)
+	recordCreator(commandOutputChan, commandChan, recordOptions{
+		parseArgv:        *parseArgv,
+		format:           *format,
+		color:            color,
+		collapseProgress: *collapseProgress,
+		newline:          *newline,
+	})
+
+	return waitCommand(cmd)
+}
+
+// waitCommand waits for cmd to exit, and reports an errCommandFailed if it failed.
+func waitCommand(cmd *exec.Cmd) error {
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: %s exited with status %d", errCommandFailed, cmd.Args[0], exitErr.ExitCode())
+		}
+		return fmt.Errorf("%w: %v", errCommandFailed, err)
+	}
+	return nil
+}
+
+// markerStreamReader reads a terminal byte stream that carries integration markers,
+// relays it without the markers to display and, while a command runs, to the
+// session's scriptFifoByteChan. It takes the place of the signal handlers: the start
+// marker starts reading, and the end marker sends an EOF to close the command's
+// output. An "end;<base64 command>" marker, as written by the run subcommand's shell
+// integration, also sends the command to commandChan; a bare "end" leaves the command
+// to the command FIFO.
+func markerStreamReader(sess *session, r io.Reader, display io.Writer, commandChan chan<- commandInfo, logger *slog.Logger) {
+	defer close(sess.scriptFifoByteChan)
+	readMarkerStream(sess, r, display, commandChan, logger)
+}
+
+// readMarkerStream does the work of markerStreamReader without closing the
+// session's scriptFifoByteChan at the end of r.
+func readMarkerStream(sess *session, r io.Reader, display io.Writer, commandChan chan<- commandInfo, logger *slog.Logger) {
+	// shown is the text of the current read, and pending the part of it that hasn't
+	// been fed to the session, which is fed before each marker acts
+	var shown, pending []byte
+	feed := func() {
+		// Out-of-band starts, such as over the signal socket, may come late
+		sess.paused.feed(sess, pending)
+		pending = pending[:0]
+	}
+	filter := &pipeline.MarkerFilter{
+		Text: func(b byte) {
+			shown = append(shown, b)
+			pending = append(pending, b)
+		},
+		Marker: func(payload string) {
+			feed()
+			switch {
+			case payload == "start":
+				// The output starts right after the marker, so nothing before it belongs to the command
+				sess.paused.discard()
+				sess.state.Start()
+			case payload == "end" || strings.HasPrefix(payload, "end;"):
+				// A stray end marker has no output to pair the command with
+				if !sess.state.Stop() {
+					return
+				}
+				if encoded, ok := strings.CutPrefix(payload, "end;"); ok && commandChan != nil {
+					command, err := base64.StdEncoding.DecodeString(encoded)
+					if err != nil {
+						logger.Warn("Could not decode command from shell integration", "error", err)
+					}
+					commandChan <- commandInfo{command: strings.TrimRight(string(command), "\n")}
+				}
+				sess.scriptFifoByteChan <- endOfOutput
+			default:
+				logger.Debug("Ignoring unknown shell integration marker", "payload", payload)
+			}
+		},
+	}
+
+	buf := make([]byte, scriptReadSize)
+	for {
+		n, err := r.Read(buf)
+		shown = shown[:0]
+		for _, b := range buf[:n] {
+			filter.WriteByte(b)
+		}
+		feed()
+		if len(shown) > 0 {
+			display.Write(shown)
+		}
+		if err != nil {
+			// Linux reports EIO on a pty master once the shell has exited and the slave is closed
+			if err != io.EOF && !errors.Is(err, syscall.EIO) && !inputClosed(err) {
+				reportError(logger, pipeline.StageScript, fmt.Errorf("reading terminal byte stream: %w", err))
+			}
+			return
+		}
+	}
+}
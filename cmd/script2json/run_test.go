@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestMarkerStreamReader tests that markers start reading and end commands, and are hidden from the display
+func TestMarkerStreamReader(t *testing.T) {
+	defer single.state.Reset()
+	single.state.Reset()
+
+	command := base64.StdEncoding.EncodeToString([]byte("echo hello\n"))
+	input := "$ echo hello\r\n\x1b]6973;start\x07hello\r\n\x1b]6973;end;" + command + "\x07$ "
+
+	var display bytes.Buffer
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandChan := make(chan commandInfo, 1)
+	markerStreamReader(defaultSession(scriptFifoByteChan), strings.NewReader(input), &display, commandChan, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if display.String() != "$ echo hello\r\nhello\r\n$ " {
+		t.Errorf("Display = %q, want %q", display.String(), "$ echo hello\r\nhello\r\n$ ")
+	}
+	if got := readStream(scriptFifoByteChan); got != "hello\r\n\x04" {
+		t.Errorf("Stream = %q, want %q", got, "hello\r\n\x04")
+	}
+	if cmd := <-commandChan; cmd.command != "echo hello" {
+		t.Errorf("Command = %q, want %q", cmd.command, "echo hello")
+	}
+	if single.recording() {
+		t.Error("Reading should stop at the end marker")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// recordTypes are the kinds of JSON lines that script2json writes, with the value
+// of their type field. Command records have none.
+var recordTypes = []struct {
+	name   string
+	record any
+	typ    string
+}{
+	{"command", pipeline.CommandRecord{}, ""},
+	{"summary", SummaryRecord{}, "summary"},
+	{"annotation", AnnotationRecord{}, "annotation"},
+	{"diagnostic", DiagnosticRecord{}, "diagnostic"},
+	{"warning", WarningRecord{}, "warning"},
+	{"error", ErrorRecord{}, "error"},
+}
+
+// jsonSchemaer is implemented by types with their own JSON encoding, which
+// describe it instead of the fields they hold.
+type jsonSchemaer interface {
+	JSONSchema() map[string]any
+}
+
+// runSchema implements the schema subcommand, which prints the JSON Schema of a
+// record type, generated from the record's Go type so it can't fall behind.
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	names := make([]string, len(recordTypes))
+	for i, t := range recordTypes {
+		names[i] = t.name
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s schema [%s]\n", os.Args[0], strings.Join(names, "|"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	name := "command"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		name = fs.Arg(0)
+	default:
+		fs.Usage()
+		return fmt.Errorf("%w: schema takes at most one record type", errConfig)
+	}
+	schema, err := recordSchema(name)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errConfig, err)
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", data)
+	return err
+}
+
+// recordSchema returns the JSON Schema of the record type called name.
+func recordSchema(name string) (map[string]any, error) {
+	for _, t := range recordTypes {
+		if t.name != name {
+			continue
+		}
+		schema := typeSchema(reflect.TypeOf(t.record))
+		schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+		schema["title"] = reflect.TypeOf(t.record).Name()
+		if t.typ != "" {
+			schema["properties"].(map[string]any)["type"] = map[string]any{"const": t.typ}
+		}
+		return schema, nil
+	}
+	return nil, fmt.Errorf("unknown record type: %s", name)
+}
+
+// typeSchema returns the JSON Schema of the encoding/json encoding of t.
+func typeSchema(t reflect.Type) map[string]any {
+	if s, ok := reflect.New(t).Elem().Interface().(jsonSchemaer); ok {
+		return s.JSONSchema()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		for i := range t.NumField() {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			name, opts, _ := strings.Cut(tag, ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = typeSchema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]any{}
+}
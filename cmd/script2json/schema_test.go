@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestRecordSchema tests generating the JSON Schema of record types from their Go types
+func TestRecordSchema(t *testing.T) {
+	for _, typ := range recordTypes {
+		schema, err := recordSchema(typ.name)
+		if err != nil {
+			t.Fatalf("recordSchema(%q) failed: %v", typ.name, err)
+		}
+		properties := schema["properties"].(map[string]any)
+		if typ.typ != "" && properties["type"].(map[string]any)["const"] != typ.typ {
+			t.Errorf("%s: type = %v, want const %q", typ.name, properties["type"], typ.typ)
+		}
+	}
+
+	schema, _ := recordSchema("annotation")
+	required := schema["required"].([]string)
+	if !slices.Equal(required, []string{"type", "timestamp", "text"}) {
+		t.Errorf("Required = %v, want omitempty fields left out", required)
+	}
+	timestamp := schema["properties"].(map[string]any)["timestamp"].(map[string]any)
+	if timestamp["format"] != "date-time" {
+		t.Errorf("Timestamp = %v, want a date-time string", timestamp)
+	}
+
+	if _, err := recordSchema("nope"); err == nil {
+		t.Error("recordSchema should fail for an unknown record type")
+	}
+}
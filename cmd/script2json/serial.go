@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultSerialBaud is the baud rate of a --serial device given without one.
+const defaultSerialBaud = 115200
+
+// parseSerialSpec parses a --serial value, "path[,baud]".
+func parseSerialSpec(spec string) (path string, baud int, err error) {
+	path, rate, hasRate := strings.Cut(spec, ",")
+	if path == "" {
+		return "", 0, fmt.Errorf("invalid serial device %q: missing path", spec)
+	}
+	baud = defaultSerialBaud
+	if hasRate {
+		if baud, err = strconv.Atoi(rate); err != nil || baud <= 0 {
+			return "", 0, fmt.Errorf("invalid serial device %q: invalid baud rate %q", spec, rate)
+		}
+	}
+	return path, baud, nil
+}
+
+// serialTransport reads the terminal byte stream of a serial console. Unlike a
+// FIFO, the device has no writers coming and going, so it is opened once and read
+// until it goes away, like stdin.
+type serialTransport struct {
+	path   string
+	baud   int
+	opened atomic.Bool
+}
+
+// newSerialTransport returns a transport for the serial device at path.
+func newSerialTransport(path string, baud int) *serialTransport {
+	return &serialTransport{path: path, baud: baud}
+}
+
+// Create does nothing; the device is configured when it is opened.
+func (t *serialTransport) Create(logger *slog.Logger) error {
+	logger.Debug("Reading from serial device", "path", t.path, "baud", t.baud)
+	return nil
+}
+
+// Open opens the device and puts it into raw mode at the transport's baud rate. It
+// returns errTransportClosed once the device has been opened.
+func (t *serialTransport) Open() (io.ReadCloser, error) {
+	if t.opened.Swap(true) {
+		return nil, errTransportClosed
+	}
+	return openSerial(t.path, t.baud)
+}
+
+// Close does nothing; the reader stops when the device goes away.
+func (t *serialTransport) Close() error {
+	return nil
+}
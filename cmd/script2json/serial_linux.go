@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// cbaud masks the speed bits of c_cflag; the syscall package does not define it.
+const cbaud = 0o10017
+
+// serialBaudRates maps the supported baud rates to their termios speeds.
+var serialBaudRates = map[int]uint32{
+	1200: syscall.B1200, 2400: syscall.B2400, 4800: syscall.B4800, 9600: syscall.B9600,
+	19200: syscall.B19200, 38400: syscall.B38400, 57600: syscall.B57600,
+	115200: syscall.B115200, 230400: syscall.B230400, 460800: syscall.B460800,
+	500000: syscall.B500000, 921600: syscall.B921600, 1000000: syscall.B1000000,
+	1500000: syscall.B1500000, 2000000: syscall.B2000000, 3000000: syscall.B3000000,
+	4000000: syscall.B4000000,
+}
+
+// openSerial opens the serial device at path for reading and puts it into raw mode,
+// 8N1 at baud. The device is opened without blocking, since without CLOCAL the open
+// waits for a carrier that many consoles never raise.
+func openSerial(path string, baud int) (*os.File, error) {
+	speed, ok := serialBaudRates[baud]
+	if !ok {
+		return nil, fmt.Errorf("unsupported baud rate %d", baud)
+	}
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NOCTTY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	var tio syscall.Termios
+	if err := ioctl(uintptr(fd), syscall.TCGETS, unsafe.Pointer(&tio)); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("%s is not a serial device: %w", path, err)
+	}
+	tio.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF
+	tio.Oflag &^= syscall.OPOST
+	tio.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	tio.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.CSTOPB | cbaud
+	tio.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL | speed
+	tio.Ispeed, tio.Ospeed = speed, speed
+	tio.Cc[syscall.VMIN] = 1
+	tio.Cc[syscall.VTIME] = 0
+	if err := ioctl(uintptr(fd), syscall.TCSETS, unsafe.Pointer(&tio)); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("could not configure %s: %w", path, err)
+	}
+
+	// With CLOCAL set, reads can block as usual
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
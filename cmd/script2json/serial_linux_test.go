@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSerialTransport tests reading a pseudo-terminal as if it were a serial console
+func TestSerialTransport(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Skipf("Could not open a pseudo-terminal: %v", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	transport := newSerialTransport(slave.Name(), 9600)
+	if err := transport.Create(slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	f, err := transport.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	// Raw mode passes carriage returns through untranslated
+	if _, err := master.Write([]byte("Router>\r")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(buf) != "Router>\r" {
+		t.Errorf("Read %q, want %q", buf, "Router>\r")
+	}
+
+	if _, err := transport.Open(); err != errTransportClosed {
+		t.Errorf("Second Open = %v, want errTransportClosed", err)
+	}
+}
+
+// TestOpenSerialErrors tests that unusable devices are rejected
+func TestOpenSerialErrors(t *testing.T) {
+	regular := filepath.Join(t.TempDir(), "not-a-tty")
+	if err := os.WriteFile(regular, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path string
+		baud int
+	}{
+		{regular, 9600},
+		{filepath.Join(t.TempDir(), "missing"), 9600},
+		{"/dev/ptmx", 12345},
+	} {
+		if f, err := openSerial(tt.path, tt.baud); err == nil {
+			f.Close()
+			t.Errorf("openSerial(%q, %d) succeeded, want error", tt.path, tt.baud)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// TestParseSerialSpec tests parsing --serial values
+func TestParseSerialSpec(t *testing.T) {
+	tests := []struct {
+		spec  string
+		path  string
+		baud  int
+		valid bool
+	}{
+		{"/dev/ttyUSB0", "/dev/ttyUSB0", defaultSerialBaud, true},
+		{"/dev/ttyS1,9600", "/dev/ttyS1", 9600, true},
+		{"/dev/ttyS1,fast", "", 0, false},
+		{"/dev/ttyS1,-9600", "", 0, false},
+		{",9600", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		path, baud, err := parseSerialSpec(tt.spec)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseSerialSpec(%q) error = %v, want valid %v", tt.spec, err, tt.valid)
+			continue
+		}
+		if path != tt.path || baud != tt.baud {
+			t.Errorf("parseSerialSpec(%q) = %q, %d, want %q, %d", tt.spec, path, baud, tt.path, tt.baud)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"script2json/pkg/pipeline"
+)
+
+// session holds the state of one capture pipeline. The single-session mode uses the
+// state in single, which SIGUSR1 and SIGUSR2 control; sessions defined with
+// --session each have their own, and are controlled by integration markers in their
+// byte streams instead, since a signal cannot say which session it is meant for.
+type session struct {
+	// name tags the session's records; it is empty in the single-session mode
+	name            string
+	scriptFifoPath  string
+	commandFifoPath string
+	// scriptTransport and commandTransport deliver the session's byte stream and
+	// commands; they are nil for the single-session mode
+	scriptTransport  InputTransport
+	commandTransport InputTransport
+	// state is where the session is in recording a command; it is shared by the
+	// copies that defaultSession makes of single
+	state *pipeline.SessionMachine
+	// markers is set if integration markers, rather than signals, start and stop reading
+	markers bool
+	// scriptFifoByteChan carries the session's terminal bytes to its lineEditor in
+	// chunks, with endOfOutput after each command's output
+	scriptFifoByteChan     chan []byte
+	resetChan              chan struct{}
+	recordCreatorResetChan chan struct{}
+	// dumpChan asks lineEditor to write a DiagnosticRecord of its current state to
+	// the given writer. SIGQUIT sends os.Stderr.
+	dumpChan chan io.Writer
+	// drainChan carries the requests to drain the pipeline at shutdown, each of
+	// which is closed once the output before it has been recorded
+	drainChan chan chan struct{}
+	// annotations carries annotation texts to the session's recordCreator
+	annotations chan string
+	// paused holds the bytes read while the session isn't reading
+	paused *pauseBuffer
+	// done is closed when the session's byte stream ends; it is nil for the
+	// single-session mode, which runs until the process exits
+	done chan struct{}
+	// conn is the connection of an input socket session, which is its input in
+	// place of the transports
+	conn net.Conn
+	// peer identifies the writer of an input socket session
+	peer *pipeline.PeerIdentity
+	// owner is the uid of the user the session belongs to, who may see and control
+	// it through the gRPC API; it is nil for the single-session mode
+	owner *int
+	// host is the destination of an ssh session
+	host string
+	// container is the container of an exec session
+	container *pipeline.ContainerInfo
+	// kubernetes is the pod of a kubectl exec session
+	kubernetes *pipeline.KubernetesInfo
+	// stats are reported by the HTTP status endpoint
+	stats *sessionStats
+}
+
+// sessionStats counts a session's progress for status queries.
+type sessionStats struct {
+	records atomic.Uint64
+	// lastRecordAt is when the last record was written, in Unix nanoseconds
+	lastRecordAt atomic.Int64
+	// bufferBytes is the number of bytes of the current command's output received so far
+	bufferBytes atomic.Int64
+	// bytesProcessed is the number of bytes of the terminal stream processed so far
+	bytesProcessed atomic.Uint64
+	// droppedOutputs and droppedCommands are the outputs and commands dropped by
+	// the overflow policy
+	droppedOutputs  atomic.Uint64
+	droppedCommands atomic.Uint64
+}
+
+// markerBoundaries makes the single-session mode start and stop reading on
+// integration markers in its byte stream, as --session sessions do, instead of on
+// SIGUSR1 and SIGUSR2 (--markers). Windows always does.
+var markerBoundaries bool
+
+// single is the state of the single-session mode, which SIGUSR1 and SIGUSR2 act on.
+var single = newSessionState("")
+
+// newSessionState returns a session named name with its state machine, control
+// channels, pause buffer and stats set up and nothing else.
+func newSessionState(name string) *session {
+	return &session{
+		name:                   name,
+		state:                  pipeline.NewSessionMachine(name, nil),
+		resetChan:              make(chan struct{}, 1),
+		recordCreatorResetChan: make(chan struct{}, 1),
+		dumpChan:               make(chan io.Writer, 1),
+		drainChan:              make(chan chan struct{}, 1),
+		annotations:            make(chan string, annotationQueueSize),
+		paused:                 new(pauseBuffer),
+		stats:                  new(sessionStats),
+	}
+}
+
+// endOfOutput is the message on a scriptFifoByteChan that ends a command's output,
+// so that lineEditor flushes it. Chunks of bytes are never empty, so it can't be
+// mistaken for one.
+var endOfOutput []byte
+
+// recording reports whether sess is recording a command, so its bytes are output.
+func (s *session) recording() bool {
+	return s.state.State() == pipeline.StateRecording
+}
+
+// defaultSession returns the single-session mode's session, which shares the state
+// in single, with scriptFifoByteChan as its byte stream.
+func defaultSession(scriptFifoByteChan chan []byte) *session {
+	sess := *single
+	sess.scriptFifoByteChan = scriptFifoByteChan
+	sess.markers = startReadingSignal == nil || markerBoundaries
+	return &sess
+}
+
+// processUID is the uid of the user running script2json, who sees every session.
+// It is -1 on Windows, which has no uids.
+var processUID = os.Getuid()
+
+// newSession returns a marker-controlled session with state of its own.
+func newSession(name, scriptFifoPath, commandFifoPath string) *session {
+	sess := newSessionState(name)
+	sess.scriptFifoPath = scriptFifoPath
+	sess.commandFifoPath = commandFifoPath
+	sess.scriptTransport = transportFor(name, scriptFifoPath)
+	sess.commandTransport = transportFor(name, commandFifoPath)
+	sess.markers = true
+	sess.scriptFifoByteChan = make(chan []byte, byteBufferSize)
+	sess.done = make(chan struct{})
+	// Sessions belong to the user running script2json unless their writer is known
+	if uid := processUID; uid >= 0 {
+		sess.owner = &uid
+	}
+	return sess
+}
+
+// scopeFor returns the owner whose sessions the user uid may see and control, or
+// nil for every session if uid is root or the user running script2json.
+func scopeFor(uid int) *int {
+	if uid == 0 || uid == processUID {
+		return nil
+	}
+	return &uid
+}
+
+// ownedBy reports whether sess is visible in scope, as returned by scopeFor.
+func (s *session) ownedBy(scope *int) bool {
+	return scope == nil || (s.owner != nil && *s.owner == *scope)
+}
+
+// sessionFlags collects repeated --session name:scriptfifo:commandfifo definitions.
+type sessionFlags []*session
+
+func (s *sessionFlags) String() string {
+	names := make([]string, len(*s))
+	for i, sess := range *s {
+		names[i] = sess.name
+	}
+	return strings.Join(names, ",")
+}
+
+func (s *sessionFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("invalid session %q: want name:scriptfifo:commandfifo", value)
+	}
+	for _, sess := range *s {
+		if sess.name == parts[0] {
+			return fmt.Errorf("duplicate session name: %s", parts[0])
+		}
+	}
+	*s = append(*s, newSession(parts[0], parts[1], parts[2]))
+	return nil
+}
+
+// closeInput closes the input of sess, its transports or its connection, so that
+// its readers stop and its pipeline ends.
+func (s *session) closeInput() {
+	if s.conn != nil {
+		s.conn.Close()
+		return
+	}
+	if s.scriptTransport != nil {
+		s.scriptTransport.Close()
+	}
+	if s.commandTransport != nil {
+		s.commandTransport.Close()
+	}
+}
+
+// errShuttingDown is returned by sessionRegistry.add once shutdown has begun.
+var errShuttingDown = errors.New("shutting down")
+
+// sessionRegistry tracks the running sessions, which the control socket can add to
+// at runtime. It is safe for concurrent use.
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions []*session
+	// closed is set by close, after which no session can be added
+	closed bool
+}
+
+// newSessionRegistry returns a registry of the given sessions.
+func newSessionRegistry(sessions ...*session) *sessionRegistry {
+	return &sessionRegistry{sessions: sessions}
+}
+
+// add registers sess, whose name must not be in use by a running session. Until it
+// is removed, sess holds pipelines, so that shutdown waits for it to end. Once
+// shutdown has begun, add fails with errShuttingDown.
+func (r *sessionRegistry) add(sess *session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errShuttingDown
+	}
+	for _, other := range r.sessions {
+		if other.name == sess.name {
+			return fmt.Errorf("duplicate session name: %s", sess.name)
+		}
+	}
+	r.sessions = append(r.sessions, sess)
+	pipelines.Add(1)
+	return nil
+}
+
+// remove unregisters sess, freeing its name and releasing its hold on pipelines.
+func (r *sessionRegistry) remove(sess *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.Index(r.sessions, sess); i >= 0 {
+		r.sessions = slices.Delete(r.sessions, i, i+1)
+		pipelines.Done()
+	}
+}
+
+// close stops sessions from being added, for shutdown, and returns the running
+// ones.
+func (r *sessionRegistry) close() []*session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return slices.Clone(r.sessions)
+}
+
+// list returns the running sessions.
+func (r *sessionRegistry) list() []*session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.sessions)
+}
+
+// startSession registers sess, creates its FIFOs and starts its pipeline, reading
+// commands as readerOpts says. The session ends, and is unregistered, when the
+// writer of its script FIFO closes it.
+func startSession(sess *session, registry *sessionRegistry, readerOpts commandReaderOptions, editorOpts editorOptions, recordOpts recordOptions, logger *slog.Logger) error {
+	if err := registry.add(sess); err != nil {
+		return err
+	}
+	logger = logger.With("session", sess.name)
+	if err := sess.scriptTransport.Create(logger); err != nil {
+		registry.remove(sess)
+		return fmt.Errorf("%w: could not create script fifo: %v", errFIFOSetup, err)
+	}
+	if err := sess.commandTransport.Create(logger); err != nil {
+		sess.scriptTransport.Close()
+		registry.remove(sess)
+		return fmt.Errorf("%w: could not create command fifo: %v", errFIFOSetup, err)
+	}
+
+	commandChan := make(chan commandInfo, commandBufferSize)
+	pipelines.run(func() {
+		sessionFifoReader(sess, logger)
+		// Wake the command FIFO reader if it is waiting for a writer, so it stops,
+		// and release the FIFOs' locks before the name can be registered again
+		sess.scriptTransport.Close()
+		sess.commandTransport.Close()
+		registry.remove(sess)
+		close(sess.done)
+		logger.Info("Session ended")
+	})
+	readerOpts.session = sess
+	pipelines.run(func() { commandFifoReader(sess.commandTransport, commandChan, readerOpts, logger) })
+	startPipeline(sess, commandChan, editorOpts, recordOpts, logger)
+
+	logger.Info("Session started", "script_fifo_path", sess.scriptFifoPath, "command_fifo_path", sess.commandFifoPath)
+	events.FireSessionStart(sess.name)
+	return nil
+}
+
+// startPipeline starts the lineEditor and recordCreator of sess, which reconstruct
+// the output from its scriptFifoByteChan and pair it with the commands on commandChan.
+func startPipeline(sess *session, commandChan <-chan commandInfo, editorOpts editorOptions, recordOpts recordOptions, logger *slog.Logger) {
+	commandOutputChan := make(chan commandOutput, outputBufferSize)
+	editorOpts.session, recordOpts.session = sess, sess
+	pipelines.run(func() { lineEditor(sess.scriptFifoByteChan, commandOutputChan, editorOpts, logger) })
+	pipelines.run(func() { recordCreator(commandOutputChan, commandChan, recordOpts) })
+}
+
+// sessionFifoReader opens the session's script FIFO and reads it until the writer
+// closes it, starting and stopping reading at the integration markers in the stream.
+func sessionFifoReader(sess *session, logger *slog.Logger) {
+	f, err := sess.scriptTransport.Open()
+	if err != nil {
+		// Only this session fails; the others keep running
+		reportError(logger, pipeline.StageScript, fmt.Errorf("opening script FIFO: %w", err))
+		close(sess.scriptFifoByteChan)
+		return
+	}
+	defer f.Close()
+
+	logger.Debug("Script FIFO opened for reading")
+	markerStreamReader(sess, f, io.Discard, nil, logger)
+}
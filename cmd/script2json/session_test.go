@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestSessionFlags tests parsing of --session definitions
+func TestSessionFlags(t *testing.T) {
+	var sessions sessionFlags
+	if err := sessions.Set("web:/tmp/web.fifo:/tmp/web.cmd"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := sessions.Set("db:/tmp/db.fifo:/tmp/db:cmd"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if sessions.String() != "web,db" {
+		t.Errorf("String = %q, want %q", sessions.String(), "web,db")
+	}
+	if sess := sessions[1]; sess.scriptFifoPath != "/tmp/db.fifo" || sess.commandFifoPath != "/tmp/db:cmd" || !sess.markers {
+		t.Errorf("Session = %+v", sess)
+	}
+
+	for _, value := range []string{"web:/tmp/a:/tmp/b", "nopaths", "x::/tmp/b", ":/tmp/a:/tmp/b"} {
+		if err := sessions.Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+// TestScopeFor tests that root and the user running script2json see every
+// session and other users only their own
+func TestScopeFor(t *testing.T) {
+	if scopeFor(0) != nil || scopeFor(processUID) != nil {
+		t.Error("Root and the user running script2json should see every session")
+	}
+	other := processUID + 1000
+	scope := scopeFor(other)
+	if scope == nil || *scope != other {
+		t.Fatalf("scopeFor(%d) = %v, want the user's own sessions", other, scope)
+	}
+	owned, unowned, mine := newSession("owned", "", ""), newSession("unowned", "", ""), newSession("mine", "", "")
+	owned.owner, unowned.owner = &other, nil
+	if !owned.ownedBy(scope) || unowned.ownedBy(scope) || mine.ownedBy(scope) {
+		t.Error("A user should only see the sessions they own")
+	}
+	if !unowned.ownedBy(nil) || !owned.ownedBy(nil) {
+		t.Error("Without a scope, every session should be visible")
+	}
+}
+
+// TestSessionPipelines tests that concurrent sessions keep their own state and tag their records
+func TestSessionPipelines(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	streams := map[string]string{
+		"web": "$ \x1b]6973;start\x07nginx ok\r\n\x1b]6973;end\x07$ ",
+		"db":  "$ ls\r\n$ \x1b]6973;start\x07postgres ok\r\n\x1b]6973;end\x07$ ",
+	}
+	commands := map[string]string{"web": "systemctl status nginx", "db": "systemctl status postgres"}
+
+	var buf bytes.Buffer
+	for name, stream := range streams {
+		sess := newSession(name, "", "")
+		commandOutputChan := make(chan commandOutput, 1)
+		commandChan := make(chan commandInfo, 1)
+		commandChan <- commandInfo{command: commands[name]}
+
+		go markerStreamReader(sess, strings.NewReader(stream), io.Discard, nil, logger)
+		go lineEditor(sess.scriptFifoByteChan, commandOutputChan, editorOptions{session: sess}, logger)
+		go recordCreator(commandOutputChan, commandChan, recordOptions{session: sess, stdout: &buf})
+	}
+
+	// Give the pipelines time to process
+	time.Sleep(100 * time.Millisecond)
+	output := sinkOutput(&buf)
+
+	outputs := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var record pipeline.CommandRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse record JSON: %v\nOutput: %s", err, output)
+		}
+		if record.Command != commands[record.Session] {
+			t.Errorf("Session %q: command = %q, want %q", record.Session, record.Command, commands[record.Session])
+		}
+		// Sessions without a known writer belong to the user running script2json
+		if processUID >= 0 && (record.OwnerUID == nil || *record.OwnerUID != processUID) {
+			t.Errorf("Session %q: owner_uid = %v, want %d", record.Session, record.OwnerUID, processUID)
+		}
+		outputs[record.Session] = record.Output
+	}
+	expected := map[string]string{"web": "nginx ok\r\n", "db": "postgres ok\r\n"}
+	if len(outputs) != len(expected) || outputs["web"] != expected["web"] || outputs["db"] != expected["db"] {
+		t.Errorf("Outputs = %q, want %q", outputs, expected)
+	}
+	if single.recording() {
+		t.Errorf("Sessions should not change the state of the single-session mode, state is %v", single.state.State())
+	}
+}
+
+// sinkOutput returns what the record sinks of running pipelines have written to
+// buf, reading it under the lock they write it under
+func sinkOutput(buf *bytes.Buffer) string {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	return buf.String()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// shutdownTimeout is how long SIGINT and SIGTERM wait for the sessions to drain
+// (--shutdown-timeout). Zero exits at once, dropping what is in flight.
+var shutdownTimeout = 5 * time.Second
+
+// goroutines tracks a set of goroutines, so that shutdown can wait for them.
+type goroutines struct {
+	sync.WaitGroup
+}
+
+// run runs f in a goroutine that g tracks.
+func (g *goroutines) run(f func()) {
+	g.Add(1)
+	go func() {
+		defer g.Done()
+		f()
+	}()
+}
+
+// wait waits until the goroutines have finished, giving up after timeout, and
+// reports whether they finished.
+func (g *goroutines) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		g.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// pipelines tracks the goroutines of every session's pipeline: its readers, its
+// lineEditor and its recordCreator, which wait for their own helpers. main holds
+// it with holdPipelines until shutdownPipelines, so that sessions can start, and
+// add to it, until then.
+var pipelines goroutines
+
+// holdPipelines keeps pipelines from finishing until shutdownPipelines.
+func holdPipelines() {
+	pipelines.Add(1)
+}
+
+// shutdownPipelines drains the sessions of registry, then stops them in dependency
+// order: it closes their inputs, so that their readers stop and close the channels
+// that their lineEditor and then their recordCreator wait on, and waits for all of
+// their goroutines to finish. No session can start meanwhile. It gives up after
+// timeout and reports whether everything was recorded and every goroutine finished.
+func shutdownPipelines(registry *sessionRegistry, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	drained := timeout > 0 && drainSessions(registry.list(), timeout)
+	for _, sess := range registry.close() {
+		sess.closeInput()
+	}
+	pipelines.Done()
+	return pipelines.wait(time.Until(deadline)) && drained
+}
+
+// drainSessions stops sessions from taking new bytes, turns the output of the
+// commands they are reading into records, and waits until everything they have
+// read is recorded and their output flushed. It gives up after timeout and
+// reports whether every session drained. Sessions that end meanwhile are skipped.
+func drainSessions(sessions []*session, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	pending := make(map[*session]chan struct{}, len(sessions))
+	for _, sess := range sessions {
+		if sess.paused.close(sess) {
+			select {
+			case sess.scriptFifoByteChan <- endOfOutput:
+			case <-sess.done:
+				continue
+			case <-deadline:
+				return false
+			}
+		}
+		drained := make(chan struct{})
+		select {
+		case sess.drainChan <- drained:
+			pending[sess] = drained
+		case <-sess.done:
+		case <-deadline:
+			return false
+		}
+	}
+	for sess, drained := range pending {
+		select {
+		case <-drained:
+		case <-sess.done:
+		case <-deadline:
+			return false
+		}
+	}
+	return true
+}
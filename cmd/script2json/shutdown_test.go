@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestDrainSessions tests that draining records the output of the command being
+// read, and stops the session from reading again
+func TestDrainSessions(t *testing.T) {
+	sess := newSession("web", "", "")
+	commandChan := make(chan commandInfo, 2)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var buf bytes.Buffer
+	startPipeline(sess, commandChan, editorOptions{}, recordOptions{stdout: &buf}, logger)
+	startReading(sess)
+	sess.paused.feed(sess, []byte("partial output"))
+	commandChan <- commandInfo{command: "make"}
+	if !drainSessions([]*session{sess}, 5*time.Second) {
+		t.Fatal("drainSessions timed out")
+	}
+	var record pipeline.CommandRecord
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &record); err != nil {
+		t.Fatalf("Failed to parse record JSON: %v\nOutput: %s", err, buf.String())
+	}
+	if record.Command != "make" || record.Output != "partial output" || record.Session != "web" {
+		t.Errorf("Record = %+v", record)
+	}
+
+	startReading(sess)
+	if sess.recording() {
+		t.Error("A drained session started reading again")
+	}
+}
+
+// TestDrainSessionsTimeout tests that draining gives up on a pipeline that is stuck
+func TestDrainSessionsTimeout(t *testing.T) {
+	sess := newSession("web", "", "")
+	// Nothing reads the drain request
+	sess.drainChan = make(chan chan struct{})
+	if drainSessions([]*session{sess}, 50*time.Millisecond) {
+		t.Error("drainSessions succeeded without a pipeline")
+	}
+
+	// A session that ended is skipped
+	close(sess.done)
+	if !drainSessions([]*session{sess}, time.Second) {
+		t.Error("drainSessions waited for a session that ended")
+	}
+}
+
+// TestShutdownOrder tests that closing the inputs of a pipeline whose writers are
+// still open ends its readers, lineEditor and recordCreator in turn, writing the
+// records read before
+func TestShutdownOrder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	scriptR, scriptW := io.Pipe()
+	commandR, commandW := io.Pipe()
+	defer scriptW.Close()
+	defer commandW.Close()
+	sess := newSession("web", "", "")
+	sess.scriptTransport, sess.commandTransport = newMemoryTransport(scriptR), newMemoryTransport(commandR)
+
+	var buf bytes.Buffer
+	var g goroutines
+	commandChan := make(chan commandInfo, 4)
+	commandOutputChan := make(chan commandOutput, 4)
+	g.run(func() { sessionFifoReader(sess, logger) })
+	g.run(func() {
+		commandFifoReader(sess.commandTransport, commandChan, commandReaderOptions{session: sess, framing: commandFramingNewline}, logger)
+	})
+	g.run(func() { lineEditor(sess.scriptFifoByteChan, commandOutputChan, editorOptions{session: sess}, logger) })
+	g.run(func() { recordCreator(commandOutputChan, commandChan, recordOptions{session: sess, stdout: &buf}) })
+
+	commandW.Write([]byte("make\n"))
+	scriptW.Write([]byte("\x1b]6973;start\x07built"))
+	// The last byte written may not have been passed on yet
+	for sess.stats.bytesProcessed.Load() < uint64(len("built")) {
+		time.Sleep(time.Millisecond)
+	}
+	if !drainSessions([]*session{sess}, 5*time.Second) {
+		t.Fatal("drainSessions timed out")
+	}
+	sess.closeInput()
+	if !g.wait(5 * time.Second) {
+		t.Fatal("Pipeline goroutines did not finish after their inputs were closed")
+	}
+
+	var record pipeline.CommandRecord
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &record); err != nil {
+		t.Fatalf("Failed to parse record JSON: %v\nOutput: %s", err, buf.String())
+	}
+	if record.Command != "make" || record.Output != "built" || record.Session != "web" {
+		t.Errorf("Record = %+v", record)
+	}
+}
+
+// TestRegistryClose tests that no session can start once shutdown has begun
+func TestRegistryClose(t *testing.T) {
+	registry := newSessionRegistry()
+	sess := newSession("web", "", "")
+	if err := registry.add(sess); err != nil {
+		t.Fatal(err)
+	}
+	defer registry.remove(sess)
+	if running := registry.close(); len(running) != 1 || running[0] != sess {
+		t.Errorf("close = %v, want the running session", running)
+	}
+	if err := registry.add(newSession("db", "", "")); !errors.Is(err, errShuttingDown) {
+		t.Errorf("add after close = %v, want errShuttingDown", err)
+	}
+}
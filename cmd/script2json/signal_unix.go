@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// startReadingSignal and stopReadingSignal start and stop reading in the
+// single-session mode.
+var startReadingSignal, stopReadingSignal os.Signal = syscall.SIGUSR1, syscall.SIGUSR2
+
+// processAlive reports whether a process with the ID pid exists, by sending it
+// the null signal.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		// Kill would signal a process group instead
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	// EPERM means it exists but belongs to someone else
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,290 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// waitUntil waits up to a second for cond to hold, failing the test with what
+// otherwise
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for %s", what)
+		}
+	}
+}
+
+// signalSelf sends sig to the test process
+func signalSelf(t *testing.T, sig syscall.Signal) {
+	t.Helper()
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		t.Fatalf("Failed to send %v: %v", sig, err)
+	}
+}
+
+// TestSignalHandlingUSR1 tests SIGUSR1 signal handling
+func TestSignalHandlingUSR1(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	single.state.Reset()
+
+	handleSignals(t, defaultSession(scriptFifoByteChan), "", logger)
+
+	signalSelf(t, syscall.SIGUSR1)
+	waitUntil(t, "SIGUSR1 to move the session to recording", single.recording)
+}
+
+// TestSignalHandlingUSR2 tests SIGUSR2 signal handling
+func TestSignalHandlingUSR2(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	single.state.Start()
+
+	handleSignals(t, defaultSession(scriptFifoByteChan), "", logger)
+
+	signalSelf(t, syscall.SIGUSR2)
+
+	// The stop ends the output, which moves the session out of recording first
+	select {
+	case chunk := <-scriptFifoByteChan:
+		if chunk != nil {
+			t.Errorf("Expected endOfOutput, got %q", chunk)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("EOF was not sent to channel after SIGUSR2")
+	}
+	if single.recording() {
+		t.Errorf("SIGUSR2 should have moved the session out of recording, state is %v", single.state.State())
+	}
+}
+
+// TestSignalHandlingHUP tests SIGHUP signal handling (reset)
+func TestSignalHandlingHUP(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	single.state.Start()
+
+	handleSignals(t, defaultSession(scriptFifoByteChan), "", logger)
+
+	// Clear any pre-existing signals in the channels
+	select {
+	case <-single.resetChan:
+	default:
+	}
+	select {
+	case <-single.recordCreatorResetChan:
+	default:
+	}
+
+	signalSelf(t, syscall.SIGHUP)
+
+	// The reset returns the session to idle. The reset requests it sends are taken
+	// by whichever lineEditor and recordCreator of earlier tests share single's
+	// channels, so only the state is checked.
+	waitUntil(t, "SIGHUP to move the session to idle", func() bool { return single.state.State() == pipeline.StateIdle })
+}
+
+// TestEndToEnd tests the complete pipeline from FIFOs to JSON output
+func TestEndToEnd(t *testing.T) {
+	tmpDir := t.TempDir()
+	scriptFifoPath := filepath.Join(tmpDir, "script.fifo")
+	commandFifoPath := filepath.Join(tmpDir, "command.fifo")
+	pidFilePath := filepath.Join(tmpDir, "script2json.pid")
+
+	// Create FIFOs
+	if err := syscall.Mkfifo(scriptFifoPath, 0666); err != nil {
+		t.Fatalf("Failed to create script FIFO: %v", err)
+	}
+	if err := syscall.Mkfifo(commandFifoPath, 0666); err != nil {
+		t.Fatalf("Failed to create command FIFO: %v", err)
+	}
+
+	// Records are written to a pipe, and read back one at a time
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer w.Close()
+	lines := make(chan []byte)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- bytes.Clone(scanner.Bytes())
+		}
+		close(lines)
+	}()
+
+	// Reset global state
+	single.state.Reset()
+	recordID.Store(0)
+
+	// Create channels for the pipeline
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+	commandChan := make(chan commandInfo, 1)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError, // Suppress logs during test
+	}))
+
+	// Start the pipeline components
+	scriptTransport := newFifoTransport(scriptFifoPath)
+	defer scriptTransport.Close()
+	go scriptFifoReader(scriptTransport, scriptFifoByteChan, logger)
+	// Commands pass through received, so the test knows when each has been read
+	received := make(chan commandInfo)
+	commandRead := make(chan struct{})
+	go commandFifoReader(newFifoTransport(commandFifoPath), received, commandReaderOptions{framing: commandFramingNewline}, logger)
+	go func() {
+		for command := range received {
+			commandChan <- command
+			commandRead <- struct{}{}
+		}
+	}()
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{}, logger)
+	go recordCreator(commandOutputChan, commandChan, recordOptions{stdout: w})
+
+	// Write PID file
+	if err := writePidFile(pidFilePath, logger); err != nil {
+		t.Fatalf("Failed to write PID file: %v", err)
+	}
+
+	// Set up signal handling
+	handleSignals(t, defaultSession(scriptFifoByteChan), pidFilePath, logger)
+
+	// Open script FIFO for writing (simulates script -f)
+	scriptFifo, err := os.OpenFile(scriptFifoPath, os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatalf("Failed to open script FIFO for writing: %v", err)
+	}
+	defer scriptFifo.Close()
+
+	// Simulate three commands, the second with ANSI color codes (ESC[32m = green)
+	// that should be stripped
+	commands := []struct {
+		command, output, want string
+	}{
+		{"echo hello", "hello\r\n", "hello\r\n"},
+		{"ls --color=auto", "\x1b[32mfile.txt\x1b[0m\r\n", "file.txt\r\n"},
+		{"echo fixed", "fixed\r\n", "fixed\r\n"},
+	}
+	var records []pipeline.CommandRecord
+	for _, c := range commands {
+		// SIGUSR1 starts reading (simulates the DEBUG trap)
+		signalSelf(t, syscall.SIGUSR1)
+		waitUntil(t, "SIGUSR1 to start recording", single.recording)
+
+		// The command's output goes to the script FIFO, and is read before the stop
+		processed := single.stats.bytesProcessed.Load()
+		scriptFifo.Write([]byte(c.output))
+		waitUntil(t, "the output to be read", func() bool {
+			return single.stats.bytesProcessed.Load() >= processed+uint64(len(c.output))
+		})
+
+		// PROMPT_COMMAND writes the command, then sends SIGUSR2 to stop reading and flush
+		commandFifo, err := os.OpenFile(commandFifoPath, os.O_WRONLY, 0666)
+		if err != nil {
+			t.Fatalf("Failed to open command FIFO for writing: %v", err)
+		}
+		commandFifo.Write([]byte(c.command + "\n"))
+		commandFifo.Close()
+		select {
+		case <-commandRead:
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %q to be read", c.command)
+		}
+		signalSelf(t, syscall.SIGUSR2)
+
+		var record pipeline.CommandRecord
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("The record output ended early")
+			}
+			if err := json.Unmarshal(line, &record); err != nil {
+				t.Fatalf("JSON parse error: %v in %s", err, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout waiting for the record of %q", c.command)
+		}
+		if record.Command != c.command || record.Output != c.want {
+			t.Errorf("Record = %q with output %q, want %q with output %q", record.Command, record.Output, c.command, c.want)
+		}
+		records = append(records, record)
+	}
+
+	// Verify all records have monotonically increasing IDs
+	for i := 1; i < len(records); i++ {
+		prevID, _ := strconv.Atoi(records[i-1].ID)
+		currID, _ := strconv.Atoi(records[i].ID)
+		if currID <= prevID {
+			t.Errorf("Record IDs not monotonic: %d -> %d", prevID, currID)
+		}
+	}
+
+	// Verify all records have timestamps
+	for i, record := range records {
+		if record.ReturnTimestamp.IsZero() {
+			t.Errorf("Record %d has zero timestamp", i)
+		}
+	}
+
+	// Verify PID file was created and contains correct PID
+	pidData, err := os.ReadFile(pidFilePath)
+	if err != nil {
+		t.Errorf("Failed to read PID file: %v", err)
+	}
+	expectedPID := fmt.Sprintf("%d\n", os.Getpid())
+	if string(pidData) != expectedPID {
+		t.Errorf("PID file content = %q, want %q", string(pidData), expectedPID)
+	}
+}
+
+// TestMarkerBoundaries tests that --markers starts and stops the single-session
+// mode on integration markers
+func TestMarkerBoundaries(t *testing.T) {
+	markerBoundaries = true
+	defer func() {
+		markerBoundaries = false
+		single.state.Reset()
+	}()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	scriptFifoByteChan := make(chan []byte, 1024)
+	single.state.Reset()
+
+	sess := defaultSession(scriptFifoByteChan)
+	// The signal handlers leave marker-controlled sessions alone
+	if !sess.markers {
+		t.Fatal("With --markers, the single-session mode should be marker-controlled")
+	}
+
+	scriptStreamReader(bytes.NewReader([]byte("$ ls\r\n\x1b]6973;start\x07file1\r\n\x1b]6973;end\x07$ ")), scriptFifoByteChan, logger)
+	close(scriptFifoByteChan)
+	if got, expected := readStream(scriptFifoByteChan), "file1\r\n\x04"; got != expected {
+		t.Errorf("Got %q, want %q", got, expected)
+	}
+}
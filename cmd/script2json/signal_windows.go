@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Windows has no user-defined signals, so startReadingSignal and stopReadingSignal
+// are nil and the single-session mode is controlled by integration markers in the
+// byte stream instead, as --session sessions are.
+var startReadingSignal, stopReadingSignal os.Signal
+
+// processAlive reports whether a process with the ID pid exists. On Windows,
+// FindProcess opens the process and fails if there is none.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
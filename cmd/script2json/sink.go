@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"script2json/pkg/pipeline"
+)
+
+// sinkStdout names the stdout sink in control messages and the status.
+const sinkStdout = "stdout"
+
+// maxSinkTargetBytes is the longest sink switch target that the HTTP API reads.
+const maxSinkTargetBytes = 4096
+
+// sink is where live capture writes its records: stdout, or the file at path
+// (--output-file). The control APIs can switch it, or reopen the file after it
+// has been rotated, while capture runs. It is guarded by stdoutMu, so a switch
+// never splits a record.
+var sink struct {
+	file *os.File
+	path string
+}
+
+// sinkWriter writes to the current sink, or to stdout when that is the sink. It
+// is the primary output of the recordCreators' outputWriters.
+type sinkWriter struct {
+	stdout io.Writer
+}
+
+func (w sinkWriter) Write(p []byte) (int, error) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	if sink.file != nil {
+		return sink.file.Write(p)
+	}
+	return w.stdout.Write(p)
+}
+
+// switchSink makes the file at path the sink, appending to it, or stdout if path
+// is empty. The new file is opened before the old one is closed, so a sink that
+// can't be opened leaves the current one in place. Writers that had given up on
+// the old sink return to the new one, and deliver their spooled records to it.
+func switchSink(path string) error {
+	var f *os.File
+	if path != "" {
+		var err error
+		if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return fmt.Errorf("could not open output file: %w", err)
+		}
+	}
+	stdoutMu.Lock()
+	old := sink.file
+	sink.file, sink.path = f, path
+	stdoutMu.Unlock()
+
+	// Make reloadable writers return from the fallback file to the sink
+	outputConfig.generation.Add(1)
+	if old != nil {
+		if err := old.Close(); err != nil {
+			return fmt.Errorf("could not close the previous output file: %w", err)
+		}
+	}
+	return nil
+}
+
+// reopenSink reopens the output file under its path, such as after logrotate has
+// moved it away. With stdout as the sink, it only makes writers that had given
+// up on stdout try it again.
+func reopenSink() error {
+	return switchSink(sinkPath())
+}
+
+// sinkPath returns the path of the output file, or "" if the sink is stdout.
+func sinkPath() string {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	return sink.path
+}
+
+// sinkName describes the sink for the status: "stdout", or the output file's path.
+func sinkName() string {
+	if path := sinkPath(); path != "" {
+		return path
+	}
+	return sinkStdout
+}
+
+// parseSinkTarget returns the output file path of a sink switch target, which is
+// "stdout" or "file <path>", or "" for stdout.
+func parseSinkTarget(target string) (string, error) {
+	kind, path, _ := strings.Cut(strings.TrimSpace(target), " ")
+	path = strings.TrimSpace(path)
+	switch {
+	case kind == sinkStdout && path == "":
+		return "", nil
+	case kind == "file" && path != "":
+		return path, nil
+	}
+	return "", errors.New("usage: sink stdout|file <path>")
+}
+
+// recordSink is the pipeline.RecordSink of a session's recordCreator. It writes each
+// record in the --format to the sink through an outputWriter, which applies the
+// --on-output-error policy, and publishes it to StreamRecords subscribers. Emit
+// fails with errOutputFailed if the record could not be delivered, and with the
+// marshaling error if the record could not be encoded.
+type recordSink struct {
+	out  *outputWriter
+	opts recordOptions
+}
+
+// newRecordSink returns the recordSink of a recordCreator with opts.
+func newRecordSink(opts recordOptions) *recordSink {
+	stdout := opts.stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	return &recordSink{
+		out:  newReloadableOutputWriter(sinkWriter{stdout: stdout}, opts.outputFailurePolicy, opts.fallbackFile, slog.Default()),
+		opts: opts,
+	}
+}
+
+// Emit writes record and publishes it to StreamRecords subscribers.
+func (s *recordSink) Emit(record pipeline.CommandRecord) error {
+	// Records are also marshaled for StreamRecords subscribers in pretty mode
+	var jsonData []byte
+	if s.opts.format != "pretty" || liveRecords.active() {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		jsonData = data
+	}
+
+	var err error
+	if s.opts.format == "pretty" {
+		err = s.write([]byte(formatPretty(record, s.opts)))
+	} else {
+		err = s.write(append(jsonData, '\n'))
+	}
+	if err != nil {
+		return err
+	}
+	if jsonData != nil && liveRecords.active() {
+		liveRecords.publish(record.Session, record.OwnerUID, jsonData)
+	}
+	return nil
+}
+
+// write writes a formatted line that is not a record, such as a summary or an
+// annotation, in order with the records.
+func (s *recordSink) write(data []byte) error {
+	return s.out.write(data)
+}
+
+// Flush makes a last attempt to deliver spooled records and syncs the fallback file.
+func (s *recordSink) Flush() error {
+	s.out.flush()
+	return nil
+}
+
+// Close flushes the sink. The sink itself stays open, since the sessions share it.
+func (s *recordSink) Close() error {
+	return s.Flush()
+}
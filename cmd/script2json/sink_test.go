@@ -0,0 +1,147 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestSwitchSink tests that records follow the sink from stdout to a file and
+// back, and that a sink that can't be opened leaves the current one in place
+func TestSwitchSink(t *testing.T) {
+	defer switchSink("")
+	dir := t.TempDir()
+	r, stdout, _ := os.Pipe()
+	defer r.Close()
+	w := sinkWriter{stdout: stdout}
+
+	path := filepath.Join(dir, "records.jsonl")
+	if err := switchSink(path); err != nil {
+		t.Fatalf("switchSink failed: %v", err)
+	}
+	w.Write([]byte("one\n"))
+	if err := switchSink(filepath.Join(dir, "missing", "records.jsonl")); err == nil {
+		t.Error("switchSink succeeded with a file that can't be opened")
+	}
+	if sinkName() != path {
+		t.Errorf("sinkName() = %q, want %q", sinkName(), path)
+	}
+	w.Write([]byte("two\n"))
+
+	// After rotation, reopening starts a new file under the path
+	rotated := path + ".1"
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if err := reopenSink(); err != nil {
+		t.Fatalf("reopenSink failed: %v", err)
+	}
+	w.Write([]byte("three\n"))
+
+	if err := switchSink(""); err != nil {
+		t.Fatalf("switchSink failed: %v", err)
+	}
+	w.Write([]byte("four\n"))
+	stdout.Close()
+
+	if data, _ := os.ReadFile(rotated); string(data) != "one\ntwo\n" {
+		t.Errorf("Rotated file = %q, want %q", data, "one\ntwo\n")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "three\n" {
+		t.Errorf("Output file = %q, want %q", data, "three\n")
+	}
+	data := make([]byte, 64)
+	n, _ := r.Read(data)
+	if string(data[:n]) != "four\n" || sinkName() != sinkStdout {
+		t.Errorf("Stdout = %q and sink %q, want %q and %q", data[:n], sinkName(), "four\n", sinkStdout)
+	}
+}
+
+// TestSwitchSinkDeliversSpool tests that the records spooled while the sink was
+// failing are written to the sink it is switched to
+func TestSwitchSinkDeliversSpool(t *testing.T) {
+	defer switchSink("")
+	defer setOutputConfig(failurePolicyExit, "")
+	setOutputConfig(failurePolicySpool, "")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+	r, stdout, _ := os.Pipe()
+	r.Close()
+	defer stdout.Close()
+	w := newReloadableOutputWriter(sinkWriter{stdout: stdout}, failurePolicySpool, "", logger)
+
+	if err := w.write([]byte("one\n")); err != nil {
+		t.Fatalf("write should spool: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	if err := switchSink(path); err != nil {
+		t.Fatalf("switchSink failed: %v", err)
+	}
+	if err := w.write([]byte("two\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "one\ntwo\n" {
+		t.Errorf("Output file = %q, want %q", data, "one\ntwo\n")
+	}
+	if len(w.spool) != 0 {
+		t.Errorf("%d records are still spooled", len(w.spool))
+	}
+}
+
+// TestParseSinkTarget tests the targets of the sink control message
+func TestParseSinkTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		path   string
+		valid  bool
+	}{
+		{"stdout", "", true},
+		{" file /var/log/records.jsonl ", "/var/log/records.jsonl", true},
+		{"file /tmp/my records.jsonl", "/tmp/my records.jsonl", true},
+		{"file", "", false},
+		{"stdout now", "", false},
+		{"http://example.com", "", false},
+	}
+	for _, tt := range tests {
+		path, err := parseSinkTarget(tt.target)
+		if (err == nil) != tt.valid || path != tt.path {
+			t.Errorf("parseSinkTarget(%q) = %q, %v", tt.target, path, err)
+		}
+	}
+}
+
+// TestRecordSink tests that the recordSink writes records in the output format to
+// the sink
+func TestRecordSink(t *testing.T) {
+	defer switchSink("")
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	if err := switchSink(path); err != nil {
+		t.Fatalf("switchSink failed: %v", err)
+	}
+
+	sink := newRecordSink(recordOptions{format: "json"})
+	if err := sink.Emit(pipeline.CommandRecord{ID: "1", Command: "ls"}); err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	if err := sink.write([]byte("{\"type\":\"annotation\"}\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	pretty := newRecordSink(recordOptions{format: "pretty", timeDisplay: "rfc3339"})
+	if err := pretty.Emit(pipeline.CommandRecord{ID: "2", Command: "pwd", Output: "/tmp"}); err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := strings.SplitN(string(data), "\n", 3)
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], `{"id":"1","command":"ls"`) || lines[1] != `{"type":"annotation"}` || !strings.Contains(lines[2], "pwd") {
+		t.Errorf("Output file = %q, want a JSON record, the annotation and a pretty record", data)
+	}
+}
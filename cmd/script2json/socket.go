@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+
+	"script2json/pkg/pipeline"
+)
+
+// serveInputSocket accepts connections on l until it is closed, recording each one
+// as a session. l is the --input-socket Unix socket or the --listen TCP listener,
+// optionally wrapped in TLS. Unlike a FIFO, each connection is its own byte stream,
+// so several terminals can write to the same listener without their output mixing.
+// Sessions are controlled by integration markers, and since there is no command
+// FIFO, their end markers carry the command ("end;<base64 command>").
+func serveInputSocket(l net.Listener, registry *sessionRegistry, editorOpts editorOptions, recordOpts recordOptions, logger *slog.Logger) {
+	var connections uint64
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Error("Error accepting input connection", "error", err)
+			}
+			return
+		}
+		connections++
+		go serveInputConn(conn, connections, registry, editorOpts, recordOpts, logger)
+	}
+}
+
+// serveInputConn records the byte stream from conn as a session until it is closed.
+func serveInputConn(conn net.Conn, connection uint64, registry *sessionRegistry, editorOpts editorOptions, recordOpts recordOptions, logger *slog.Logger) {
+	defer conn.Close()
+
+	var peer *pipeline.PeerIdentity
+	name := fmt.Sprintf("conn%d", connection)
+	switch c := conn.(type) {
+	case *net.UnixConn:
+		var err error
+		if peer, err = peerIdentity(c); err != nil {
+			logger.Debug("Could not get peer credentials", "error", err)
+		} else {
+			name = fmt.Sprintf("uid%d-pid%d", peer.UID, peer.PID)
+		}
+	case *tls.Conn:
+		if err := c.Handshake(); err != nil {
+			logger.Warn("TLS handshake failed", "remote_addr", conn.RemoteAddr().String(), "error", err)
+			return
+		}
+		name = conn.RemoteAddr().String()
+		// With --tls-client-ca, the verified client certificate names the session
+		if certs := c.ConnectionState().VerifiedChains; len(certs) > 0 && certs[0][0].Subject.CommonName != "" {
+			name = certs[0][0].Subject.CommonName
+		}
+	default:
+		name = conn.RemoteAddr().String()
+	}
+
+	sess := newSession(name, "", "")
+	sess.peer = peer
+	if peer != nil {
+		sess.owner = &peer.UID
+	}
+	sess.conn = conn
+	if err := registry.add(sess); err != nil {
+		// The same writer connected twice
+		sess.name = fmt.Sprintf("%s-%d", sess.name, connection)
+		if err := registry.add(sess); err != nil {
+			logger.Error("Error registering input connection", "error", err)
+			return
+		}
+	}
+
+	logger = logger.With("session", sess.name)
+	logger.Info("Session started", "remote_addr", conn.RemoteAddr().String(), "peer", peer)
+	events.FireSessionStart(sess.name)
+	commandChan := make(chan commandInfo, commandBufferSize)
+	startPipeline(sess, commandChan, editorOpts, recordOpts, logger)
+	markerStreamReader(sess, conn, io.Discard, commandChan, logger)
+	registry.remove(sess)
+	close(sess.done)
+	logger.Info("Session ended")
+}
+
+// tlsListenerConfig returns the TLS configuration for --listen from a server
+// certificate and key and, optionally, a CA whose client certificates are required.
+func tlsListenerConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestInputSocketSessions tests that each connection is recorded as its own session
+// identified by its peer credentials
+func TestInputSocketSessions(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "input.sock")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	l, err := listenUnixSocket(socket, 0666)
+	if err != nil {
+		t.Fatalf("listenUnixSocket failed: %v", err)
+	}
+	defer l.Close()
+
+	var buf bytes.Buffer
+	registry := newSessionRegistry()
+	go serveInputSocket(l, registry, editorOptions{}, recordOptions{stdout: &buf}, logger)
+
+	// Both connections are open at once, so the second one's name gets a suffix
+	commands := []string{"uptime", "whoami"}
+	var conns []net.Conn
+	for range commands {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		conns = append(conns, conn)
+		time.Sleep(20 * time.Millisecond)
+	}
+	for i, command := range commands {
+		encoded := base64.StdEncoding.EncodeToString([]byte(command + "\n"))
+		fmt.Fprintf(conns[i], "$ %s\r\n\x1b]6973;start\x07%s ok\r\n\x1b]6973;end;%s\x07$ ", command, command, encoded)
+		conns[i].Close()
+	}
+
+	// Give the pipelines time to process
+	time.Sleep(100 * time.Millisecond)
+	output := sinkOutput(&buf)
+
+	name := fmt.Sprintf("uid%d-pid%d", os.Getuid(), os.Getpid())
+	expected := map[string]string{"uptime": name, "whoami": name + "-2"}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Got %d records, want %d:\n%s", len(lines), len(expected), output)
+	}
+	for _, line := range lines {
+		var record pipeline.CommandRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse record JSON: %v\nOutput: %s", err, output)
+		}
+		if record.Output != record.Command+" ok\r\n" {
+			t.Errorf("Command %q: output = %q, want %q", record.Command, record.Output, record.Command+" ok\r\n")
+		}
+		if record.Session != expected[record.Command] {
+			t.Errorf("Command %q: session = %q, want %q", record.Command, record.Session, expected[record.Command])
+		}
+		if record.Peer == nil || record.Peer.PID != os.Getpid() || record.Peer.UID != os.Getuid() {
+			t.Errorf("Command %q: peer = %+v, want pid %d uid %d", record.Command, record.Peer, os.Getpid(), os.Getuid())
+		}
+		if record.OwnerUID == nil || *record.OwnerUID != os.Getuid() {
+			t.Errorf("Command %q: owner_uid = %v, want the peer's uid %d", record.Command, record.OwnerUID, os.Getuid())
+		}
+	}
+	if sessions := registry.list(); len(sessions) != 0 {
+		t.Errorf("Sessions still registered after their connections closed: %d", len(sessions))
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 with common
+// name cn, usable for both servers and clients, and returns the certificate and key paths
+func writeTestCertificate(t *testing.T, cn string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, cn+".crt"), filepath.Join(dir, cn+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// TestTCPInputSessions tests recording sessions streamed over TCP, with and without
+// TLS client certificates
+func TestTCPInputSessions(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "agent1")
+	serverConfig, err := tlsListenerConfig(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatalf("tlsListenerConfig failed: %v", err)
+	}
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	rootPEM, _ := os.ReadFile(certFile)
+	roots.AppendCertsFromPEM(rootPEM)
+
+	tests := []struct {
+		name   string
+		server *tls.Config
+		dial   func(addr string) (net.Conn, error)
+		// session returns the expected session name for a connection from local
+		session func(local net.Addr) string
+	}{
+		{
+			name:    "Plain TCP",
+			dial:    func(addr string) (net.Conn, error) { return net.Dial("tcp", addr) },
+			session: func(local net.Addr) string { return local.String() },
+		},
+		{
+			name:   "TLS with client certificate",
+			server: serverConfig,
+			dial: func(addr string) (net.Conn, error) {
+				return tls.Dial("tcp", addr, &tls.Config{Certificates: []tls.Certificate{clientCert}, RootCAs: roots})
+			},
+			session: func(net.Addr) string { return "agent1" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			if tt.server != nil {
+				l = tls.NewListener(l, tt.server)
+			}
+			defer l.Close()
+
+			var buf bytes.Buffer
+			go serveInputSocket(l, newSessionRegistry(), editorOptions{}, recordOptions{stdout: &buf}, logger)
+
+			conn, err := tt.dial(l.Addr().String())
+			if err != nil {
+				t.Fatalf("Failed to connect: %v", err)
+			}
+			encoded := base64.StdEncoding.EncodeToString([]byte("hostname\n"))
+			fmt.Fprintf(conn, "$ hostname\r\n\x1b]6973;start\x07web01\r\n\x1b]6973;end;%s\x07$ ", encoded)
+			local := conn.LocalAddr()
+			conn.Close()
+
+			// Give the pipeline time to process
+			time.Sleep(100 * time.Millisecond)
+			output := sinkOutput(&buf)
+
+			var record pipeline.CommandRecord
+			if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &record); err != nil {
+				t.Fatalf("Failed to parse record JSON: %v\nOutput: %s", err, output)
+			}
+			if record.Command != "hostname" || record.Output != "web01\r\n" {
+				t.Errorf("Record = (%q, %q), want (%q, %q)", record.Command, record.Output, "hostname", "web01\r\n")
+			}
+			if want := tt.session(local); record.Session != want {
+				t.Errorf("Session = %q, want %q", record.Session, want)
+			}
+		})
+	}
+}
+
+// TestTLSInputRejectsUnknownClients tests that --tls-client-ca refuses clients without a certificate
+func TestTLSInputRejectsUnknownClients(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "server")
+	serverConfig, err := tlsListenerConfig(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatalf("tlsListenerConfig failed: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	l = tls.NewListener(l, serverConfig)
+	defer l.Close()
+
+	registry := newSessionRegistry()
+	go serveInputSocket(l, registry, editorOptions{}, recordOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		// TLS 1.3 reports the rejected client certificate on the first read
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("Connection without a client certificate should fail")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if sessions := registry.list(); len(sessions) != 0 {
+		t.Errorf("Rejected client registered %d sessions", len(sessions))
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"script2json/pkg/pipeline"
+)
+
+// sshOptionsWithArgument are the ssh(1) options that take an argument.
+const sshOptionsWithArgument = "BbcDEeFIiJLlmOoPpQRSWw"
+
+// maxPromptLineLength bounds how much of a line promptStreamReader holds back while
+// it waits to see whether the line is a prompt; longer lines, such as the redraws
+// of full-screen programs, are passed on as output.
+const maxPromptLineLength = 4096
+
+// runSSH implements the ssh subcommand, which records an ssh session without
+// installing anything on the remote host: it runs ssh on a local pseudo-terminal,
+// relays it to the controlling terminal, and finds commands in its output by
+// matching prompts, as the convert subcommand does. Records are tagged with the
+// destination host.
+func runSSH(args []string) error {
+	fs := flag.NewFlagSet("ssh", flag.ExitOnError)
+	flags := addPromptRecorderFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ssh [flags] [--] [ssh options] destination\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := flags.validate(); err != nil {
+		return err
+	}
+	destination := sshDestination(fs.Args())
+	if destination == "" {
+		fs.Usage()
+		return fmt.Errorf("%w: ssh requires a destination", errConfig)
+	}
+
+	return recordWithPrompts(exec.Command("ssh", fs.Args()...), flags, func(sess *session) {
+		sess.host = sshHost(destination)
+	})
+}
+
+// promptRecorderFlags are the flags of the subcommands that record a program on a
+// pseudo-terminal and find its commands by matching prompts.
+type promptRecorderFlags struct {
+	prompt           *string
+	marker           *string
+	parseArgv        *bool
+	keepColors       *bool
+	collapseProgress *bool
+	newline          *string
+	tabWidth         *int
+	format           *string
+	// promptRe is the compiled prompt pattern, set by validate
+	promptRe *regexp.Regexp
+}
+
+// addPromptRecorderFlags defines the prompt recorder flags on fs.
+func addPromptRecorderFlags(fs *flag.FlagSet) *promptRecorderFlags {
+	return &promptRecorderFlags{
+		prompt:           fs.String("prompt", defaultPromptPattern, "Regular expression matching a prompt line up to the start of the command"),
+		marker:           fs.String("marker", "", "Literal string that ends the prompt; overrides -prompt"),
+		parseArgv:        fs.Bool("parse-argv", false, "Tokenize each command with shell quoting rules into an argv field"),
+		keepColors:       fs.Bool("keep-colors", false, "Keep SGR color sequences in a styled_output field alongside the plain output"),
+		collapseProgress: fs.Bool("collapse-progress", false, "Collapse runs of progress lines in output into their final line"),
+		newline:          fs.String("newline", pipeline.NewlineRaw, "Line endings in output (lf, crlf, raw)"),
+		tabWidth:         fs.Int("tab-width", pipeline.DefaultTabWidth, "Distance between tab stops used to expand tabs into spaces"),
+		format:           fs.String("format", "json", "Output format (json, pretty)"),
+	}
+}
+
+// validate checks the flags' values and compiles the prompt pattern.
+func (f *promptRecorderFlags) validate() error {
+	promptRe, err := promptPattern(*f.prompt, *f.marker)
+	if err != nil {
+		return err
+	}
+	if *f.newline != pipeline.NewlineLF && *f.newline != pipeline.NewlineCRLF && *f.newline != pipeline.NewlineRaw {
+		return fmt.Errorf("%w: invalid newline mode: %s. Must be lf, crlf, or raw", errConfig, *f.newline)
+	}
+	if *f.tabWidth < 1 {
+		return fmt.Errorf("%w: invalid tab width: %d. Must be at least 1", errConfig, *f.tabWidth)
+	}
+	if *f.format != "json" && *f.format != "pretty" {
+		return fmt.Errorf("%w: invalid format: %s. Must be json or pretty", errConfig, *f.format)
+	}
+	f.promptRe = promptRe
+	return nil
+}
+
+// recordWithPrompts runs cmd on a pseudo-terminal of its own, shows it on the
+// controlling terminal, and writes records of the commands found by
+// promptStreamReader to stdout until cmd exits. tag sets the fields that the
+// session's records are stamped with.
+func recordWithPrompts(cmd *exec.Cmd, flags *promptRecorderFlags, tag func(*session)) error {
+	// The session is shown on the controlling terminal, leaving stdout for records
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("could not open the controlling terminal: %w", err)
+	}
+	defer tty.Close()
+
+	master, stop, err := startOnPTY(cmd, tty)
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	defer stop()
+
+	scriptFifoByteChan := make(chan []byte, byteBufferSize)
+	commandOutputChan := make(chan commandOutput, outputBufferSize)
+	commandChan := make(chan commandInfo, commandBufferSize)
+
+	go io.Copy(master, tty)
+	sess := defaultSession(scriptFifoByteChan)
+	tag(sess)
+	go promptStreamReader(sess, master, tty, commandChan, flags.promptRe, slog.Default())
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{
+		session:       sess,
+		EditorOptions: pipeline.EditorOptions{TabWidth: *flags.tabWidth, KeepColors: *flags.keepColors},
+	}, slog.Default())
+	// recordCreator returns once cmd has exited and its last output is written
+	color, _ := colorEnabled("auto", os.Stdout)
+	recordCreator(commandOutputChan, commandChan, recordOptions{
+		session:          sess,
+		parseArgv:        *flags.parseArgv,
+		format:           *flags.format,
+		color:            color,
+		collapseProgress: *flags.collapseProgress,
+		newline:          *flags.newline,
+	})
+
+	return waitCommand(cmd)
+}
+
+// sshDestination returns the destination among the arguments of an ssh command
+// line: the first argument that is not an option or an option's argument.
+func sshDestination(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+			return ""
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return arg
+		}
+		// Options can be combined ("-tt", "-vp22"); the first one that takes an
+		// argument ends the group, and takes the next argument if nothing follows it
+		for j := 1; j < len(arg); j++ {
+			if strings.IndexByte(sshOptionsWithArgument, arg[j]) >= 0 {
+				if j == len(arg)-1 {
+					i++
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// sshHost returns the host name of an ssh destination, given as [user@]host or
+// ssh://[user@]host[:port].
+func sshHost(destination string) string {
+	if strings.HasPrefix(destination, "ssh://") {
+		if u, err := url.Parse(destination); err == nil {
+			return u.Hostname()
+		}
+	}
+	if i := strings.LastIndexByte(destination, '@'); i >= 0 {
+		return destination[i+1:]
+	}
+	return destination
+}
+
+// promptStreamReader reads a terminal byte stream without integration markers,
+// relays it to display and, while a command runs, to the session's
+// scriptFifoByteChan. It takes the place of the signal handlers by matching each
+// line's cleaned text against prompt: a prompt line that is submitted starts a
+// command, made up of the rest of the line, and the next prompt to be shown sends
+// the command to commandChan and ends its output with an EOF. Each line is held back
+// until it is known not to be a prompt, so prompts are left out of the output.
+func promptStreamReader(sess *session, r io.Reader, display io.Writer, commandChan chan<- commandInfo, prompt *regexp.Regexp, logger *slog.Logger) {
+	defer close(sess.scriptFifoByteChan)
+
+	lines := pipeline.NewLineEditor(pipeline.EditorOptions{}, logger, nil)
+	promptCommand := func(line []byte) (string, bool) {
+		for _, b := range line {
+			lines.WriteByte(b)
+		}
+		cleaned := strings.TrimRight(lines.Finish().Text, "\r\n")
+		loc := prompt.FindStringIndex(cleaned)
+		if loc == nil {
+			return "", false
+		}
+		return strings.TrimSpace(cleaned[loc[1]:]), true
+	}
+
+	command := ""
+	send := func(data []byte) {
+		if sess.recording() && len(data) > 0 {
+			sess.scriptFifoByteChan <- bytes.Clone(data)
+		}
+	}
+	end := func() {
+		if sess.recording() {
+			commandChan <- commandInfo{command: command}
+			sess.state.Stop()
+			sess.scriptFifoByteChan <- endOfOutput
+		}
+	}
+
+	var line []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			display.Write(buf[:n])
+		}
+		for _, b := range buf[:n] {
+			line = append(line, b)
+			if b != '\n' {
+				continue
+			}
+			if submitted, ok := promptCommand(line); ok {
+				end()
+				// Empty command lines produce no record
+				if submitted != "" {
+					command = submitted
+					sess.state.Start()
+				}
+			} else {
+				send(line)
+			}
+			line = line[:0]
+		}
+
+		// A prompt waits for input without ending its line, so the command before it
+		// has returned as soon as it is shown
+		if len(line) > 0 {
+			if _, ok := promptCommand(line); ok {
+				end()
+			} else if len(line) > maxPromptLineLength {
+				send(line)
+				line = line[:0]
+			}
+		}
+
+		if err != nil {
+			// Linux reports EIO on a pty master once ssh has exited and the slave is closed
+			if err != io.EOF && !errors.Is(err, syscall.EIO) {
+				reportError(logger, pipeline.StageScript, fmt.Errorf("reading terminal byte stream: %w", err))
+			}
+			// The last command, such as "exit", ends with the session
+			send(line)
+			end()
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestSSHDestination tests finding the destination among ssh arguments
+func TestSSHDestination(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"user@host"}, "user@host"},
+		{[]string{"-p", "2222", "host", "uptime"}, "host"},
+		{[]string{"-tt", "-vp22", "host"}, "host"},
+		{[]string{"-A", "-J", "bastion", "-i", "key", "user@host"}, "user@host"},
+		{[]string{"-o", "User=me", "--", "host"}, "host"},
+		{[]string{"-p", "2222"}, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := sshDestination(tt.args); got != tt.expected {
+			t.Errorf("sshDestination(%q) = %q, want %q", tt.args, got, tt.expected)
+		}
+	}
+}
+
+// TestSSHHost tests reducing destinations to host names
+func TestSSHHost(t *testing.T) {
+	tests := []struct {
+		destination string
+		expected    string
+	}{
+		{"host", "host"},
+		{"user@host.example.com", "host.example.com"},
+		{"ssh://user@host:2222", "host"},
+		{"ssh://[::1]:22", "::1"},
+	}
+
+	for _, tt := range tests {
+		if got := sshHost(tt.destination); got != tt.expected {
+			t.Errorf("sshHost(%q) = %q, want %q", tt.destination, got, tt.expected)
+		}
+	}
+}
+
+// TestPromptStreamReader tests splitting a live stream into commands at prompts,
+// both when it arrives at once and byte by byte
+func TestPromptStreamReader(t *testing.T) {
+	input := "Welcome\r\n" +
+		"user@host:~$ ls\r\n" +
+		"a  b\r\n" +
+		"user@host:~$ \r\n" +
+		"user@host:~$ exit\r\n" +
+		"logout\r\n"
+
+	for _, oneByte := range []bool{false, true} {
+		var r io.Reader = strings.NewReader(input)
+		if oneByte {
+			r = iotest.OneByteReader(r)
+		}
+
+		var display bytes.Buffer
+		sess := newSession("test", "", "")
+		commandChan := make(chan commandInfo, 4)
+		promptStreamReader(sess, r, &display, commandChan, regexp.MustCompile(defaultPromptPattern), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		if display.String() != input {
+			t.Errorf("Display = %q, want the input", display.String())
+		}
+		if got := readStream(sess.scriptFifoByteChan); got != "a  b\r\n\x04logout\r\n\x04" {
+			t.Errorf("Stream = %q, want %q", got, "a  b\r\n\x04logout\r\n\x04")
+		}
+		close(commandChan)
+		var commands []string
+		for command := range commandChan {
+			commands = append(commands, command.command)
+		}
+		if strings.Join(commands, ",") != "ls,exit" {
+			t.Errorf("Commands = %q, want [ls exit]", commands)
+		}
+		if sess.recording() {
+			t.Error("Reading should stop at the end of the stream")
+		}
+	}
+}
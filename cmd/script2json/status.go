@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// processStartedAt is when script2json started, as reported by status queries.
+var processStartedAt = time.Now()
+
+// errNotRunning is returned by the status subcommand when the process named by
+// the PID file or status file is gone.
+var errNotRunning = errors.New("script2json is not running")
+
+// writeStatusFile writes the status of the sessions in registry to path as JSON.
+// The file is replaced in one step, so readers never see a partial write.
+func writeStatusFile(path string, registry *sessionRegistry) error {
+	data, err := json.MarshalIndent(statusOf(registry.list()), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not write status file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write status file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write status file: %w", err)
+	}
+	// CreateTemp makes the file private, but the status is no secret
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("could not write status file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not write status file: %w", err)
+	}
+	return nil
+}
+
+// writeStatusFiles rewrites the status file at path every interval, forever.
+func writeStatusFiles(path string, interval time.Duration, registry *sessionRegistry, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := writeStatusFile(path, registry); err != nil {
+			logger.Warn("Error writing status file", "path", path, "error", err)
+		}
+		<-ticker.C
+	}
+}
+
+// runStatus implements the status subcommand, which prints the state of a running
+// script2json: whether each session is reading, how much it has recorded and
+// processed, and whether the output is healthy. The state is asked for on the
+// signal or control socket, or read from the --status-file of the running
+// process if the socket can't be reached. With -pid-file, the process named in
+// it must be running.
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	socket := fs.String("socket", defaultSignalSocket, "Path to the signal or control socket of the running script2json")
+	pidFile := fs.String("pid-file", "", "Check that the process in this PID file is running")
+	statusFile := fs.String("status-file", "", "Read the status from this file if the socket can't be reached")
+	session := fs.String("session", "", "Only show this session")
+	jsonOutput := fs.Bool("json", false, "Print the status as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s status [-socket path] [-pid-file path] [-status-file path] [-session name] [-json]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("%w: status takes no arguments", errConfig)
+	}
+
+	pid := 0
+	if *pidFile != "" {
+		var err error
+		if pid, err = readPidFile(*pidFile); err != nil {
+			return err
+		}
+		if !processAlive(pid) {
+			return fmt.Errorf("%w: no process %d from %s", errNotRunning, pid, *pidFile)
+		}
+	}
+
+	status, err := queryStatus(*socket, *session)
+	if err != nil && *statusFile != "" {
+		status, err = readStatusFile(*statusFile, *session)
+	}
+	if err != nil {
+		return err
+	}
+	if pid != 0 && status.PID != pid {
+		return fmt.Errorf("the PID file names process %d, but the status is of process %d", pid, status.PID)
+	}
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", data)
+		return err
+	}
+	return formatStatus(os.Stdout, status, time.Now())
+}
+
+// readPidFile returns the process ID in the PID file at path.
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("%w: no PID file at %s", errNotRunning, path)
+		}
+		return 0, fmt.Errorf("could not read PID file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s: %q", path, strings.TrimSpace(string(data)))
+	}
+	return pid, nil
+}
+
+// queryStatus asks the signal or control socket at socket for the status of the
+// session called session, or of all sessions if it is empty.
+func queryStatus(socket, session string) (StatusResponse, error) {
+	message := "status"
+	if session != "" {
+		message = "@" + session + " " + message
+	}
+	var status StatusResponse
+	reply, err := requestControlSocket(socket, message)
+	if err != nil {
+		return status, err
+	}
+	if len(reply) != 1 {
+		return status, fmt.Errorf("unexpected reply to status: %q", reply)
+	}
+	if err := json.Unmarshal([]byte(reply[0]), &status); err != nil {
+		return status, fmt.Errorf("invalid reply to status: %w", err)
+	}
+	return status, nil
+}
+
+// readStatusFile returns the status in the status file at path, limited to the
+// session called session unless it is empty. The process that wrote it must
+// still be running.
+func readStatusFile(path, session string) (StatusResponse, error) {
+	var status StatusResponse
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return status, fmt.Errorf("could not read status file: %w", err)
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, fmt.Errorf("invalid status file %s: %w", path, err)
+	}
+	if !processAlive(status.PID) {
+		return status, fmt.Errorf("%w: %s was written by process %d, which is gone", errNotRunning, path, status.PID)
+	}
+	if session != "" {
+		for _, sess := range status.Sessions {
+			if sess.Name == session {
+				status.Sessions = []SessionStatus{sess}
+				return status, nil
+			}
+		}
+		return status, fmt.Errorf("%w: %s", errUnknownSession, session)
+	}
+	return status, nil
+}
+
+// outputHealth describes the state of the output in a word or two.
+func outputHealth(output OutputStatus) string {
+	switch {
+	case output.UsingFallback:
+		return "writing to the fallback file"
+	case output.SpooledRecords > 0:
+		return "spooling"
+	case output.WriteErrors > 0:
+		return "ok after errors"
+	default:
+		return "ok"
+	}
+}
+
+// formatStatus writes status to w for humans, with times relative to now.
+func formatStatus(w io.Writer, status StatusResponse, now time.Time) error {
+	fmt.Fprintf(w, "Process:      %d, started %s\n", status.PID, formatRelative(now.Sub(status.StartedAt)))
+	fmt.Fprintf(w, "Output:       %s (%d write errors, %d dropped, %d spooled)\n", outputHealth(status.Output),
+		status.Output.WriteErrors, status.Output.DroppedRecords, status.Output.SpooledRecords)
+	if status.Output.Sink != "" {
+		fmt.Fprintf(w, "Sink:         %s\n", status.Output.Sink)
+	}
+	fmt.Fprintf(w, "Parse errors: %d\n", status.ParseErrors)
+	fmt.Fprintf(w, "Errors:       %d\n\n", status.Errors)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tREADING\tRECORDS\tLAST RECORD\tBYTES\tBUFFER\tDROPPED")
+	for _, sess := range status.Sessions {
+		name := sess.Name
+		if name == "" {
+			name = "-"
+		}
+		reading := "no"
+		if sess.State == pipeline.StateFlushing.String() {
+			reading = "flushing"
+		}
+		if sess.Reading {
+			reading = "yes"
+			if sess.ReadingSince != nil {
+				reading = "since " + formatRelative(now.Sub(*sess.ReadingSince))
+			}
+		}
+		lastRecord := "-"
+		if sess.LastRecord != nil {
+			lastRecord = formatRelative(now.Sub(*sess.LastRecord))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%d\t%d\n", name, reading, sess.Records, lastRecord, sess.BytesProcessed, sess.BufferBytes,
+			sess.DroppedOutputs+sess.DroppedCommands)
+	}
+	return tw.Flush()
+}
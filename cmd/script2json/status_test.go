@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestQueryStatus tests asking a running script2json for its status over the signal socket
+func TestQueryStatus(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "signal.sock")
+	l, err := listenUnixSocket(socket, 0600)
+	if err != nil {
+		t.Fatalf("listenUnixSocket failed: %v", err)
+	}
+	defer l.Close()
+	web := newSession("web", "", "")
+	db := newSession("db", "", "")
+	db.stats.records.Store(3)
+	db.stats.bytesProcessed.Store(1024)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	go serveSignalSocket(l, newSessionRegistry(web, db), logger)
+
+	status, err := queryStatus(socket, "")
+	if err != nil {
+		t.Fatalf("queryStatus failed: %v", err)
+	}
+	if len(status.Sessions) != 2 || status.PID != os.Getpid() || !status.StartedAt.Equal(processStartedAt) {
+		t.Errorf("Status = %+v, want both sessions of this process", status)
+	}
+	status, err = queryStatus(socket, "db")
+	if err != nil {
+		t.Fatalf("queryStatus of db failed: %v", err)
+	}
+	if len(status.Sessions) != 1 || status.Sessions[0].Records != 3 || status.Sessions[0].BytesProcessed != 1024 {
+		t.Errorf("Sessions = %+v, want db's", status.Sessions)
+	}
+	if _, err := queryStatus(socket, "cache"); err == nil || err.Error() != "unknown session: cache" {
+		t.Errorf("queryStatus of an unknown session = %v", err)
+	}
+}
+
+// TestStatusFile tests writing the status file and reading it back, and rejecting stale ones
+func TestStatusFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status.json")
+	web := newSession("web", "", "")
+	web.stats.records.Store(5)
+	if err := writeStatusFile(path, newSessionRegistry(web, newSession("db", "", ""))); err != nil {
+		t.Fatalf("writeStatusFile failed: %v", err)
+	}
+	status, err := readStatusFile(path, "web")
+	if err != nil {
+		t.Fatalf("readStatusFile failed: %v", err)
+	}
+	if len(status.Sessions) != 1 || status.Sessions[0].Records != 5 || status.PID != os.Getpid() {
+		t.Errorf("Status = %+v, want web's of this process", status)
+	}
+	if _, err := readStatusFile(path, "cache"); !errors.Is(err, errUnknownSession) {
+		t.Errorf("readStatusFile of an unknown session = %v", err)
+	}
+
+	// A status file outlives its process if it is killed
+	os.WriteFile(path, []byte(`{"pid":1073741824}`), 0644)
+	if _, err := readStatusFile(path, ""); !errors.Is(err, errNotRunning) {
+		t.Errorf("readStatusFile of a stale file = %v, want errNotRunning", err)
+	}
+
+	if _, err := readPidFile(filepath.Join(dir, "missing.pid")); !errors.Is(err, errNotRunning) {
+		t.Errorf("readPidFile of a missing file = %v, want errNotRunning", err)
+	}
+	os.WriteFile(filepath.Join(dir, "s2j.pid"), []byte("4242\n"), 0644)
+	if pid, err := readPidFile(filepath.Join(dir, "s2j.pid")); pid != 4242 || err != nil {
+		t.Errorf("readPidFile = %d, %v, want 4242", pid, err)
+	}
+}
+
+// TestFormatStatus tests the human-readable status
+func TestFormatStatus(t *testing.T) {
+	now := time.Date(2025, 9, 29, 14, 0, 0, 0, time.UTC)
+	since := now.Add(-30 * time.Second)
+	last := now.Add(-2 * time.Minute)
+	status := StatusResponse{
+		Sessions: []SessionStatus{
+			{Reading: true, ReadingSince: &since, Records: 12, LastRecord: &last, BufferBytes: 80, BytesProcessed: 4096},
+			{Name: "db", DroppedOutputs: 2, DroppedCommands: 1},
+		},
+		Output:    OutputStatus{Sink: "/var/log/records.jsonl", WriteErrors: 1, UsingFallback: true},
+		Errors:    2,
+		PID:       4242,
+		StartedAt: now.Add(-3 * time.Hour),
+	}
+	expected := `Process:      4242, started 3h ago
+Output:       writing to the fallback file (1 write errors, 0 dropped, 0 spooled)
+Sink:         /var/log/records.jsonl
+Parse errors: 0
+Errors:       2
+
+SESSION  READING        RECORDS  LAST RECORD  BYTES  BUFFER  DROPPED
+-        since 30s ago  12       2m ago       4096   80      0
+db       no             0        -            0      0       3
+`
+	var out bytes.Buffer
+	if err := formatStatus(&out, status, now); err != nil {
+		t.Fatalf("formatStatus failed: %v", err)
+	}
+	if out.String() != expected {
+		t.Errorf("Output = %q, want %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// captureSubcommand names capture from the FIFOs explicitly. It is also what
+// script2json does without a subcommand, so its flags are the global ones.
+const captureSubcommand = "capture"
+
+// subcommand is a mode of script2json chosen by the first argument, with flags of
+// its own.
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) error
+	// failure describes a failed run in the final error line
+	failure string
+}
+
+// subcommands lists the subcommands in the order that help shows them. It is
+// filled in by init, since help refers to it.
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{"run", "Record a shell on a built-in pseudo-terminal", runRecorder, "error recording shell"},
+		{"ssh", "Record an ssh session", runSSH, "error recording ssh session"},
+		{"exec", "Record a shell in a container", runContainerExec, "error recording container session"},
+		{"kubectl", "Record a shell in a Kubernetes pod", runKubectl, "error recording kubectl session"},
+		{"register", "Start recording a session in a running script2json", runRegister, "error registering session"},
+		{"reload", "Make a running script2json re-read its config file", runReload, "error reloading config"},
+		{"ctl", "Send start, stop, flush, reset or annotate to a running script2json", runCtl, "error sending control message"},
+		{"status", "Show the state of a running script2json", runStatus, "error getting status"},
+		{"install-hooks", "Print or install the shell hooks that start and stop reading", runInstallHooks, "error installing hooks"},
+		{"install", "Create the FIFOs, install the shell hooks and a systemd user unit", runInstall, "error installing"},
+		{"uninstall", "Undo what install set up", runUninstall, "error uninstalling"},
+		{"systemd", "Generate a systemd service unit, and optionally a socket unit, for capture", runSystemd, "error generating systemd units"},
+		{"convert", "Convert recorded typescripts and asciinema recordings into records", runConvert, "error converting typescript"},
+		{"replay", "Re-emit records, optionally at their original pace", runReplay, "error replaying records"},
+		{"query", "Filter records by type, session, command, time or exit code", runQuery, "error querying records"},
+		{"export", "Convert records into shell history", runExport, "error exporting history"},
+		{"schema", "Print the JSON Schema of a record type", runSchema, "error printing schema"},
+		{"help", "List the subcommands", runHelp, "error printing help"},
+	}
+}
+
+// findSubcommand returns the subcommand called name, or nil if there is none.
+func findSubcommand(name string) *subcommand {
+	for i := range subcommands {
+		if subcommands[i].name == name {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+// printSubcommands writes the subcommands and their summaries to the output of
+// the global flag set.
+func printSubcommands() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "\nSubcommands (see %s <subcommand> -h):\n", os.Args[0])
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  %s\t%s\n", captureSubcommand, "Capture from the FIFOs with the flags above (the default)")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	w.Flush()
+}
+
+// captureUsage is the usage message of capture, which lists the subcommands too.
+func captureUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [capture] [flags]\n       %s <subcommand> [flags] [args]\n\nFlags:\n", os.Args[0], os.Args[0])
+	flag.PrintDefaults()
+	printSubcommands()
+}
+
+// runHelp implements the help subcommand, which lists the subcommands, or shows
+// the usage of the one named in args.
+func runHelp(args []string) error {
+	if len(args) > 0 {
+		if cmd := findSubcommand(args[0]); cmd != nil && cmd.name != "help" {
+			return cmd.run([]string{"-h"})
+		}
+		if args[0] == captureSubcommand {
+			// The flags of capture are only defined once main knows there is no subcommand
+			_, err := fmt.Printf("The flags of capture are listed by %s -h\n", os.Args[0])
+			return err
+		}
+		return fmt.Errorf("%w: unknown subcommand: %s", errConfig, args[0])
+	}
+	flag.CommandLine.SetOutput(os.Stdout)
+	fmt.Fprintf(os.Stdout, "Usage: %s [capture] [flags]\n       %s <subcommand> [flags] [args]\n", os.Args[0], os.Args[0])
+	printSubcommands()
+	return nil
+}
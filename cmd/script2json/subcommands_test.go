@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+// TestFindSubcommand tests looking up subcommands, which capture isn't one of
+func TestFindSubcommand(t *testing.T) {
+	seen := map[string]bool{}
+	for _, cmd := range subcommands {
+		if seen[cmd.name] {
+			t.Errorf("Subcommand %q is listed twice", cmd.name)
+		}
+		seen[cmd.name] = true
+		if found := findSubcommand(cmd.name); found == nil || found.name != cmd.name {
+			t.Errorf("findSubcommand(%q) = %v", cmd.name, found)
+		}
+	}
+	for _, name := range []string{captureSubcommand, "-format", ""} {
+		if findSubcommand(name) != nil {
+			t.Errorf("findSubcommand(%q) should be nil", name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// SummaryRecord aggregates the command records emitted during an interval.
+// It is distinguished from a CommandRecord by its Type field.
+type SummaryRecord struct {
+	Type          string    `json:"type"`
+	Session       string    `json:"session,omitempty"`
+	IntervalStart time.Time `json:"interval_start"`
+	IntervalEnd   time.Time `json:"interval_end"`
+	CommandCount  int       `json:"command_count"`
+	OutputBytes   int       `json:"output_bytes"`
+	AvgDurationMs int64     `json:"avg_duration_ms"`
+}
+
+// summaryAggregator accumulates per-interval statistics for SummaryRecords.
+// It is not safe for concurrent use.
+type summaryAggregator struct {
+	start         time.Time
+	count         int
+	outputBytes   int
+	timedCount    int
+	totalDuration time.Duration
+}
+
+// newSummaryAggregator returns an aggregator whose first interval starts at start.
+func newSummaryAggregator(start time.Time) *summaryAggregator {
+	return &summaryAggregator{start: start}
+}
+
+// add accounts for a command record. duration is the time between the start of
+// reading and the record's creation, or zero if unknown; unknown durations are
+// excluded from the average.
+func (s *summaryAggregator) add(record pipeline.CommandRecord, duration time.Duration) {
+	s.count++
+	s.outputBytes += len(record.Output)
+	if duration > 0 {
+		s.timedCount++
+		s.totalDuration += duration
+	}
+}
+
+// flush returns the summary of the interval ending at now and starts a new interval.
+func (s *summaryAggregator) flush(now time.Time) SummaryRecord {
+	summary := SummaryRecord{
+		Type:          "summary",
+		IntervalStart: s.start,
+		IntervalEnd:   now,
+		CommandCount:  s.count,
+		OutputBytes:   s.outputBytes,
+	}
+	if s.timedCount > 0 {
+		summary.AvgDurationMs = (s.totalDuration / time.Duration(s.timedCount)).Milliseconds()
+	}
+	*s = summaryAggregator{start: now}
+	return summary
+}
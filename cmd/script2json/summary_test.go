@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestSummaryAggregator tests interval statistics and reset on flush
+func TestSummaryAggregator(t *testing.T) {
+	start := time.Date(2025, 9, 29, 13, 0, 0, 0, time.UTC)
+	s := newSummaryAggregator(start)
+
+	s.add(pipeline.CommandRecord{Output: "hello\r\n"}, 2*time.Second)
+	s.add(pipeline.CommandRecord{Output: "abc"}, 4*time.Second)
+	s.add(pipeline.CommandRecord{Output: ""}, 0) // Unknown duration is not averaged
+
+	end := start.Add(time.Minute)
+	summary := s.flush(end)
+
+	if summary.Type != "summary" {
+		t.Errorf("Type = %q, want %q", summary.Type, "summary")
+	}
+	if !summary.IntervalStart.Equal(start) || !summary.IntervalEnd.Equal(end) {
+		t.Errorf("Interval = %v - %v, want %v - %v", summary.IntervalStart, summary.IntervalEnd, start, end)
+	}
+	if summary.CommandCount != 3 {
+		t.Errorf("CommandCount = %d, want 3", summary.CommandCount)
+	}
+	if summary.OutputBytes != 10 {
+		t.Errorf("OutputBytes = %d, want 10", summary.OutputBytes)
+	}
+	if summary.AvgDurationMs != 3000 {
+		t.Errorf("AvgDurationMs = %d, want 3000", summary.AvgDurationMs)
+	}
+
+	// The next interval starts empty where the previous one ended
+	next := s.flush(end.Add(time.Minute))
+	if !next.IntervalStart.Equal(end) {
+		t.Errorf("Next IntervalStart = %v, want %v", next.IntervalStart, end)
+	}
+	if next.CommandCount != 0 || next.OutputBytes != 0 || next.AvgDurationMs != 0 {
+		t.Errorf("Next summary not empty: %+v", next)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"script2json/pkg/pipeline"
+)
+
+// fatalClasses are the error classes that a pipeline can't recover from while it
+// runs: a FIFO that can't be opened, or records that can't be delivered.
+var fatalClasses = []error{errFIFOSetup, errOutputFailed}
+
+// reportedError is an error on its way to superviseErrors, with the logger of the
+// goroutine that ran into it and the channel that is closed once it is dealt with.
+type reportedError struct {
+	err     error
+	logger  *slog.Logger
+	handled chan struct{}
+}
+
+// runtimeErrors carries the errors that the pipelines' goroutines run into to
+// superviseErrors, which deals with them in one place instead of each goroutine
+// logging or exiting on its own.
+var runtimeErrors = make(chan reportedError)
+
+// superviseOnce starts superviseErrors with the first reported error.
+var superviseOnce sync.Once
+
+// reportedErrors is the number of errors reported so far, for status queries.
+var reportedErrors atomic.Uint64
+
+// reportError hands err, which happened at stage of a pipeline, to the error
+// supervisor as a *pipeline.Error and returns once it has been dealt with. An
+// error of a fatal class exits the process, so reportError doesn't return.
+func reportError(logger *slog.Logger, stage string, err error) {
+	superviseOnce.Do(func() { go superviseErrors(runtimeErrors, fatal) })
+	handled := make(chan struct{})
+	runtimeErrors <- reportedError{err: &pipeline.Error{Stage: stage, Err: err}, logger: logger, handled: handled}
+	<-handled
+}
+
+// superviseErrors deals with the errors from errs until it is closed: it logs and
+// counts each one, and calls exit with those of a fatal class.
+func superviseErrors(errs <-chan reportedError, exit func(error)) {
+	for reported := range errs {
+		handleError(reported.err, reported.logger, exit)
+		close(reported.handled)
+	}
+}
+
+// handleError logs and counts err, and calls exit if it is of a fatal class.
+func handleError(err error, logger *slog.Logger, exit func(error)) {
+	reportedErrors.Add(1)
+	for _, class := range fatalClasses {
+		if errors.Is(err, class) {
+			logger.Error("Unrecoverable pipeline error, exiting", "error", err)
+			exit(err)
+			return
+		}
+	}
+	logger.Error("Pipeline error", "error", err)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestHandleError tests that only errors of a fatal class exit
+func TestHandleError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tests := []struct {
+		name     string
+		err      error
+		wantExit bool
+	}{
+		{"Read error", &pipeline.Error{Stage: pipeline.StageCommand, Err: errors.New("read failed")}, false},
+		{"Marshal error", &pipeline.Error{Stage: pipeline.StageRecord, Err: errors.New("unsupported value")}, false},
+		{"FIFO setup", &pipeline.Error{Stage: pipeline.StageScript, Err: fmt.Errorf("%w: no such file", errFIFOSetup)}, true},
+		{"Sink failure", &pipeline.Error{Stage: pipeline.StageSink, Err: fmt.Errorf("%w: broken pipe", errOutputFailed)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := reportedErrors.Load()
+			var exited error
+			handleError(tt.err, logger, func(err error) { exited = err })
+			if (exited != nil) != tt.wantExit {
+				t.Errorf("Exited with %v, want exit %v", exited, tt.wantExit)
+			}
+			if reportedErrors.Load() != before+1 {
+				t.Error("Error not counted")
+			}
+		})
+	}
+}
+
+// TestSuperviseErrors tests that a reporter waits until its error is dealt with
+func TestSuperviseErrors(t *testing.T) {
+	errs := make(chan reportedError)
+	var exited []error
+	go superviseErrors(errs, func(err error) { exited = append(exited, err) })
+	defer close(errs)
+
+	handled := make(chan struct{})
+	err := &pipeline.Error{Stage: pipeline.StageSink, Err: errOutputFailed}
+	errs <- reportedError{err: err, logger: slog.New(slog.NewTextHandler(io.Discard, nil)), handled: handled}
+	<-handled
+	if len(exited) != 1 || exited[0] != err {
+		t.Errorf("Exited with %v, want the sink error", exited)
+	}
+}
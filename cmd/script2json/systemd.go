@@ -0,0 +1,292 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// unitOptions describes the systemd units that script2json generates.
+type unitOptions struct {
+	// name is the name of the units, without the .service or .socket suffix
+	name string
+	// exe and args are the command line of the service
+	exe  string
+	args []string
+	// env holds the S2J_ variables of the service, as "NAME=value"
+	env []string
+	// user makes the units user units, which are wanted by default.target
+	user bool
+	// restart is the Restart policy, and restartSec the RestartSec if not zero
+	restart    string
+	restartSec string
+	// output is the file that records are appended to, rather than the journal
+	output string
+	// sockets are the sockets that the socket unit listens on
+	sockets []activationSocket
+}
+
+// activationSocket is a socket that systemd listens on in place of script2json.
+type activationSocket struct {
+	// flag is the flag that the socket stands in for, and its FileDescriptorName
+	flag string
+	// listen is the path or address to listen on
+	listen string
+	// mode is the SocketMode of a Unix socket, or empty for TCP
+	mode string
+}
+
+// activationFlags are the flags whose sockets a socket unit can listen on, with the
+// modes that script2json gives them unless a <name>-mode flag is set. Those without
+// a mode take TCP addresses.
+var activationFlags = []struct {
+	name string
+	mode string
+}{
+	{"input-socket", "0666"},
+	{"control-socket", "0600"},
+	{"signal-socket", "0600"},
+	{"grpc-socket", "0600"},
+	{"listen", ""},
+	{"http-addr", ""},
+}
+
+// unitRestartPolicies are the values of Restart in a systemd service.
+var unitRestartPolicies = []string{"no", "always", "on-success", "on-failure", "on-abnormal", "on-abort", "on-watchdog"}
+
+// serviceUnit returns the service unit for opts. A configuration error is not
+// retried, since it would only fail again.
+func serviceUnit(opts unitOptions) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\nDescription=script2json terminal recorder\n")
+	if len(opts.sockets) > 0 {
+		var names []string
+		for _, s := range opts.sockets {
+			names = append(names, socketUnitName(opts.name, s))
+		}
+		fmt.Fprintf(&b, "Requires=%s\nAfter=%s\n", strings.Join(names, " "), strings.Join(names, " "))
+		b.WriteString("\n[Service]\n")
+		fmt.Fprintf(&b, "Sockets=%s\n", strings.Join(names, " "))
+	} else {
+		b.WriteString("\n[Service]\n")
+	}
+	for _, env := range opts.env {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(env))
+	}
+	execStart := systemdQuote(opts.exe)
+	for _, arg := range opts.args {
+		execStart += " " + systemdQuote(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", execStart)
+	if opts.output != "" {
+		fmt.Fprintf(&b, "StandardOutput=append:%s\n", opts.output)
+	}
+	fmt.Fprintf(&b, "Restart=%s\n", opts.restart)
+	if opts.restartSec != "" {
+		fmt.Fprintf(&b, "RestartSec=%s\n", opts.restartSec)
+	}
+	fmt.Fprintf(&b, "RestartPreventExitStatus=%d\n", exitConfig)
+	fmt.Fprintf(&b, "\n[Install]\nWantedBy=%s\n", unitTarget(opts.user))
+	return b.String()
+}
+
+// socketUnit returns the socket unit for s, which passes it to the service named
+// after the flag it stands in for. Each socket has a unit of its own, since a
+// FileDescriptorName applies to every socket of a unit.
+func socketUnit(s activationSocket) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=script2json terminal recorder socket for --%s\n\n[Socket]\n", s.flag)
+	fmt.Fprintf(&b, "ListenStream=%s\nFileDescriptorName=%s\n", s.listen, s.flag)
+	if s.mode != "" {
+		fmt.Fprintf(&b, "SocketMode=%s\n", s.mode)
+	}
+	b.WriteString("\n[Install]\nWantedBy=sockets.target\n")
+	return b.String()
+}
+
+// socketUnitName returns the name of the socket unit for s of the units called name.
+func socketUnitName(name string, s activationSocket) string {
+	return name + "-" + s.flag + ".socket"
+}
+
+// listenStream returns the ListenStream of a TCP address as Go takes it, which
+// leaves out the host to listen on all of them, as systemd does with a bare port.
+func listenStream(address string) string {
+	return strings.TrimPrefix(address, ":")
+}
+
+// unitTarget returns the target that the service is wanted by.
+func unitTarget(user bool) string {
+	if user {
+		return "default.target"
+	}
+	return "multi-user.target"
+}
+
+// systemdQuote quotes s for a systemd command line if it needs it.
+func systemdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\$%;") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "$", "$$")
+	s = strings.ReplaceAll(s, "%", "%%")
+	return `"` + s + `"`
+}
+
+// captureSetting returns the value of the capture flag name in the configuration
+// made of args, the S2J_ variables in environ, and the config file, in that order
+// of precedence, as capture would see it.
+func captureSetting(name string, args, environ []string, config map[string]string) (string, bool) {
+	if value, ok := argValue(name, args); ok {
+		return value, true
+	}
+	for _, entry := range environ {
+		if key, value, _ := strings.Cut(entry, "="); key == envName(name) {
+			return value, true
+		}
+	}
+	value, ok := config[name]
+	return value, ok
+}
+
+// argValue returns the value of the flag name in the command line args, given as
+// -name value or -name=value, with one or two dashes. The last one wins.
+func argValue(name string, args []string) (string, bool) {
+	var value string
+	var found bool
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		flagName, flagValue, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if flagName != name {
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				continue
+			}
+			i++
+			flagValue = args[i]
+		}
+		value, found = flagValue, true
+	}
+	return value, found
+}
+
+// runSystemd implements the systemd subcommand, which prints or writes a service
+// unit that runs capture with the flags after its own, for rolling out the same
+// capture on many hosts. The S2J_ variables of the environment are carried over,
+// and with -socket, socket units listen on the sockets of the configuration in
+// place of script2json, which takes them over through socket activation.
+func runSystemd(args []string) error {
+	fs := flag.NewFlagSet("systemd", flag.ExitOnError)
+	name := fs.String("name", "script2json", "Name of the units")
+	user := fs.Bool("user", false, "Generate user units rather than system units")
+	restart := fs.String("restart", "on-failure", "Restart policy of the service (no, always, on-success, on-failure, on-abnormal, on-abort, on-watchdog)")
+	restartSec := fs.Duration("restart-sec", 0, "Time to wait before restarting the service, e.g. 5s (default: systemd's)")
+	output := fs.String("output", "", "File to append records to (default: the journal)")
+	socket := fs.Bool("socket", false, "Also generate a socket unit for each socket of the configuration")
+	exe := fs.String("exe", "", "Path of script2json in ExecStart (default: this executable)")
+	dir := fs.String("dir", "", "Write the units into this directory instead of printing them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s systemd [-user] [-restart policy] [-restart-sec duration] [-output path] [-socket] [-dir path] [-- capture flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if !slices.Contains(unitRestartPolicies, *restart) {
+		return fmt.Errorf("%w: invalid restart policy: %s. Must be one of %s", errConfig, *restart, strings.Join(unitRestartPolicies, ", "))
+	}
+	if *restartSec < 0 {
+		return fmt.Errorf("%w: invalid restart delay: %s. Must not be negative", errConfig, *restartSec)
+	}
+	captureArgs := fs.Args()
+	if len(captureArgs) > 0 && captureArgs[0] == captureSubcommand {
+		captureArgs = captureArgs[1:]
+	}
+	for _, arg := range captureArgs {
+		flagName, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && (flagName == "daemon" || flagName == "check") && value != "false" {
+			return fmt.Errorf("%w: --%s cannot be used in a service", errConfig, flagName)
+		}
+	}
+	opts := unitOptions{name: *name, exe: *exe, args: captureArgs, user: *user, restart: *restart, output: *output}
+	if opts.exe == "" {
+		var err error
+		if opts.exe, err = os.Executable(); err != nil {
+			return fmt.Errorf("could not find the script2json executable: %w", err)
+		}
+	}
+	if *restartSec > 0 {
+		opts.restartSec = restartSec.String()
+	}
+	for _, entry := range os.Environ() {
+		if strings.HasPrefix(entry, envPrefix) {
+			opts.env = append(opts.env, entry)
+		}
+	}
+
+	if *socket {
+		var config map[string]string
+		if path, ok := captureSetting("config", captureArgs, os.Environ(), nil); ok {
+			var err error
+			if config, err = readConfigFile(path); err != nil {
+				return fmt.Errorf("%w: could not read config file: %v", errConfig, err)
+			}
+		}
+		for _, f := range activationFlags {
+			if listen, ok := captureSetting(f.name, captureArgs, os.Environ(), config); ok && listen != "" {
+				mode := f.mode
+				if mode == "" {
+					listen = listenStream(listen)
+				} else if value, ok := captureSetting(f.name+"-mode", captureArgs, os.Environ(), config); ok && value != "" {
+					// --grpc-socket-mode lets other users connect
+					mode = value
+				}
+				opts.sockets = append(opts.sockets, activationSocket{flag: f.name, listen: listen, mode: mode})
+			}
+		}
+		if len(opts.sockets) == 0 {
+			return fmt.Errorf("%w: -socket requires a socket in the configuration, such as --input-socket or --listen", errConfig)
+		}
+	}
+
+	units := [][2]string{{opts.name + ".service", serviceUnit(opts)}}
+	names := []string{units[0][0]}
+	for _, s := range opts.sockets {
+		units = append(units, [2]string{socketUnitName(opts.name, s), socketUnit(s)})
+		names = append(names, socketUnitName(opts.name, s))
+	}
+	for i, unit := range units {
+		if *dir == "" {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", unit[0], unit[1])
+			continue
+		}
+		path := filepath.Join(*dir, unit[0])
+		if err := os.WriteFile(path, []byte(unit[1]), 0644); err != nil {
+			return fmt.Errorf("could not write unit: %w", err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if *dir != "" {
+		systemctl := "systemctl"
+		if *user {
+			systemctl += " --user"
+		}
+		fmt.Printf("Start it with: %s daemon-reload && %s enable --now %s\n", systemctl, systemctl, strings.Join(names, " "))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestServiceUnit tests the generated service unit
+func TestServiceUnit(t *testing.T) {
+	opts := unitOptions{
+		name:       "script2json",
+		exe:        "/usr/bin/script2json",
+		args:       []string{"-markers", "-config", "/etc/script2json conf"},
+		env:        []string{"S2J_LOG_LEVEL=debug"},
+		restart:    "always",
+		restartSec: "5s",
+		output:     "/var/log/script2json.jsonl",
+		sockets:    []activationSocket{{flag: "input-socket", listen: "/run/s2j.sock", mode: "0666"}},
+	}
+	unit := serviceUnit(opts)
+	for _, want := range []string{
+		`ExecStart=/usr/bin/script2json -markers -config "/etc/script2json conf"`,
+		"Environment=S2J_LOG_LEVEL=debug",
+		"StandardOutput=append:/var/log/script2json.jsonl",
+		"Restart=always\nRestartSec=5s\nRestartPreventExitStatus=2\n",
+		"Requires=script2json-input-socket.socket",
+		"Sockets=script2json-input-socket.socket",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("Unit lacks %q:\n%s", want, unit)
+		}
+	}
+
+	opts.user, opts.sockets = true, nil
+	unit = serviceUnit(opts)
+	if strings.Contains(unit, "Sockets=") || !strings.Contains(unit, "WantedBy=default.target") {
+		t.Errorf("User unit without sockets is wrong:\n%s", unit)
+	}
+}
+
+// TestSocketUnit tests the generated socket units
+func TestSocketUnit(t *testing.T) {
+	unit := socketUnit(activationSocket{flag: "input-socket", listen: "/run/s2j.sock", mode: "0666"})
+	if !strings.Contains(unit, "ListenStream=/run/s2j.sock\nFileDescriptorName=input-socket\nSocketMode=0666\n") {
+		t.Errorf("Unix socket unit is wrong:\n%s", unit)
+	}
+	unit = socketUnit(activationSocket{flag: "listen", listen: listenStream(":7070")})
+	if !strings.Contains(unit, "ListenStream=7070\nFileDescriptorName=listen\n") || strings.Contains(unit, "SocketMode") {
+		t.Errorf("TCP socket unit is wrong:\n%s", unit)
+	}
+}
+
+// TestCaptureSetting tests finding a capture flag in the command line, the
+// environment and the config file
+func TestCaptureSetting(t *testing.T) {
+	environ := []string{"S2J_INPUT_SOCKET=/env.sock", "S2J_LISTEN=:1"}
+	config := map[string]string{"input-socket": "/config.sock", "listen": ":2", "http-addr": ":3"}
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		found    bool
+	}{
+		{"input-socket", []string{"-input-socket", "/arg.sock"}, "/arg.sock", true},
+		{"input-socket", []string{"--input-socket=/a.sock", "-input-socket", "/b.sock"}, "/b.sock", true},
+		{"input-socket", []string{"-markers"}, "/env.sock", true},
+		{"listen", nil, ":1", true},
+		{"http-addr", []string{"-listen", "-http-addr"}, ":3", true},
+		{"grpc-socket", []string{"--", "-grpc-socket", "/x.sock"}, "", false},
+	}
+	for _, tt := range tests {
+		got, found := captureSetting(tt.name, tt.args, environ, config)
+		if got != tt.expected || found != tt.found {
+			t.Errorf("captureSetting(%q, %q) = (%q, %v), want (%q, %v)", tt.name, tt.args, got, found, tt.expected, tt.found)
+		}
+	}
+}
+
+// TestSystemdQuote tests quoting for systemd command lines
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"/usr/bin/script2json", "/usr/bin/script2json"},
+		{"", `""`},
+		{"/tmp/my fifo", `"/tmp/my fifo"`},
+		{`a"b\c`, `"a\"b\\c"`},
+		{"$HOME/100%", `"$$HOME/100%%"`},
+	}
+	for _, tt := range tests {
+		if got := systemdQuote(tt.input); got != tt.expected {
+			t.Errorf("systemdQuote(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"script2json/pkg/pipeline"
+)
+
+// validateTermEmulation returns an error if mode is not a known terminal emulation mode.
+func validateTermEmulation(mode string) error {
+	switch mode {
+	case pipeline.TermEmulationHeuristic, pipeline.TermEmulationFull:
+		return nil
+	}
+	return fmt.Errorf("invalid terminal emulation: %s. Must be heuristic or full", mode)
+}
+
+// validateAltScreen returns an error if policy is not a known alternate screen policy.
+func validateAltScreen(policy string) error {
+	switch policy {
+	case pipeline.AltScreenDiscard, pipeline.AltScreenKeep:
+		return nil
+	}
+	return fmt.Errorf("invalid alternate screen policy: %s. Must be discard or keep", policy)
+}
+
+// parseTermSize parses a terminal size such as "80x24" into columns and rows.
+func parseTermSize(size string) (int, int, error) {
+	var cols, rows int
+	if _, err := fmt.Sscanf(size, "%dx%d", &cols, &rows); err != nil || cols < 1 || rows < 1 {
+		return 0, 0, fmt.Errorf("invalid terminal size: %s. Must be COLSxROWS, e.g. 80x24", size)
+	}
+	return cols, rows, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestParseTermSize tests parsing of the --term-size flag
+func TestParseTermSize(t *testing.T) {
+	cols, rows, err := parseTermSize("132x50")
+	if err != nil || cols != 132 || rows != 50 {
+		t.Errorf("parseTermSize(\"132x50\") = (%d, %d, %v), want (132, 50, nil)", cols, rows, err)
+	}
+
+	for _, size := range []string{"", "80", "80x", "0x24", "x24", "80by24"} {
+		if _, _, err := parseTermSize(size); err == nil {
+			t.Errorf("parseTermSize(%q) expected error", size)
+		}
+	}
+}
+
+// TestValidateAltScreen tests validation of the --alt-screen flag
+func TestValidateAltScreen(t *testing.T) {
+	for _, policy := range []string{pipeline.AltScreenDiscard, pipeline.AltScreenKeep} {
+		if err := validateAltScreen(policy); err != nil {
+			t.Errorf("validateAltScreen(%q) = %v", policy, err)
+		}
+	}
+	for _, policy := range []string{"", "ignore", "Keep"} {
+		if err := validateAltScreen(policy); err == nil {
+			t.Errorf("validateAltScreen(%q) expected error", policy)
+		}
+	}
+}
+
+// TestLineEditorFullEmulation tests lineEditor with the full terminal emulator
+func TestLineEditorFullEmulation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	commandOutputChan := make(chan commandOutput, 1)
+
+	go lineEditor(scriptFifoByteChan, commandOutputChan, editorOptions{EditorOptions: pipeline.EditorOptions{TermEmulation: pipeline.TermEmulationFull}}, logger)
+
+	for _, input := range []string{"first\r\n", "\x1b[2J\x1b[Hsecond"} {
+		scriptFifoByteChan <- []byte(input)
+		scriptFifoByteChan <- endOfOutput
+	}
+
+	// Each command starts from a blank screen
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case output := <-commandOutputChan:
+			if output.Text != expected {
+				t.Errorf("Output = %q, want %q", output.Text, expected)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("Timeout waiting for output")
+		}
+	}
+	close(scriptFifoByteChan)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// timingChunk is a block of typescript output written at a known time.
+type timingChunk struct {
+	offset  int64         // offset of the chunk's first byte in the typescript, after the header
+	size    int64         // number of bytes in the chunk
+	elapsed time.Duration // time since the start of the session when the chunk was written
+}
+
+// timingLog maps typescript offsets to the times they were written, as recorded by
+// script's --log-timing (or -t) option.
+type timingLog struct {
+	chunks []timingChunk
+	// total is the time of the last entry in the log
+	total time.Duration
+	// startTime is the START_TIME from an advanced format log, or the zero time
+	startTime time.Time
+}
+
+// readTimingLog parses a script timing file in either of util-linux's formats:
+//   - classic ("<delay> <bytes>"), written by -t and by --log-timing alone
+//   - advanced ("<type> <delay> <data>"), written when --log-out, --log-in or
+//     --log-io is combined with --log-timing; only "O" (output) entries describe
+//     the typescript, but every entry's delay counts towards the elapsed time,
+//     and the "H" START_TIME entry gives the session's start time
+//
+// Delays are relative to the previous entry.
+func readTimingLog(r io.Reader) (*timingLog, error) {
+	scanner := bufio.NewScanner(r)
+	timing := &timingLog{}
+	var offset int64
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Classic entries start with the delay, advanced entries with a type letter
+		entryType := "O"
+		if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+			entryType, fields = fields[0], fields[1:]
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: malformed timing entry", lineNum)
+		}
+		delay, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("line %d: invalid delay: %s", lineNum, fields[0])
+		}
+		timing.total += time.Duration(delay * float64(time.Second))
+
+		switch entryType {
+		case "O":
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("line %d: invalid byte count: %s", lineNum, fields[1])
+			}
+			timing.chunks = append(timing.chunks, timingChunk{offset: offset, size: size, elapsed: timing.total})
+			offset += size
+		case "H":
+			if fields[1] == "START_TIME" {
+				timing.startTime, _ = parseScriptTimestamp(strings.Join(fields[2:], " "))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read timing log: %w", err)
+	}
+	return timing, nil
+}
+
+// at returns the time since the start of the session when the byte at offset was
+// written. Offsets past the end of the log, such as the "Script done" footer, are
+// given the time of the last entry.
+func (l *timingLog) at(offset int64) time.Duration {
+	i := sort.Search(len(l.chunks), func(i int) bool {
+		return l.chunks[i].offset+l.chunks[i].size > offset
+	})
+	if i == len(l.chunks) {
+		return l.total
+	}
+	return l.chunks[i].elapsed
+}
+
+// events splits data, which starts at offset in the typescript, into the chunks
+// it was written in, with times relative to start.
+func (l *timingLog) events(data []byte, offset int64, start time.Duration) []pipeline.CastEvent {
+	var events []pipeline.CastEvent
+	end := offset + int64(len(data))
+	for _, c := range l.chunks {
+		from, to := max(c.offset, offset), min(c.offset+c.size, end)
+		if from >= to {
+			continue
+		}
+		events = append(events, pipeline.CastEvent{
+			Time: max(c.elapsed-start, 0).Seconds(),
+			Data: string(data[from-offset : to-offset]),
+		})
+	}
+	return events
+}
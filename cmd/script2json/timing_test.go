@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestReadTimingLog tests parsing of the classic and advanced timing formats
+func TestReadTimingLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []timingChunk
+		total    time.Duration
+		start    string
+	}{
+		{
+			name:  "Classic",
+			input: "0.5 10\n1.25 4\n",
+			expected: []timingChunk{
+				{offset: 0, size: 10, elapsed: 500 * time.Millisecond},
+				{offset: 10, size: 4, elapsed: 1750 * time.Millisecond},
+			},
+			total: 1750 * time.Millisecond,
+		},
+		{
+			name: "Advanced",
+			input: "H 0.000000 START_TIME 2025-09-29 13:20:00-04:00\n" +
+				"O 0.5 10\n" +
+				"I 1.0 3\n" +
+				"S 0.0 SIGWINCH ROWS=24 COLS=80\n" +
+				"O 0.25 4\n" +
+				"H 0.1 EXIT_CODE 0\n",
+			expected: []timingChunk{
+				{offset: 0, size: 10, elapsed: 500 * time.Millisecond},
+				{offset: 10, size: 4, elapsed: 1750 * time.Millisecond},
+			},
+			total: 1850 * time.Millisecond,
+			start: "2025-09-29T13:20:00-04:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timing, err := readTimingLog(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("readTimingLog failed: %v", err)
+			}
+			if len(timing.chunks) != len(tt.expected) {
+				t.Fatalf("Got %d chunks, want %d", len(timing.chunks), len(tt.expected))
+			}
+			for i, c := range timing.chunks {
+				if c != tt.expected[i] {
+					t.Errorf("Chunk %d = %+v, want %+v", i, c, tt.expected[i])
+				}
+			}
+			if timing.total != tt.total {
+				t.Errorf("Total = %v, want %v", timing.total, tt.total)
+			}
+			if tt.start != "" && timing.startTime.Format(time.RFC3339) != tt.start {
+				t.Errorf("Start time = %v, want %s", timing.startTime, tt.start)
+			}
+		})
+	}
+}
+
+// TestReadTimingLogInvalid tests that malformed entries are reported
+func TestReadTimingLogInvalid(t *testing.T) {
+	for _, input := range []string{"0.5\n", "0.5 x\n", "O -1 5\n"} {
+		if _, err := readTimingLog(strings.NewReader(input)); err == nil {
+			t.Errorf("readTimingLog(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+// TestTimingLogAt tests mapping typescript offsets to times
+func TestTimingLogAt(t *testing.T) {
+	timing, err := readTimingLog(strings.NewReader("1 5\n2 5\n0.5 0\n"))
+	if err != nil {
+		t.Fatalf("readTimingLog failed: %v", err)
+	}
+	tests := []struct {
+		offset   int64
+		expected time.Duration
+	}{
+		{offset: 0, expected: time.Second},
+		{offset: 4, expected: time.Second},
+		{offset: 5, expected: 3 * time.Second},
+		{offset: 9, expected: 3 * time.Second},
+		{offset: 10, expected: 3500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := timing.at(tt.offset); got != tt.expected {
+			t.Errorf("at(%d) = %v, want %v", tt.offset, got, tt.expected)
+		}
+	}
+}
+
+// TestCastEventJSON tests the asciicast event encoding
+func TestCastEventJSON(t *testing.T) {
+	data, err := json.Marshal(pipeline.CastEvent{Time: 1.5, Data: "hi\r\n"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `[1.5,"o","hi\r\n"]` {
+		t.Errorf("Marshal = %s, want %s", data, `[1.5,"o","hi\r\n"]`)
+	}
+
+	var event pipeline.CastEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if event != (pipeline.CastEvent{Time: 1.5, Data: "hi\r\n"}) {
+		t.Errorf("Unmarshal = %+v", event)
+	}
+}
+
+// TestConvertTypescriptTiming tests start times, durations and output events from a timing log
+func TestConvertTypescriptTiming(t *testing.T) {
+	header := "Script started on 2025-09-29 13:20:00-04:00 [TERM=\"xterm\"]\n"
+	chunks := []string{"$ sleep 2\r\n", "done\r\n", "$ ", "exit\r\n"}
+	timingLog := "0.5 11\n2.0 6\n0.1 2\n3.0 6\n"
+
+	timing, err := readTimingLog(strings.NewReader(timingLog))
+	if err != nil {
+		t.Fatalf("readTimingLog failed: %v", err)
+	}
+	var out bytes.Buffer
+	opts := convertOptions{
+		prompt:    regexp.MustCompile(defaultPromptPattern),
+		timing:    timing,
+		asciicast: true,
+	}
+	typescript := header + strings.Join(chunks, "") + "\nScript done on 2025-09-29 13:20:06-04:00\n"
+	if err := convertTypescript(strings.NewReader(typescript), &out, opts); err != nil {
+		t.Fatalf("convertTypescript failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Got %d records, want 2:\n%s", len(lines), out.String())
+	}
+	var record pipeline.CommandRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Failed to parse record: %v", err)
+	}
+
+	started := time.Date(2025, 9, 29, 13, 20, 0, 0, time.FixedZone("", -4*60*60))
+	if record.Command != "sleep 2" {
+		t.Errorf("Command = %q, want %q", record.Command, "sleep 2")
+	}
+	if record.StartTimestamp == nil || !record.StartTimestamp.Equal(started.Add(500*time.Millisecond)) {
+		t.Errorf("Start timestamp = %v, want %v", record.StartTimestamp, started.Add(500*time.Millisecond))
+	}
+	if !record.ReturnTimestamp.Equal(started.Add(2600 * time.Millisecond)) {
+		t.Errorf("Return timestamp = %v, want %v", record.ReturnTimestamp, started.Add(2600*time.Millisecond))
+	}
+	if record.DurationMs != 2100 {
+		t.Errorf("Duration = %dms, want 2100ms", record.DurationMs)
+	}
+	if len(record.OutputEvents) != 1 || record.OutputEvents[0] != (pipeline.CastEvent{Time: 2, Data: "done\r\n"}) {
+		t.Errorf("Output events = %+v, want [{2 \"done\\r\\n\"}]", record.OutputEvents)
+	}
+}
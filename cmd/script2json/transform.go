@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// defaultTransformTimeout is how long --transform-cmd may take over a record.
+const defaultTransformTimeout = 5 * time.Second
+
+// maxTransformStderr is how much of a failing transform command's stderr goes into
+// the error reported for it.
+const maxTransformStderr = 512
+
+// transformProcessor returns a processor that runs command with the shell for each
+// record, writes the record to its stdin as a line of JSON, and replaces the record
+// with the JSON record the command writes to stdout, or drops it if the command
+// writes nothing. Fields the command adds beyond the record's own are lost, so
+// site-specific data belongs in attributes. A command that fails, outlasts timeout
+// or writes something other than a record leaves the record as it was, and the
+// error goes to report.
+func transformProcessor(command string, timeout time.Duration, report func(error)) pipeline.RecordProcessor {
+	return pipeline.ProcessorFunc(func(record pipeline.CommandRecord) (pipeline.CommandRecord, bool) {
+		transformed, keep, err := runTransform(command, timeout, record)
+		if err != nil {
+			report(fmt.Errorf("transforming record %s with --transform-cmd: %w", record.ID, err))
+			return record, true
+		}
+		return transformed, keep
+	})
+}
+
+// runTransform runs command over record as transformProcessor does, and returns
+// the record it wrote, or false if it wrote nothing.
+func runTransform(command string, timeout time.Duration, record pipeline.CommandRecord) (pipeline.CommandRecord, bool, error) {
+	input, err := json.Marshal(record)
+	if err != nil {
+		return record, true, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	shell, flag := shellCommand()
+	cmd := exec.CommandContext(ctx, shell, flag, command)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// A background process that inherited stdout mustn't hold up the record
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return record, true, fmt.Errorf("timed out after %v", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			if len(msg) > maxTransformStderr {
+				msg = msg[:maxTransformStderr] + "..."
+			}
+			return record, true, fmt.Errorf("%w: %s", err, msg)
+		}
+		return record, true, err
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		return record, false, nil
+	}
+	var transformed pipeline.CommandRecord
+	if err := json.Unmarshal(output, &transformed); err != nil {
+		return record, true, fmt.Errorf("could not parse its output as a record: %w", err)
+	}
+	return transformed, true, nil
+}
+
+// shellCommand returns the shell that runs --transform-cmd, and the flag that
+// passes it a command line.
+func shellCommand() (shell, flag string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", "/C"
+	}
+	return "/bin/sh", "-c"
+}
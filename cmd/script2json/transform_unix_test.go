@@ -0,0 +1,69 @@
+//go:build !windows
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestTransformProcessor tests replacing, enriching and dropping records with a
+// transform command, and keeping them when it fails
+func TestTransformProcessor(t *testing.T) {
+	record := pipeline.CommandRecord{ID: "1", Command: "psql", Output: "ok"}
+	tests := []struct {
+		name, command string
+		timeout       time.Duration
+		wantKeep      bool
+		wantRecord    func(pipeline.CommandRecord) bool
+		wantErr       string
+	}{
+		{"Unchanged", "cat", time.Second, true,
+			func(r pipeline.CommandRecord) bool { return r.Command == "psql" && r.Output == "ok" }, ""},
+		{"Enriched", `sed 's/^{/{"attributes":{"team":"db"},/'`, time.Second, true,
+			func(r pipeline.CommandRecord) bool { return r.Command == "psql" && r.Attributes["team"] == "db" }, ""},
+		{"Replaced", `echo '{"id":"1","command":"psql","output":"hidden"}'`, time.Second, true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "hidden" }, ""},
+		{"Dropped", "cat >/dev/null", time.Second, false, nil, ""},
+		{"Failed", "echo boom >&2; exit 3", time.Second, true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "ok" }, "boom"},
+		{"Not a record", "echo not json", time.Second, true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "ok" }, "could not parse"},
+		{"Timed out", "sleep 5", 100 * time.Millisecond, true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "ok" }, "timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []error
+			got, keep := transformProcessor(tt.command, tt.timeout, func(err error) {
+				reported = append(reported, err)
+			}).Process(record)
+			if keep != tt.wantKeep {
+				t.Fatalf("Kept = %v, want %v", keep, tt.wantKeep)
+			}
+			if tt.wantRecord != nil && !tt.wantRecord(got) {
+				t.Errorf("Unexpected record %+v", got)
+			}
+			if tt.wantErr == "" && len(reported) > 0 {
+				t.Errorf("Reported %v, want no error", reported)
+			}
+			if tt.wantErr != "" && (len(reported) != 1 || !strings.Contains(reported[0].Error(), tt.wantErr)) {
+				t.Errorf("Reported %v, want an error containing %q", reported, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestBuildProcessorsTransform tests adding the transform command to the chain
+func TestBuildProcessorsTransform(t *testing.T) {
+	chain, err := buildProcessors(processorFlags{order: defaultProcessorOrder, transformCmd: "cat", transformTimeout: time.Second})
+	if err != nil || len(chain) != 1 {
+		t.Fatalf("buildProcessors() = %d processors, %v, want the transform", len(chain), err)
+	}
+	if _, err := buildProcessors(processorFlags{order: defaultProcessorOrder, transformCmd: "cat"}); err == nil {
+		t.Error("buildProcessors() accepted a transform command without a timeout")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"script2json/pkg/pipeline"
+)
+
+// errTransportClosed is returned by InputTransport.Open once the transport is closed
+// or has no more writers.
+var errTransportClosed = errors.New("transport closed")
+
+// InputTransport is where a terminal byte stream or a stream of commands comes from.
+// The readers only see the streams that a transport opens, so transports can be
+// added without changing the pipeline, and tests can use a memoryTransport instead
+// of FIFOs on disk.
+type InputTransport interface {
+	// Create prepares the transport before any writer starts, such as by creating
+	// the FIFO.
+	Create(logger *slog.Logger) error
+	// Open waits for the next writer and returns its stream, which ends when the
+	// writer is done. A terminal byte stream is opened once; commands are read from
+	// each writer in turn.
+	Open() (io.ReadCloser, error)
+	// Close stops the transport; an Open that is waiting for a writer returns
+	// errTransportClosed, and a read of the open stream returns an error that
+	// inputClosed recognizes.
+	Close() error
+}
+
+// inputClosed reports whether err is from reading a stream that its transport
+// closed, which ends the stream like EOF.
+func inputClosed(err error) bool {
+	return errors.Is(err, os.ErrClosed) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe)
+}
+
+// openStream is the stream that a transport has open, which the transport's Close
+// closes too, so that a read waiting on the writer returns.
+type openStream struct {
+	mu     sync.Mutex
+	stream io.Closer
+	closed bool
+}
+
+// set records stream as the open one, or closes it and returns false if the
+// transport is closed.
+func (s *openStream) set(stream io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		stream.Close()
+		return false
+	}
+	s.stream = stream
+	return true
+}
+
+// close closes the open stream, if any, and any stream set later.
+func (s *openStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.stream != nil {
+		s.stream.Close()
+	}
+}
+
+// transportFor returns the transport for a --script-fifo, --command-fifo or
+// --session path of the named session: a Unix socket if the path starts with
+// "unix:", else a FIFO (a named pipe on Windows).
+func transportFor(sessionName, path string) InputTransport {
+	if socketPath, ok := strings.CutPrefix(path, "unix:"); ok {
+		return newSocketTransport(socketPath)
+	}
+	t := newFifoTransport(path)
+	t.session = sessionName
+	return t
+}
+
+// fifoTransport reads from a FIFO, which each writer opens and closes in turn.
+type fifoTransport struct {
+	path string
+	fifo *pipeline.FifoReader
+	// session names the session in warnings about the FIFO
+	session string
+	closed  atomic.Bool
+	open    openStream
+	// stopWatching stops the watcher that recreates the FIFO if it is deleted
+	stopWatching func()
+}
+
+// newFifoTransport returns a transport for the FIFO at path.
+func newFifoTransport(path string) *fifoTransport {
+	return &fifoTransport{path: path, fifo: pipeline.NewFifoReader(path)}
+}
+
+// Create takes the FIFO's lock, so that no other instance reads it, creates the
+// FIFO if it does not exist, and starts watching it so that it is recreated if it
+// is deleted.
+func (t *fifoTransport) Create(logger *slog.Logger) error {
+	if err := acquireFifoLock(t.path, logger); err != nil {
+		return err
+	}
+	if err := createFifo(t.path, logger); err != nil {
+		releaseFifoLock(t.path)
+		return err
+	}
+	stop, err := watchFifo(t.path, t.session, logger)
+	if err != nil {
+		// Reading still works; only a deleted FIFO goes unnoticed
+		logger.Warn("Could not watch FIFO", "path", t.path, "error", err)
+		return nil
+	}
+	t.stopWatching = stop
+	return nil
+}
+
+// Open opens the FIFO for reading, waiting for a writer.
+func (t *fifoTransport) Open() (io.ReadCloser, error) {
+	f, err := t.fifo.Open()
+	if errors.Is(err, pipeline.ErrFifoClosed) {
+		return nil, errTransportClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !t.open.set(f) {
+		return nil, errTransportClosed
+	}
+	return f, nil
+}
+
+// Close stops watching the FIFO, wakes a waiting Open, closes the FIFO if it is
+// open and releases the FIFO's lock.
+func (t *fifoTransport) Close() error {
+	if t.closed.Swap(true) {
+		return nil
+	}
+	if t.stopWatching != nil {
+		t.stopWatching()
+	}
+	t.fifo.Close()
+	t.open.close()
+	releaseFifoLock(t.path)
+	return nil
+}
+
+// createFifo creates a FIFO at path if nothing exists there yet.
+func createFifo(path string, logger *slog.Logger) error {
+	created, err := pipeline.CreateFifo(path)
+	if created {
+		logger.Warn("FIFO did not exist, created it", "path", path)
+	}
+	return err
+}
+
+// socketTransport reads from a Unix stream socket, taking one connection per writer.
+type socketTransport struct {
+	path string
+	l    net.Listener
+	open openStream
+}
+
+// newSocketTransport returns a transport for a Unix socket at path.
+func newSocketTransport(path string) *socketTransport {
+	return &socketTransport{path: path}
+}
+
+// Create listens on the socket, which only its owner may connect to.
+func (t *socketTransport) Create(logger *slog.Logger) error {
+	l, err := listenUnixSocket(t.path, 0600)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Listening on input transport socket", "path", t.path)
+	t.l = l
+	return nil
+}
+
+// Open accepts the next connection.
+func (t *socketTransport) Open() (io.ReadCloser, error) {
+	conn, err := t.l.Accept()
+	if errors.Is(err, net.ErrClosed) {
+		return nil, errTransportClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !t.open.set(conn) {
+		return nil, errTransportClosed
+	}
+	return conn, nil
+}
+
+// Close stops listening, which removes the socket, and closes the open connection.
+func (t *socketTransport) Close() error {
+	if t.l == nil {
+		return nil
+	}
+	t.open.close()
+	return t.l.Close()
+}
+
+// memoryTransport replays streams that are already at hand, such as stdin or test
+// data, as if each came from a writer of its own.
+type memoryTransport struct {
+	streams chan io.Reader
+	open    openStream
+}
+
+// newMemoryTransport returns a transport whose Open returns each of streams in turn.
+func newMemoryTransport(streams ...io.Reader) *memoryTransport {
+	t := &memoryTransport{streams: make(chan io.Reader, len(streams))}
+	for _, r := range streams {
+		t.streams <- r
+	}
+	close(t.streams)
+	return t
+}
+
+// Create does nothing.
+func (t *memoryTransport) Create(logger *slog.Logger) error {
+	return nil
+}
+
+// Open returns the next stream, or errTransportClosed once they have all been
+// opened. Since closing a stream such as stdin does not interrupt a read of it,
+// the stream is read through a pipe, which Close does interrupt; the read in
+// progress is left to finish in the background.
+func (t *memoryTransport) Open() (io.ReadCloser, error) {
+	r, ok := <-t.streams
+	if !ok {
+		return nil, errTransportClosed
+	}
+	pr, pw := io.Pipe()
+	if !t.open.set(pr) {
+		return nil, errTransportClosed
+	}
+	go func() {
+		_, err := io.Copy(pw, r)
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// Close closes the open stream; the streams not yet opened are never opened.
+func (t *memoryTransport) Close() error {
+	t.open.close()
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// readCommands runs commandFifoReader on transport and returns the commands it sends
+func readCommands(transport InputTransport) []string {
+	commandChan := make(chan commandInfo, 16)
+	commandFifoReader(transport, commandChan, commandReaderOptions{framing: commandFramingNewline}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var commands []string
+	for command := range commandChan {
+		commands = append(commands, command.command)
+	}
+	return commands
+}
+
+// readStream returns what scriptFifoByteChan carries until it is closed, with each
+// endOfOutput written as an EOF byte
+func readStream(scriptFifoByteChan <-chan []byte) string {
+	var stream []byte
+	for chunk := range scriptFifoByteChan {
+		if len(chunk) == 0 {
+			chunk = []byte{pipeline.EOF}
+		}
+		stream = append(stream, chunk...)
+	}
+	return string(stream)
+}
+
+// TestMemoryTransportCommands tests reading commands from several writers without FIFOs
+func TestMemoryTransportCommands(t *testing.T) {
+	transport := newMemoryTransport(strings.NewReader("ls\npwd\n"), strings.NewReader("\necho hi\n"))
+
+	commands := readCommands(transport)
+	if expected := []string{"ls", "pwd", "echo hi"}; !slices.Equal(commands, expected) {
+		t.Errorf("Commands = %q, want %q", commands, expected)
+	}
+	if _, err := transport.Open(); err != errTransportClosed {
+		t.Errorf("Open after the last stream = %v, want errTransportClosed", err)
+	}
+}
+
+// TestMemoryTransportScript tests reading the terminal byte stream without a FIFO
+func TestMemoryTransportScript(t *testing.T) {
+	defer single.state.Reset()
+	single.state.Start()
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	scriptFifoReader(newMemoryTransport(strings.NewReader("hello\r\n")), scriptFifoByteChan, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if got := readStream(scriptFifoByteChan); got != "hello\r\n" {
+		t.Errorf("Stream = %q, want %q", got, "hello\r\n")
+	}
+}
+
+// TestScriptFifoReaderReopen tests that the terminal byte stream survives its writer
+// closing and is read from the next writer
+func TestScriptFifoReaderReopen(t *testing.T) {
+	defer single.state.Reset()
+	single.state.Start()
+
+	scriptFifoByteChan := make(chan []byte, 1024)
+	transport := newMemoryTransport(strings.NewReader("one\r\n"), strings.NewReader("two\r\n"))
+	scriptFifoReader(transport, scriptFifoByteChan, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if got := readStream(scriptFifoByteChan); got != "one\r\ntwo\r\n" {
+		t.Errorf("Stream = %q, want %q", got, "one\r\ntwo\r\n")
+	}
+}
+
+// TestSocketTransport tests taking commands from each connection to a Unix socket
+func TestSocketTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.sock")
+	transport := newSocketTransport(path)
+	if err := transport.Create(slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	done := make(chan []string)
+	go func() { done <- readCommands(transport) }()
+
+	for _, commands := range []string{"ls\n", "pwd\nid\n"} {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		conn.Write([]byte(commands))
+		conn.Close()
+	}
+	time.Sleep(100 * time.Millisecond)
+	transport.Close()
+
+	select {
+	case commands := <-done:
+		if expected := []string{"ls", "pwd", "id"}; !slices.Equal(commands, expected) {
+			t.Errorf("Commands = %q, want %q", commands, expected)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("commandFifoReader did not stop when the transport was closed")
+	}
+}
+
+// TestTransportFor tests choosing a transport from a path
+func TestTransportFor(t *testing.T) {
+	if _, ok := transportFor("", "/tmp/script.fifo").(*fifoTransport); !ok {
+		t.Error("transportFor a path should return a fifoTransport")
+	}
+	if tr, ok := transportFor("", "unix:/tmp/script.sock").(*socketTransport); !ok || tr.path != "/tmp/script.sock" {
+		t.Error("transportFor a unix: path should return a socketTransport for the path")
+	}
+}
+
+// TestMemoryTransportClose tests that closing the transport interrupts a read of a
+// stream whose writer is still open
+func TestMemoryTransportClose(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	transport := newMemoryTransport(r, strings.NewReader("never opened"))
+	stream, err := transport.Open()
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	read := make(chan error, 1)
+	go func() {
+		_, err := stream.Read(make([]byte, 1))
+		read <- err
+	}()
+	transport.Close()
+	select {
+	case err := <-read:
+		if !inputClosed(err) {
+			t.Errorf("Read = %v, want a closed input error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read not interrupted by Close")
+	}
+	if _, err := transport.Open(); err != errTransportClosed {
+		t.Errorf("Open after Close = %v, want errTransportClosed", err)
+	}
+}
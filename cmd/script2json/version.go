@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is the version of script2json, set when building a release with
+//
+//	go build -ldflags "-X main.version=v1.2.3"
+//
+// Without it, the version that the go command stamped into the binary is used.
+var version string
+
+// recorderVersion returns the version of this binary: the one given at build time,
+// or else the module version from the build info, which go install sets to the
+// release and go build to a pseudo-version of the checked-out commit.
+func recorderVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+// versionLine is what --version prints.
+func versionLine() string {
+	return fmt.Sprintf("script2json %s (%s %s/%s)", recorderVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
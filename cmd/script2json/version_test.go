@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestRecorderVersion tests that the version set at build time is reported and
+// tags records
+func TestRecorderVersion(t *testing.T) {
+	oldVersion := version
+	defer func() { version = oldVersion }()
+
+	version = ""
+	if recorderVersion() == "" {
+		t.Error("recorderVersion() is empty without a version set at build time")
+	}
+	version = "v1.2.3"
+	if got := recorderVersion(); got != "v1.2.3" {
+		t.Errorf("recorderVersion() = %q, want v1.2.3", got)
+	}
+	if line := versionLine(); !strings.HasPrefix(line, "script2json v1.2.3 (go") {
+		t.Errorf("versionLine() = %q", line)
+	}
+
+	record := newCommandRecord("ls", pipeline.Output{Text: "out"}, time.Now(), recordOptions{recorderVersion: recorderVersion()})
+	if record.RecorderVersion != "v1.2.3" {
+		t.Errorf("RecorderVersion = %q, want v1.2.3", record.RecorderVersion)
+	}
+	if record := newCommandRecord("ls", pipeline.Output{Text: "out"}, time.Now(), recordOptions{}); record.RecorderVersion != "" {
+		t.Errorf("RecorderVersion = %q without --recorder-version", record.RecorderVersion)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"script2json/pkg/pipeline"
+)
+
+// The exports of the record-filter ABI that a --wasm-filter module implements,
+// besides its memory.
+const (
+	// wasmAlloc is s2j_alloc(size i32) -> i32, which returns the address of size
+	// bytes of the module's memory for the host to write the record to
+	wasmAlloc = "s2j_alloc"
+	// wasmFilter is s2j_filter(ptr i32, len i32) -> i64, which filters the JSON record
+	// at ptr and returns 0 to drop it, or the address of the JSON record that replaces
+	// it in the high 32 bits and its length in the low 32 bits
+	wasmFilter = "s2j_filter"
+)
+
+// wasmTimeout is how long a --wasm-filter module may take over a record.
+const wasmTimeout = time.Second
+
+// wasmMemoryLimitPages caps the memory of a --wasm-filter module at 64 MiB, four
+// times the longest record that the records package reads.
+const wasmMemoryLimitPages = 1024
+
+// wasmFilterModule is a --wasm-filter module, compiled once and instantiated afresh
+// for each record, so a record can't see what the module kept from the last one.
+// The module is sandboxed: it may import WASI, but has no files, environment or
+// arguments, and its stdout and stderr are discarded. It is compiled again when its
+// file changes, so a new version takes effect with the next record.
+type wasmFilterModule struct {
+	path    string
+	runtime wazero.Runtime
+
+	// mu guards the compiled module, the version of the file it was compiled from
+	// and the last version that failed to compile, which isn't tried again
+	mu       sync.Mutex
+	compiled *wasmCompiled
+	version  fileVersion
+	failed   fileVersion
+}
+
+// wasmCompiled is a compiled version of a --wasm-filter module. The runtime keeps
+// its code until it is closed, which happens once a new version has replaced it
+// and no record is being filtered with it.
+type wasmCompiled struct {
+	module wazero.CompiledModule
+	// users counts the records being filtered with it, and replaced is set once a
+	// new version took its place; both are guarded by the wasmFilterModule's mu
+	users    int
+	replaced bool
+}
+
+// fileVersion tells versions of a file apart.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// newWasmFilter compiles the module at path and checks that it implements the
+// record-filter ABI.
+func newWasmFilter(path string) (*wasmFilterModule, error) {
+	ctx := context.Background()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(wasmMemoryLimitPages))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	w := &wasmFilterModule{path: path, runtime: r}
+	info, err := os.Stat(path)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("could not read WASM filter: %w", err)
+	}
+	compiled, err := w.compile()
+	if err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	w.compiled = &wasmCompiled{module: compiled}
+	w.version = fileVersion{info.ModTime(), info.Size()}
+	return w, nil
+}
+
+// acquire returns the compiled module for a record, compiling the file again if it
+// changed since the last time, and the caller releases it once the record has been
+// filtered. If the new version can't be used, the error is returned once and the
+// last version stays in use.
+func (w *wasmFilterModule) acquire() (*wasmCompiled, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	// Editors may replace the file rather than write it in place, so a file that
+	// can't be found keeps the last version
+	if info, statErr := os.Stat(w.path); statErr == nil {
+		version := fileVersion{info.ModTime(), info.Size()}
+		if version != w.version && version != w.failed {
+			var compiled wazero.CompiledModule
+			if compiled, err = w.compile(); err != nil {
+				w.failed = version
+			} else {
+				w.replace(&wasmCompiled{module: compiled})
+				w.version = version
+			}
+		}
+	}
+	w.compiled.users++
+	return w.compiled, err
+}
+
+// release ends a use of compiled that acquire began, closing it if it was the last
+// use of a replaced version.
+func (w *wasmFilterModule) release(compiled *wasmCompiled) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	compiled.users--
+	if compiled.replaced && compiled.users == 0 {
+		compiled.module.Close(context.Background())
+	}
+}
+
+// replace makes compiled the module in use, with mu held. The last version is
+// closed now if no record is being filtered with it, or by the last release.
+func (w *wasmFilterModule) replace(compiled *wasmCompiled) {
+	old := w.compiled
+	w.compiled = compiled
+	old.replaced = true
+	if old.users == 0 {
+		old.module.Close(context.Background())
+	}
+}
+
+// compile compiles the module file and checks that it implements the record-filter
+// ABI.
+func (w *wasmFilterModule) compile() (wazero.CompiledModule, error) {
+	code, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read WASM filter: %w", err)
+	}
+	compiled, err := w.runtime.CompileModule(context.Background(), code)
+	if err != nil {
+		return nil, fmt.Errorf("could not compile WASM filter %s: %w", w.path, err)
+	}
+	missing := ""
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		missing = "memory"
+	}
+	for _, name := range []string{wasmAlloc, wasmFilter} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			missing = name
+		}
+	}
+	if missing != "" {
+		compiled.Close(context.Background())
+		return nil, fmt.Errorf("WASM filter %s doesn't export %s", w.path, missing)
+	}
+	return compiled, nil
+}
+
+// filter runs record through a new instance of compiled, and returns the record
+// that replaces it, or false if the module drops it.
+func (w *wasmFilterModule) filter(compiled wazero.CompiledModule, record pipeline.CommandRecord) (pipeline.CommandRecord, bool, error) {
+	input, err := json.Marshal(record)
+	if err != nil {
+		return record, true, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wasmTimeout)
+	defer cancel()
+	// An empty name lets instances of the module coexist
+	mod, err := w.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return record, true, wasmError(ctx, err)
+	}
+	defer mod.Close(context.Background())
+
+	results, err := mod.ExportedFunction(wasmAlloc).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return record, true, wasmError(ctx, err)
+	}
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, input) {
+		return record, true, fmt.Errorf("%s returned %d, outside the module's memory", wasmAlloc, ptr)
+	}
+	results, err = mod.ExportedFunction(wasmFilter).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return record, true, wasmError(ctx, err)
+	}
+	if results[0] == 0 {
+		return record, false, nil
+	}
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	output, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return record, true, fmt.Errorf("%s returned a record outside the module's memory", wasmFilter)
+	}
+	var filtered pipeline.CommandRecord
+	if err := json.Unmarshal(output, &filtered); err != nil {
+		return record, true, fmt.Errorf("could not parse the record it returned: %w", err)
+	}
+	return filtered, true, nil
+}
+
+// wasmError returns err, or a timeout error if the module ran out of time.
+func wasmError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %v", wasmTimeout)
+	}
+	return err
+}
+
+// wasmFilterProcessor returns a processor that runs each record through the
+// --wasm-filter module w. A module that fails, traps or runs out of time leaves the
+// record as it was, and the error goes to report, as does a new version of the
+// module that can't be used.
+func wasmFilterProcessor(w *wasmFilterModule, report func(error)) pipeline.RecordProcessor {
+	return pipeline.ProcessorFunc(func(record pipeline.CommandRecord) (pipeline.CommandRecord, bool) {
+		// A new version that doesn't compile is reported, and the last one used
+		compiled, err := w.acquire()
+		if err != nil {
+			report(err)
+		}
+		defer w.release(compiled)
+		filtered, keep, err := w.filter(compiled.module, record)
+		if err != nil {
+			report(fmt.Errorf("filtering record %s with --wasm-filter: %w", record.ID, err))
+			return record, true
+		}
+		return filtered, keep
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// The s2j_filter bodies of the test modules. The record is written at 1024, where
+// s2j_alloc always puts it, and the module's data, if any, is at 0.
+var (
+	// wasmIdentity returns the record it was given
+	wasmIdentity = []byte{0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b}
+	// wasmDrop drops the record
+	wasmDrop = []byte{0x42, 0x00, 0x0b}
+	// wasmTrap traps
+	wasmTrap = []byte{0x00, 0x0b}
+	// wasmLoop never returns
+	wasmLoop = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x42, 0x00, 0x0b}
+)
+
+// wasmReturnData is the s2j_filter body that returns the module's data, of length n.
+func wasmReturnData(n int) []byte {
+	return append(append([]byte{0x42}, sleb128(int64(n))...), 0x0b)
+}
+
+// wasmModule assembles a module with a page of memory, an s2j_alloc that returns
+// 1024, an s2j_filter with the body filter, and data at address 0. Without filter,
+// s2j_filter isn't exported.
+func wasmModule(filter []byte, data string) []byte {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	// Types: (i32) -> i32 and (i32, i32) -> i64
+	module = append(module, section(0x01, vector(
+		[]byte{0x60, 0x01, 0x7f, 0x01, 0x7f},
+		[]byte{0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e}))...)
+	module = append(module, section(0x03, vector([]byte{0x00}, []byte{0x01}))...)
+	module = append(module, section(0x05, vector([]byte{0x00, 0x01}))...)
+	exports := [][]byte{exportEntry("memory", 0x02, 0), exportEntry(wasmAlloc, 0x00, 0)}
+	if filter != nil {
+		exports = append(exports, exportEntry(wasmFilter, 0x00, 1))
+	} else {
+		filter = wasmDrop
+	}
+	module = append(module, section(0x07, vector(exports...))...)
+	alloc := []byte{0x00, 0x41, 0x80, 0x08, 0x0b}
+	module = append(module, section(0x0a, vector(
+		append(uleb128(len(alloc)), alloc...),
+		append(uleb128(len(filter)+1), append([]byte{0x00}, filter...)...)))...)
+	if data != "" {
+		segment := append([]byte{0x00, 0x41, 0x00, 0x0b}, uleb128(len(data))...)
+		module = append(module, section(0x0b, vector(append(segment, data...)))...)
+	}
+	return module
+}
+
+// section encodes a module section with its id and size.
+func section(id byte, contents []byte) []byte {
+	return append(append([]byte{id}, uleb128(len(contents))...), contents...)
+}
+
+// vector encodes items with their count.
+func vector(items ...[]byte) []byte {
+	v := uleb128(len(items))
+	for _, item := range items {
+		v = append(v, item...)
+	}
+	return v
+}
+
+// exportEntry encodes an export of the kind and index under name.
+func exportEntry(name string, kind byte, index int) []byte {
+	return append(append(append(uleb128(len(name)), name...), kind), uleb128(index)...)
+}
+
+// uleb128 encodes n as an unsigned LEB128 number.
+func uleb128(n int) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// sleb128 encodes n as a signed LEB128 number.
+func sleb128(n int64) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if (n == 0 && c&0x40 == 0) || (n == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// writeWasm writes module to path and dates it modTime, so a rewrite is seen as a
+// new version even within the file system's timestamp resolution.
+func writeWasm(t *testing.T, path string, module []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, module, 0o644); err != nil {
+		t.Fatalf("Failed to write module: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to date module: %v", err)
+	}
+}
+
+// TestWasmFilterProcessor tests replacing and dropping records with a WASM filter,
+// and keeping them when it fails
+func TestWasmFilterProcessor(t *testing.T) {
+	record := pipeline.CommandRecord{ID: "1", Command: "psql", Output: "ok"}
+	replacement := `{"id":"1","command":"psql","output":"hidden","attributes":{"team":"db"}}`
+	tests := []struct {
+		name       string
+		module     []byte
+		wantKeep   bool
+		wantRecord func(pipeline.CommandRecord) bool
+		wantErr    string
+	}{
+		{"Unchanged", wasmModule(wasmIdentity, ""), true,
+			func(r pipeline.CommandRecord) bool { return r.Command == "psql" && r.Output == "ok" }, ""},
+		{"Replaced", wasmModule(wasmReturnData(len(replacement)), replacement), true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "hidden" && r.Attributes["team"] == "db" }, ""},
+		{"Dropped", wasmModule(wasmDrop, ""), false, nil, ""},
+		{"Trapped", wasmModule(wasmTrap, ""), true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "ok" }, "unreachable"},
+		{"Not a record", wasmModule(wasmReturnData(len("nope")), "nope"), true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "ok" }, "could not parse"},
+		{"Timed out", wasmModule(wasmLoop, ""), true,
+			func(r pipeline.CommandRecord) bool { return r.Output == "ok" }, "timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "filter.wasm")
+			writeWasm(t, path, tt.module, time.Now())
+			module, err := newWasmFilter(path)
+			if err != nil {
+				t.Fatalf("newWasmFilter() failed: %v", err)
+			}
+			var reported []error
+			got, keep := wasmFilterProcessor(module, func(err error) {
+				reported = append(reported, err)
+			}).Process(record)
+			if keep != tt.wantKeep {
+				t.Fatalf("Kept = %v, want %v", keep, tt.wantKeep)
+			}
+			if tt.wantRecord != nil && !tt.wantRecord(got) {
+				t.Errorf("Unexpected record %+v", got)
+			}
+			if tt.wantErr == "" && len(reported) > 0 {
+				t.Errorf("Reported %v, want no error", reported)
+			}
+			if tt.wantErr != "" && (len(reported) != 1 || !strings.Contains(reported[0].Error(), tt.wantErr)) {
+				t.Errorf("Reported %v, want an error containing %q", reported, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestWasmFilterInvalid tests rejecting modules that don't implement the ABI
+func TestWasmFilterInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, module := range map[string][]byte{
+		"missing.wasm":   nil,
+		"garbage.wasm":   []byte("not wasm"),
+		"no-filter.wasm": wasmModule(nil, ""),
+	} {
+		path := filepath.Join(dir, name)
+		if module != nil {
+			writeWasm(t, path, module, time.Now())
+		}
+		if _, err := newWasmFilter(path); err == nil {
+			t.Errorf("newWasmFilter(%s) succeeded, want an error", name)
+		}
+	}
+}
+
+// TestWasmFilterReload tests that a new version of the module takes effect with
+// the next record, and that a broken one is reported once and the last one kept
+func TestWasmFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	now := time.Now()
+	writeWasm(t, path, wasmModule(wasmIdentity, ""), now)
+	module, err := newWasmFilter(path)
+	if err != nil {
+		t.Fatalf("newWasmFilter() failed: %v", err)
+	}
+	var reported []error
+	processor := wasmFilterProcessor(module, func(err error) { reported = append(reported, err) })
+	record := pipeline.CommandRecord{ID: "1", Command: "ls"}
+	if _, keep := processor.Process(record); !keep {
+		t.Fatal("The first version dropped the record")
+	}
+
+	writeWasm(t, path, wasmModule(wasmDrop, ""), now.Add(time.Second))
+	if _, keep := processor.Process(record); keep {
+		t.Fatal("The new version was not loaded")
+	}
+
+	writeWasm(t, path, []byte("not wasm"), now.Add(2*time.Second))
+	for range 2 {
+		if _, keep := processor.Process(record); keep {
+			t.Error("The last version was not kept after a broken one")
+		}
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "could not compile") {
+		t.Errorf("Reported %v, want the broken version once", reported)
+	}
+}
+
+// TestBuildProcessorsWasm tests adding the WASM filter to the chain
+func TestBuildProcessorsWasm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	writeWasm(t, path, wasmModule(wasmIdentity, ""), time.Now())
+	chain, err := buildProcessors(processorFlags{order: defaultProcessorOrder, wasmFilter: path})
+	if err != nil || len(chain) != 1 {
+		t.Fatalf("buildProcessors() = %d processors, %v, want the WASM filter", len(chain), err)
+	}
+	if _, err := buildProcessors(processorFlags{order: defaultProcessorOrder, wasmFilter: path + ".missing"}); err == nil {
+		t.Error("buildProcessors() accepted a missing WASM filter")
+	}
+}
+
+// TestWasmFilterReloadCloses tests that a replaced version of the module is closed
+// once the last record filtered with it is done, and not before
+func TestWasmFilterReloadCloses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	now := time.Now()
+	writeWasm(t, path, wasmModule(wasmIdentity, ""), now)
+	module, err := newWasmFilter(path)
+	if err != nil {
+		t.Fatalf("newWasmFilter() failed: %v", err)
+	}
+	old, err := module.acquire()
+	if err != nil {
+		t.Fatalf("acquire() failed: %v", err)
+	}
+
+	writeWasm(t, path, wasmModule(wasmDrop, ""), now.Add(time.Second))
+	current, err := module.acquire()
+	if err != nil || current == old {
+		t.Fatalf("acquire() = %p, %v, want the new version", current, err)
+	}
+	module.release(current)
+	record := pipeline.CommandRecord{ID: "1", Command: "ls"}
+	if _, keep, err := module.filter(old.module, record); err != nil || !keep {
+		t.Fatalf("The replaced version failed while in use: %v", err)
+	}
+
+	module.release(old)
+	if _, _, err := module.filter(old.module, record); err == nil {
+		t.Error("The replaced version was not closed after its last use")
+	}
+}
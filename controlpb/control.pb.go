@@ -0,0 +1,758 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: control.proto
+
+// The control API of script2json, served on the --grpc-socket Unix socket.
+
+package controlpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ControlRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// session picks a single session by name. Without it, Start and Stop apply
+	// to the signal-controlled sessions and Reset and Status to all of them.
+	Session       *string `protobuf:"bytes,1,opt,name=session,proto3,oneof" json:"session,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ControlRequest) Reset() {
+	*x = ControlRequest{}
+	mi := &file_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ControlRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ControlRequest) ProtoMessage() {}
+
+func (x *ControlRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ControlRequest.ProtoReflect.Descriptor instead.
+func (*ControlRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ControlRequest) GetSession() string {
+	if x != nil && x.Session != nil {
+		return *x.Session
+	}
+	return ""
+}
+
+type AnnotateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// session picks the session to annotate; it may be left out if only one runs.
+	Session *string `protobuf:"bytes,1,opt,name=session,proto3,oneof" json:"session,omitempty"`
+	// text is the note, such as "starting maintenance window".
+	Text          string `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnnotateRequest) Reset() {
+	*x = AnnotateRequest{}
+	mi := &file_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnnotateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnnotateRequest) ProtoMessage() {}
+
+func (x *AnnotateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnnotateRequest.ProtoReflect.Descriptor instead.
+func (*AnnotateRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AnnotateRequest) GetSession() string {
+	if x != nil && x.Session != nil {
+		return *x.Session
+	}
+	return ""
+}
+
+func (x *AnnotateRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type SwitchSinkRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// path is the file to append records to; empty switches back to stdout.
+	Path          string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SwitchSinkRequest) Reset() {
+	*x = SwitchSinkRequest{}
+	mi := &file_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SwitchSinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SwitchSinkRequest) ProtoMessage() {}
+
+func (x *SwitchSinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SwitchSinkRequest.ProtoReflect.Descriptor instead.
+func (*SwitchSinkRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SwitchSinkRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+type ReopenSinkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReopenSinkRequest) Reset() {
+	*x = ReopenSinkRequest{}
+	mi := &file_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReopenSinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReopenSinkRequest) ProtoMessage() {}
+
+func (x *ReopenSinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReopenSinkRequest.ProtoReflect.Descriptor instead.
+func (*ReopenSinkRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{3}
+}
+
+type SessionStatus struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Name    string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Reading bool                   `protobuf:"varint,2,opt,name=reading,proto3" json:"reading,omitempty"`
+	// reading_since is when the current command started being read.
+	ReadingSince *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=reading_since,json=readingSince,proto3" json:"reading_since,omitempty"`
+	// markers is set for sessions that integration markers start and stop.
+	Markers bool   `protobuf:"varint,4,opt,name=markers,proto3" json:"markers,omitempty"`
+	Records uint64 `protobuf:"varint,5,opt,name=records,proto3" json:"records,omitempty"`
+	// last_record is when the session's last record was written.
+	LastRecord *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=last_record,json=lastRecord,proto3" json:"last_record,omitempty"`
+	// buffer_bytes is how much of the current command's output has been received.
+	BufferBytes int64 `protobuf:"varint,7,opt,name=buffer_bytes,json=bufferBytes,proto3" json:"buffer_bytes,omitempty"`
+	// bytes_processed is how many bytes of the terminal stream have been processed.
+	BytesProcessed uint64 `protobuf:"varint,8,opt,name=bytes_processed,json=bytesProcessed,proto3" json:"bytes_processed,omitempty"`
+	// dropped_outputs and dropped_commands are what the overflow policy dropped.
+	DroppedOutputs  uint64 `protobuf:"varint,9,opt,name=dropped_outputs,json=droppedOutputs,proto3" json:"dropped_outputs,omitempty"`
+	DroppedCommands uint64 `protobuf:"varint,10,opt,name=dropped_commands,json=droppedCommands,proto3" json:"dropped_commands,omitempty"`
+	// state is the session's state: idle, recording or flushing.
+	State string `protobuf:"bytes,11,opt,name=state,proto3" json:"state,omitempty"`
+	// owner_uid is the uid of the user the session belongs to.
+	OwnerUid      *int64 `protobuf:"varint,12,opt,name=owner_uid,json=ownerUid,proto3,oneof" json:"owner_uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionStatus) Reset() {
+	*x = SessionStatus{}
+	mi := &file_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionStatus) ProtoMessage() {}
+
+func (x *SessionStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionStatus.ProtoReflect.Descriptor instead.
+func (*SessionStatus) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SessionStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SessionStatus) GetReading() bool {
+	if x != nil {
+		return x.Reading
+	}
+	return false
+}
+
+func (x *SessionStatus) GetReadingSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReadingSince
+	}
+	return nil
+}
+
+func (x *SessionStatus) GetMarkers() bool {
+	if x != nil {
+		return x.Markers
+	}
+	return false
+}
+
+func (x *SessionStatus) GetRecords() uint64 {
+	if x != nil {
+		return x.Records
+	}
+	return 0
+}
+
+func (x *SessionStatus) GetLastRecord() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastRecord
+	}
+	return nil
+}
+
+func (x *SessionStatus) GetBufferBytes() int64 {
+	if x != nil {
+		return x.BufferBytes
+	}
+	return 0
+}
+
+func (x *SessionStatus) GetBytesProcessed() uint64 {
+	if x != nil {
+		return x.BytesProcessed
+	}
+	return 0
+}
+
+func (x *SessionStatus) GetDroppedOutputs() uint64 {
+	if x != nil {
+		return x.DroppedOutputs
+	}
+	return 0
+}
+
+func (x *SessionStatus) GetDroppedCommands() uint64 {
+	if x != nil {
+		return x.DroppedCommands
+	}
+	return 0
+}
+
+func (x *SessionStatus) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *SessionStatus) GetOwnerUid() int64 {
+	if x != nil && x.OwnerUid != nil {
+		return *x.OwnerUid
+	}
+	return 0
+}
+
+type OutputStatus struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	WriteErrors    uint64                 `protobuf:"varint,1,opt,name=write_errors,json=writeErrors,proto3" json:"write_errors,omitempty"`
+	DroppedRecords uint64                 `protobuf:"varint,2,opt,name=dropped_records,json=droppedRecords,proto3" json:"dropped_records,omitempty"`
+	SpooledRecords int64                  `protobuf:"varint,3,opt,name=spooled_records,json=spooledRecords,proto3" json:"spooled_records,omitempty"`
+	UsingFallback  bool                   `protobuf:"varint,4,opt,name=using_fallback,json=usingFallback,proto3" json:"using_fallback,omitempty"`
+	// sink is "stdout" or the path of the output file.
+	Sink          string `protobuf:"bytes,5,opt,name=sink,proto3" json:"sink,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OutputStatus) Reset() {
+	*x = OutputStatus{}
+	mi := &file_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutputStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutputStatus) ProtoMessage() {}
+
+func (x *OutputStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutputStatus.ProtoReflect.Descriptor instead.
+func (*OutputStatus) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *OutputStatus) GetWriteErrors() uint64 {
+	if x != nil {
+		return x.WriteErrors
+	}
+	return 0
+}
+
+func (x *OutputStatus) GetDroppedRecords() uint64 {
+	if x != nil {
+		return x.DroppedRecords
+	}
+	return 0
+}
+
+func (x *OutputStatus) GetSpooledRecords() int64 {
+	if x != nil {
+		return x.SpooledRecords
+	}
+	return 0
+}
+
+func (x *OutputStatus) GetUsingFallback() bool {
+	if x != nil {
+		return x.UsingFallback
+	}
+	return false
+}
+
+func (x *OutputStatus) GetSink() string {
+	if x != nil {
+		return x.Sink
+	}
+	return ""
+}
+
+type StatusResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Sessions    []*SessionStatus       `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	Output      *OutputStatus          `protobuf:"bytes,2,opt,name=output,proto3" json:"output,omitempty"`
+	ParseErrors uint64                 `protobuf:"varint,3,opt,name=parse_errors,json=parseErrors,proto3" json:"parse_errors,omitempty"`
+	// pid is the process ID of script2json.
+	Pid int64 `protobuf:"varint,4,opt,name=pid,proto3" json:"pid,omitempty"`
+	// started_at is when script2json started.
+	StartedAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	// errors is the number of errors reported so far.
+	Errors        uint64 `protobuf:"varint,6,opt,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusResponse) Reset() {
+	*x = StatusResponse{}
+	mi := &file_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusResponse) ProtoMessage() {}
+
+func (x *StatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusResponse.ProtoReflect.Descriptor instead.
+func (*StatusResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StatusResponse) GetSessions() []*SessionStatus {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+func (x *StatusResponse) GetOutput() *OutputStatus {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+func (x *StatusResponse) GetParseErrors() uint64 {
+	if x != nil {
+		return x.ParseErrors
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetPid() int64 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *StatusResponse) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *StatusResponse) GetErrors() uint64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+type StreamRecordsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// session limits the stream to a single session's records.
+	Session       *string `protobuf:"bytes,1,opt,name=session,proto3,oneof" json:"session,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamRecordsRequest) Reset() {
+	*x = StreamRecordsRequest{}
+	mi := &file_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamRecordsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamRecordsRequest) ProtoMessage() {}
+
+func (x *StreamRecordsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamRecordsRequest.ProtoReflect.Descriptor instead.
+func (*StreamRecordsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamRecordsRequest) GetSession() string {
+	if x != nil && x.Session != nil {
+		return *x.Session
+	}
+	return ""
+}
+
+type Record struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// session is the name of the session that wrote the record.
+	Session string `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	// json is the record as written to stdout with --format=json.
+	Json          []byte `protobuf:"bytes,2,opt,name=json,proto3" json:"json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Record) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *Record) GetJson() []byte {
+	if x != nil {
+		return x.Json
+	}
+	return nil
+}
+
+var File_control_proto protoreflect.FileDescriptor
+
+const file_control_proto_rawDesc = "" +
+	"\n" +
+	"\rcontrol.proto\x12\x16script2json.control.v1\x1a\x1fgoogle/protobuf/timestamp.proto\";\n" +
+	"\x0eControlRequest\x12\x1d\n" +
+	"\asession\x18\x01 \x01(\tH\x00R\asession\x88\x01\x01B\n" +
+	"\n" +
+	"\b_session\"P\n" +
+	"\x0fAnnotateRequest\x12\x1d\n" +
+	"\asession\x18\x01 \x01(\tH\x00R\asession\x88\x01\x01\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04textB\n" +
+	"\n" +
+	"\b_session\"'\n" +
+	"\x11SwitchSinkRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\"\x13\n" +
+	"\x11ReopenSinkRequest\"\xd5\x03\n" +
+	"\rSessionStatus\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\areading\x18\x02 \x01(\bR\areading\x12?\n" +
+	"\rreading_since\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\freadingSince\x12\x18\n" +
+	"\amarkers\x18\x04 \x01(\bR\amarkers\x12\x18\n" +
+	"\arecords\x18\x05 \x01(\x04R\arecords\x12;\n" +
+	"\vlast_record\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"lastRecord\x12!\n" +
+	"\fbuffer_bytes\x18\a \x01(\x03R\vbufferBytes\x12'\n" +
+	"\x0fbytes_processed\x18\b \x01(\x04R\x0ebytesProcessed\x12'\n" +
+	"\x0fdropped_outputs\x18\t \x01(\x04R\x0edroppedOutputs\x12)\n" +
+	"\x10dropped_commands\x18\n" +
+	" \x01(\x04R\x0fdroppedCommands\x12\x14\n" +
+	"\x05state\x18\v \x01(\tR\x05state\x12 \n" +
+	"\towner_uid\x18\f \x01(\x03H\x00R\bownerUid\x88\x01\x01B\f\n" +
+	"\n" +
+	"_owner_uid\"\xbe\x01\n" +
+	"\fOutputStatus\x12!\n" +
+	"\fwrite_errors\x18\x01 \x01(\x04R\vwriteErrors\x12'\n" +
+	"\x0fdropped_records\x18\x02 \x01(\x04R\x0edroppedRecords\x12'\n" +
+	"\x0fspooled_records\x18\x03 \x01(\x03R\x0espooledRecords\x12%\n" +
+	"\x0eusing_fallback\x18\x04 \x01(\bR\rusingFallback\x12\x12\n" +
+	"\x04sink\x18\x05 \x01(\tR\x04sink\"\x99\x02\n" +
+	"\x0eStatusResponse\x12A\n" +
+	"\bsessions\x18\x01 \x03(\v2%.script2json.control.v1.SessionStatusR\bsessions\x12<\n" +
+	"\x06output\x18\x02 \x01(\v2$.script2json.control.v1.OutputStatusR\x06output\x12!\n" +
+	"\fparse_errors\x18\x03 \x01(\x04R\vparseErrors\x12\x10\n" +
+	"\x03pid\x18\x04 \x01(\x03R\x03pid\x129\n" +
+	"\n" +
+	"started_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12\x16\n" +
+	"\x06errors\x18\x06 \x01(\x04R\x06errors\"A\n" +
+	"\x14StreamRecordsRequest\x12\x1d\n" +
+	"\asession\x18\x01 \x01(\tH\x00R\asession\x88\x01\x01B\n" +
+	"\n" +
+	"\b_session\"6\n" +
+	"\x06Record\x12\x18\n" +
+	"\asession\x18\x01 \x01(\tR\asession\x12\x12\n" +
+	"\x04json\x18\x02 \x01(\fR\x04json2\xf4\x05\n" +
+	"\x0eControlService\x12W\n" +
+	"\x05Start\x12&.script2json.control.v1.ControlRequest\x1a&.script2json.control.v1.StatusResponse\x12V\n" +
+	"\x04Stop\x12&.script2json.control.v1.ControlRequest\x1a&.script2json.control.v1.StatusResponse\x12W\n" +
+	"\x05Reset\x12&.script2json.control.v1.ControlRequest\x1a&.script2json.control.v1.StatusResponse\x12X\n" +
+	"\x06Status\x12&.script2json.control.v1.ControlRequest\x1a&.script2json.control.v1.StatusResponse\x12[\n" +
+	"\bAnnotate\x12'.script2json.control.v1.AnnotateRequest\x1a&.script2json.control.v1.StatusResponse\x12_\n" +
+	"\n" +
+	"SwitchSink\x12).script2json.control.v1.SwitchSinkRequest\x1a&.script2json.control.v1.StatusResponse\x12_\n" +
+	"\n" +
+	"ReopenSink\x12).script2json.control.v1.ReopenSinkRequest\x1a&.script2json.control.v1.StatusResponse\x12_\n" +
+	"\rStreamRecords\x12,.script2json.control.v1.StreamRecordsRequest\x1a\x1e.script2json.control.v1.Record0\x01B\x17Z\x15script2json/controlpbb\x06proto3"
+
+var (
+	file_control_proto_rawDescOnce sync.Once
+	file_control_proto_rawDescData []byte
+)
+
+func file_control_proto_rawDescGZIP() []byte {
+	file_control_proto_rawDescOnce.Do(func() {
+		file_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)))
+	})
+	return file_control_proto_rawDescData
+}
+
+var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_control_proto_goTypes = []any{
+	(*ControlRequest)(nil),        // 0: script2json.control.v1.ControlRequest
+	(*AnnotateRequest)(nil),       // 1: script2json.control.v1.AnnotateRequest
+	(*SwitchSinkRequest)(nil),     // 2: script2json.control.v1.SwitchSinkRequest
+	(*ReopenSinkRequest)(nil),     // 3: script2json.control.v1.ReopenSinkRequest
+	(*SessionStatus)(nil),         // 4: script2json.control.v1.SessionStatus
+	(*OutputStatus)(nil),          // 5: script2json.control.v1.OutputStatus
+	(*StatusResponse)(nil),        // 6: script2json.control.v1.StatusResponse
+	(*StreamRecordsRequest)(nil),  // 7: script2json.control.v1.StreamRecordsRequest
+	(*Record)(nil),                // 8: script2json.control.v1.Record
+	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+}
+var file_control_proto_depIdxs = []int32{
+	9,  // 0: script2json.control.v1.SessionStatus.reading_since:type_name -> google.protobuf.Timestamp
+	9,  // 1: script2json.control.v1.SessionStatus.last_record:type_name -> google.protobuf.Timestamp
+	4,  // 2: script2json.control.v1.StatusResponse.sessions:type_name -> script2json.control.v1.SessionStatus
+	5,  // 3: script2json.control.v1.StatusResponse.output:type_name -> script2json.control.v1.OutputStatus
+	9,  // 4: script2json.control.v1.StatusResponse.started_at:type_name -> google.protobuf.Timestamp
+	0,  // 5: script2json.control.v1.ControlService.Start:input_type -> script2json.control.v1.ControlRequest
+	0,  // 6: script2json.control.v1.ControlService.Stop:input_type -> script2json.control.v1.ControlRequest
+	0,  // 7: script2json.control.v1.ControlService.Reset:input_type -> script2json.control.v1.ControlRequest
+	0,  // 8: script2json.control.v1.ControlService.Status:input_type -> script2json.control.v1.ControlRequest
+	1,  // 9: script2json.control.v1.ControlService.Annotate:input_type -> script2json.control.v1.AnnotateRequest
+	2,  // 10: script2json.control.v1.ControlService.SwitchSink:input_type -> script2json.control.v1.SwitchSinkRequest
+	3,  // 11: script2json.control.v1.ControlService.ReopenSink:input_type -> script2json.control.v1.ReopenSinkRequest
+	7,  // 12: script2json.control.v1.ControlService.StreamRecords:input_type -> script2json.control.v1.StreamRecordsRequest
+	6,  // 13: script2json.control.v1.ControlService.Start:output_type -> script2json.control.v1.StatusResponse
+	6,  // 14: script2json.control.v1.ControlService.Stop:output_type -> script2json.control.v1.StatusResponse
+	6,  // 15: script2json.control.v1.ControlService.Reset:output_type -> script2json.control.v1.StatusResponse
+	6,  // 16: script2json.control.v1.ControlService.Status:output_type -> script2json.control.v1.StatusResponse
+	6,  // 17: script2json.control.v1.ControlService.Annotate:output_type -> script2json.control.v1.StatusResponse
+	6,  // 18: script2json.control.v1.ControlService.SwitchSink:output_type -> script2json.control.v1.StatusResponse
+	6,  // 19: script2json.control.v1.ControlService.ReopenSink:output_type -> script2json.control.v1.StatusResponse
+	8,  // 20: script2json.control.v1.ControlService.StreamRecords:output_type -> script2json.control.v1.Record
+	13, // [13:21] is the sub-list for method output_type
+	5,  // [5:13] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_control_proto_init() }
+func file_control_proto_init() {
+	if File_control_proto != nil {
+		return
+	}
+	file_control_proto_msgTypes[0].OneofWrappers = []any{}
+	file_control_proto_msgTypes[1].OneofWrappers = []any{}
+	file_control_proto_msgTypes[4].OneofWrappers = []any{}
+	file_control_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_control_proto_goTypes,
+		DependencyIndexes: file_control_proto_depIdxs,
+		MessageInfos:      file_control_proto_msgTypes,
+	}.Build()
+	File_control_proto = out.File
+	file_control_proto_goTypes = nil
+	file_control_proto_depIdxs = nil
+}
@@ -0,0 +1,419 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: control.proto
+
+// The control API of script2json, served on the --grpc-socket Unix socket.
+
+package controlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ControlService_Start_FullMethodName         = "/script2json.control.v1.ControlService/Start"
+	ControlService_Stop_FullMethodName          = "/script2json.control.v1.ControlService/Stop"
+	ControlService_Reset_FullMethodName         = "/script2json.control.v1.ControlService/Reset"
+	ControlService_Status_FullMethodName        = "/script2json.control.v1.ControlService/Status"
+	ControlService_Annotate_FullMethodName      = "/script2json.control.v1.ControlService/Annotate"
+	ControlService_SwitchSink_FullMethodName    = "/script2json.control.v1.ControlService/SwitchSink"
+	ControlService_ReopenSink_FullMethodName    = "/script2json.control.v1.ControlService/ReopenSink"
+	ControlService_StreamRecords_FullMethodName = "/script2json.control.v1.ControlService/StreamRecords"
+)
+
+// ControlServiceClient is the client API for ControlService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ControlService starts, stops and resets capture like SIGUSR1, SIGUSR2 and
+// SIGHUP, annotates it, switches its output, reports its state, and streams
+// records as they are written.
+type ControlServiceClient interface {
+	// Start starts reading, like SIGUSR1.
+	Start(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// Stop stops reading and flushes the current buffer, like SIGUSR2.
+	Stop(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// Reset resets the pipeline state, like SIGHUP.
+	Reset(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// Status reports the state without changing it.
+	Status(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// Annotate writes an annotation record between the command records.
+	Annotate(ctx context.Context, in *AnnotateRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// SwitchSink switches the output that records are written to.
+	SwitchSink(ctx context.Context, in *SwitchSinkRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// ReopenSink reopens the output file under its path, e.g. after rotation.
+	ReopenSink(ctx context.Context, in *ReopenSinkRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// StreamRecords sends each record written from now on, until the client
+	// cancels the call.
+	StreamRecords(ctx context.Context, in *StreamRecordsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error)
+}
+
+type controlServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlServiceClient(cc grpc.ClientConnInterface) ControlServiceClient {
+	return &controlServiceClient{cc}
+}
+
+func (c *controlServiceClient) Start(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, ControlService_Start_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlServiceClient) Stop(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, ControlService_Stop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlServiceClient) Reset(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, ControlService_Reset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlServiceClient) Status(ctx context.Context, in *ControlRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, ControlService_Status_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlServiceClient) Annotate(ctx context.Context, in *AnnotateRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, ControlService_Annotate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlServiceClient) SwitchSink(ctx context.Context, in *SwitchSinkRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, ControlService_SwitchSink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlServiceClient) ReopenSink(ctx context.Context, in *ReopenSinkRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, ControlService_ReopenSink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlServiceClient) StreamRecords(ctx context.Context, in *StreamRecordsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ControlService_ServiceDesc.Streams[0], ControlService_StreamRecords_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRecordsRequest, Record]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ControlService_StreamRecordsClient = grpc.ServerStreamingClient[Record]
+
+// ControlServiceServer is the server API for ControlService service.
+// All implementations must embed UnimplementedControlServiceServer
+// for forward compatibility.
+//
+// ControlService starts, stops and resets capture like SIGUSR1, SIGUSR2 and
+// SIGHUP, annotates it, switches its output, reports its state, and streams
+// records as they are written.
+type ControlServiceServer interface {
+	// Start starts reading, like SIGUSR1.
+	Start(context.Context, *ControlRequest) (*StatusResponse, error)
+	// Stop stops reading and flushes the current buffer, like SIGUSR2.
+	Stop(context.Context, *ControlRequest) (*StatusResponse, error)
+	// Reset resets the pipeline state, like SIGHUP.
+	Reset(context.Context, *ControlRequest) (*StatusResponse, error)
+	// Status reports the state without changing it.
+	Status(context.Context, *ControlRequest) (*StatusResponse, error)
+	// Annotate writes an annotation record between the command records.
+	Annotate(context.Context, *AnnotateRequest) (*StatusResponse, error)
+	// SwitchSink switches the output that records are written to.
+	SwitchSink(context.Context, *SwitchSinkRequest) (*StatusResponse, error)
+	// ReopenSink reopens the output file under its path, e.g. after rotation.
+	ReopenSink(context.Context, *ReopenSinkRequest) (*StatusResponse, error)
+	// StreamRecords sends each record written from now on, until the client
+	// cancels the call.
+	StreamRecords(*StreamRecordsRequest, grpc.ServerStreamingServer[Record]) error
+	mustEmbedUnimplementedControlServiceServer()
+}
+
+// UnimplementedControlServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedControlServiceServer struct{}
+
+func (UnimplementedControlServiceServer) Start(context.Context, *ControlRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
+func (UnimplementedControlServiceServer) Stop(context.Context, *ControlRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+}
+func (UnimplementedControlServiceServer) Reset(context.Context, *ControlRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reset not implemented")
+}
+func (UnimplementedControlServiceServer) Status(context.Context, *ControlRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedControlServiceServer) Annotate(context.Context, *AnnotateRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Annotate not implemented")
+}
+func (UnimplementedControlServiceServer) SwitchSink(context.Context, *SwitchSinkRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SwitchSink not implemented")
+}
+func (UnimplementedControlServiceServer) ReopenSink(context.Context, *ReopenSinkRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReopenSink not implemented")
+}
+func (UnimplementedControlServiceServer) StreamRecords(*StreamRecordsRequest, grpc.ServerStreamingServer[Record]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamRecords not implemented")
+}
+func (UnimplementedControlServiceServer) mustEmbedUnimplementedControlServiceServer() {}
+func (UnimplementedControlServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeControlServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ControlServiceServer will
+// result in compilation errors.
+type UnsafeControlServiceServer interface {
+	mustEmbedUnimplementedControlServiceServer()
+}
+
+func RegisterControlServiceServer(s grpc.ServiceRegistrar, srv ControlServiceServer) {
+	// If the following call pancis, it indicates UnimplementedControlServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ControlService_ServiceDesc, srv)
+}
+
+func _ControlService_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ControlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_Start_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).Start(ctx, req.(*ControlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlService_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ControlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_Stop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).Stop(ctx, req.(*ControlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlService_Reset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ControlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).Reset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_Reset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).Reset(ctx, req.(*ControlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlService_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ControlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).Status(ctx, req.(*ControlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlService_Annotate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnnotateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).Annotate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_Annotate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).Annotate(ctx, req.(*AnnotateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlService_SwitchSink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SwitchSinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).SwitchSink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_SwitchSink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).SwitchSink(ctx, req.(*SwitchSinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlService_ReopenSink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReopenSinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).ReopenSink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_ReopenSink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).ReopenSink(ctx, req.(*ReopenSinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlService_StreamRecords_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRecordsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServiceServer).StreamRecords(m, &grpc.GenericServerStream[StreamRecordsRequest, Record]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ControlService_StreamRecordsServer = grpc.ServerStreamingServer[Record]
+
+// ControlService_ServiceDesc is the grpc.ServiceDesc for ControlService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ControlService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "script2json.control.v1.ControlService",
+	HandlerType: (*ControlServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Start",
+			Handler:    _ControlService_Start_Handler,
+		},
+		{
+			MethodName: "Stop",
+			Handler:    _ControlService_Stop_Handler,
+		},
+		{
+			MethodName: "Reset",
+			Handler:    _ControlService_Reset_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _ControlService_Status_Handler,
+		},
+		{
+			MethodName: "Annotate",
+			Handler:    _ControlService_Annotate_Handler,
+		},
+		{
+			MethodName: "SwitchSink",
+			Handler:    _ControlService_SwitchSink_Handler,
+		},
+		{
+			MethodName: "ReopenSink",
+			Handler:    _ControlService_ReopenSink_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRecords",
+			Handler:       _ControlService_StreamRecords_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "control.proto",
+}
@@ -0,0 +1,5 @@
+// Package controlpb is the generated gRPC code of script2json's ControlService,
+// defined in control.proto.
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
@@ -0,0 +1,25 @@
+// Package ansiclean strips terminal noise from a byte stream, for programs that
+// only want the text a terminal would show and none of script2json's FIFOs,
+// sessions or records:
+//
+//	text := ansiclean.Clean(raw)
+//
+// It runs the stream through the heuristic screen model of package pipeline, so
+// escape sequences are removed after they take effect: backspaces, cursor
+// movement, erases and carriage-return redraws edit the text as they would on a
+// terminal, and what full-screen programs draw on the alternate screen is dropped.
+package ansiclean
+
+import "script2json/pkg/pipeline"
+
+// Clean returns the text that b shows on a terminal, without escape sequences or
+// control characters. Line endings are kept as they are, "\r\n" included, and bytes
+// that aren't valid UTF-8 are passed through, apart from a character cut off at the
+// end of b. Malformed or unterminated escape sequences are dropped, and count
+// towards pipeline.ParseErrors; a CSI sequence longer than pipeline.MaxCSILength is
+// dropped up to its final byte.
+func Clean(b []byte) []byte {
+	editor := pipeline.NewLineEditor(pipeline.EditorOptions{}, nil, nil)
+	editor.Write(b)
+	return []byte(editor.Flush())
+}
@@ -0,0 +1,96 @@
+package ansiclean
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestClean tests stripping every kind of terminal noise
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"Empty", "", ""},
+		{"Plain text", "hello world", "hello world"},
+		{"LF line endings", "one\ntwo\n", "one\ntwo\n"},
+		{"CRLF line endings", "one\r\ntwo\r\n", "one\r\ntwo\r\n"},
+		{"Tab", "a\tb", "a       b"},
+		{"UTF-8", "héllo ✓", "héllo ✓"},
+		{"Invalid UTF-8", "caf\xe9 au lait", "caf\xe9 au lait"},
+
+		// Control characters
+		{"Backspace", "helo\bl\blo", "hello"},
+		{"DEL", "abc\x7fd", "abd"},
+		{"Kill line", "wrong\x15right", "right"},
+		{"Vertical tab is a line feed", "ab\x0bcd", "ab\ncd"},
+		{"Kill word", "git stauts\x17status", "git status"},
+		{"Bell", "ding\x07", "ding"},
+		{"EOF", "one\x04two", "onetwo"},
+		{"Form feed and shifts", "a\x0cb\x0ec\x0fd", "abcd"},
+		{"Carriage return redraw", "10%\r50%\r100%", "100%"},
+		{"Carriage return shorter redraw", "loading...\rdone", "doneing..."},
+		{"Carriage return and erase", "loading...\r\x1b[Kdone", "done"},
+		{"Colored progress", "\x1b[1;31merror\x1b[0m\n10%\r\x1b[K100%\n", "error\n100%\n"},
+
+		// CSI sequences
+		{"SGR colors", "\x1b[1;31mred\x1b[0m plain", "red plain"},
+		{"C1 CSI", "\x9b31mred\x9b0m", "red"},
+		{"Cursor left and insert", "ac\x1b[Db", "abc"},
+		{"Cursor right", "abc\x1b[2D\x1b[CX", "abXc"},
+		{"Cursor up", "one\ntwo\x1b[A\rONE", "ONE\ntwo"},
+		{"Cursor down", "one\ntwo\x1b[A\x1b[B\rTWO", "one\nTWO"},
+		{"Cursor position", "xx\nyy\x1b[1;1HZ", "Zxx\nyy"},
+		{"Erase line to end", "abcdef\x1b[3D\x1b[K", "abc"},
+		{"Erase whole line", "abc\x1b[2K", ""},
+		{"Erase display", "abc\x1b[2J", ""},
+		{"Delete chars", "abcdef\x1b[4D\x1b[2P", "abef"},
+		{"Insert chars", "abc\x1b[2D\x1b[@", "a bc"},
+		{"Home and End keys", "bc\x1b[1~a\x1b[4~d", "abcd"},
+		{"Delete key", "abXc\x1b[2D\x1b[3~", "abc"},
+		{"Save and restore cursor", "ab\x1b[s\x1b[1D\x1b[uc", "abc"},
+		{"Bracketed paste", "\x1b[200~pasted\x1b[201~", "pasted"},
+		{"Private mode", "\x1b[?25lhidden cursor\x1b[?25h", "hidden cursor"},
+		{"Mouse report", "a\x1b[M !!b", "ab"},
+		{"SGR mouse report", "a\x1b[<0;10;5Mb", "ab"},
+
+		// Other escapes
+		{"Charset selection", "\x1b(Bplain", "plain"},
+		{"DECSC and DECRC", "ab\x1b7\x1b[1D\x1b8c", "abc"},
+		{"SS3 keys", "bc\x1bOHa", "abc"},
+		{"OSC title with BEL", "\x1b]0;title\x07text", "text"},
+		{"OSC title with ST", "\x1b]2;title\x1b\\text", "text"},
+		{"OSC hyperlink", "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"DCS", "a\x1bPq#0;2;0;0;0\x1b\\b", "ab"},
+		{"APC", "a\x1b_Gf=100;AAAA\x1b\\b", "ab"},
+
+		// Alternate screen
+		{"Alternate screen", "before\x1b[?1049hvim\x1b[2J\x1b[H~\x1b[?1049lafter", "beforeafter"},
+
+		// Malformed input
+		{"Cancelled sequence", "a\x1b[12\x18b", "ab"},
+		{"Unterminated sequence", "text\x1b[12;", "text"},
+		{"Overlong sequence", "a\x1b[" + strings.Repeat("1;", 200) + "mb", "ab"},
+		{"Lone ESC", "text\x1b", "text"},
+		{"Unfinished character", "caf\xc3", "caf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Clean([]byte(tt.input))); got != tt.want {
+				t.Errorf("Clean(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCleanIndependent tests that each call starts from a blank screen, and that
+// Clean doesn't change its input
+func TestCleanIndependent(t *testing.T) {
+	input := []byte("\x1b[?1049hfull screen")
+	Clean(input)
+	if got := string(Clean([]byte("text"))); got != "text" {
+		t.Errorf("Clean after an alternate screen = %q, want text", got)
+	}
+	if string(input) != "\x1b[?1049hfull screen" {
+		t.Errorf("Clean changed its input to %q", input)
+	}
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import "sync/atomic"
+
+// Control characters, and the final bytes of the escape sequences that the line
+// editor and the terminal emulator handle
+const (
+	EOF         = 0x04
+	ESC         = 0x1B
+	BACKSPACE   = 0x08
+	DEL         = 0x7F
+	KILL_LINE   = 0x15 // Ctrl-U: kill from the start of the line to the cursor
+	VT          = 0x0B // Vertical tab: a line feed, like in a terminal
+	KILL_WORD   = 0x17 // Ctrl-W: kill the word before the cursor
+	CSI         = '['
+	OSC         = ']'
+	BEL         = 0x07
+	CAN         = 0x18 // Cancels an escape sequence
+	SUB         = 0x1A // Cancels an escape sequence
+	FF          = 0x0C // Form feed
+	SO          = 0x0E // Shift out: switch to the G1 character set
+	SI          = 0x0F // Shift in: switch back to the G0 character set
+	TAB         = '\t'
+	ST          = '\\' // Final byte of the ESC \ string terminator
+	ARROW_LEFT  = 'D'
+	ARROW_RIGHT = 'C'
+
+	CURSOR_UP           = 'A'
+	CURSOR_DOWN         = 'B'
+	CURSOR_POSITION     = 'H'
+	CURSOR_POSITION_ALT = 'f'
+	CURSOR_END          = 'F' // End key; with a count, cursor previous line (CPL)
+	ERASE_IN_LINE       = 'K'
+	ERASE_IN_DISPLAY    = 'J'
+	SGR                 = 'm'
+	INSERT_CHARS        = '@'
+	DELETE_CHARS        = 'P'
+	EDITING_KEY         = '~' // Final byte of CSI n ~ sequences such as delete (3~)
+	SAVE_CURSOR         = 's'
+	RESTORE_CURSOR      = 'u'
+	SET_SCROLL_REGION   = 'r'
+	SCROLL_UP           = 'S'
+	SCROLL_DOWN         = 'T'
+	DECSC               = '7'  // ESC 7: save cursor
+	DECRC               = '8'  // ESC 8: restore cursor
+	IND                 = 'D'  // ESC D: index (down one line, scrolling if needed)
+	RI                  = 'M'  // ESC M: reverse index (up one line, scrolling if needed)
+	SS3                 = 'O'  // ESC O x: keys in application cursor mode, e.g. ESC O H (Home)
+	C1_CSI              = 0x9B // 8-bit equivalent of ESC [
+	DCS                 = 'P'  // ESC P: device control string, e.g. a sixel image
+	SOS                 = 'X'  // ESC X: start of string
+	PM                  = '^'  // ESC ^: privacy message
+	APC                 = '_'  // ESC _: application program command, e.g. a kitty graphics image
+	MOUSE_REPORT        = 'M'  // ESC [ M Cb Cx Cy: legacy X10 mouse report with 3 raw bytes
+	SGR_MOUSE           = '<'  // ESC [ < b;x;y M/m: SGR (1006) mouse report
+)
+
+// PASTE_START is the body of the CSI sequence that starts a bracketed paste.
+// The paste ends with "201~", which needs no handling beyond being stripped.
+const PASTE_START = "200~"
+
+// ITERM2_OSC is the start of iTerm2's OSC 1337 payloads, which include base64
+// inline images of arbitrary size. Their contents are never buffered.
+const ITERM2_OSC = "1337;"
+
+// MaxCSILength is the longest CSI sequence (parameters and final byte) the parsers
+// accept. Real sequences are far shorter; a longer one means the stream is malformed
+// or out of sync, so the sequence is abandoned rather than buffered, and the rest of
+// it is ignored up to its final byte, as a terminal does.
+const MaxCSILength = 128
+
+// parseErrors counts malformed input across all editors, so desyncs can be
+// surfaced alongside other runtime state.
+var parseErrors atomic.Uint64
+
+// ParseErrors returns the number of malformed or abandoned escape sequences that
+// the editors of this process have met.
+func ParseErrors() uint64 {
+	return parseErrors.Load()
+}
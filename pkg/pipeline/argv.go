@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+)
+
+// errUnterminatedQuote is returned by splitArgv when a quoted string is not closed.
+var errUnterminatedQuote = errors.New("unterminated quoted string")
+
+// splitArgv tokenizes a command line using POSIX shell quoting rules.
+// Words are separated by unquoted whitespace. Single quotes preserve their
+// contents literally, double quotes allow backslash escapes of $, `, ", \ and
+// newline, and an unquoted backslash escapes the following character.
+// Shell syntax such as pipes, redirections and expansions is not interpreted;
+// operators are returned as ordinary words.
+func splitArgv(command string) ([]string, error) {
+	var argv []string
+	var word strings.Builder
+	inWord := false
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				argv = append(argv, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			inWord = true
+			if i+1 < len(runes) {
+				i++
+				// A backslash-newline pair is a line continuation
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+				}
+			}
+		case r == '\'':
+			inWord = true
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, errUnterminatedQuote
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inWord = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, errUnterminatedQuote
+			}
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	if inWord {
+		argv = append(argv, word.String())
+	}
+	return argv, nil
+}
+
+// privilegeCommands lists programs that run their arguments with elevated privileges.
+var privilegeCommands = map[string]bool{
+	"sudo": true,
+	"doas": true,
+	"su":   true,
+}
+
+// isPrivileged reports whether a command starts with a privilege escalation program
+// such as sudo, doas or su. Leading variable assignments (e.g. "LANG=C sudo ...") and
+// absolute program paths (e.g. "/usr/bin/sudo") are recognized.
+func isPrivileged(command string) bool {
+	argv, err := splitArgv(command)
+	if err != nil {
+		argv = strings.Fields(command)
+	}
+	for _, word := range argv {
+		if name, _, ok := strings.Cut(word, "="); ok && name != "" && !strings.Contains(name, "/") {
+			continue
+		}
+		return privilegeCommands[word[strings.LastIndex(word, "/")+1:]]
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitArgv tests shell-style tokenization of commands
+func TestSplitArgv(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "Simple words",
+			command:  "ls -la /tmp",
+			expected: []string{"ls", "-la", "/tmp"},
+		},
+		{
+			name:     "Extra whitespace",
+			command:  "  echo   hello\tworld ",
+			expected: []string{"echo", "hello", "world"},
+		},
+		{
+			name:     "Single quotes are literal",
+			command:  `echo 'a "b" \c'`,
+			expected: []string{"echo", `a "b" \c`},
+		},
+		{
+			name:     "Double quotes with escapes",
+			command:  `echo "say \"hi\" \$HOME \n"`,
+			expected: []string{"echo", `say "hi" $HOME \n`},
+		},
+		{
+			name:     "Backslash escapes space",
+			command:  `cat my\ file.txt`,
+			expected: []string{"cat", "my file.txt"},
+		},
+		{
+			name:     "Adjacent quoted parts join into one word",
+			command:  `grep -e 'foo'"bar"baz`,
+			expected: []string{"grep", "-e", "foobarbaz"},
+		},
+		{
+			name:     "Empty quoted argument",
+			command:  `printf ''`,
+			expected: []string{"printf", ""},
+		},
+		{
+			name:     "Operators are ordinary words",
+			command:  "echo foo | rev",
+			expected: []string{"echo", "foo", "|", "rev"},
+		},
+		{
+			name:     "Empty command",
+			command:  "",
+			expected: nil,
+		},
+		{
+			name:    "Unterminated single quote",
+			command: "echo 'oops",
+			wantErr: true,
+		},
+		{
+			name:    "Unterminated double quote",
+			command: `echo "oops`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, err := splitArgv(tt.command)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("splitArgv(%q) expected error, got %q", tt.command, argv)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitArgv(%q) returned error: %v", tt.command, err)
+			}
+			if !reflect.DeepEqual(argv, tt.expected) {
+				t.Errorf("splitArgv(%q) = %q, want %q", tt.command, argv, tt.expected)
+			}
+		})
+	}
+}
+
+// TestIsPrivileged tests detection of privilege escalation commands
+func TestIsPrivileged(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected bool
+	}{
+		{"sudo systemctl restart sshd", true},
+		{"doas vi /etc/hosts", true},
+		{"su - root", true},
+		{"/usr/bin/sudo -i", true},
+		{"SUDO_ASKPASS=/bin/true sudo -A ls", true},
+		{"sudoku --new", false},
+		{"echo sudo", false},
+		{"ls | sudo tee /etc/motd", false},
+		{"FOO=bar", false},
+		{"sudo 'unterminated", true},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPrivileged(tt.command); got != tt.expected {
+			t.Errorf("isPrivileged(%q) = %v, want %v", tt.command, got, tt.expected)
+		}
+	}
+}
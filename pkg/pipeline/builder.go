@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// ErrInvalidRecord is the error, wrapped with the reason, of a record that
+// RecordBuilder.Build rejects.
+var ErrInvalidRecord = errors.New("invalid record")
+
+// BuilderOptions controls what a RecordBuilder fills in and cuts.
+type BuilderOptions struct {
+	// IDs is the counter that numbers records built without an ID, which can be
+	// shared with a RecordCreator; nil gives the builder a counter of its own
+	IDs *atomic.Uint64
+	// MaxOutputBytes truncates Output and StyledOutput as TruncateOutput does
+	// (0 disables)
+	MaxOutputBytes int
+	// RecorderVersion tags the records that don't have a version of their own, if set
+	RecorderVersion string
+}
+
+// RecordBuilder turns CommandRecords that a program assembles itself into records
+// that match the published schema, as if a RecordCreator had made them. It is safe
+// for concurrent use.
+type RecordBuilder struct {
+	opts BuilderOptions
+}
+
+// NewRecordBuilder returns a RecordBuilder that numbers and cuts records as opts
+// says.
+func NewRecordBuilder(opts BuilderOptions) *RecordBuilder {
+	if opts.IDs == nil {
+		opts.IDs = new(atomic.Uint64)
+	}
+	return &RecordBuilder{opts: opts}
+}
+
+// Build checks record and returns it completed: numbered from the builder's counter
+// if it has no ID, with output that isn't UTF-8 transcoded and its Encoding set as
+// RecordCreator sets it, and truncated to MaxOutputBytes. A record missing its
+// return timestamp, with another text field that isn't UTF-8, or with a field the
+// schema doesn't allow, such as a negative duration or a container without an ID,
+// is rejected with an error that wraps ErrInvalidRecord for each problem. No ID
+// is used up by a rejected record.
+func (b *RecordBuilder) Build(record CommandRecord) (CommandRecord, error) {
+	if err := validateRecord(record); err != nil {
+		return CommandRecord{}, err
+	}
+
+	if record.Output != "" && (record.Encoding == "" || !utf8.ValidString(record.Output)) {
+		record.Output, record.Encoding = normalizeEncoding(record.Output)
+	}
+	record.StyledOutput, _ = normalizeEncoding(record.StyledOutput)
+	if b.opts.MaxOutputBytes > 0 {
+		record, _ = TruncateOutput(b.opts.MaxOutputBytes).Process(record)
+	}
+	if record.RecorderVersion == "" {
+		record.RecorderVersion = b.opts.RecorderVersion
+	}
+	if record.ID == "" {
+		record.ID = strconv.FormatUint(b.opts.IDs.Add(1), 10)
+	}
+	return record, nil
+}
+
+// validateRecord returns the problems of record that Build can't fix, joined.
+func validateRecord(record CommandRecord) error {
+	var errs []error
+	invalid := func(reason string) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidRecord, reason))
+	}
+
+	if record.ReturnTimestamp.IsZero() {
+		invalid("return_timestamp is required")
+	}
+	if record.StartTimestamp != nil && record.StartTimestamp.After(record.ReturnTimestamp) {
+		invalid("start_timestamp is after return_timestamp")
+	}
+	if record.DurationMs < 0 || record.BellCount < 0 || record.ProgressFramesCollapsed < 0 {
+		invalid("duration_ms, bell_count and progress_frames_collapsed can't be negative")
+	}
+	if c := record.Container; c != nil && (c.Runtime == "" || c.ID == "" || c.Image == "") {
+		invalid("container needs a runtime, an id and an image")
+	}
+	if k := record.Kubernetes; k != nil && (k.Namespace == "" || k.Pod == "") {
+		invalid("kubernetes needs a namespace and a pod")
+	}
+	for _, field := range textFields(record) {
+		if !utf8.ValidString(field.value) {
+			invalid(field.name + " is not valid UTF-8")
+		}
+	}
+	if record.Attributes != nil {
+		if _, err := json.Marshal(record.Attributes); err != nil {
+			invalid(fmt.Sprintf("attributes can't be encoded as JSON: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// textField is a text field of a record, named as in its JSON.
+type textField struct {
+	name, value string
+}
+
+// textFields returns the text fields of record that Build doesn't transcode.
+func textFields(record CommandRecord) []textField {
+	fields := []textField{
+		{"id", record.ID},
+		{"session", record.Session},
+		{"host", record.Host},
+		{"command", record.Command},
+		{"encoding", record.Encoding},
+		{"cwd", record.Cwd},
+		{"recorder_version", record.RecorderVersion},
+	}
+	for i, arg := range record.Argv {
+		fields = append(fields, textField{fmt.Sprintf("argv[%d]", i), arg})
+	}
+	for i, link := range record.Links {
+		fields = append(fields, textField{fmt.Sprintf("links[%d]", i), link})
+	}
+	for i, sample := range record.ProgressSamples {
+		fields = append(fields, textField{fmt.Sprintf("progress_samples[%d].line", i), sample.Line})
+	}
+	for i, event := range record.OutputEvents {
+		fields = append(fields, textField{fmt.Sprintf("output_events[%d]", i), event.Data})
+	}
+	if c := record.Container; c != nil {
+		fields = append(fields, textField{"container.runtime", c.Runtime}, textField{"container.id", c.ID}, textField{"container.image", c.Image})
+	}
+	if k := record.Kubernetes; k != nil {
+		fields = append(fields, textField{"kubernetes.cluster", k.Cluster}, textField{"kubernetes.namespace", k.Namespace},
+			textField{"kubernetes.pod", k.Pod}, textField{"kubernetes.container", k.Container})
+	}
+	return fields
+}
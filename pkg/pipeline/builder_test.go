@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRecordBuilder tests numbering, transcoding, truncating and tagging the
+// records a program assembles
+func TestRecordBuilder(t *testing.T) {
+	ids := &atomic.Uint64{}
+	creator := NewRecordCreator(RecordOptions{IDs: ids})
+	builder := NewRecordBuilder(BuilderOptions{IDs: ids, MaxOutputBytes: 8, RecorderVersion: "1.2.3"})
+	now := time.Now()
+
+	if record := creator.Create("ls", Output{Text: "a"}, now); record.ID != "1" {
+		t.Fatalf("Created ID = %s, want 1", record.ID)
+	}
+	record, err := builder.Build(CommandRecord{Command: "cat", Output: "caf\xe9 au lait", ReturnTimestamp: now})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if record.ID != "2" {
+		t.Errorf("ID = %s, want 2 from the shared counter", record.ID)
+	}
+	if record.Output != "café au" || record.Encoding != encodingISO88591 || !record.OutputTruncated {
+		t.Errorf("Output = %q in %q (truncated %v), want it transcoded and truncated", record.Output, record.Encoding, record.OutputTruncated)
+	}
+	if record.RecorderVersion != "1.2.3" {
+		t.Errorf("RecorderVersion = %q, want 1.2.3", record.RecorderVersion)
+	}
+
+	record, err = builder.Build(CommandRecord{ID: "web-7", Command: "pwd", Output: "/src", ReturnTimestamp: now, RecorderVersion: "2.0.0"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if record.ID != "web-7" || record.Encoding != encodingUTF8 || record.RecorderVersion != "2.0.0" || record.OutputTruncated {
+		t.Errorf("Record = %+v, want its own ID and version kept", record)
+	}
+}
+
+// TestRecordBuilderInvalid tests rejecting records that break the schema, without
+// using up an ID
+func TestRecordBuilderInvalid(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Second)
+	tests := []struct {
+		name    string
+		record  CommandRecord
+		wantErr []string
+	}{
+		{"No timestamp", CommandRecord{Command: "ls"}, []string{"return_timestamp is required"}},
+		{"Starts after return", CommandRecord{ReturnTimestamp: now, StartTimestamp: &later}, []string{"start_timestamp"}},
+		{"Negative", CommandRecord{ReturnTimestamp: now, DurationMs: -1}, []string{"negative"}},
+		{"Command not UTF-8", CommandRecord{Command: "ls \xff", ReturnTimestamp: now}, []string{"command is not valid UTF-8"}},
+		{"Argv not UTF-8", CommandRecord{Argv: []string{"ls", "\xff"}, ReturnTimestamp: now}, []string{"argv[1]"}},
+		{"Container", CommandRecord{Container: &ContainerInfo{Runtime: "docker"}, ReturnTimestamp: now}, []string{"container needs"}},
+		{"Pod", CommandRecord{Kubernetes: &KubernetesInfo{Namespace: "default", Pod: "web\xff"}, ReturnTimestamp: now}, []string{"kubernetes.pod"}},
+		{"Attributes", CommandRecord{Attributes: map[string]any{"fn": func() {}}, ReturnTimestamp: now}, []string{"attributes"}},
+		{"Several", CommandRecord{Cwd: "\xff"}, []string{"return_timestamp", "cwd"}},
+	}
+	builder := NewRecordBuilder(BuilderOptions{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := builder.Build(tt.record)
+			if !errors.Is(err, ErrInvalidRecord) {
+				t.Fatalf("Build() = %v, want ErrInvalidRecord", err)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Build() = %v, want an error containing %q", err, want)
+				}
+			}
+		})
+	}
+	if record, err := builder.Build(CommandRecord{ReturnTimestamp: now}); err != nil || record.ID != "1" {
+		t.Errorf("Build() = %q, %v, want ID 1 after the rejected records", record.ID, err)
+	}
+}
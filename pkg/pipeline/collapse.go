@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"strings"
+	"unicode"
+)
+
+// progressRunes are characters that change between frames of typical progress
+// output (spinners, bars, percentages) in addition to digits, braille spinners and
+// block, box-drawing and geometric shape characters.
+const progressRunes = "|/-\\%#=>.*+·• "
+
+// isProgressRune reports whether r is a character that varies between progress frames.
+func isProgressRune(r rune) bool {
+	return unicode.IsDigit(r) ||
+		strings.ContainsRune(progressRunes, r) ||
+		(r >= 0x2500 && r <= 0x25FF) || // box drawing, block elements, geometric shapes
+		(r >= 0x2800 && r <= 0x28FF) // braille patterns
+}
+
+// progressSkeleton returns line with all progress characters removed. Lines with the
+// same non-empty skeleton are frames of the same progress display.
+func progressSkeleton(line string) string {
+	return strings.Map(func(r rune) rune {
+		if isProgressRune(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// collapseProgressFrames replaces each run of consecutive lines that differ only in
+// progress characters (e.g. "Downloading 10%", "Downloading 11%", ...) with the last
+// line of the run, and returns the result along with the number of lines removed.
+// Identical lines and lines made up entirely of progress characters are never
+// collapsed, since they are more likely to be real output.
+func collapseProgressFrames(output string) (string, int) {
+	lines := strings.SplitAfter(output, "\n")
+	kept := make([]string, 0, len(lines))
+	collapsed := 0
+
+	prevSkeleton, prevLine := "", ""
+	for _, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+		skeleton := progressSkeleton(content)
+		if len(kept) > 0 && skeleton != "" && skeleton == prevSkeleton && content != prevLine {
+			kept[len(kept)-1] = line
+			collapsed++
+		} else {
+			kept = append(kept, line)
+		}
+		prevSkeleton, prevLine = skeleton, content
+	}
+	if collapsed == 0 {
+		return output, 0
+	}
+	return strings.Join(kept, ""), collapsed
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import "testing"
+
+// TestCollapseProgressFrames tests collapsing of progress output into its final frame
+func TestCollapseProgressFrames(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		expected  string
+		collapsed int
+	}{
+		{
+			name:      "Percentages",
+			output:    "Downloading 10%\r\nDownloading 55%\r\nDownloading 100%\r\nDone\r\n",
+			expected:  "Downloading 100%\r\nDone\r\n",
+			collapsed: 2,
+		},
+		{
+			name:      "Bars and spinners",
+			output:    "[##   ] | 2/5\n[###  ] / 3/5\n[#####] - 5/5",
+			expected:  "[#####] - 5/5",
+			collapsed: 2,
+		},
+		{
+			name:      "Unicode bars and braille spinners",
+			output:    "⠋ pulling ━━╸      \n⠙ pulling ━━━━╸    \n⠹ pulling ━━━━━━━━━\nok",
+			expected:  "⠹ pulling ━━━━━━━━━\nok",
+			collapsed: 2,
+		},
+		{
+			name:      "Separate runs",
+			output:    "a 1%\na 100%\nbuilding\nb 1%\nb 100%\n",
+			expected:  "a 100%\nbuilding\nb 100%\n",
+			collapsed: 2,
+		},
+		{
+			name:      "Identical lines are kept",
+			output:    "ok\nok\nok\n",
+			expected:  "ok\nok\nok\n",
+			collapsed: 0,
+		},
+		{
+			name:      "Lines of only digits are kept",
+			output:    "1\n2\n3\n",
+			expected:  "1\n2\n3\n",
+			collapsed: 0,
+		},
+		{
+			name:      "Different text is kept",
+			output:    "file1.txt\nfile2.log\n",
+			expected:  "file1.txt\nfile2.log\n",
+			collapsed: 0,
+		},
+		{
+			name:      "Empty output",
+			output:    "",
+			expected:  "",
+			collapsed: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, collapsed := collapseProgressFrames(tt.output)
+			if got != tt.expected {
+				t.Errorf("collapseProgressFrames() output = %q, want %q", got, tt.expected)
+			}
+			if collapsed != tt.collapsed {
+				t.Errorf("collapseProgressFrames() collapsed = %d, want %d", collapsed, tt.collapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// handleCSI processes a Control Sequence Introducer (CSI) escape sequence.
+// It updates the screen contents, cursor position, and alternate screen mode state as appropriate.
+// - seq: the CSI sequence bytes
+// - scr: the screen model of the current command's output
+// - inAlternateScreen: pointer to a bool indicating if alternate screen mode is active
+func handleCSI(seq []byte, scr *screen, inAlternateScreen *bool) {
+	if on, ok := altScreenSwitch(seq); ok {
+		*inAlternateScreen = on
+	} else if len(seq) > 0 && !*inAlternateScreen {
+		params := csiParams(seq)
+		switch seq[len(seq)-1] {
+		case ARROW_LEFT:
+			scr.moveLeft(csiParam(params, 0, 1))
+		case ARROW_RIGHT:
+			scr.moveRight(csiParam(params, 0, 1))
+		case CURSOR_UP:
+			scr.moveUp(csiParam(params, 0, 1))
+		case CURSOR_DOWN:
+			scr.moveDown(csiParam(params, 0, 1))
+		case CURSOR_END:
+			if len(params) == 0 {
+				scr.lineEnd()
+			} else {
+				scr.moveUp(csiParam(params, 0, 1))
+				scr.lineHome()
+			}
+		case CURSOR_POSITION, CURSOR_POSITION_ALT:
+			// Positions are 1-based, with row 1 being the first line of the command's output.
+			// Without parameters this is the origin, which for a single-line edit is also
+			// where the Home key goes
+			scr.moveTo(csiParam(params, 0, 1)-1, csiParam(params, 1, 1)-1)
+		case ERASE_IN_LINE:
+			scr.eraseLine(csiParam(params, 0, 0))
+		case ERASE_IN_DISPLAY:
+			scr.eraseDisplay(csiParam(params, 0, 0))
+		case SET_SCROLL_REGION:
+			// Rows are 1-based like CSI H; a missing bottom row removes the region
+			scr.setScrollRegion(csiParam(params, 0, 1)-1, csiParam(params, 1, 0)-1)
+		case SCROLL_UP:
+			scr.scrollUp(csiParam(params, 0, 1))
+		case SCROLL_DOWN:
+			scr.scrollDown(csiParam(params, 0, 1))
+		case INSERT_CHARS:
+			scr.insertBlanks(csiParam(params, 0, 1))
+		case DELETE_CHARS:
+			scr.deleteChars(csiParam(params, 0, 1))
+		case EDITING_KEY:
+			switch csiParam(params, 0, 0) {
+			case 1, 7: // Home (xterm, rxvt)
+				scr.lineHome()
+			case 3: // Delete
+				scr.deleteChars(1)
+			case 4, 8: // End (xterm, rxvt)
+				scr.lineEnd()
+			}
+		// With parameters or a private prefix, s and u mean something else
+		// (e.g. left/right margins, keyboard protocol queries)
+		case SAVE_CURSOR:
+			if len(seq) == 1 {
+				scr.saveCursor()
+			}
+		case RESTORE_CURSOR:
+			if len(seq) == 1 {
+				scr.restoreCursor()
+			}
+		}
+	}
+}
+
+// oscHyperlink returns the target URI of an OSC 8 hyperlink payload
+// ("8;params;uri"), or "" if the payload is not a hyperlink or closes one.
+func oscHyperlink(payload []byte) string {
+	rest, ok := bytes.CutPrefix(payload, []byte("8;"))
+	if !ok {
+		return ""
+	}
+	_, uri, ok := bytes.Cut(rest, []byte(";"))
+	if !ok {
+		return ""
+	}
+	return string(uri)
+}
+
+// csiParams parses the numeric parameters of a CSI sequence, e.g. "12;5H" yields [12 5].
+// Private-mode prefixes such as '?' are ignored, and empty parameters are returned as 0.
+func csiParams(seq []byte) []int {
+	if len(seq) == 0 {
+		return nil
+	}
+	body := bytes.TrimLeft(seq[:len(seq)-1], "?<=>")
+	if len(body) == 0 {
+		return nil
+	}
+	var params []int
+	for _, field := range bytes.Split(body, []byte(";")) {
+		n, err := strconv.Atoi(string(field))
+		if err != nil {
+			n = 0
+		}
+		params = append(params, n)
+	}
+	return params
+}
+
+// csiParam returns the i-th CSI parameter, or def if it is missing or zero.
+func csiParam(params []int, i int, def int) int {
+	if i >= len(params) || params[i] == 0 {
+		return def
+	}
+	return params[i]
+}
+
+// altScreenSwitch reports whether seq enters (on) or leaves the alternate screen.
+func altScreenSwitch(seq []byte) (on, ok bool) {
+	if !bytes.Contains(seq, []byte("?1049")) {
+		return false, false
+	}
+	switch {
+	case bytes.HasSuffix(seq, []byte("h")):
+		return true, true
+	case bytes.HasSuffix(seq, []byte("l")):
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,304 @@
+package pipeline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestHandleCSI tests the ANSI CSI sequence handling logic
+func TestHandleCSI(t *testing.T) {
+	tests := []struct {
+		name              string
+		seq               []byte
+		initialBuffer     []byte
+		initialCursor     int
+		initialAltScreen  bool
+		expectedBuffer    []byte
+		expectedCursor    int
+		expectedAltScreen bool
+	}{
+		{
+			name:              "Enter alternate screen",
+			seq:               []byte("?1049h"),
+			initialBuffer:     []byte("hello"),
+			initialCursor:     5,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("hello"),
+			expectedCursor:    5,
+			expectedAltScreen: true,
+		},
+		{
+			name:              "Exit alternate screen",
+			seq:               []byte("?1049l"),
+			initialBuffer:     []byte("world"),
+			initialCursor:     3,
+			initialAltScreen:  true,
+			expectedBuffer:    []byte("world"),
+			expectedCursor:    3,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Arrow left moves cursor",
+			seq:               []byte("D"),
+			initialBuffer:     []byte("test"),
+			initialCursor:     4,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("test"),
+			expectedCursor:    3,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Arrow left at position 0 stays at 0",
+			seq:               []byte("D"),
+			initialBuffer:     []byte("test"),
+			initialCursor:     0,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("test"),
+			expectedCursor:    0,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Arrow right moves cursor",
+			seq:               []byte("C"),
+			initialBuffer:     []byte("test"),
+			initialCursor:     2,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("test"),
+			expectedCursor:    3,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Cursor left with count",
+			seq:               []byte("5D"),
+			initialBuffer:     []byte("hello world"),
+			initialCursor:     11,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("hello world"),
+			expectedCursor:    6,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Cursor left with count stops at 0",
+			seq:               []byte("10D"),
+			initialBuffer:     []byte("test"),
+			initialCursor:     3,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("test"),
+			expectedCursor:    0,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Cursor right with count",
+			seq:               []byte("3C"),
+			initialBuffer:     []byte("hello world"),
+			initialCursor:     2,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("hello world"),
+			expectedCursor:    5,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Cursor right with count stops at end",
+			seq:               []byte("10C"),
+			initialBuffer:     []byte("test"),
+			initialCursor:     1,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("test"),
+			expectedCursor:    4,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Zero count moves one column",
+			seq:               []byte("0D"),
+			initialBuffer:     []byte("test"),
+			initialCursor:     2,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("test"),
+			expectedCursor:    1,
+			expectedAltScreen: false,
+		},
+		{
+			name:              "Arrow right at end of buffer stays at end",
+			seq:               []byte("C"),
+			initialBuffer:     []byte("test"),
+			initialCursor:     4,
+			initialAltScreen:  false,
+			expectedBuffer:    []byte("test"),
+			expectedCursor:    4,
+			expectedAltScreen: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := make([]byte, len(tt.initialBuffer))
+			copy(buffer, tt.initialBuffer)
+			scr := &screen{lines: [][]byte{buffer}, col: tt.initialCursor}
+			altScreen := tt.initialAltScreen
+
+			handleCSI(tt.seq, scr, &altScreen)
+
+			if !bytes.Equal([]byte(scr.String()), tt.expectedBuffer) {
+				t.Errorf("Buffer = %v, want %v", []byte(scr.String()), tt.expectedBuffer)
+			}
+			if scr.col != tt.expectedCursor {
+				t.Errorf("Cursor = %d, want %d", scr.col, tt.expectedCursor)
+			}
+			if altScreen != tt.expectedAltScreen {
+				t.Errorf("AltScreen = %v, want %v", altScreen, tt.expectedAltScreen)
+			}
+		})
+	}
+}
+
+// TestHandleCSIMultiLine tests vertical and absolute cursor movement across lines
+func TestHandleCSIMultiLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		seq         string
+		initialRow  int
+		initialCol  int
+		expectedRow int
+		expectedCol int
+		expectedLen int
+	}{
+		{name: "Cursor up", seq: "A", initialRow: 2, initialCol: 1, expectedRow: 1, expectedCol: 1, expectedLen: 3},
+		{name: "Cursor up with count", seq: "2A", initialRow: 2, initialCol: 1, expectedRow: 0, expectedCol: 1, expectedLen: 3},
+		{name: "Cursor up stops at first line", seq: "5A", initialRow: 1, initialCol: 0, expectedRow: 0, expectedCol: 0, expectedLen: 3},
+		{name: "Cursor down", seq: "B", initialRow: 0, initialCol: 2, expectedRow: 1, expectedCol: 2, expectedLen: 3},
+		{name: "Cursor down stops at last line", seq: "9B", initialRow: 0, initialCol: 0, expectedRow: 2, expectedCol: 0, expectedLen: 3},
+		{name: "Cursor home", seq: "H", initialRow: 2, initialCol: 3, expectedRow: 0, expectedCol: 0, expectedLen: 3},
+		{name: "Cursor position", seq: "2;4H", initialRow: 0, initialCol: 0, expectedRow: 1, expectedCol: 3, expectedLen: 3},
+		{name: "Cursor position with f", seq: "3;1f", initialRow: 0, initialCol: 2, expectedRow: 2, expectedCol: 0, expectedLen: 3},
+		{name: "Cursor position below last line adds lines", seq: "5;1H", initialRow: 0, initialCol: 0, expectedRow: 4, expectedCol: 0, expectedLen: 5},
+		{name: "Cursor position far below last line is capped", seq: "99999999;1H", initialRow: 0, initialCol: 0, expectedRow: 2 + maxScreenGrowth, expectedCol: 0, expectedLen: 3 + maxScreenGrowth},
+		{name: "Cursor position far past end of line is capped", seq: "1;99999999H", initialRow: 2, initialCol: 0, expectedRow: 0, expectedCol: 3 + maxScreenGrowth, expectedLen: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scr := &screen{
+				lines: [][]byte{[]byte("one"), []byte("two"), []byte("three")},
+				row:   tt.initialRow,
+				col:   tt.initialCol,
+			}
+			altScreen := false
+
+			handleCSI([]byte(tt.seq), scr, &altScreen)
+
+			if scr.row != tt.expectedRow || scr.col != tt.expectedCol {
+				t.Errorf("Cursor = (%d, %d), want (%d, %d)", scr.row, scr.col, tt.expectedRow, tt.expectedCol)
+			}
+			if len(scr.lines) != tt.expectedLen {
+				t.Errorf("Lines = %d, want %d", len(scr.lines), tt.expectedLen)
+			}
+		})
+	}
+}
+
+// TestHandleCSIErase tests erase in line (K) and erase in display (J)
+func TestHandleCSIErase(t *testing.T) {
+	tests := []struct {
+		name     string
+		seq      string
+		row      int
+		col      int
+		expected string
+	}{
+		{name: "Erase to end of line", seq: "K", row: 1, col: 2, expected: "one\ntw\nthree"},
+		{name: "Erase to end of line explicit", seq: "0K", row: 1, col: 0, expected: "one\n\nthree"},
+		{name: "Erase to start of line", seq: "1K", row: 2, col: 2, expected: "one\ntwo\n   ee"},
+		{name: "Erase whole line", seq: "2K", row: 1, col: 1, expected: "one\n\nthree"},
+		{name: "Erase to end of display", seq: "J", row: 1, col: 1, expected: "one\nt"},
+		{name: "Erase to start of display", seq: "1J", row: 1, col: 1, expected: "\n  o\nthree"},
+		{name: "Erase whole display", seq: "2J", row: 1, col: 1, expected: "\n"},
+		{name: "Erase display and scrollback", seq: "3J", row: 0, col: 0, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scr := &screen{
+				lines: [][]byte{[]byte("one"), []byte("two"), []byte("three")},
+				row:   tt.row,
+				col:   tt.col,
+			}
+			altScreen := false
+
+			handleCSI([]byte(tt.seq), scr, &altScreen)
+
+			if got := scr.String(); got != tt.expected {
+				t.Errorf("Screen = %q, want %q", got, tt.expected)
+			}
+			if scr.row != tt.row || scr.col != tt.col {
+				t.Errorf("Cursor moved to (%d, %d), want (%d, %d)", scr.row, scr.col, tt.row, tt.col)
+			}
+		})
+	}
+}
+
+// TestHandleCSIScrollRegion tests scroll region setup and scrolling within it
+func TestHandleCSIScrollRegion(t *testing.T) {
+	tests := []struct {
+		name     string
+		seqs     []string
+		expected string
+	}{
+		{name: "Scroll up within region", seqs: []string{"2;3r", "S"}, expected: "a\nc\n\nd"},
+		{name: "Scroll down within region", seqs: []string{"2;4r", "2T"}, expected: "a\n\n\nb"},
+		{name: "Scroll count limited to region", seqs: []string{"1;2r", "9S"}, expected: "\n\nc\nd"},
+		{name: "No region does not scroll", seqs: []string{"S", "T"}, expected: "a\nb\nc\nd"},
+		{name: "Region reset", seqs: []string{"2;3r", "r", "S"}, expected: "a\nb\nc\nd"},
+		{name: "Region bottom far below last line is capped", seqs: []string{"1;99999999r", "S"}, expected: "b\nc\nd" + strings.Repeat("\n", maxScreenGrowth+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scr := &screen{lines: [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}}
+			altScreen := false
+
+			for _, seq := range tt.seqs {
+				handleCSI([]byte(seq), scr, &altScreen)
+			}
+
+			if got := scr.String(); got != tt.expected {
+				t.Errorf("Screen = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestHandleCSIInsertDeleteChars tests insert blank characters (@) and delete characters (P)
+func TestHandleCSIInsertDeleteChars(t *testing.T) {
+	tests := []struct {
+		name     string
+		seq      string
+		col      int
+		expected string
+	}{
+		{name: "Insert one blank", seq: "@", col: 2, expected: "he llo"},
+		{name: "Insert blanks", seq: "3@", col: 0, expected: "   hello"},
+		{name: "Insert at end of line", seq: "2@", col: 5, expected: "hello"},
+		{name: "Insert many blanks is capped", seq: "99999999@", col: 4, expected: "hell" + strings.Repeat(" ", maxScreenGrowth) + "o"},
+		{name: "Delete one character", seq: "P", col: 1, expected: "hllo"},
+		{name: "Delete characters", seq: "3P", col: 1, expected: "ho"},
+		{name: "Delete past end of line", seq: "9P", col: 3, expected: "hel"},
+		{name: "Delete at end of line", seq: "P", col: 5, expected: "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scr := &screen{lines: [][]byte{[]byte("hello")}, col: tt.col}
+			altScreen := false
+
+			handleCSI([]byte(tt.seq), scr, &altScreen)
+
+			if got := scr.String(); got != tt.expected {
+				t.Errorf("Screen = %q, want %q", got, tt.expected)
+			}
+			if scr.col != tt.col {
+				t.Errorf("Cursor = %d, want %d", scr.col, tt.col)
+			}
+		})
+	}
+}
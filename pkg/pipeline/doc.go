@@ -0,0 +1,29 @@
+// Package pipeline is the terminal-cleaning and record-building core of
+// script2json, for programs that embed it rather than running the binary.
+//
+// A LineEditor reconstructs each command's output from the terminal byte stream
+// that script -f writes, undoing the line editing, cursor movement and escape
+// sequences that a terminal would have rendered. A RecordCreator turns a command
+// and its cleaned output into a CommandRecord, the JSON record that script2json
+// writes. ScriptReader and CommandReader read the script and command FIFOs that
+// the shell hooks write to:
+//
+//	editor := pipeline.NewLineEditor(pipeline.EditorOptions{}, logger, func(output pipeline.Output) {
+//		outputs <- output
+//	})
+//	script, err := pipeline.NewScriptReader("/tmp/script.fifo", editor)
+//	...
+//	go script.Run()
+//
+// The script reader only feeds the editor between its Start and Stop, which the
+// program calls when the shell's hooks report that a command starts and returns.
+//
+// A Pipeline wires the two readers to a RecordCreator and runs until its context
+// is cancelled:
+//
+//	p := pipeline.New("/tmp/script.fifo", "/tmp/command.fifo")
+//	go p.Run(ctx)
+//	for record := range p.Records() {
+//		...
+//	}
+package pipeline
@@ -0,0 +1,288 @@
+package pipeline
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// DefaultTabWidth is the conventional terminal tab stop distance
+const DefaultTabWidth = 8
+
+// DEL (0x7F) modes of EditorOptions.DelMode
+const (
+	DelModeBackspace = "backspace"
+	DelModeDelete    = "delete"
+)
+
+// Alternate screen policies of EditorOptions.AltScreen
+const (
+	// AltScreenDiscard ignores what full-screen programs draw on the alternate screen
+	AltScreenDiscard = "discard"
+	// AltScreenKeep adds the last contents of the alternate screen to the output
+	// when the program leaves it
+	AltScreenKeep = "keep"
+)
+
+// editor reconstructs the output of commands from a terminal byte stream using an
+// EscapeParser and the screen model. It is the heuristic engine behind LineEditor.
+// An editor is not safe for concurrent use.
+type editor struct {
+	opts     EditorOptions
+	tabWidth int
+	scr      *screen
+	parser   *EscapeParser
+	links    []string
+	pasted   bool
+	bells    int
+	// inAlternateScreen is set while a full-screen program has the alternate screen
+	inAlternateScreen bool
+	// mainScreen holds the main screen while scr is the alternate screen, with
+	// AltScreenKeep
+	mainScreen *screen
+	// pendingCR is set after a carriage return until the next character, control or
+	// sequence shows whether it is part of a "\r\n" line ending or a bare return that
+	// redraws the line
+	pendingCR bool
+	// emit is called with the output of the current command when it ends
+	emit func(Output)
+}
+
+// newHeuristicEditor returns an editor with a blank screen that passes each
+// command's output to emit when it ends.
+func newHeuristicEditor(opts EditorOptions, logger *slog.Logger, emit func(Output)) *editor {
+	e := &editor{
+		opts:     opts,
+		tabWidth: opts.TabWidth,
+		scr:      newScreen(),
+		parser:   NewEscapeParser(logger),
+		emit:     emit,
+	}
+	if e.tabWidth <= 0 {
+		e.tabWidth = DefaultTabWidth
+	}
+	e.parser.Print = e.print
+	e.parser.Execute = e.execute
+	e.parser.EscDispatch = e.escDispatch
+	e.parser.CSIDispatch = e.csiDispatch
+	e.parser.OSCDispatch = e.oscDispatch
+	e.parser.SS3Dispatch = e.ss3Dispatch
+	return e
+}
+
+// write processes the next byte of the stream.
+func (e *editor) write(b byte) {
+	e.parser.Advance(b)
+}
+
+// finish returns the output of the current command and starts a new one with a
+// blank screen. Terminal modes such as the alternate screen carry over.
+func (e *editor) finish() Output {
+	scr := e.scr
+	if e.mainScreen != nil {
+		// The command ends on the alternate screen, whose contents so far are kept
+		scr = e.mainScreen
+		keepScreen(scr, e.scr)
+		e.mainScreen = newScreen()
+	}
+	output := Output{Text: scr.String(), Links: e.links, Pasted: e.pasted, Bells: e.bells}
+	if e.opts.KeepColors {
+		output.Styled = scr.styledString()
+	}
+	e.scr = newScreen()
+	e.links = nil
+	e.pasted = false
+	e.bells = 0
+	return output
+}
+
+// end ends the current command, passing its output to emit. Unlike the bytes of
+// the stream, it isn't ignored on the alternate screen, so every command has an
+// output.
+func (e *editor) end() {
+	e.parser.End()
+	e.returnCarriage()
+	if e.emit != nil {
+		e.emit(e.finish())
+	}
+}
+
+// ignoring reports whether output is being ignored because a full-screen program
+// has the alternate screen.
+func (e *editor) ignoring() bool {
+	return e.inAlternateScreen && e.opts.AltScreen != AltScreenKeep
+}
+
+// switchScreen enters or leaves the alternate screen with AltScreenKeep. The
+// alternate screen is a screen of its own, whose contents are added to the main
+// screen when the program leaves it.
+func (e *editor) switchScreen(on bool) {
+	if on == e.inAlternateScreen {
+		return
+	}
+	e.inAlternateScreen = on
+	if on {
+		e.mainScreen, e.scr = e.scr, newScreen()
+		return
+	}
+	alt := e.scr
+	e.scr, e.mainScreen = e.mainScreen, nil
+	keepScreen(e.scr, alt)
+}
+
+// keepScreen adds the lines of alt from the first to the last non-empty one to scr,
+// on lines of their own, starting at the cursor. Lines that alt ended with "\r\n"
+// keep that terminator.
+func keepScreen(scr, alt *screen) {
+	first, last := 0, len(alt.lines)
+	for first < last && len(stripSGR(alt.lines[first])) == 0 {
+		first++
+	}
+	for last > first && len(stripSGR(alt.lines[last-1])) == 0 {
+		last--
+	}
+	if first < last && scr.col > 0 {
+		scr.newline()
+	}
+	for i := first; i < last; i++ {
+		line := alt.lines[i]
+		for len(line) > 0 {
+			n, sgr := nextChar(line)
+			if sgr {
+				scr.insertSGR(line[2:n])
+			} else {
+				scr.insertChar(line[:n])
+			}
+			line = line[n:]
+		}
+		if i < len(alt.crlf) && alt.crlf[i] {
+			scr.crlfNewline()
+		} else {
+			scr.newline()
+		}
+	}
+}
+
+// returnCarriage performs a pending bare carriage return.
+func (e *editor) returnCarriage() {
+	if e.pendingCR {
+		e.pendingCR = false
+		e.scr.carriageReturn()
+	}
+}
+
+// print inserts a printable character at the cursor. Like the other handlers, it
+// ignores the alternate screen, where only CSI sequences are processed since they
+// include the sequence that leaves it.
+func (e *editor) print(char []byte) {
+	if e.ignoring() {
+		return
+	}
+	e.returnCarriage()
+	e.scr.insertChar(char)
+}
+
+// execute performs a control character.
+func (e *editor) execute(b byte) {
+	if e.ignoring() {
+		return
+	}
+	if e.pendingCR && b == '\n' {
+		e.pendingCR = false
+		e.scr.crlfNewline()
+		return
+	}
+	e.returnCarriage()
+
+	switch b {
+	case BACKSPACE:
+		e.scr.backspace()
+	case DEL:
+		if e.opts.DelMode == DelModeDelete {
+			e.scr.deleteChars(1)
+		} else {
+			e.scr.backspace()
+		}
+	case KILL_LINE:
+		e.scr.killLineBackward()
+	case KILL_WORD:
+		e.scr.killWord()
+	case '\n', VT:
+		e.scr.newline()
+	case '\r':
+		e.pendingCR = true
+	case TAB:
+		e.scr.tab(e.tabWidth)
+	case BEL:
+		e.bells++
+	case FF, SO, SI:
+		// Page breaks and character set shifts have no effect on the line model.
+		// VT is Ctrl-K too, but readline echoes that as CSI K rather than the byte.
+	}
+}
+
+// escDispatch performs a complete escape sequence.
+func (e *editor) escDispatch(intermediates []byte, final byte) {
+	e.returnCarriage()
+	// Escapes with intermediates, such as ESC ( B for charset selection, have no
+	// effect on the text, and cursor movement in the alternate screen must not
+	// disturb the main screen
+	if len(intermediates) > 0 || e.ignoring() {
+		return
+	}
+	switch final {
+	case DECSC:
+		e.scr.saveCursor()
+	case DECRC:
+		e.scr.restoreCursor()
+	case IND:
+		e.scr.index()
+	case RI:
+		e.scr.reverseIndex()
+	}
+}
+
+// csiDispatch performs a complete CSI sequence.
+func (e *editor) csiDispatch(seq []byte) {
+	e.returnCarriage()
+	if e.opts.AltScreen == AltScreenKeep {
+		if on, ok := altScreenSwitch(seq); ok {
+			e.switchScreen(on)
+			return
+		}
+		// Sequences apply to whichever screen is current
+		drawing := false
+		handleCSI(seq, e.scr, &drawing)
+	} else {
+		handleCSI(seq, e.scr, &e.inAlternateScreen)
+	}
+	if seq[len(seq)-1] == SGR && e.opts.KeepColors && !e.ignoring() {
+		e.scr.insertSGR(seq)
+	}
+	// Paste markers are dropped like any other CSI sequence, but the paste is noted
+	if string(seq) == PASTE_START && !e.ignoring() {
+		e.pasted = true
+	}
+}
+
+// oscDispatch handles a complete OSC string. Window titles and other OSC payloads
+// are discarded; OSC 8 hyperlink targets are collected into links.
+func (e *editor) oscDispatch(payload []byte) {
+	e.returnCarriage()
+	if link := oscHyperlink(payload); link != "" && !e.ignoring() && !slices.Contains(e.links, link) {
+		e.links = append(e.links, link)
+	}
+}
+
+// ss3Dispatch handles the Home and End keys in their ESC O forms.
+func (e *editor) ss3Dispatch(key byte) {
+	e.returnCarriage()
+	if e.ignoring() {
+		return
+	}
+	switch key {
+	case CURSOR_POSITION:
+		e.scr.lineHome()
+	case CURSOR_END:
+		e.scr.lineEnd()
+	}
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Encodings reported in the CommandRecord Encoding field
+const (
+	encodingUTF8     = "utf-8"
+	encodingISO88591 = "iso-8859-1"
+)
+
+// normalizeEncoding detects the character encoding of raw command output and returns
+// it transcoded to UTF-8 along with the name of the detected encoding.
+// Output that is valid UTF-8 (including plain ASCII) is returned unchanged. Anything
+// else is assumed to come from a legacy tool writing ISO-8859-1, in which every byte
+// maps directly to the Unicode code point of the same value.
+// Empty output has no encoding.
+func normalizeEncoding(output string) (string, string) {
+	if output == "" {
+		return output, ""
+	}
+	if utf8.ValidString(output) {
+		return output, encodingUTF8
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(output) * 2)
+	for i := 0; i < len(output); i++ {
+		sb.WriteRune(rune(output[i]))
+	}
+	return sb.String(), encodingISO88591
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import "testing"
+
+// TestNormalizeEncoding tests output encoding detection and transcoding
+func TestNormalizeEncoding(t *testing.T) {
+	tests := []struct {
+		name             string
+		output           string
+		expectedOutput   string
+		expectedEncoding string
+	}{
+		{
+			name:             "Empty output",
+			output:           "",
+			expectedOutput:   "",
+			expectedEncoding: "",
+		},
+		{
+			name:             "ASCII is UTF-8",
+			output:           "hello\r\n",
+			expectedOutput:   "hello\r\n",
+			expectedEncoding: "utf-8",
+		},
+		{
+			name:             "Valid UTF-8 is unchanged",
+			output:           "caf\xc3\xa9 \xe2\x9c\x93",
+			expectedOutput:   "café ✓",
+			expectedEncoding: "utf-8",
+		},
+		{
+			name:             "ISO-8859-1 is transcoded",
+			output:           "caf\xe9 na\xefve \xa9",
+			expectedOutput:   "café naïve ©",
+			expectedEncoding: "iso-8859-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, encoding := normalizeEncoding(tt.output)
+			if output != tt.expectedOutput {
+				t.Errorf("Output = %q, want %q", output, tt.expectedOutput)
+			}
+			if encoding != tt.expectedEncoding {
+				t.Errorf("Encoding = %q, want %q", encoding, tt.expectedEncoding)
+			}
+		})
+	}
+}
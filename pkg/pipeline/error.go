@@ -0,0 +1,50 @@
+package pipeline
+
+// The stages of a pipeline where an Error can happen.
+const (
+	// StageScript is reading the terminal byte stream, from the script FIFO or a reader
+	StageScript = "script"
+	// StageCommand is reading the command FIFO
+	StageCommand = "command"
+	// StageDecode is decoding a command from a shell integration marker
+	StageDecode = "decode"
+	// StageRecord is turning a record into its output format, such as JSON
+	StageRecord = "record"
+	// StageSink is delivering a record to its sink
+	StageSink = "sink"
+)
+
+// Error is an error that a pipeline ran into while running, reported to the
+// WithOnError hook. Stage tells where it happened, so that a caller can tell a
+// failing FIFO from a failing sink.
+type Error struct {
+	Stage string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithOnError sets the hook that the pipeline reports the errors it runs into to,
+// each as an *Error. Without one, it logs them. The hook runs on the goroutine
+// that ran into the error, which waits for it to return.
+func WithOnError(fn func(err error)) Option {
+	return func(p *Pipeline) { p.onError = fn }
+}
+
+// report hands err, which happened at stage, to the pipeline's OnError hook, or
+// logs it, and returns it as an *Error.
+func (p *Pipeline) report(stage string, err error) error {
+	err = &Error{Stage: stage, Err: err}
+	if p.onError != nil {
+		p.onError(err)
+	} else {
+		p.logger.Error("Pipeline error", "error", err)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestProcessOnError tests that Process reports read and decode errors to the hook
+func TestProcessOnError(t *testing.T) {
+	readErr := errors.New("device gone")
+	input := io.MultiReader(
+		strings.NewReader("\x1b]6973;start\x07out\x1b]6973;end;!!!\x07"),
+		iotest.ErrReader(readErr))
+	var reported []error
+	records, err := Process(context.Background(), input,
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithOnError(func(err error) { reported = append(reported, err) }))
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	for range records {
+	}
+
+	var stages []string
+	for _, err := range reported {
+		var pipelineErr *Error
+		if !errors.As(err, &pipelineErr) {
+			t.Fatalf("Reported %v, want an *Error", err)
+		}
+		stages = append(stages, pipelineErr.Stage)
+	}
+	if len(stages) != 2 || stages[0] != StageDecode || stages[1] != StageScript {
+		t.Fatalf("Reported stages %v, want decode then script", stages)
+	}
+	if !errors.Is(reported[1], readErr) {
+		t.Errorf("Reported %v, want it to wrap the read error", reported[1])
+	}
+}
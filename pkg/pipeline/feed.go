@@ -0,0 +1,41 @@
+package pipeline
+
+// CommandMeta is a command fed to a Pipeline with FeedCommand: its command line
+// and, when the embedder knows them, its exit code and working directory, which
+// go into the ExitCode and Cwd of its record, and the effective user ID it ran
+// as, 0 of which marks the record Privileged.
+type CommandMeta struct {
+	Command  string
+	ExitCode *int
+	Cwd      string
+	EUID     *int
+}
+
+// FeedOutput feeds b to the pipeline as terminal output, as if it had been read from
+// the script FIFO, for programs that have the terminal byte stream in hand, such as
+// terminal multiplexers. Like the FIFO's bytes, b only becomes output between
+// Start and Stop. It has no effect before or after Run. FeedOutput, Start and Stop
+// are safe to call from different goroutines, which take turns.
+func (p *Pipeline) FeedOutput(b []byte) {
+	if script := p.scriptReader(); script != nil {
+		script.write(b)
+	}
+}
+
+// FeedCommand queues cmd as the command of the next output that the pipeline
+// records, as a line of the command FIFO would, for programs that learn of commands
+// from their own shell integration. As with the FIFO, the command must be fed
+// before Stop ends its output, or it pairs with the next one. Commands fed before
+// Run are kept for it. FeedCommand waits while the queue is full, and has no
+// effect once Run has returned.
+func (p *Pipeline) FeedCommand(cmd CommandMeta) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	select {
+	case p.commands <- cmd:
+	case <-p.done:
+	}
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// TestFeed tests recording a pipeline fed in-process, without FIFOs
+func TestFeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hooks := &Hooks{}
+	started := make(chan struct{}, 1)
+	hooks.OnSessionStart(func(string) { started <- struct{}{} })
+	p := New("", "", WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithHooks(hooks))
+
+	exitCode, euid := 1, 0
+	p.FeedCommand(CommandMeta{Command: "make", ExitCode: &exitCode, Cwd: "/src", EUID: &euid})
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the session to start")
+	}
+
+	p.FeedOutput([]byte("prompt$ "))
+	p.Start()
+	p.FeedOutput([]byte("buidl"))
+	p.FeedOutput([]byte("\b\b\bild failed"))
+	p.Stop()
+	p.FeedOutput([]byte("prompt$ "))
+	select {
+	case record := <-p.Records():
+		if record.Command != "make" || record.Output != "build failed" || record.ExitCode == nil || *record.ExitCode != 1 || record.Cwd != "/src" || !record.Privileged {
+			t.Errorf("Record = %+v, want make with its output, exit code and cwd, privileged by its EUID", record)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for record")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	// Once Run has returned, feeding has no effect and doesn't block
+	for range channelBuffer + 1 {
+		p.FeedCommand(CommandMeta{Command: "late"})
+	}
+	p.Start()
+	p.FeedOutput([]byte("late"))
+	p.Stop()
+}
@@ -0,0 +1,248 @@
+package pipeline
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// ErrFifoClosed is returned by FifoReader.Open once the reader is closed.
+var ErrFifoClosed = errors.New("FIFO reader closed")
+
+// FifoReader reads a FIFO that writers open and close in turn, such as the one
+// that script -f writes to, which each session of script reopens.
+type FifoReader struct {
+	path   string
+	closed atomic.Bool
+}
+
+// NewFifoReader returns a reader of the FIFO at path.
+func NewFifoReader(path string) *FifoReader {
+	return &FifoReader{path: path}
+}
+
+// Path returns the path of the FIFO.
+func (r *FifoReader) Path() string {
+	return r.path
+}
+
+// Open opens the FIFO for reading, waiting for the next writer.
+func (r *FifoReader) Open() (*os.File, error) {
+	if r.closed.Load() {
+		return nil, ErrFifoClosed
+	}
+	f, err := OpenFifo(r.path)
+	if err != nil {
+		// Closing may have raced with removing the FIFO
+		if r.closed.Load() {
+			return nil, ErrFifoClosed
+		}
+		return nil, err
+	}
+	if r.closed.Load() {
+		f.Close()
+		return nil, ErrFifoClosed
+	}
+	return f, nil
+}
+
+// Close makes Open fail with ErrFifoClosed, waking a waiting Open by opening the
+// FIFO for writing without blocking; that fails harmlessly if no Open is waiting.
+func (r *FifoReader) Close() error {
+	if r.closed.Swap(true) {
+		return nil
+	}
+	if f, err := os.OpenFile(r.path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+		f.Close()
+	}
+	return nil
+}
+
+// openFile is the FIFO that a ScriptReader or CommandReader is reading, which Close
+// closes to interrupt a read that waits on a writer.
+type openFile struct {
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+}
+
+// set records f as the open FIFO, or closes it and returns false after close.
+func (o *openFile) set(f *os.File) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		f.Close()
+		return false
+	}
+	o.f = f
+	return true
+}
+
+// close closes the open FIFO, if any, and every FIFO set later.
+func (o *openFile) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	if o.f != nil {
+		o.f.Close()
+	}
+}
+
+// ScriptReader feeds the terminal byte stream of a script FIFO to a LineEditor.
+// Bytes only reach the editor between Start and Stop, which a shell's prompt hooks
+// call around each command; Stop ends the command, so the editor emits its output.
+type ScriptReader struct {
+	fifo *FifoReader
+	file openFile
+	// mu orders the bytes written to the editor with the end of Stop
+	mu     sync.Mutex
+	editor *LineEditor
+	state  SessionMachine
+	// opened is called, if set, whenever a writer opens the FIFO
+	opened func()
+}
+
+// NewScriptReader returns a reader of the script FIFO at path, creating the FIFO if
+// nothing exists there yet, that writes to editor.
+func NewScriptReader(path string, editor *LineEditor) (*ScriptReader, error) {
+	if _, err := CreateFifo(path); err != nil {
+		return nil, err
+	}
+	return &ScriptReader{fifo: NewFifoReader(path), editor: editor}, nil
+}
+
+// Run reads the FIFO, one writer after another, until Close.
+func (r *ScriptReader) Run() error {
+	buf := make([]byte, 4096)
+	for {
+		f, err := r.fifo.Open()
+		if errors.Is(err, ErrFifoClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !r.file.set(f) {
+			return nil
+		}
+		if r.opened != nil {
+			r.opened()
+		}
+		for {
+			n, err := f.Read(buf)
+			r.write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		f.Close()
+	}
+}
+
+// write feeds p to the editor if a command was started.
+func (r *ScriptReader) write(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state.State() == StateRecording {
+		r.editor.Write(p)
+	}
+}
+
+// Start starts a command: the bytes read from now on are its output.
+func (r *ScriptReader) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.Start()
+}
+
+// Stop ends the current command, if one was started, so the editor emits its output.
+func (r *ScriptReader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state.Stop() {
+		r.editor.End()
+		r.state.Flushed()
+	}
+}
+
+// Reset ends the current command without output and resets the editor, to recover
+// from a byte stream that went out of sync.
+func (r *ScriptReader) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.Reset()
+	r.editor.Reset()
+}
+
+// State returns where the reader is in recording a command. It is Flushing while
+// Stop waits for the editor's emit to take the output.
+func (r *ScriptReader) State() SessionState {
+	return r.state.State()
+}
+
+// Close makes Run return, interrupting the current writer.
+func (r *ScriptReader) Close() error {
+	r.file.close()
+	return r.fifo.Close()
+}
+
+// CommandReader reads the commands that a shell's hooks write to a command FIFO,
+// one per line, and passes each to a handler.
+type CommandReader struct {
+	fifo   *FifoReader
+	file   openFile
+	handle func(command string)
+}
+
+// NewCommandReader returns a reader of the command FIFO at path, creating the FIFO
+// if nothing exists there yet, that passes each command to handle.
+func NewCommandReader(path string, handle func(command string)) (*CommandReader, error) {
+	if _, err := CreateFifo(path); err != nil {
+		return nil, err
+	}
+	return &CommandReader{fifo: NewFifoReader(path), handle: handle}, nil
+}
+
+// Run reads the FIFO, one writer after another, until Close.
+func (r *CommandReader) Run() error {
+	for {
+		f, err := r.fifo.Open()
+		if errors.Is(err, ErrFifoClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !r.file.set(f) {
+			return nil
+		}
+		err = readCommands(f, r.handle)
+		f.Close()
+		if errors.Is(err, os.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readCommands passes each line of rd to handle.
+func readCommands(rd io.Reader, handle func(string)) error {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		handle(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Close makes Run return, interrupting the current writer.
+func (r *CommandReader) Close() error {
+	r.file.close()
+	return r.fifo.Close()
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package pipeline
+
+import (
+	"os"
+	"syscall"
+)
+
+// CreateFifo creates a FIFO at path if nothing exists there yet, and reports
+// whether it did.
+func CreateFifo(path string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := syscall.Mkfifo(path, 0666); err != nil {
+			return false, err
+		}
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// OpenFifo opens the FIFO at path for reading, waiting until a writer opens it. If
+// the FIFO was replaced while it waited, the new FIFO at path is opened instead.
+func OpenFifo(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDONLY, 0666)
+		if err != nil {
+			return nil, err
+		}
+		opened, err := f.Stat()
+		if err != nil {
+			return f, nil
+		}
+		if current, err := os.Stat(path); err == nil && !os.SameFile(opened, current) {
+			f.Close()
+			continue
+		}
+		return f, nil
+	}
+}
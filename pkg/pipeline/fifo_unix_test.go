@@ -0,0 +1,93 @@
+//go:build !windows
+
+package pipeline
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFifo opens the FIFO at path as a writer, writes data and closes it.
+func writeFifo(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestScriptReader tests that only the bytes written between Start and Stop reach
+// the editor, across writers, and that Close ends Run
+func TestScriptReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.fifo")
+	outputs := make(chan Output, 1)
+	editor := NewLineEditor(EditorOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)), func(output Output) {
+		outputs <- output
+	})
+	reader, err := NewScriptReader(path, editor)
+	if err != nil {
+		t.Fatalf("NewScriptReader failed: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- reader.Run() }()
+
+	// Writes return before the reader has read them, hence the sleeps
+	writeFifo(t, path, "prompt$ ")
+	time.Sleep(50 * time.Millisecond)
+	reader.Start()
+	writeFifo(t, path, "out")
+	writeFifo(t, path, "put")
+	time.Sleep(50 * time.Millisecond)
+	reader.Stop()
+	select {
+	case output := <-outputs:
+		if output.Text != "output" {
+			t.Errorf("Output = %q, want output", output.Text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+
+	reader.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Close")
+	}
+}
+
+// TestCommandReader tests that each line written to the command FIFO is a command
+func TestCommandReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "command.fifo")
+	commands := make(chan string, 3)
+	reader, err := NewCommandReader(path, func(command string) { commands <- command })
+	if err != nil {
+		t.Fatalf("NewCommandReader failed: %v", err)
+	}
+	go reader.Run()
+	defer reader.Close()
+
+	writeFifo(t, path, "ls -l\n")
+	writeFifo(t, path, "cd /tmp\necho hi\n")
+	for _, want := range []string{"ls -l", "cd /tmp", "echo hi"} {
+		select {
+		case command := <-commands:
+			if command != want {
+				t.Errorf("Command = %q, want %q", command, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %q", want)
+		}
+	}
+}
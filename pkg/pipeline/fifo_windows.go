@@ -0,0 +1,52 @@
+//go:build windows
+
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe = kernel32.NewProc("ConnectNamedPipe")
+)
+
+// Flags and errors of CreateNamedPipeW and ConnectNamedPipe.
+const (
+	pipeAccessInbound      = 0x00000001
+	pipeTypeByte           = 0x00000000
+	pipeUnlimitedInstances = 255
+	errorPipeConnected     = syscall.Errno(535)
+)
+
+// CreateFifo does nothing on Windows: a named pipe only exists while its reader has
+// it open, so OpenFifo creates it.
+func CreateFifo(path string) (bool, error) {
+	return false, nil
+}
+
+// OpenFifo creates an instance of the named pipe at path, such as
+// \\.\pipe\script2json, and waits until a writer connects to it. Reads return
+// io.EOF once the writer disconnects, as they do for a FIFO. The pipe gets the
+// default security descriptor, which lets processes of the same user write to it.
+func OpenFifo(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, _, callErr := procCreateNamedPipeW.Call(uintptr(unsafe.Pointer(name)), pipeAccessInbound,
+		pipeTypeByte, pipeUnlimitedInstances, 4096, 4096, 0, 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		return nil, fmt.Errorf("could not create named pipe %s: %w", path, callErr)
+	}
+	// A writer that connected between the two calls is reported as an error
+	if ok, _, callErr := procConnectNamedPipe.Call(h, 0); ok == 0 && callErr != errorPipeConnected {
+		syscall.CloseHandle(syscall.Handle(h))
+		return nil, fmt.Errorf("could not wait for a writer on named pipe %s: %w", path, callErr)
+	}
+	return os.NewFile(h, path), nil
+}
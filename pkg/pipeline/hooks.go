@@ -0,0 +1,105 @@
+package pipeline
+
+import "sync"
+
+// The reasons that OnDrop hooks are given for a dropped record.
+const (
+	// DropFiltered is a record that a RecordProcessor dropped
+	DropFiltered = "filtered"
+)
+
+// Hooks are the functions that observe a pipeline's lifecycle, registered with
+// OnRecord, OnSessionStart, OnReset and OnDrop and called in the order they were
+// registered. A pipeline calls them on its own goroutines and waits for them to
+// return, so they must not block. Registering is safe while the pipeline runs. The
+// zero value has no hooks, and so has a nil *Hooks.
+type Hooks struct {
+	mu           sync.RWMutex
+	record       []func(CommandRecord)
+	sessionStart []func(session string)
+	reset        []func(session string)
+	drop         []func(record CommandRecord, reason string)
+}
+
+// WithHooks sets the hooks that the pipeline calls. Several pipelines can share them.
+func WithHooks(hooks *Hooks) Option {
+	return func(p *Pipeline) { p.hooks = hooks }
+}
+
+// Hooks returns the hooks that the pipeline calls, or nil if it has none.
+func (p *Pipeline) Hooks() *Hooks {
+	return p.hooks
+}
+
+// OnRecord registers fn to be called with each record, after the processors, as it
+// is sent on.
+func (h *Hooks) OnRecord(fn func(record CommandRecord)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.record = append(h.record, fn)
+}
+
+// OnSessionStart registers fn to be called when a session starts: a Pipeline's
+// when a writer, such as a new run of script, opens the script FIFO, or when Run
+// starts if it is fed with FeedOutput instead, and Process's when it starts
+// reading. Pipelines start unnamed sessions; the command names its own.
+func (h *Hooks) OnSessionStart(fn func(session string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sessionStart = append(h.sessionStart, fn)
+}
+
+// OnReset registers fn to be called when a session's state is reset to recover
+// from a desync, such as by Pipeline.Reset.
+func (h *Hooks) OnReset(fn func(session string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reset = append(h.reset, fn)
+}
+
+// OnDrop registers fn to be called with each record that is dropped instead of
+// sent on, and the reason, such as DropFiltered.
+func (h *Hooks) OnDrop(fn func(record CommandRecord, reason string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop = append(h.drop, fn)
+}
+
+// FireRecord calls the OnRecord hooks with record.
+func (h *Hooks) FireRecord(record CommandRecord) {
+	for _, fn := range registered(h, func(h *Hooks) []func(CommandRecord) { return h.record }) {
+		fn(record)
+	}
+}
+
+// FireSessionStart calls the OnSessionStart hooks with session.
+func (h *Hooks) FireSessionStart(session string) {
+	for _, fn := range registered(h, func(h *Hooks) []func(string) { return h.sessionStart }) {
+		fn(session)
+	}
+}
+
+// FireReset calls the OnReset hooks with session.
+func (h *Hooks) FireReset(session string) {
+	for _, fn := range registered(h, func(h *Hooks) []func(string) { return h.reset }) {
+		fn(session)
+	}
+}
+
+// FireDrop calls the OnDrop hooks with record and reason.
+func (h *Hooks) FireDrop(record CommandRecord, reason string) {
+	for _, fn := range registered(h, func(h *Hooks) []func(CommandRecord, string) { return h.drop }) {
+		fn(record, reason)
+	}
+}
+
+// registered returns the hooks that list picks from h, or none if h is nil. Hooks
+// are only ever appended, so the slice stays valid while they run.
+func registered[F any](h *Hooks, list func(*Hooks) []F) []F {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return list(h)
+}
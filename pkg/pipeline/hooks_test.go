@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestHooks tests that hooks run in the order they were registered, and that a nil
+// *Hooks has none
+func TestHooks(t *testing.T) {
+	var calls []string
+	hooks := &Hooks{}
+	hooks.OnRecord(func(record CommandRecord) { calls = append(calls, "record1 "+record.Command) })
+	hooks.OnRecord(func(record CommandRecord) { calls = append(calls, "record2 "+record.Command) })
+	hooks.OnSessionStart(func(session string) { calls = append(calls, "start "+session) })
+	hooks.OnReset(func(session string) { calls = append(calls, "reset "+session) })
+	hooks.OnDrop(func(record CommandRecord, reason string) { calls = append(calls, "drop "+record.Command+" "+reason) })
+
+	hooks.FireSessionStart("web")
+	hooks.FireRecord(CommandRecord{Command: "ls"})
+	hooks.FireDrop(CommandRecord{Command: "pwd"}, DropFiltered)
+	hooks.FireReset("web")
+	want := []string{"start web", "record1 ls", "record2 ls", "drop pwd filtered", "reset web"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("Calls = %q, want %q", calls, want)
+	}
+
+	var none *Hooks
+	none.FireRecord(CommandRecord{})
+	none.FireSessionStart("")
+	none.FireReset("")
+	none.FireDrop(CommandRecord{}, DropFiltered)
+}
+
+// TestProcessHooks tests that Process calls the hooks for its session, its records
+// and the records its processors drop
+func TestProcessHooks(t *testing.T) {
+	var starts int
+	var recorded, dropped []string
+	hooks := &Hooks{}
+	hooks.OnSessionStart(func(string) { starts++ })
+	hooks.OnRecord(func(record CommandRecord) { recorded = append(recorded, record.Output) })
+	hooks.OnDrop(func(record CommandRecord, reason string) { dropped = append(dropped, record.Output+" "+reason) })
+
+	input := "\x1b]6973;start\x07keep\x1b]6973;end\x07\x1b]6973;start\x07skip\x1b]6973;end\x07"
+	records, err := Process(context.Background(), strings.NewReader(input),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithProcessors(ProcessorFunc(func(record CommandRecord) (CommandRecord, bool) {
+			return record, record.Output != "skip"
+		}), Redact(regexp.MustCompile(`e`))),
+		WithHooks(hooks))
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	for range records {
+	}
+	if starts != 1 {
+		t.Errorf("Session starts = %d, want 1", starts)
+	}
+	if !slices.Equal(recorded, []string{"k[REDACTED][REDACTED]p"}) {
+		t.Errorf("Recorded = %q, want the processed keep", recorded)
+	}
+	if !slices.Equal(dropped, []string{"skip filtered"}) {
+		t.Errorf("Dropped = %q, want skip, filtered", dropped)
+	}
+}
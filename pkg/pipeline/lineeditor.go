@@ -0,0 +1,239 @@
+package pipeline
+
+import (
+	"cmp"
+	"log/slog"
+)
+
+// EditorOptions controls how a LineEditor reconstructs output.
+type EditorOptions struct {
+	// TabWidth is the distance between tab stops (DefaultTabWidth if 0)
+	TabWidth int
+	// KeepColors keeps SGR color sequences in a styled copy of the output
+	KeepColors bool
+	// DelMode selects whether DEL erases backwards like backspace or forwards like CSI 3~
+	DelMode string
+	// TermEmulation selects the heuristic screen model or the full terminal emulator
+	TermEmulation string
+	// TermCols and TermRows are the size of the full terminal emulator
+	// (DefaultTermCols and DefaultTermRows if 0)
+	TermCols, TermRows int
+	// AltScreen selects whether full-screen programs' alternate screen is discarded
+	// or kept in the output (AltScreenDiscard if empty)
+	AltScreen string
+	// Newline selects how line endings in the output are normalized (lf, crlf, raw);
+	// empty leaves them alone, like raw
+	Newline string
+}
+
+// EditorOption sets one of the EditorOptions of a LineEditor made by NewEditor.
+type EditorOption func(*EditorOptions)
+
+// WithAltScreen sets the alternate screen policy (AltScreenDiscard, AltScreenKeep).
+func WithAltScreen(policy string) EditorOption {
+	return func(o *EditorOptions) { o.AltScreen = policy }
+}
+
+// WithColors keeps SGR color sequences in the Styled copy of the output.
+func WithColors(keep bool) EditorOption {
+	return func(o *EditorOptions) { o.KeepColors = keep }
+}
+
+// WithNewline sets how line endings in the output are normalized (NewlineLF,
+// NewlineCRLF, NewlineRaw).
+func WithNewline(mode string) EditorOption {
+	return func(o *EditorOptions) { o.Newline = mode }
+}
+
+// WithTabWidth sets the distance between tab stops.
+func WithTabWidth(width int) EditorOption {
+	return func(o *EditorOptions) { o.TabWidth = width }
+}
+
+// WithDelMode sets how DEL edits the line (DelModeBackspace, DelModeDelete).
+func WithDelMode(mode string) EditorOption {
+	return func(o *EditorOptions) { o.DelMode = mode }
+}
+
+// WithTermEmulation selects the full terminal emulator of the given size, or the
+// heuristic screen model, by mode (TermEmulationFull, TermEmulationHeuristic).
+func WithTermEmulation(mode string, cols, rows int) EditorOption {
+	return func(o *EditorOptions) { o.TermEmulation, o.TermCols, o.TermRows = mode, cols, rows }
+}
+
+// Output is the cleaned output of a single command.
+type Output struct {
+	Text            string
+	Styled          string // text with SGR color sequences kept (only set with KeepColors)
+	ProgressSamples []ProgressSample
+	Links           []string
+	Pasted          bool // the output contained a bracketed paste
+	Bells           int  // number of BEL characters outside of OSC strings
+}
+
+// EditorState is a snapshot of the reconstruction state of a LineEditor, for
+// diagnostics. Overwrite and ScrollRegion are only tracked by the heuristic model.
+type EditorState struct {
+	Buffer               string
+	CursorRow, CursorCol int
+	Overwrite            bool
+	// ScrollRegion is the 1-based top and bottom line of the scrolling region, if set
+	ScrollRegion    []int
+	AlternateScreen bool
+	PendingCR       bool
+	ParserState     string
+	PendingSequence string
+}
+
+// LineEditor reconstructs the output of commands from a terminal byte stream, such
+// as the one that script -f writes, with the heuristic screen model or the full
+// terminal emulator. End ends the current command; the bytes of the stream, EOF
+// (0x04) included, never do. A LineEditor is not safe for concurrent use.
+type LineEditor struct {
+	opts   EditorOptions
+	logger *slog.Logger
+	ed     *editor
+	// term replaces ed with full terminal emulation
+	term *terminal
+	emit func(Output)
+}
+
+// NewLineEditor returns a LineEditor with a blank screen that passes each command's
+// output to emit when End ends it. With a nil emit, outputs are only returned by
+// Finish.
+func NewLineEditor(opts EditorOptions, logger *slog.Logger, emit func(Output)) *LineEditor {
+	e := &LineEditor{opts: opts, logger: logger, emit: emit}
+	e.Reset()
+	return e
+}
+
+// NewEditor returns a LineEditor with the given options that logs to slog.Default(),
+// for use through Write and Flush, which returns all the output written since the
+// last Flush.
+func NewEditor(opts ...EditorOption) *LineEditor {
+	var o EditorOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return NewLineEditor(o, slog.Default(), nil)
+}
+
+// Reset discards the current command's output and all terminal modes, leaving a
+// blank screen, to recover from a byte stream that went out of sync.
+func (e *LineEditor) Reset() {
+	var emit func(Output)
+	if e.emit != nil {
+		emit = func(output Output) { e.emit(e.normalize(output)) }
+	}
+	e.ed = newHeuristicEditor(e.opts, e.logger, emit)
+	e.term = e.newTerminal()
+}
+
+// normalize applies the Newline option to output.
+func (e *LineEditor) normalize(output Output) Output {
+	output.Text = NormalizeNewlines(output.Text, e.opts.Newline)
+	output.Styled = NormalizeNewlines(output.Styled, e.opts.Newline)
+	return output
+}
+
+// newTerminal returns a blank terminal for full terminal emulation, or nil.
+func (e *LineEditor) newTerminal() *terminal {
+	if e.opts.TermEmulation != TermEmulationFull {
+		return nil
+	}
+	t := newTerminal(cmp.Or(e.opts.TermCols, DefaultTermCols), cmp.Or(e.opts.TermRows, DefaultTermRows), e.ed.tabWidth, e.logger)
+	t.keepAlt = e.opts.AltScreen == AltScreenKeep
+	return t
+}
+
+// WriteByte processes the next byte of the stream. It never fails; it returns an
+// error to implement io.ByteWriter.
+func (e *LineEditor) WriteByte(b byte) error {
+	if e.term == nil {
+		e.ed.write(b)
+		return nil
+	}
+	e.term.write(b)
+	return nil
+}
+
+// End ends the current command and passes its output to emit. A character or
+// escape sequence that the command's output left incomplete doesn't carry over
+// into the next command's.
+func (e *LineEditor) End() {
+	if e.term == nil {
+		e.ed.end()
+		return
+	}
+	e.term.end()
+	output := e.Finish()
+	if e.emit != nil {
+		e.emit(output)
+	}
+}
+
+// Write processes the bytes of p as WriteByte does. It implements io.Writer and
+// never fails.
+func (e *LineEditor) Write(p []byte) (int, error) {
+	for _, b := range p {
+		e.WriteByte(b)
+	}
+	return len(p), nil
+}
+
+// Flush returns the text of the current command's output and starts a new one, as
+// Finish does.
+func (e *LineEditor) Flush() string {
+	return e.Finish().Text
+}
+
+// Finish returns the output of the current command and starts a new one with a
+// blank screen. The heuristic model carries terminal modes such as the alternate
+// screen over; the full emulator starts afresh.
+func (e *LineEditor) Finish() Output {
+	if e.term == nil {
+		return e.normalize(e.ed.finish())
+	}
+	output := Output{Text: e.term.String(), Links: e.term.links, Pasted: e.term.pasted, Bells: e.term.bells}
+	e.term = e.newTerminal()
+	return e.normalize(output)
+}
+
+// ProgressLine returns the line that the current command is drawing, such as a
+// progress bar, or "" if there is none.
+func (e *LineEditor) ProgressLine() string {
+	if e.term != nil {
+		return e.term.progressLine()
+	}
+	return e.ed.scr.progressLine()
+}
+
+// State returns a snapshot of the reconstruction state.
+func (e *LineEditor) State() EditorState {
+	if e.term != nil {
+		state := EditorState{
+			Buffer:          e.term.String(),
+			CursorRow:       e.term.row,
+			CursorCol:       e.term.col,
+			AlternateScreen: e.term.inAlt,
+			ParserState:     e.term.parser.state.String(),
+			PendingSequence: string(e.term.parser.pending()),
+		}
+		return state
+	}
+	scr := e.ed.scr
+	state := EditorState{
+		Buffer:          scr.String(),
+		CursorRow:       scr.row,
+		CursorCol:       scr.col,
+		Overwrite:       scr.overwrite,
+		AlternateScreen: e.ed.inAlternateScreen,
+		PendingCR:       e.ed.pendingCR,
+		ParserState:     e.ed.parser.state.String(),
+		PendingSequence: string(e.ed.parser.pending()),
+	}
+	if scr.region {
+		state.ScrollRegion = []int{scr.scrollTop + 1, scr.scrollBottom + 1}
+	}
+	return state
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// TestLineEditor tests that both engines emit each command's output at End, but
+// not at an EOF byte, and that Finish returns the output so far
+func TestLineEditor(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, emulation := range []string{TermEmulationHeuristic, TermEmulationFull} {
+		t.Run(emulation, func(t *testing.T) {
+			var outputs []Output
+			editor := NewLineEditor(EditorOptions{TermEmulation: emulation}, logger, func(output Output) {
+				outputs = append(outputs, output)
+			})
+			for _, b := range []byte("helo\bl\x07\x04o") {
+				editor.WriteByte(b)
+			}
+			if len(outputs) != 0 {
+				t.Fatalf("Outputs = %+v before End, want none", outputs)
+			}
+			editor.End()
+			editor.Write([]byte("second\x1b[1"))
+			if len(outputs) != 1 || outputs[0].Text != "hello" || outputs[0].Bells != 1 {
+				t.Fatalf("Outputs = %+v, want one with hello and a bell", outputs)
+			}
+
+			state := editor.State()
+			if state.Buffer != "second" || state.CursorCol != 6 || state.ParserState == "ground" || state.PendingSequence == "" {
+				t.Errorf("Unexpected state %+v", state)
+			}
+			if line := editor.ProgressLine(); line != "second" {
+				t.Errorf("ProgressLine() = %q, want second", line)
+			}
+			if output := editor.Finish(); output.Text != "second" {
+				t.Errorf("Finish() = %q, want second", output.Text)
+			}
+			if output := editor.Finish(); output.Text != "" {
+				t.Errorf("Finish() after Finish = %q, want nothing", output.Text)
+			}
+		})
+	}
+}
+
+// TestLineEditorVerticalTab tests that VT is a line feed in both engines, rather
+// than Ctrl-K erasing the rest of the line
+func TestLineEditorVerticalTab(t *testing.T) {
+	for emulation, want := range map[string]string{TermEmulationHeuristic: "ab\ncd", TermEmulationFull: "ab\n  cd"} {
+		editor := NewEditor(WithTermEmulation(emulation, 10, 5))
+		editor.Write([]byte("ab\vcd"))
+		if got := editor.Flush(); got != want {
+			t.Errorf("%s: Flush() = %q, want %q", emulation, got, want)
+		}
+	}
+}
+
+// TestEditorWriteFlush tests the io.Writer form of a LineEditor and its options
+func TestEditorWriteFlush(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []EditorOption
+		input string
+		want  string
+	}{
+		{name: "Defaults", input: "a\tb\r\nc", want: "a       b\r\nc"},
+		{name: "Tab width and newline", opts: []EditorOption{WithTabWidth(4), WithNewline(NewlineLF)}, input: "a\tb\r\nc", want: "a   b\nc"},
+		{name: "Delete mode", opts: []EditorOption{WithDelMode(DelModeDelete)}, input: "abc\x1b[2D\x7f", want: "ac"},
+		{name: "Alternate screen discarded", input: "before\r\n\x1b[?1049hscreen\x1b[?1049lafter", want: "before\r\nafter"},
+		{name: "Alternate screen kept", opts: []EditorOption{WithAltScreen(AltScreenKeep)}, input: "before\r\n\x1b[?1049hscreen\x1b[Hs\x1b[?1049lafter", want: "before\r\nsscreen\nafter"},
+		{name: "Ending on the kept alternate screen", opts: []EditorOption{WithAltScreen(AltScreenKeep)}, input: "before\r\n\x1b[?1049hscreen", want: "before\r\nscreen\n"},
+		{name: "Full emulation", opts: []EditorOption{WithTermEmulation(TermEmulationFull, 10, 5)}, input: "0123456789ab", want: "0123456789\nab"},
+		{name: "Full emulation, alternate screen kept", opts: []EditorOption{WithTermEmulation(TermEmulationFull, 10, 5), WithAltScreen(AltScreenKeep)}, input: "before\r\n\x1b[?1049hscreen\x1b[?1049lafter", want: "before\nscreen\nafter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewEditor(tt.opts...)
+			if n, err := editor.Write([]byte(tt.input)); n != len(tt.input) || err != nil {
+				t.Fatalf("Write = %d, %v", n, err)
+			}
+			if got := editor.Flush(); got != tt.want {
+				t.Errorf("Flush() = %q, want %q", got, tt.want)
+			}
+			if got := editor.Flush(); got != "" {
+				t.Errorf("Flush() after Flush = %q, want nothing", got)
+			}
+		})
+	}
+}
+
+// TestEditorColorsKept tests that kept colors survive the alternate screen
+func TestEditorColorsKept(t *testing.T) {
+	editor := NewEditor(WithColors(true), WithAltScreen(AltScreenKeep))
+	editor.Write([]byte("\x1b[?1049h\x1b[31mred\x1b[0m\x1b[?1049l"))
+	if output := editor.Finish(); output.Text != "red\n" || output.Styled != "\x1b[31mred\x1b[0m\n" {
+		t.Errorf("Finish() = %q, %q", output.Text, output.Styled)
+	}
+}
+
+// TestLineEditorEndOnAlternateScreen tests that a command that ends while a
+// full-screen program has the discarded alternate screen still has an output
+func TestLineEditorEndOnAlternateScreen(t *testing.T) {
+	var outputs []Output
+	editor := NewLineEditor(EditorOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)), func(output Output) {
+		outputs = append(outputs, output)
+	})
+	editor.Write([]byte("before\r\n\x1b[?1049hscreen"))
+	editor.End()
+	if len(outputs) != 1 || outputs[0].Text != "before\r\n" {
+		t.Errorf("Outputs = %+v, want one with the output before the alternate screen", outputs)
+	}
+}
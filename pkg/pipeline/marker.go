@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"bytes"
+	"strings"
+)
+
+// IntegrationMarker starts the OSC sequences that the shell integration writes to
+// the terminal to mark where commands start and end. The markers are written in
+// band, so they are ordered with the command's output, and are removed from the
+// stream before it is shown or reconstructed.
+const IntegrationMarker = "\x1b]6973;"
+
+// MaxMarkerLength bounds the payload of a marker; longer sequences are passed
+// through as ordinary output.
+const MaxMarkerLength = 64 * 1024
+
+// MarkerFilter separates shell integration markers from the rest of the byte stream.
+// Bytes that might start a marker are held back until they can be told apart.
+type MarkerFilter struct {
+	// pending holds a partial IntegrationMarker, or the payload once it is complete
+	pending  []byte
+	inMarker bool
+	// Text is called with each byte that is not part of a marker
+	Text func(b byte)
+	// Marker is called with the payload of each complete marker
+	Marker func(payload string)
+}
+
+// WriteByte processes the next byte of the stream. It never fails; it returns an
+// error to implement io.ByteWriter.
+func (f *MarkerFilter) WriteByte(b byte) error {
+	if f.inMarker {
+		if b == BEL {
+			f.inMarker = false
+			payload := string(f.pending)
+			f.pending = f.pending[:0]
+			f.Marker(payload)
+			return nil
+		}
+		f.pending = append(f.pending, b)
+		if len(f.pending) > MaxMarkerLength {
+			// Not one of ours after all
+			f.Flush()
+		}
+		return nil
+	}
+
+	if len(f.pending) == 0 && b != ESC {
+		f.Text(b)
+		return nil
+	}
+	f.pending = append(f.pending, b)
+	if strings.HasPrefix(IntegrationMarker, string(f.pending)) {
+		if len(f.pending) == len(IntegrationMarker) {
+			f.inMarker = true
+			f.pending = f.pending[:0]
+		}
+		return nil
+	}
+
+	// The held back bytes are not a marker; a new ESC may start one
+	if b == ESC {
+		f.pending = f.pending[:len(f.pending)-1]
+		f.Flush()
+		f.pending = append(f.pending, ESC)
+		return nil
+	}
+	f.Flush()
+	return nil
+}
+
+// Flush passes the held back bytes, including an unfinished marker, through as
+// text, for the end of the stream.
+func (f *MarkerFilter) Flush() {
+	if f.inMarker {
+		f.inMarker = false
+		for _, p := range []byte(IntegrationMarker) {
+			f.Text(p)
+		}
+	}
+	pending := bytes.Clone(f.pending)
+	f.pending = f.pending[:0]
+	for _, p := range pending {
+		f.Text(p)
+	}
+}
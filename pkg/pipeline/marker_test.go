@@ -0,0 +1,45 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMarkerFilter tests separating shell integration markers from other output
+func TestMarkerFilter(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectedText    string
+		expectedMarkers []string
+	}{
+		{name: "Plain text", input: "hello\r\n", expectedText: "hello\r\n"},
+		{name: "Marker", input: "a\x1b]6973;start\x07b", expectedText: "ab", expectedMarkers: []string{"start"}},
+		{name: "Other OSC", input: "\x1b]0;title\x07", expectedText: "\x1b]0;title\x07"},
+		{name: "Other escape", input: "\x1b[1m\x1b]69x", expectedText: "\x1b[1m\x1b]69x"},
+		{name: "Escape restarts match", input: "\x1b]6\x1b]6973;end;YQ==\x07", expectedText: "\x1b]6", expectedMarkers: []string{"end;YQ=="}},
+		{name: "Unfinished marker", input: "a\x1b]6973;sta", expectedText: "a\x1b]6973;sta"},
+		{name: "Overlong marker", input: "\x1b]6973;" + strings.Repeat("x", MaxMarkerLength+1) + "y", expectedText: "\x1b]6973;" + strings.Repeat("x", MaxMarkerLength+1) + "y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var text []byte
+			var markers []string
+			f := &MarkerFilter{
+				Text:   func(b byte) { text = append(text, b) },
+				Marker: func(payload string) { markers = append(markers, payload) },
+			}
+			for _, b := range []byte(tt.input) {
+				f.WriteByte(b)
+			}
+			f.Flush()
+			if string(text) != tt.expectedText {
+				t.Errorf("Text = %q, want %q", text, tt.expectedText)
+			}
+			if strings.Join(markers, ",") != strings.Join(tt.expectedMarkers, ",") {
+				t.Errorf("Markers = %q, want %q", markers, tt.expectedMarkers)
+			}
+		})
+	}
+}
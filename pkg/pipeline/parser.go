@@ -0,0 +1,358 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"unicode/utf8"
+)
+
+// parserState is a state of the EscapeParser state machine.
+type parserState uint8
+
+// Parser states, after the DEC VT500-series parser model. DCS, SOS, PM and APC
+// strings share a single state because their contents are always discarded, and
+// two states are added for input that ends up echoed into the output: ESC O keys
+// (SS3) and the raw coordinate bytes of legacy mouse reports.
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSIEntry
+	stateCSIParam
+	stateCSIIntermediate
+	stateCSIIgnore
+	stateOSC
+	stateDCS
+	stateSS3
+	stateMouse
+	numParserStates
+)
+
+// parserStateNames are the names of the parser states reported in diagnostics.
+var parserStateNames = [numParserStates]string{
+	"ground", "escape", "escape_intermediate", "csi_entry", "csi_param",
+	"csi_intermediate", "csi_ignore", "osc", "dcs", "ss3", "mouse",
+}
+
+// String returns the name of the state.
+func (s parserState) String() string {
+	if s < numParserStates {
+		return parserStateNames[s]
+	}
+	return fmt.Sprintf("parserState(%d)", s)
+}
+
+// parserAction is what the EscapeParser does with a byte on a transition.
+type parserAction uint8
+
+const (
+	actionIgnore parserAction = iota
+	actionPrint
+	actionExecute
+	actionCollect
+	actionEscDispatch
+	actionCSIDispatch
+	actionOSCPut
+	actionOSCEnd
+	actionSS3Dispatch
+	actionMouseByte
+	// actionCancel abandons the current sequence and executes the byte
+	actionCancel
+)
+
+// parserTransition is an entry of the parser's transition table.
+type parserTransition struct {
+	action parserAction
+	next   parserState
+}
+
+// parserTable holds the transition for every state and input byte.
+var parserTable = buildParserTable()
+
+// buildParserTable returns the transition table of the EscapeParser.
+func buildParserTable() [numParserStates][256]parserTransition {
+	var table [numParserStates][256]parserTransition
+	set := func(state parserState, from, to byte, action parserAction, next parserState) {
+		for b := int(from); b <= int(to); b++ {
+			table[state][b] = parserTransition{action, next}
+		}
+	}
+
+	// By default, C0 controls are executed without leaving the current sequence and
+	// everything else is ignored
+	for state := range numParserStates {
+		set(state, 0x00, 0x1F, actionExecute, state)
+		set(state, 0x20, 0xFF, actionIgnore, state)
+	}
+
+	set(stateGround, 0x20, 0x7E, actionPrint, stateGround)
+	set(stateGround, DEL, DEL, actionExecute, stateGround)
+	set(stateGround, 0x80, 0xFF, actionPrint, stateGround)
+
+	set(stateEscape, 0x20, 0x2F, actionCollect, stateEscapeIntermediate)
+	set(stateEscape, 0x30, 0x7E, actionEscDispatch, stateGround)
+	set(stateEscape, CSI, CSI, actionIgnore, stateCSIEntry)
+	set(stateEscape, OSC, OSC, actionIgnore, stateOSC)
+	set(stateEscape, SS3, SS3, actionIgnore, stateSS3)
+	for _, b := range []byte{DCS, SOS, PM, APC} {
+		set(stateEscape, b, b, actionIgnore, stateDCS)
+	}
+
+	set(stateEscapeIntermediate, 0x20, 0x2F, actionCollect, stateEscapeIntermediate)
+	set(stateEscapeIntermediate, 0x30, 0x7E, actionEscDispatch, stateGround)
+
+	// Parameter bytes include ':' for the colon-separated SGR color forms. Private
+	// markers (<, =, >, ?) are only valid before the first parameter.
+	set(stateCSIEntry, 0x30, 0x3F, actionCollect, stateCSIParam)
+	set(stateCSIEntry, 0x20, 0x2F, actionCollect, stateCSIIntermediate)
+	set(stateCSIEntry, 0x40, 0x7E, actionCSIDispatch, stateGround)
+	set(stateCSIParam, 0x30, 0x3B, actionCollect, stateCSIParam)
+	set(stateCSIParam, 0x3C, 0x3F, actionIgnore, stateCSIIgnore)
+	set(stateCSIParam, 0x20, 0x2F, actionCollect, stateCSIIntermediate)
+	set(stateCSIParam, 0x40, 0x7E, actionCSIDispatch, stateGround)
+	set(stateCSIIntermediate, 0x20, 0x2F, actionCollect, stateCSIIntermediate)
+	set(stateCSIIntermediate, 0x30, 0x3F, actionIgnore, stateCSIIgnore)
+	set(stateCSIIntermediate, 0x40, 0x7E, actionCSIDispatch, stateGround)
+	set(stateCSIIgnore, 0x40, 0x7E, actionIgnore, stateGround)
+
+	// Strings ignore C0 controls; OSC strings may also end with BEL
+	set(stateOSC, 0x00, 0x1F, actionIgnore, stateOSC)
+	set(stateOSC, BEL, BEL, actionOSCEnd, stateGround)
+	set(stateOSC, 0x20, 0xFF, actionOSCPut, stateOSC)
+	set(stateOSC, DEL, DEL, actionIgnore, stateOSC)
+	set(stateDCS, 0x00, 0x1F, actionIgnore, stateDCS)
+
+	set(stateSS3, 0x20, 0xFF, actionSS3Dispatch, stateGround)
+
+	set(stateMouse, 0x00, 0xFF, actionMouseByte, stateMouse)
+
+	// Transitions from anywhere. ESC starts a new escape, which also terminates
+	// strings (ESC \ is the string terminator). CAN and SUB abandon a sequence.
+	for state := range numParserStates {
+		set(state, ESC, ESC, actionIgnore, stateEscape)
+		set(state, CAN, CAN, actionCancel, stateGround)
+		set(state, SUB, SUB, actionCancel, stateGround)
+	}
+	set(stateOSC, ESC, ESC, actionOSCEnd, stateEscape)
+
+	return table
+}
+
+// EscapeParser splits a terminal output stream into printable characters, control
+// characters and complete escape sequences, and calls the matching handler for each.
+// It is a table-driven state machine after the DEC VT500-series parser, so
+// interrupted and malformed sequences resynchronize the way a real terminal does:
+// ESC always starts a new sequence, CAN and SUB abandon one, and CSI sequences
+// longer than MaxCSILength are abandoned and ignored up to their final byte.
+//
+// Printable text is delivered one character at a time, with UTF-8 sequences
+// assembled into a single character and bytes that are not valid UTF-8 delivered
+// on their own. Mouse reports are dropped, since they are terminal input echoed into
+// the output. Handlers that are not set do nothing, and slices passed to handlers
+// are only valid until they return.
+type EscapeParser struct {
+	// Print is called with each printable character.
+	Print func(char []byte)
+	// Execute is called with each C0 control character and DEL.
+	Execute func(b byte)
+	// EscDispatch is called with the intermediate and final bytes of an escape
+	// sequence, e.g. "(" and 'B' for ESC ( B.
+	EscDispatch func(intermediates []byte, final byte)
+	// CSIDispatch is called with the parameter, intermediate and final bytes of a
+	// CSI sequence, e.g. "?1049h" for ESC [ ? 1049 h.
+	CSIDispatch func(seq []byte)
+	// OSCDispatch is called with the payload of an OSC string, e.g. "0;title".
+	OSCDispatch func(payload []byte)
+	// SS3Dispatch is called with the key byte following ESC O.
+	SS3Dispatch func(key byte)
+
+	state      parserState
+	buf        []byte
+	utf8Buf    []byte
+	mouseBytes int
+	logger     *slog.Logger
+}
+
+// NewEscapeParser returns an EscapeParser in the ground state with no handlers set.
+// Abandoned sequences are logged to logger.
+func NewEscapeParser(logger *slog.Logger) *EscapeParser {
+	return &EscapeParser{logger: logger}
+}
+
+// Reset returns the parser to the ground state, discarding any partial sequence or
+// character.
+func (p *EscapeParser) Reset() {
+	p.state = stateGround
+	p.buf = nil
+	p.utf8Buf = nil
+	p.mouseBytes = 0
+}
+
+// End ends the stream at the end of a command, so that nothing in progress carries
+// over into the next one: an incomplete UTF-8 character is delivered as single
+// bytes and a sequence is abandoned.
+func (p *EscapeParser) End() {
+	for _, c := range p.utf8Buf {
+		p.print([]byte{c})
+	}
+	p.utf8Buf = nil
+	if p.state != stateGround {
+		p.abandon("ended")
+	}
+}
+
+// pending returns the bytes of the sequence or UTF-8 character in progress.
+func (p *EscapeParser) pending() []byte {
+	if p.state == stateGround {
+		return p.utf8Buf
+	}
+	return p.buf
+}
+
+// Advance feeds the next byte of the stream to the parser.
+func (p *EscapeParser) Advance(b byte) {
+	// A byte that cannot continue a UTF-8 sequence ends an incomplete one, whose
+	// bytes are delivered as single characters (e.g. ISO-8859-1 text)
+	if len(p.utf8Buf) > 0 && b < 0x80 {
+		for _, c := range p.utf8Buf {
+			p.print([]byte{c})
+		}
+		p.utf8Buf = nil
+	}
+
+	// 0x9B is also a UTF-8 continuation byte, so it only introduces a CSI sequence
+	// when it can't be part of a character
+	if p.state == stateGround && b == C1_CSI && len(p.utf8Buf) == 0 {
+		p.enter(stateCSIEntry)
+		return
+	}
+
+	// Abandon a CSI sequence that grows too long, and ignore the rest of it up to
+	// its final byte, so its parameters don't leak into the text
+	if p.inCSI() && p.state != stateCSIIgnore && len(p.buf) >= MaxCSILength {
+		p.abandon("length")
+		p.enter(stateCSIIgnore)
+	}
+
+	t := parserTable[p.state][b]
+	if t.action == actionCancel && p.state != stateGround {
+		p.abandon("cancelled")
+	}
+
+	// The action runs before the transition, so a string is dispatched before the
+	// escape that terminates it starts a new sequence. Actions that change the state
+	// themselves (mouse reports) take precedence over the table.
+	state := p.state
+	p.perform(t.action, b)
+	if p.state == state && t.next != state {
+		p.enter(t.next)
+	}
+}
+
+// perform carries out action for the byte b.
+func (p *EscapeParser) perform(action parserAction, b byte) {
+	switch action {
+	case actionPrint:
+		if b < 0x80 {
+			p.print([]byte{b})
+			return
+		}
+		// Collect UTF-8 sequences so each character is delivered whole. Invalid
+		// bytes are complete characters on their own.
+		p.utf8Buf = append(p.utf8Buf, b)
+		for len(p.utf8Buf) > 0 && utf8.FullRune(p.utf8Buf) {
+			_, size := utf8.DecodeRune(p.utf8Buf)
+			p.print(p.utf8Buf[:size])
+			p.utf8Buf = p.utf8Buf[size:]
+		}
+	case actionExecute, actionCancel:
+		if p.Execute != nil {
+			p.Execute(b)
+		}
+	case actionCollect:
+		p.buf = append(p.buf, b)
+	case actionEscDispatch:
+		if p.EscDispatch != nil {
+			p.EscDispatch(p.buf, b)
+		}
+	case actionCSIDispatch:
+		p.buf = append(p.buf, b)
+		p.csiDispatch()
+	case actionOSCPut:
+		// iTerm2 payloads such as inline images can be arbitrarily large, and are never needed
+		if !bytes.HasPrefix(p.buf, []byte(ITERM2_OSC)) {
+			p.buf = append(p.buf, b)
+		}
+	case actionOSCEnd:
+		if p.OSCDispatch != nil {
+			p.OSCDispatch(p.buf)
+		}
+	case actionSS3Dispatch:
+		if p.SS3Dispatch != nil {
+			p.SS3Dispatch(b)
+		}
+	case actionMouseByte:
+		p.mouseBytes--
+		if p.mouseBytes <= 0 {
+			p.enter(stateGround)
+		}
+	}
+}
+
+// enter moves the parser to state, clearing the sequence buffer when a new
+// sequence starts.
+func (p *EscapeParser) enter(state parserState) {
+	p.state = state
+	switch state {
+	case stateEscape, stateCSIEntry, stateOSC:
+		p.buf = p.buf[:0]
+	}
+}
+
+// inCSI reports whether the parser is inside a CSI sequence.
+func (p *EscapeParser) inCSI() bool {
+	return p.state >= stateCSIEntry && p.state <= stateCSIIgnore
+}
+
+// csiDispatch delivers the complete CSI sequence in buf, unless it is a mouse report.
+func (p *EscapeParser) csiDispatch() {
+	if isMouseReport(p.buf) {
+		if len(p.buf) == 1 {
+			// The 3 raw bytes of a legacy report follow
+			p.mouseBytes = 3
+			p.enter(stateMouse)
+		}
+		return
+	}
+	if p.CSIDispatch != nil {
+		p.CSIDispatch(p.buf)
+	}
+}
+
+// abandon drops the sequence in progress, counting it as a parse error.
+func (p *EscapeParser) abandon(reason string) {
+	parseErrors.Add(1)
+	if p.logger != nil {
+		p.logger.Warn("Abandoned unterminated escape sequence", "reason", reason, "state", p.state, "length", len(p.buf))
+	}
+	p.enter(stateGround)
+}
+
+// print delivers a printable character.
+func (p *EscapeParser) print(char []byte) {
+	if p.Print != nil {
+		p.Print(char)
+	}
+}
+
+// isMouseReport reports whether the CSI sequence seq is an xterm mouse report: either
+// a legacy ESC [ M, whose 3 raw coordinate bytes follow, or an SGR ESC [ < ... M/m.
+// A bare ESC [ M is also delete line, which the screen model does not implement.
+func isMouseReport(seq []byte) bool {
+	if len(seq) == 1 {
+		return seq[0] == MOUSE_REPORT
+	}
+	final := seq[len(seq)-1]
+	return seq[0] == SGR_MOUSE && (final == MOUSE_REPORT || final == SGR)
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recordEvents returns a parser that records each handler call as a string
+func recordEvents(events *[]string) *EscapeParser {
+	p := NewEscapeParser(nil)
+	p.Print = func(char []byte) { *events = append(*events, fmt.Sprintf("print %q", char)) }
+	p.Execute = func(b byte) { *events = append(*events, fmt.Sprintf("execute %#02x", b)) }
+	p.EscDispatch = func(intermediates []byte, final byte) {
+		*events = append(*events, fmt.Sprintf("esc %q %c", intermediates, final))
+	}
+	p.CSIDispatch = func(seq []byte) { *events = append(*events, fmt.Sprintf("csi %q", seq)) }
+	p.OSCDispatch = func(payload []byte) { *events = append(*events, fmt.Sprintf("osc %q", payload)) }
+	p.SS3Dispatch = func(key byte) { *events = append(*events, fmt.Sprintf("ss3 %c", key)) }
+	return p
+}
+
+// TestEscapeParser tests the events produced for complete, interrupted and malformed input
+func TestEscapeParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "Text and controls", input: "a\r\n", expected: []string{`print "a"`, "execute 0x0d", "execute 0x0a"}},
+		{name: "UTF-8", input: "\xc3\xa9", expected: []string{`print "é"`}},
+		{name: "Invalid UTF-8", input: "\xe9a", expected: []string{`print "\xe9"`, `print "a"`}},
+		{name: "CSI", input: "\x1b[1;31m", expected: []string{`csi "1;31m"`}},
+		{name: "Private CSI", input: "\x1b[?1049h", expected: []string{`csi "?1049h"`}},
+		{name: "CSI with intermediate", input: "\x1b[2 q", expected: []string{`csi "2 q"`}},
+		{name: "Colon parameters", input: "\x1b[38:2:1:2:3m", expected: []string{`csi "38:2:1:2:3m"`}},
+		{name: "8-bit CSI", input: "\x9b2K", expected: []string{`csi "2K"`}},
+		{name: "0x9B inside UTF-8", input: "\xc4\x9b", expected: []string{`print "ě"`}},
+		{name: "Misplaced private marker is ignored", input: "\x1b[1?2hx", expected: []string{`print "x"`}},
+		{name: "Controls inside CSI are executed", input: "\x1b[1\b2A", expected: []string{"execute 0x08", `csi "12A"`}},
+		{name: "Escape", input: "\x1b7", expected: []string{`esc "" 7`}},
+		{name: "Escape with intermediate", input: "\x1b(Bx", expected: []string{`esc "(" B`, `print "x"`}},
+		{name: "SS3", input: "\x1bOH", expected: []string{"ss3 H"}},
+		{name: "OSC terminated by BEL", input: "\x1b]0;title\x07", expected: []string{`osc "0;title"`}},
+		{name: "OSC terminated by ST", input: "\x1b]0;title\x1b\\", expected: []string{`osc "0;title"`, `esc "" \`}},
+		{name: "Escape interrupts OSC", input: "\x1b]0;ti\x1b[Kx", expected: []string{`osc "0;ti"`, `csi "K"`, `print "x"`}},
+		{name: "iTerm2 payload is not buffered", input: "\x1b]1337;File=:AAAA\x07", expected: []string{`osc "1337;"`}},
+		{name: "DCS is dropped", input: "\x1bPq#0~~\x1b\\x", expected: []string{`esc "" \`, `print "x"`}},
+		{name: "APC is dropped", input: "\x1b_Ga=T;AAAA\x1b\\", expected: []string{`esc "" \`}},
+		{name: "Escape interrupts CSI", input: "\x1b[12\x1b[3Dx", expected: []string{`csi "3D"`, `print "x"`}},
+		{name: "CAN abandons CSI", input: "\x1b[12\x18x", expected: []string{"execute 0x18", `print "x"`}},
+		{name: "EOF is an ordinary control", input: "a\x04b", expected: []string{`print "a"`, "execute 0x04", `print "b"`}},
+		{name: "EOF inside OSC is ignored", input: "\x1b]0;ti\x04tle\x07", expected: []string{`osc "0;title"`}},
+		{name: "SGR mouse report is dropped", input: "\x1b[<0;1;1Mx", expected: []string{`print "x"`}},
+		{name: "Legacy mouse report is dropped", input: "\x1b[M !!x", expected: []string{`print "x"`}},
+		{name: "Overlong CSI is ignored to its final byte", input: "\x1b[" + strings.Repeat("1", MaxCSILength) + "2;3mx", expected: []string{`print "x"`}},
+		{name: "Escape interrupts overlong CSI", input: "\x1b[" + strings.Repeat("1", MaxCSILength) + "2\x1b[3Dx", expected: []string{`csi "3D"`, `print "x"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []string
+			p := recordEvents(&events)
+			for _, b := range []byte(tt.input) {
+				p.Advance(b)
+			}
+			if !slices.Equal(events, tt.expected) {
+				t.Errorf("Events = %q, want %q", events, tt.expected)
+			}
+		})
+	}
+}
+
+// TestEscapeParserReset tests that Reset discards a partial sequence
+func TestEscapeParserReset(t *testing.T) {
+	var events []string
+	p := recordEvents(&events)
+	for _, b := range []byte("\x1b[12\xc3") {
+		p.Advance(b)
+	}
+	p.Reset()
+	for _, b := range []byte("3Dx") {
+		p.Advance(b)
+	}
+
+	expected := []string{`print "3"`, `print "D"`, `print "x"`}
+	if !slices.Equal(events, expected) {
+		t.Errorf("Events = %q, want %q", events, expected)
+	}
+}
+
+// TestEscapeParserEnd tests that End abandons a partial sequence and delivers a
+// partial character
+func TestEscapeParserEnd(t *testing.T) {
+	for _, input := range []string{"\x1b]0;title", "\x1b[12", "\x1bPq#0"} {
+		var events []string
+		p := recordEvents(&events)
+		for _, b := range []byte(input + "\xc3") {
+			p.Advance(b)
+		}
+		p.End()
+		for _, b := range []byte("x") {
+			p.Advance(b)
+		}
+		if expected := []string{`print "x"`}; !slices.Equal(events, expected) {
+			t.Errorf("%q: Events = %q, want %q", input, events, expected)
+		}
+	}
+
+	var events []string
+	p := recordEvents(&events)
+	p.Advance(0xc3)
+	p.End()
+	if expected := []string{`print "\xc3"`}; !slices.Equal(events, expected) {
+		t.Errorf("Events = %q, want %q", events, expected)
+	}
+}
+
+// TestParserTableComplete tests that ESC, CAN and SUB leave every state
+func TestParserTableComplete(t *testing.T) {
+	for state := range numParserStates {
+		if next := parserTable[state][ESC].next; next != stateEscape {
+			t.Errorf("State %d: ESC leads to %d, want %d", state, next, stateEscape)
+		}
+		for _, b := range []byte{CAN, SUB} {
+			if tr := parserTable[state][b]; tr.action != actionCancel || tr.next != stateGround {
+				t.Errorf("State %d: %#02x = %+v, want cancel to ground", state, b, tr)
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// channelBuffer is the capacity of the channels between the stages of a Pipeline.
+const channelBuffer = 100
+
+// Option configures a Pipeline.
+type Option func(*Pipeline)
+
+// WithEditorOptions sets how the pipeline reconstructs output.
+func WithEditorOptions(opts EditorOptions) Option {
+	return func(p *Pipeline) { p.editorOpts = opts }
+}
+
+// WithRecordOptions sets the optional fields of the pipeline's records. Without
+// IDs, the pipeline numbers its records from 1 on its own.
+func WithRecordOptions(opts RecordOptions) Option {
+	return func(p *Pipeline) { p.recordOpts = opts }
+}
+
+// WithProcessors sets the processors that the pipeline runs its records through, in
+// order, before sending them on.
+func WithProcessors(processors ...RecordProcessor) Option {
+	return func(p *Pipeline) { p.processors = processors }
+}
+
+// WithLogger sets the logger of the pipeline (slog.Default() otherwise).
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Pipeline) { p.logger = logger }
+}
+
+// Pipeline records the commands of a shell session from a pair of FIFOs: the script
+// FIFO carries the terminal byte stream, the command FIFO the command lines. Either
+// can be replaced by feeding the pipeline in-process with FeedOutput and
+// FeedCommand. It pairs each command's output with the oldest pending command
+// line. All of its state is its own, so several pipelines can run side by side.
+type Pipeline struct {
+	scriptFifo, commandFifo string
+	editorOpts              EditorOptions
+	recordOpts              RecordOptions
+	processors              Chain
+	hooks                   *Hooks
+	onError                 func(error)
+	logger                  *slog.Logger
+
+	ids      atomic.Uint64
+	outputs  chan Output
+	commands chan CommandMeta
+	records  chan CommandRecord
+	// done is closed when Run returns
+	done chan struct{}
+
+	// mu guards script, which Run sets
+	mu     sync.Mutex
+	script *ScriptReader
+}
+
+// New returns a pipeline that reads the script and command FIFOs at the given
+// paths. Run creates them if nothing exists there yet. An empty path leaves that
+// input to FeedOutput or FeedCommand, so a pipeline without either FIFO is fed
+// entirely in-process.
+func New(scriptFifo, commandFifo string, opts ...Option) *Pipeline {
+	p := &Pipeline{
+		scriptFifo:  scriptFifo,
+		commandFifo: commandFifo,
+		logger:      slog.Default(),
+		outputs:     make(chan Output, channelBuffer),
+		commands:    make(chan CommandMeta, channelBuffer),
+		records:     make(chan CommandRecord, channelBuffer),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.recordOpts.IDs == nil {
+		p.recordOpts.IDs = &p.ids
+	}
+	return p
+}
+
+// Records returns the channel of the pipeline's records, which Run closes when it
+// returns.
+func (p *Pipeline) Records() <-chan CommandRecord {
+	return p.records
+}
+
+// Run records commands until ctx is done or reading a FIFO fails, then closes the
+// FIFOs, waits for its readers and closes the records channel. A failure to read
+// a FIFO is reported to the WithOnError hook and returned as an *Error. A Pipeline
+// runs only once.
+func (p *Pipeline) Run(ctx context.Context) error {
+	defer close(p.records)
+	defer close(p.done)
+	editor := NewLineEditor(p.editorOpts, p.logger, func(output Output) {
+		select {
+		case p.outputs <- output:
+		case <-ctx.Done():
+		}
+	})
+	// Without a script FIFO, the reader only gates the bytes of FeedOutput
+	script := &ScriptReader{editor: editor}
+	if p.scriptFifo != "" {
+		var err error
+		if script, err = NewScriptReader(p.scriptFifo, editor); err != nil {
+			return err
+		}
+		script.opened = func() { p.hooks.FireSessionStart("") }
+	}
+	script.state.logger = p.logger
+	var commands *CommandReader
+	if p.commandFifo != "" {
+		var err error
+		commands, err = NewCommandReader(p.commandFifo, func(command string) {
+			select {
+			case p.commands <- CommandMeta{Command: command}:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	p.script = script
+	p.mu.Unlock()
+
+	errs := make(chan error, 2)
+	running := 0
+	if p.scriptFifo != "" {
+		go func() { errs <- p.readerDone(StageScript, script.Run()) }()
+		running++
+	} else {
+		p.hooks.FireSessionStart("")
+	}
+	if commands != nil {
+		go func() { errs <- p.readerDone(StageCommand, commands.Run()) }()
+		running++
+	}
+
+	creator := NewRecordCreator(p.recordOpts)
+	var err error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case err = <-errs:
+			running--
+			break loop
+		case output := <-p.outputs:
+			// The command line usually arrives before the output ends, but may lag
+			var command CommandMeta
+			select {
+			case command = <-p.commands:
+			default:
+			}
+			record := creator.Create(command.Command, output, time.Now())
+			record.ExitCode, record.Cwd = command.ExitCode, command.Cwd
+			if command.EUID != nil && *command.EUID == 0 {
+				record.Privileged = true
+			}
+			record, ok := p.pass(record)
+			if !ok {
+				continue
+			}
+			select {
+			case p.records <- record:
+			case <-ctx.Done():
+				break loop
+			}
+		}
+	}
+
+	if p.scriptFifo != "" {
+		script.Close()
+	}
+	if commands != nil {
+		commands.Close()
+	}
+	// Start, Stop and FeedOutput have no effect from now on
+	p.mu.Lock()
+	p.script = nil
+	p.mu.Unlock()
+	for ; running > 0; running-- {
+		if runErr := <-errs; err == nil {
+			err = runErr
+		}
+	}
+	return err
+}
+
+// readerDone reports the error that ended the reader of stage, if any, and
+// returns it.
+func (p *Pipeline) readerDone(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return p.report(stage, err)
+}
+
+// pass runs record through the pipeline's processors and returns it, calling the
+// OnRecord hooks, or false after calling the OnDrop hooks if a processor dropped it.
+func (p *Pipeline) pass(record CommandRecord) (CommandRecord, bool) {
+	processed, ok := p.processors.Process(record)
+	if !ok {
+		p.hooks.FireDrop(record, DropFiltered)
+		return processed, false
+	}
+	p.hooks.FireRecord(processed)
+	return processed, true
+}
+
+// drain discards the pending outputs and commands.
+func (p *Pipeline) drain() {
+	for {
+		select {
+		case <-p.outputs:
+		case <-p.commands:
+		default:
+			return
+		}
+	}
+}
+
+// Start starts a command, for a shell's preexec hook. It has no effect before or
+// after Run.
+func (p *Pipeline) Start() {
+	if script := p.scriptReader(); script != nil {
+		script.Start()
+	}
+}
+
+// Stop ends the current command so the pipeline records it, for a shell's precmd
+// hook. It has no effect before or after Run.
+func (p *Pipeline) Stop() {
+	if script := p.scriptReader(); script != nil {
+		script.Stop()
+	}
+}
+
+// Reset discards the current command, the pending outputs and commands, and the
+// terminal state, to recover from FIFOs that went out of sync, and calls the
+// OnReset hooks. Output and commands that arrive after it returns are kept.
+func (p *Pipeline) Reset() {
+	if script := p.scriptReader(); script != nil {
+		script.Reset()
+	}
+	p.drain()
+	p.hooks.FireReset("")
+}
+
+// State returns where the pipeline is in recording a command: Idle between
+// commands and before or after Run, Recording between Start and Stop, and Flushing
+// while Stop waits for Run to take the command's output.
+func (p *Pipeline) State() SessionState {
+	if script := p.scriptReader(); script != nil {
+		return script.State()
+	}
+	return StateIdle
+}
+
+// scriptReader returns the ScriptReader of a running pipeline, or nil.
+func (p *Pipeline) scriptReader() *ScriptReader {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.script
+}
@@ -0,0 +1,46 @@
+package pipeline_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"script2json/pkg/pipeline"
+	"script2json/pkg/pipetest"
+)
+
+// TestPipelineReset tests that Reset discards the current command and calls the
+// reset hooks
+func TestPipelineReset(t *testing.T) {
+	h := pipetest.New(t)
+	var resets atomic.Int32
+	h.Hooks().OnReset(func(string) { resets.Add(1) })
+
+	h.Feed(
+		pipetest.Command("cat /dev/urandom"),
+		pipetest.Start(),
+		pipetest.Output("garbage\x1b["),
+		pipetest.Reset(),
+		pipetest.Stop(),
+	)
+	h.Run("echo ok", "ok")
+	record := h.ExpectRecord("echo ok", "ok")
+	if record.ID != "1" {
+		t.Errorf("ID = %s, want 1", record.ID)
+	}
+	if state := h.Pipeline().State(); state != pipeline.StateIdle {
+		t.Errorf("State = %v after the record, want idle", state)
+	}
+	if resets.Load() != 1 {
+		t.Errorf("Hooks saw %d resets, want 1", resets.Load())
+	}
+}
+
+// TestPipelineEOFByte tests that an EOF byte in a command's output doesn't end the
+// output, so the commands after it still pair with their own outputs
+func TestPipelineEOFByte(t *testing.T) {
+	h := pipetest.New(t)
+	h.Run("printf", "before\x04after")
+	h.Run("echo ok", "ok")
+	h.ExpectRecord("printf", "beforeafter")
+	h.ExpectRecord("echo ok", "ok")
+}
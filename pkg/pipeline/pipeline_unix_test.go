@@ -0,0 +1,129 @@
+//go:build !windows
+
+package pipeline
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestPipeline returns a pipeline on FIFOs in a temporary directory, and the
+// paths of the FIFOs.
+func newTestPipeline(t *testing.T) (p *Pipeline, scriptFifo, commandFifo string) {
+	t.Helper()
+	dir := t.TempDir()
+	scriptFifo = filepath.Join(dir, "script.fifo")
+	commandFifo = filepath.Join(dir, "command.fifo")
+	p = New(scriptFifo, commandFifo, WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	return p, scriptFifo, commandFifo
+}
+
+// waitFifo waits for Run to create the FIFO at path.
+func waitFifo(t *testing.T, path string) {
+	t.Helper()
+	for range 100 {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s was not created", path)
+}
+
+// TestPipelines tests that two pipelines record side by side, each numbering its
+// own records, and that cancelling the context stops them
+func TestPipelines(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type running struct {
+		p                       *Pipeline
+		scriptFifo, commandFifo string
+		done                    chan error
+	}
+	var pipelines []running
+	for range 2 {
+		p, scriptFifo, commandFifo := newTestPipeline(t)
+		done := make(chan error, 1)
+		go func() { done <- p.Run(ctx) }()
+		pipelines = append(pipelines, running{p, scriptFifo, commandFifo, done})
+	}
+
+	for i, r := range pipelines {
+		waitFifo(t, r.scriptFifo)
+		waitFifo(t, r.commandFifo)
+		r.p.Start()
+		writeFifo(t, r.commandFifo, "echo hi\n")
+		writeFifo(t, r.scriptFifo, "hi")
+		time.Sleep(50 * time.Millisecond)
+		r.p.Stop()
+		select {
+		case record := <-r.p.Records():
+			if record.ID != "1" || record.Command != "echo hi" || record.Output != "hi" {
+				t.Errorf("Pipeline %d: record = %+v, want ID 1 for echo hi", i, record)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Pipeline %d: timeout waiting for record", i)
+		}
+	}
+
+	// A writer holding the script FIFO open must not keep Run from returning
+	writer, err := os.OpenFile(pipelines[0].scriptFifo, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	cancel()
+	for i, r := range pipelines {
+		select {
+		case err := <-r.done:
+			if err != nil {
+				t.Errorf("Pipeline %d: Run failed: %v", i, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Pipeline %d: Run did not return after cancel", i)
+		}
+		if _, ok := <-r.p.Records(); ok {
+			t.Errorf("Pipeline %d: records channel not closed", i)
+		}
+	}
+}
+
+// TestPipelineSessionStart tests that each writer opening the script FIFO starts a
+// session
+func TestPipelineSessionStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, scriptFifo, _ := newTestPipeline(t)
+	var starts atomic.Int32
+	hooks := &Hooks{}
+	hooks.OnSessionStart(func(string) { starts.Add(1) })
+	WithHooks(hooks)(p)
+	go p.Run(ctx)
+	waitFifo(t, scriptFifo)
+
+	// The second writer must open the FIFO after the reader saw the first close it,
+	// or the reader takes them for one
+	writeFifo(t, scriptFifo, "first")
+	time.Sleep(50 * time.Millisecond)
+	writeFifo(t, scriptFifo, "second")
+	waitStarts(t, &starts, 2)
+}
+
+// waitStarts waits for starts to reach want.
+func waitStarts(t *testing.T, starts *atomic.Int32, want int32) {
+	t.Helper()
+	for range 100 {
+		if starts.Load() == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Hooks saw %d session starts, want %d", starts.Load(), want)
+}
@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Process records the commands in r, a terminal byte stream that carries the shell
+// integration markers of script2json run: a "start" marker begins a command's
+// output, and an "end;<base64 command>" marker ends it and names the command (a bare
+// "end" leaves it empty). It takes the options of New, and reads r in the background
+// until it ends or fails or ctx is done, then closes the returned channel; a
+// cancelled ctx takes effect once the read in progress returns. A command still
+// running at the end of r is recorded with its output so far. Read errors and
+// commands that can't be decoded go to the WithOnError hook.
+func Process(ctx context.Context, r io.Reader, opts ...Option) (<-chan CommandRecord, error) {
+	if r == nil {
+		return nil, errors.New("pipeline: nil reader")
+	}
+	p := New("", "", opts...)
+	records := make(chan CommandRecord, channelBuffer)
+	go func() {
+		defer close(records)
+		p.process(ctx, r, records)
+	}()
+	return records, nil
+}
+
+// process does the work of Process.
+func (p *Pipeline) process(ctx context.Context, r io.Reader, records chan<- CommandRecord) {
+	creator := NewRecordCreator(p.recordOpts)
+	var command string
+	editor := NewLineEditor(p.editorOpts, p.logger, func(output Output) {
+		record, ok := p.pass(creator.Create(command, output, time.Now()))
+		if !ok {
+			return
+		}
+		select {
+		case records <- record:
+		case <-ctx.Done():
+		}
+	})
+
+	reading := false
+	filter := &MarkerFilter{
+		Text: func(b byte) {
+			if reading {
+				editor.WriteByte(b)
+			}
+		},
+		Marker: func(payload string) {
+			switch {
+			case payload == "start":
+				reading = true
+			case payload == "end" || strings.HasPrefix(payload, "end;"):
+				if !reading {
+					return
+				}
+				command = ""
+				if encoded, ok := strings.CutPrefix(payload, "end;"); ok {
+					decoded, err := base64.StdEncoding.DecodeString(encoded)
+					if err != nil {
+						p.report(StageDecode, fmt.Errorf("could not decode command from shell integration: %w", err))
+					}
+					command = strings.TrimRight(string(decoded), "\n")
+				}
+				reading = false
+				editor.End()
+			default:
+				p.logger.Debug("Ignoring unknown shell integration marker", "payload", payload)
+			}
+		},
+	}
+
+	p.hooks.FireSessionStart("")
+	buf := make([]byte, 4096)
+	for ctx.Err() == nil {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			filter.WriteByte(b)
+		}
+		if err != nil {
+			if err != io.EOF {
+				p.report(StageScript, fmt.Errorf("reading terminal byte stream: %w", err))
+			}
+			filter.Flush()
+			if reading {
+				command = ""
+				editor.End()
+			}
+			return
+		}
+	}
+}
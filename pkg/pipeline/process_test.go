@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProcess tests recording the commands of a byte stream with integration markers
+func TestProcess(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("ls\n"))
+	input := "$ ls\r\n\x1b]6973;start\x07file1\r\nfile2\x1b]6973;end;" + encoded + "\x07" +
+		"$ pwd\r\n\x1b]6973;start\x07/tmp\x1b]6973;end\x07" +
+		"$ \x1b]6973;end\x07" +
+		"$ top\r\n\x1b]6973;start\x07running"
+	records, err := Process(context.Background(), strings.NewReader(input),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithRecordOptions(RecordOptions{Newline: NewlineLF}))
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	want := []struct{ id, command, output string }{
+		{"1", "ls", "file1\nfile2"},
+		{"2", "", "/tmp"},
+		{"3", "", "running"},
+	}
+	var got []CommandRecord
+	for record := range records {
+		got = append(got, record)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got %d records, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].ID != w.id || got[i].Command != w.command || got[i].Output != w.output {
+			t.Errorf("Record %d = {%q %q %q}, want %v", i, got[i].ID, got[i].Command, got[i].Output, w)
+		}
+	}
+}
+
+// TestProcessCancel tests that cancelling the context closes the records channel
+func TestProcessCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r, w := io.Pipe()
+	defer w.Close()
+	records, err := Process(ctx, r, WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	cancel()
+	// Process sees the cancellation once the read it is waiting in returns
+	go w.Write([]byte("\x1b]6973;start\x07out\x1b]6973;end\x07"))
+	select {
+	case _, ok := <-records:
+		if ok {
+			// The record may have been created before the cancellation was seen
+			if _, ok := <-records; ok {
+				t.Error("Records channel not closed")
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Records channel not closed after cancel")
+	}
+}
+
+// TestProcessNilReader tests that Process rejects a nil reader
+func TestProcessNilReader(t *testing.T) {
+	if _, err := Process(context.Background(), nil); err == nil {
+		t.Error("Process(nil) should fail")
+	}
+}
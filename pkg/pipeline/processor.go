@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// RecordProcessor transforms records on their way from the record creator to the
+// sink, for cross-cutting concerns such as redaction, enrichment, filtering and
+// truncation. Process returns the record to pass on, or false to drop it.
+type RecordProcessor interface {
+	Process(record CommandRecord) (CommandRecord, bool)
+}
+
+// ProcessorFunc is a function that is a RecordProcessor.
+type ProcessorFunc func(record CommandRecord) (CommandRecord, bool)
+
+// Process calls f(record).
+func (f ProcessorFunc) Process(record CommandRecord) (CommandRecord, bool) {
+	return f(record)
+}
+
+// Chain is a RecordProcessor that runs its processors in order. A processor that
+// drops the record ends the chain.
+type Chain []RecordProcessor
+
+// Process runs record through the processors of the chain.
+func (c Chain) Process(record CommandRecord) (CommandRecord, bool) {
+	for _, p := range c {
+		var ok bool
+		if record, ok = p.Process(record); !ok {
+			return record, false
+		}
+	}
+	return record, true
+}
+
+// Redacted replaces the text that Redact removes.
+const Redacted = "[REDACTED]"
+
+// Redact returns a processor that replaces the matches of pattern in the command,
+// argv and output of a record, plain and styled, with Redacted.
+func Redact(pattern *regexp.Regexp) RecordProcessor {
+	return ProcessorFunc(func(record CommandRecord) (CommandRecord, bool) {
+		record.Command = pattern.ReplaceAllLiteralString(record.Command, Redacted)
+		record.Output = pattern.ReplaceAllLiteralString(record.Output, Redacted)
+		record.StyledOutput = pattern.ReplaceAllLiteralString(record.StyledOutput, Redacted)
+		if record.Argv != nil {
+			argv := make([]string, len(record.Argv))
+			for i, arg := range record.Argv {
+				argv[i] = pattern.ReplaceAllLiteralString(arg, Redacted)
+			}
+			record.Argv = argv
+		}
+		return record, true
+	})
+}
+
+// ExcludeCommands returns a processor that drops the records whose command matches
+// pattern.
+func ExcludeCommands(pattern *regexp.Regexp) RecordProcessor {
+	return ProcessorFunc(func(record CommandRecord) (CommandRecord, bool) {
+		return record, !pattern.MatchString(record.Command)
+	})
+}
+
+// TruncateOutput returns a processor that cuts the output of a record, plain and
+// styled, to at most maxBytes bytes, without splitting a character or an escape
+// sequence, and marks it OutputTruncated.
+func TruncateOutput(maxBytes int) RecordProcessor {
+	return ProcessorFunc(func(record CommandRecord) (CommandRecord, bool) {
+		if len(record.Output) > maxBytes {
+			record.Output = truncateUTF8(record.Output, maxBytes)
+			record.OutputTruncated = true
+		}
+		if len(record.StyledOutput) > maxBytes {
+			styled := truncateUTF8(record.StyledOutput, maxBytes)
+			// Drop an escape sequence the cut left unfinished
+			if esc := strings.LastIndexByte(styled, 0x1b); esc >= 0 && strings.IndexByte(styled[esc+1:], 'm') < 0 {
+				styled = styled[:esc]
+			}
+			record.StyledOutput = styled
+			record.OutputTruncated = true
+		}
+		return record, true
+	})
+}
+
+// truncateUTF8 cuts s to at most n bytes at the start of a character.
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestChain tests that a chain runs its processors in order and stops at a drop
+func TestChain(t *testing.T) {
+	var ran []string
+	step := func(name string, keep bool) RecordProcessor {
+		return ProcessorFunc(func(record CommandRecord) (CommandRecord, bool) {
+			ran = append(ran, name)
+			record.Command += name
+			return record, keep
+		})
+	}
+
+	record, ok := Chain{step("a", true), step("b", true)}.Process(CommandRecord{})
+	if !ok || record.Command != "ab" {
+		t.Errorf("Process = %q, %v, want ab, true", record.Command, ok)
+	}
+	ran = nil
+	if _, ok := (Chain{step("a", false), step("b", true)}).Process(CommandRecord{}); ok || !slices.Equal(ran, []string{"a"}) {
+		t.Errorf("Process = %v after %v, want a drop after a", ok, ran)
+	}
+	if _, ok := Chain(nil).Process(CommandRecord{}); !ok {
+		t.Error("An empty chain dropped the record")
+	}
+}
+
+// TestRedact tests replacing a pattern in the command, argv and output
+func TestRedact(t *testing.T) {
+	argv := []string{"login", "--password=hunter2"}
+	record, ok := Redact(regexp.MustCompile(`hunter\d`)).Process(CommandRecord{
+		Command:      "login --password=hunter2",
+		Argv:         argv,
+		Output:       "welcome hunter2",
+		StyledOutput: "\x1b[1mwelcome hunter2\x1b[0m",
+	})
+	if !ok {
+		t.Fatal("Redact dropped the record")
+	}
+	if record.Command != "login --password=[REDACTED]" || record.Output != "welcome [REDACTED]" ||
+		record.StyledOutput != "\x1b[1mwelcome [REDACTED]\x1b[0m" || record.Argv[1] != "--password=[REDACTED]" {
+		t.Errorf("Record = %+v, want hunter2 redacted everywhere", record)
+	}
+	if argv[1] != "--password=hunter2" {
+		t.Error("Redact changed the argv of the original record")
+	}
+}
+
+// TestExcludeCommands tests dropping records by command
+func TestExcludeCommands(t *testing.T) {
+	exclude := ExcludeCommands(regexp.MustCompile(`^(ls|pwd)$`))
+	for command, want := range map[string]bool{"ls": false, "pwd": false, "ls -l": true, "": true} {
+		if _, ok := exclude.Process(CommandRecord{Command: command}); ok != want {
+			t.Errorf("Process(%q) kept = %v, want %v", command, ok, want)
+		}
+	}
+}
+
+// TestTruncateOutput tests cutting output without splitting characters or escape sequences
+func TestTruncateOutput(t *testing.T) {
+	tests := []struct {
+		name, output, styled, wantOutput, wantStyled string
+		wantTruncated                                bool
+	}{
+		{"Short", "abc", "", "abc", "", false},
+		{"ASCII", "abcdef", "", "abcd", "", true},
+		{"Multibyte", "abcéf", "", "abc", "", true},
+		{"Styled", "ab", "\x1b[31mab\x1b[0m", "ab", "", true},
+		{"Styled cut inside sequence", "ab", "a\x1b[1mb\x1b[0m", "ab", "a", true},
+		{"Styled cut after sequence", "ab", "\x1b[1mab\x1b[0m", "ab", "\x1b[1m", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, _ := TruncateOutput(4).Process(CommandRecord{Output: tt.output, StyledOutput: tt.styled})
+			if record.Output != tt.wantOutput || record.StyledOutput != tt.wantStyled || record.OutputTruncated != tt.wantTruncated {
+				t.Errorf("Record = {%q %q %v}, want {%q %q %v}", record.Output, record.StyledOutput, record.OutputTruncated,
+					tt.wantOutput, tt.wantStyled, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+// TestProcessProcessors tests that Process runs its records through WithProcessors
+func TestProcessProcessors(t *testing.T) {
+	input := "\x1b]6973;start\x07one\x1b]6973;end\x07\x1b]6973;start\x07secret\x1b]6973;end\x07"
+	records, err := Process(context.Background(), strings.NewReader(input),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithProcessors(
+			ExcludeCommands(regexp.MustCompile(`^$`)),
+			Redact(regexp.MustCompile(`secret`))))
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if record, ok := <-records; ok {
+		t.Errorf("Got record %+v, want all dropped", record)
+	}
+
+	records, _ = Process(context.Background(), strings.NewReader(input),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithProcessors(Redact(regexp.MustCompile(`secret`))))
+	var outputs []string
+	for record := range records {
+		outputs = append(outputs, record.Output)
+	}
+	if !slices.Equal(outputs, []string{"one", "[REDACTED]"}) {
+		t.Errorf("Outputs = %q, want one and [REDACTED]", outputs)
+	}
+}
@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CommandRecord is a record of a single command and its output.
+type CommandRecord struct {
+	ID                      string           `json:"id"`
+	Session                 string           `json:"session,omitempty"`
+	Peer                    *PeerIdentity    `json:"peer,omitempty"`
+	OwnerUID                *int             `json:"owner_uid,omitempty"`
+	Host                    string           `json:"host,omitempty"`
+	Container               *ContainerInfo   `json:"container,omitempty"`
+	Kubernetes              *KubernetesInfo  `json:"kubernetes,omitempty"`
+	Command                 string           `json:"command"`
+	Output                  string           `json:"output"`
+	ReturnTimestamp         time.Time        `json:"return_timestamp"`
+	Argv                    []string         `json:"argv,omitempty"`
+	Privileged              bool             `json:"privileged,omitempty"`
+	Encoding                string           `json:"encoding,omitempty"`
+	ProgressSamples         []ProgressSample `json:"progress_samples,omitempty"`
+	Links                   []string         `json:"links,omitempty"`
+	StyledOutput            string           `json:"styled_output,omitempty"`
+	Pasted                  bool             `json:"pasted,omitempty"`
+	ProgressFramesCollapsed int              `json:"progress_frames_collapsed,omitempty"`
+	BellCount               int              `json:"bell_count,omitempty"`
+	StartTimestamp          *time.Time       `json:"start_timestamp,omitempty"`
+	DurationMs              int64            `json:"duration_ms,omitempty"`
+	ExitCode                *int             `json:"exit_code,omitempty"`
+	Cwd                     string           `json:"cwd,omitempty"`
+	OutputEvents            []CastEvent      `json:"output_events,omitempty"`
+	OutputTruncated         bool             `json:"output_truncated,omitempty"`
+	Attributes              map[string]any   `json:"attributes,omitempty"`
+	RecorderVersion         string           `json:"recorder_version,omitempty"`
+}
+
+// ProgressSample is a snapshot of the line a long-running command was last drawing.
+type ProgressSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Line      string    `json:"line"`
+}
+
+// PeerIdentity is the process that wrote an input socket session, as reported by
+// the kernel rather than claimed by the writer.
+type PeerIdentity struct {
+	PID int `json:"pid"`
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// ContainerInfo identifies the container that a command ran in.
+type ContainerInfo struct {
+	Runtime string `json:"runtime"`
+	ID      string `json:"id"`
+	Image   string `json:"image"`
+}
+
+// KubernetesInfo identifies the pod that a command ran in.
+type KubernetesInfo struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+}
+
+// CastEvent is an output event in the asciicast v2 style, encoded as
+// [time, "o", data] where time is in seconds.
+type CastEvent struct {
+	Time float64
+	Data string
+}
+
+// MarshalJSON encodes the event as an asciicast v2 event array.
+func (e CastEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{e.Time, "o", e.Data})
+}
+
+// JSONSchema describes the asciicast v2 event array, for JSON Schema generators.
+func (CastEvent) JSONSchema() map[string]any {
+	return map[string]any{
+		"type":        "array",
+		"prefixItems": []any{map[string]any{"type": "number"}, map[string]any{"const": "o"}, map[string]any{"type": "string"}},
+		"items":       false,
+	}
+}
+
+// UnmarshalJSON decodes an asciicast v2 event array.
+func (e *CastEvent) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("invalid event: want 3 fields, got %d", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// Line ending modes of RecordOptions.Newline
+const (
+	NewlineLF   = "lf"
+	NewlineCRLF = "crlf"
+	NewlineRaw  = "raw"
+)
+
+// NormalizeNewlines rewrites the line endings of output according to mode: lf turns
+// "\r\n" pairs into "\n", crlf turns lone "\n" into "\r\n", and raw leaves output
+// untouched. Lone "\r" characters are never changed.
+func NormalizeNewlines(output, mode string) string {
+	switch mode {
+	case NewlineLF:
+		return strings.ReplaceAll(output, "\r\n", "\n")
+	case NewlineCRLF:
+		return strings.ReplaceAll(strings.ReplaceAll(output, "\r\n", "\n"), "\n", "\r\n")
+	default:
+		return output
+	}
+}
+
+// RecordOptions controls the optional fields that a RecordCreator adds to each
+// CommandRecord.
+type RecordOptions struct {
+	// ParseArgv tokenizes the command into the Argv field using shell quoting rules
+	ParseArgv bool
+	// CollapseProgress replaces runs of progress frames in Output with their final frame
+	CollapseProgress bool
+	// Newline selects how line endings in Output are normalized (lf, crlf, raw)
+	Newline string
+	// CountBells adds the number of terminal bells to each record
+	CountBells bool
+	// RecorderVersion is the version of the recorder to tag each record with, if set
+	RecorderVersion string
+	// IDs is the counter that numbers records, so creators that share it never
+	// repeat an ID; nil gives the creator a counter of its own
+	IDs *atomic.Uint64
+}
+
+// RecordCreator builds CommandRecords from commands and their cleaned outputs. It
+// is safe for concurrent use.
+type RecordCreator struct {
+	opts RecordOptions
+}
+
+// NewRecordCreator returns a RecordCreator that adds the fields selected by opts.
+func NewRecordCreator(opts RecordOptions) *RecordCreator {
+	if opts.IDs == nil {
+		opts.IDs = new(atomic.Uint64)
+	}
+	return &RecordCreator{opts: opts}
+}
+
+// Create builds the record of command, which returned at returned, and its cleaned
+// output, applying the encoding, progress, newline and argv options.
+func (c *RecordCreator) Create(command string, output Output, returned time.Time) CommandRecord {
+	text, encoding := normalizeEncoding(output.Text)
+	var framesCollapsed int
+	if c.opts.CollapseProgress {
+		text, framesCollapsed = collapseProgressFrames(text)
+	}
+	styled, _ := normalizeEncoding(output.Styled)
+	text = NormalizeNewlines(text, c.opts.Newline)
+	styled = NormalizeNewlines(styled, c.opts.Newline)
+
+	record := CommandRecord{
+		ID:                      strconv.FormatUint(c.opts.IDs.Add(1), 10),
+		Command:                 command,
+		Output:                  text,
+		Encoding:                encoding,
+		ProgressSamples:         output.ProgressSamples,
+		Links:                   output.Links,
+		StyledOutput:            styled,
+		Pasted:                  output.Pasted,
+		ProgressFramesCollapsed: framesCollapsed,
+		ReturnTimestamp:         returned,
+		Privileged:              isPrivileged(command),
+		RecorderVersion:         c.opts.RecorderVersion,
+	}
+	if c.opts.CountBells {
+		record.BellCount = output.Bells
+	}
+
+	if c.opts.ParseArgv && command != "" {
+		argv, err := splitArgv(command)
+		if err != nil {
+			slog.Debug("Could not tokenize command into argv", "command", command, "error", err)
+		} else {
+			record.Argv = argv
+		}
+	}
+	return record
+}
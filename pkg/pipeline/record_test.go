@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRecordCreator tests that records get the fields selected by the options,
+// and IDs from the shared counter
+func TestRecordCreator(t *testing.T) {
+	var ids atomic.Uint64
+	returned := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	creator := NewRecordCreator(RecordOptions{ParseArgv: true, Newline: NewlineLF, CountBells: true, RecorderVersion: "1.2.3", IDs: &ids})
+
+	record := creator.Create("sudo ls 'my dir'", Output{Text: "a\r\nb", Bells: 2, Pasted: true}, returned)
+	if record.ID != "1" || record.Output != "a\nb" || record.BellCount != 2 || !record.Pasted || record.RecorderVersion != "1.2.3" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if !slices.Equal(record.Argv, []string{"sudo", "ls", "my dir"}) || !record.Privileged {
+		t.Errorf("Argv = %q, privileged = %v", record.Argv, record.Privileged)
+	}
+	if !record.ReturnTimestamp.Equal(returned) {
+		t.Errorf("ReturnTimestamp = %v, want %v", record.ReturnTimestamp, returned)
+	}
+
+	// Another creator sharing the counter continues the sequence
+	other := NewRecordCreator(RecordOptions{IDs: &ids})
+	if record := other.Create("ls", Output{Text: "\xe9t\xe9", Bells: 1}, returned); record.ID != "2" || record.Output != "été" || record.Encoding != "iso-8859-1" || record.BellCount != 0 {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if record := NewRecordCreator(RecordOptions{}).Create("ls", Output{}, returned); record.ID != "1" {
+		t.Errorf("ID = %s from a creator with its own counter, want 1", record.ID)
+	}
+}
+
+// TestNormalizeNewlines tests the line ending modes
+func TestNormalizeNewlines(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		mode     string
+		expected string
+	}{
+		{name: "LF strips CR from pairs", input: "a\r\nb\r\n", mode: NewlineLF, expected: "a\nb\n"},
+		{name: "LF keeps lone CR", input: "10%\r100%\r\n", mode: NewlineLF, expected: "10%\r100%\n"},
+		{name: "CRLF adds CR to lone LF", input: "a\nb\r\n", mode: NewlineCRLF, expected: "a\r\nb\r\n"},
+		{name: "CRLF keeps pairs", input: "a\r\nb", mode: NewlineCRLF, expected: "a\r\nb"},
+		{name: "Raw is untouched", input: "a\nb\r\nc\r", mode: NewlineRaw, expected: "a\nb\r\nc\r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeNewlines(tt.input, tt.mode); got != tt.expected {
+				t.Errorf("NormalizeNewlines(%q, %q) = %q, want %q", tt.input, tt.mode, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package pipeline
+
+import (
+	"bytes"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxScreenGrowth limits how far past the last line, or past the end of a line, a
+// single cursor movement, scroll region or blank insertion can reach. The screen has
+// no fixed size, so without it one absolute position could allocate without bound.
+const maxScreenGrowth = 1000
+
+// screen is a multi-line model of the terminal output produced by a single command.
+// Rows and columns are zero-based and relative to the start of the command's output.
+// Columns count characters rather than bytes: a UTF-8 sequence occupies one column,
+// as does each byte that is not valid UTF-8, so ISO-8859-1 output survives intact.
+// Printable bytes are inserted at the cursor (shifting the rest of the line right),
+// mirroring how a line editor echoes mid-line insertions, except after a carriage
+// return, when they overwrite the line like a progress bar redraw.
+// SGR (color) sequences kept with EditorOptions.KeepColors are stored inline as
+// zero-width entries in front of the character they style.
+type screen struct {
+	lines [][]byte
+	// crlf records which lines were terminated by "\r\n" rather than a bare "\n"
+	crlf []bool
+	row  int
+	col  int
+	// overwrite is set by a carriage return and cleared by the next newline
+	overwrite bool
+	// savedRow and savedCol hold the cursor position stored by saveCursor
+	savedRow int
+	savedCol int
+	// region is set while scrolling is restricted to rows scrollTop through scrollBottom
+	region       bool
+	scrollTop    int
+	scrollBottom int
+}
+
+// newScreen returns an empty screen with the cursor at the origin.
+func newScreen() *screen {
+	return &screen{lines: [][]byte{nil}}
+}
+
+// line returns the line under the cursor.
+func (s *screen) line() []byte {
+	return s.lines[s.row]
+}
+
+// nextChar returns the length of the character or SGR sequence at the start of b,
+// and whether it is an SGR sequence.
+func nextChar(b []byte) (int, bool) {
+	if b[0] == ESC {
+		if end := bytes.IndexByte(b, SGR); end >= 0 {
+			return end + 1, true
+		}
+	}
+	_, size := utf8.DecodeRune(b)
+	return size, false
+}
+
+// columns returns the number of columns occupied by line.
+func columns(line []byte) int {
+	n := 0
+	for offset := 0; offset < len(line); {
+		size, sgr := nextChar(line[offset:])
+		if !sgr {
+			n++
+		}
+		offset += size
+	}
+	return n
+}
+
+// columnOffset returns the byte offset in line of the character in column col,
+// after any SGR sequences in front of it, or len(line) if col is at or past the
+// end of the line.
+func columnOffset(line []byte, col int) int {
+	offset := 0
+	for offset < len(line) {
+		size, sgr := nextChar(line[offset:])
+		if !sgr {
+			if col == 0 {
+				break
+			}
+			col--
+		}
+		offset += size
+	}
+	return offset
+}
+
+// stripSGR returns line without any SGR sequences.
+func stripSGR(line []byte) []byte {
+	if bytes.IndexByte(line, ESC) < 0 {
+		return line
+	}
+	var plain []byte
+	for offset := 0; offset < len(line); {
+		size, sgr := nextChar(line[offset:])
+		if !sgr {
+			plain = append(plain, line[offset:offset+size]...)
+		}
+		offset += size
+	}
+	return plain
+}
+
+// insert inserts the single-byte character b at the cursor. See insertChar.
+func (s *screen) insert(b byte) {
+	s.insertChar([]byte{b})
+}
+
+// insertChar inserts the character encoded by char at the cursor, or replaces the
+// character under the cursor in overwrite mode, and advances the cursor. If the
+// cursor has been positioned past the end of the line, the gap is filled with spaces.
+func (s *screen) insertChar(char []byte) {
+	line := s.lines[s.row]
+	for n := columns(line); n < s.col; n++ {
+		line = append(line, ' ')
+	}
+	start := columnOffset(line, s.col)
+	if s.overwrite && start < len(line) {
+		_, size := utf8.DecodeRune(line[start:])
+		line = slices.Replace(line, start, start+size, char...)
+	} else {
+		line = slices.Insert(line, start, char...)
+	}
+	s.lines[s.row] = line
+	s.col++
+}
+
+// insertSGR inserts the SGR sequence ESC [ seq at the cursor without moving it.
+func (s *screen) insertSGR(seq []byte) {
+	line := s.lines[s.row]
+	for n := columns(line); n < s.col; n++ {
+		line = append(line, ' ')
+	}
+	sgr := append([]byte{ESC, CSI}, seq...)
+	s.lines[s.row] = slices.Insert(line, columnOffset(line, s.col), sgr...)
+}
+
+// tab advances the cursor to the next multiple of width by inserting spaces, so
+// column-aligned output keeps its alignment once tabs are gone.
+func (s *screen) tab(width int) {
+	for n := width - s.col%width; n > 0; n-- {
+		s.insert(' ')
+	}
+}
+
+// backspace deletes the character before the cursor on the current line.
+func (s *screen) backspace() {
+	line := s.lines[s.row]
+	if s.col > 0 && s.col <= columns(line) {
+		start := columnOffset(line, s.col-1)
+		_, size := utf8.DecodeRune(line[start:])
+		s.lines[s.row] = slices.Delete(line, start, start+size)
+	}
+	if s.col > 0 {
+		s.col--
+	}
+}
+
+// newline moves the cursor to the start of the next line. See index.
+func (s *screen) newline() {
+	s.index()
+	s.col = 0
+	s.overwrite = false
+}
+
+// index moves the cursor down one row, creating the line if the cursor is on the
+// last line, or scrolling the region up if the cursor is on its bottom row (IND).
+func (s *screen) index() {
+	if s.region && s.row == s.scrollBottom {
+		s.scrollUp(1)
+		return
+	}
+	s.row++
+	if s.row == len(s.lines) {
+		s.lines = append(s.lines, nil)
+	}
+}
+
+// reverseIndex moves the cursor up one row, scrolling the region down if the
+// cursor is on its top row (RI).
+func (s *screen) reverseIndex() {
+	if s.region && s.row == s.scrollTop {
+		s.scrollDown(1)
+		return
+	}
+	s.moveUp(1)
+}
+
+// setScrollRegion restricts scrolling to rows top through bottom and moves the
+// cursor to the origin (DECSTBM). An empty or invalid region removes the restriction.
+// The bottom row is capped at maxScreenGrowth past the last line.
+func (s *screen) setScrollRegion(top, bottom int) {
+	bottom = min(bottom, len(s.lines)-1+maxScreenGrowth)
+	s.region = top >= 0 && bottom > top
+	s.scrollTop, s.scrollBottom = top, bottom
+	s.moveTo(0, 0)
+}
+
+// scrollUp discards the top n lines of the scroll region and adds blank lines at
+// its bottom. Without a region it does nothing: lines scrolled off the top of the
+// terminal are still part of the command's output.
+func (s *screen) scrollUp(n int) {
+	if !s.region {
+		return
+	}
+	top, end := s.prepareScroll()
+	n = min(n, end-top)
+	s.lines = slices.Insert(slices.Delete(s.lines, top, top+n), end-n, make([][]byte, n)...)
+	s.crlf = slices.Insert(slices.Delete(s.crlf, top, top+n), end-n, make([]bool, n)...)
+}
+
+// scrollDown discards the bottom n lines of the scroll region and adds blank lines
+// at its top. Without a region it does nothing.
+func (s *screen) scrollDown(n int) {
+	if !s.region {
+		return
+	}
+	top, end := s.prepareScroll()
+	n = min(n, end-top)
+	s.lines = slices.Insert(slices.Delete(s.lines, end-n, end), top, make([][]byte, n)...)
+	s.crlf = slices.Insert(slices.Delete(s.crlf, end-n, end), top, make([]bool, n)...)
+}
+
+// prepareScroll creates the lines of the scroll region and their line ending flags,
+// and returns the region's first row and the row after its last.
+func (s *screen) prepareScroll() (int, int) {
+	for len(s.lines) <= s.scrollBottom {
+		s.lines = append(s.lines, nil)
+	}
+	for len(s.crlf) < len(s.lines) {
+		s.crlf = append(s.crlf, false)
+	}
+	return s.scrollTop, s.scrollBottom + 1
+}
+
+// crlfNewline is like newline, but records that the line was terminated by "\r\n"
+// so the terminator is preserved in the screen contents.
+func (s *screen) crlfNewline() {
+	for len(s.crlf) <= s.row {
+		s.crlf = append(s.crlf, false)
+	}
+	s.crlf[s.row] = true
+	s.newline()
+}
+
+// carriageReturn moves the cursor to the start of the line and switches to
+// overwrite mode, so that the line is redrawn rather than appended to.
+func (s *screen) carriageReturn() {
+	s.col = 0
+	s.overwrite = true
+}
+
+// moveLeft moves the cursor n columns left, stopping at the start of the line.
+func (s *screen) moveLeft(n int) {
+	s.col = max(s.col-n, 0)
+}
+
+// moveRight moves the cursor n columns right, stopping at the end of the line.
+func (s *screen) moveRight(n int) {
+	s.col = min(s.col+n, max(columns(s.line()), s.col))
+}
+
+// moveUp moves the cursor n rows up, stopping at the first line.
+func (s *screen) moveUp(n int) {
+	s.row = max(s.row-n, 0)
+}
+
+// moveDown moves the cursor n rows down, stopping at the last line.
+func (s *screen) moveDown(n int) {
+	s.row = min(s.row+n, len(s.lines)-1)
+}
+
+// lineHome moves the cursor to the start of the current line.
+func (s *screen) lineHome() {
+	s.col = 0
+}
+
+// lineEnd moves the cursor to the end of the current line.
+func (s *screen) lineEnd() {
+	s.col = columns(s.line())
+}
+
+// moveTo moves the cursor to the given row and column, creating lines as needed.
+// Both are capped at maxScreenGrowth past the current extent.
+func (s *screen) moveTo(row, col int) {
+	s.row = min(max(row, 0), len(s.lines)-1+maxScreenGrowth)
+	for len(s.lines) <= s.row {
+		s.lines = append(s.lines, nil)
+	}
+	s.col = min(max(col, 0), columns(s.lines[s.row])+maxScreenGrowth)
+}
+
+// insertBlanks inserts n spaces at the cursor, shifting the rest of the line right,
+// even in overwrite mode. The cursor does not move.
+func (s *screen) insertBlanks(n int) {
+	line := s.lines[s.row]
+	if s.col >= columns(line) {
+		// Blanks past the end of the line are invisible
+		return
+	}
+	start := columnOffset(line, s.col)
+	s.lines[s.row] = slices.Insert(line, start, bytes.Repeat([]byte{' '}, min(n, maxScreenGrowth))...)
+}
+
+// deleteChars deletes up to n characters at the cursor, shifting the rest of the
+// line left. The cursor does not move.
+func (s *screen) deleteChars(n int) {
+	line := s.lines[s.row]
+	for ; n > 0; n-- {
+		start := columnOffset(line, s.col)
+		if start == len(line) {
+			break
+		}
+		_, size := utf8.DecodeRune(line[start:])
+		line = slices.Delete(line, start, start+size)
+	}
+	s.lines[s.row] = line
+}
+
+// killLineBackward deletes everything from the start of the line up to the cursor
+// and moves the cursor to the start of the line, like readline's Ctrl-U.
+func (s *screen) killLineBackward() {
+	n := s.col
+	s.col = 0
+	s.deleteChars(n)
+}
+
+// killWord deletes the whitespace-delimited word before the cursor along with any
+// whitespace between it and the cursor, like readline's Ctrl-W.
+func (s *screen) killWord() {
+	chars := []rune(string(stripSGR(s.lines[s.row])))
+	end := min(s.col, len(chars))
+	start := end
+	for start > 0 && unicode.IsSpace(chars[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(chars[start-1]) {
+		start--
+	}
+	s.col = start
+	s.deleteChars(end - start)
+}
+
+// saveCursor stores the cursor position for a later restoreCursor (DECSC, CSI s).
+func (s *screen) saveCursor() {
+	s.savedRow, s.savedCol = s.row, s.col
+}
+
+// restoreCursor moves the cursor to the position stored by saveCursor, or to the
+// origin if none was stored (DECRC, CSI u).
+func (s *screen) restoreCursor() {
+	s.moveTo(s.savedRow, s.savedCol)
+}
+
+// eraseLine implements CSI K. Mode 0 erases from the cursor to the end of the line,
+// mode 1 blanks from the start of the line through the cursor, and mode 2 erases
+// the whole line. The cursor does not move.
+func (s *screen) eraseLine(mode int) {
+	line := s.lines[s.row]
+	switch mode {
+	case 0:
+		s.lines[s.row] = line[:columnOffset(line, s.col)]
+	case 1:
+		blanked := min(s.col+1, columns(line))
+		rest := line[columnOffset(line, blanked):]
+		s.lines[s.row] = append(bytes.Repeat([]byte{' '}, blanked), rest...)
+	case 2:
+		s.lines[s.row] = nil
+	}
+}
+
+// eraseDisplay implements CSI J. Mode 0 erases from the cursor to the end of the
+// screen, mode 1 erases from the start of the screen through the cursor, and modes
+// 2 and 3 erase the whole screen. The cursor does not move.
+func (s *screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		s.lines = s.lines[:s.row+1]
+		s.crlf = s.crlf[:min(s.row, len(s.crlf))]
+	case 1:
+		for i := 0; i < s.row; i++ {
+			s.lines[i] = nil
+		}
+		s.eraseLine(1)
+	case 2, 3:
+		s.lines = make([][]byte, s.row+1)
+		s.crlf = nil
+	}
+}
+
+// progressLine returns the line a command is currently drawing: the line under the
+// cursor, or the last non-blank line above it if the cursor is on a blank line.
+func (s *screen) progressLine() string {
+	for row := s.row; row >= 0; row-- {
+		if line := bytes.TrimSpace(stripSGR(s.lines[row])); len(line) > 0 {
+			return string(line)
+		}
+	}
+	return ""
+}
+
+// String returns the screen contents with lines joined by their original
+// "\n" or "\r\n" terminators. SGR sequences are omitted.
+func (s *screen) String() string {
+	return s.render(false)
+}
+
+// styledString is like String, but keeps SGR sequences.
+func (s *screen) styledString() string {
+	return s.render(true)
+}
+
+// render returns the screen contents, with or without SGR sequences.
+func (s *screen) render(styled bool) string {
+	var buf bytes.Buffer
+	for i, line := range s.lines {
+		if styled {
+			buf.Write(line)
+		} else {
+			buf.Write(stripSGR(line))
+		}
+		if i == len(s.lines)-1 {
+			break
+		}
+		if i < len(s.crlf) && s.crlf[i] {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
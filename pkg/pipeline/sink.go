@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// RecordSink is where records go, such as a file, an HTTP endpoint or a message
+// queue. Emit delivers a record, or buffers it; Flush delivers what is buffered;
+// Close flushes the sink and releases it.
+type RecordSink interface {
+	Emit(record CommandRecord) error
+	Flush() error
+	Close() error
+}
+
+// JSONSink is a RecordSink that writes each record as a line of JSON, the format
+// that script2json writes.
+type JSONSink struct {
+	w *bufio.Writer
+	// closer is the writer, if Close should close it
+	closer io.Closer
+}
+
+// NewJSONSink returns a JSONSink that buffers records until Flush and then writes
+// them to w. Close closes w if it is an io.Closer.
+func NewJSONSink(w io.Writer) *JSONSink {
+	s := &JSONSink{w: bufio.NewWriter(w)}
+	s.closer, _ = w.(io.Closer)
+	return s
+}
+
+// Emit buffers record as a line of JSON.
+func (s *JSONSink) Emit(record CommandRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return &Error{Stage: StageRecord, Err: err}
+	}
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// Flush writes the buffered records.
+func (s *JSONSink) Flush() error {
+	return s.w.Flush()
+}
+
+// Close flushes the sink and closes its writer.
+func (s *JSONSink) Close() error {
+	err := s.Flush()
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Deliver emits the records from records to sink until the channel is closed, then
+// closes sink. It flushes the sink whenever no more records are waiting, so records
+// are not held back while the pipeline is idle. It stops at the first error, which
+// it returns as an *Error: of StageSink, unless the sink said otherwise.
+func Deliver(records <-chan CommandRecord, sink RecordSink) error {
+	for record := range records {
+		if err := sink.Emit(record); err != nil {
+			sink.Close()
+			return sinkError(err)
+		}
+		if len(records) == 0 {
+			if err := sink.Flush(); err != nil {
+				sink.Close()
+				return sinkError(err)
+			}
+		}
+	}
+	return sinkError(sink.Close())
+}
+
+// sinkError returns err as an *Error of StageSink, unless it is nil or an *Error
+// already.
+func sinkError(err error) error {
+	var pipelineErr *Error
+	if err == nil || errors.As(err, &pipelineErr) {
+		return err
+	}
+	return &Error{Stage: StageSink, Err: err}
+}
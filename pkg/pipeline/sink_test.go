@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// closingBuffer is a bytes.Buffer that records whether it was closed.
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// TestJSONSink tests that records are buffered until Flush and Close closes the writer
+func TestJSONSink(t *testing.T) {
+	var out closingBuffer
+	sink := NewJSONSink(&out)
+	if err := sink.Emit(CommandRecord{ID: "1", Command: "ls"}); err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Emit wrote %q before Flush", out.String())
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), `{"id":"1","command":"ls",`) || !strings.HasSuffix(out.String(), "}\n") {
+		t.Errorf("Output = %q, want a JSON line", out.String())
+	}
+	if err := sink.Close(); err != nil || !out.closed {
+		t.Errorf("Close = %v, closed = %v", err, out.closed)
+	}
+}
+
+// failingSink is a RecordSink whose Emit fails after ok records.
+type failingSink struct {
+	ok, emitted, flushes int
+	closed               bool
+}
+
+func (s *failingSink) Emit(CommandRecord) error {
+	if s.emitted == s.ok {
+		return errors.New("sink down")
+	}
+	s.emitted++
+	return nil
+}
+
+func (s *failingSink) Flush() error {
+	s.flushes++
+	return nil
+}
+
+func (s *failingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// TestDeliver tests delivering a channel of records to a sink
+func TestDeliver(t *testing.T) {
+	records := make(chan CommandRecord, 3)
+	for _, id := range []string{"1", "2", "3"} {
+		records <- CommandRecord{ID: id}
+	}
+	close(records)
+	sink := &failingSink{ok: 3}
+	if err := Deliver(records, sink); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if sink.emitted != 3 || sink.flushes != 1 || !sink.closed {
+		t.Errorf("Sink = %+v, want 3 records, one flush once they ran out, and closed", sink)
+	}
+
+	records = make(chan CommandRecord, 2)
+	records <- CommandRecord{ID: "1"}
+	records <- CommandRecord{ID: "2"}
+	close(records)
+	sink = &failingSink{ok: 1}
+	err := Deliver(records, sink)
+	var pipelineErr *Error
+	if !errors.As(err, &pipelineErr) || pipelineErr.Stage != StageSink || !sink.closed {
+		t.Errorf("Deliver = %v, closed = %v, want the sink's error as a sink stage Error and closed", err, sink.closed)
+	}
+}
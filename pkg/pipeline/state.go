@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionState is where a session is in recording a command.
+type SessionState int32
+
+// The states of a SessionMachine.
+const (
+	// StateIdle is between commands: the terminal's bytes aren't part of an output
+	StateIdle SessionState = iota
+	// StateRecording is while a command runs: its bytes go to the editor
+	StateRecording
+	// StateFlushing is after a command returned, until the editor has turned its
+	// output into an Output
+	StateFlushing
+)
+
+// String returns the name of the state, as the status endpoints report it.
+func (s SessionState) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRecording:
+		return "recording"
+	case StateFlushing:
+		return "flushing"
+	default:
+		return "unknown"
+	}
+}
+
+// SessionMachine is the state of a session, which moves Idle → Recording →
+// Flushing → Idle as commands start, return and are flushed, or to Recording
+// straight from Flushing when the next command starts before the last one has been
+// flushed. Reset goes back to Idle from anywhere. A start while recording or a stop
+// while not recording is an illegal transition: it is logged and leaves the state
+// as it was, and the caller learns of it from the result. Transitions are safe from
+// any goroutine; State is a single atomic load, so it suits a check per byte. The
+// zero value is an idle, unnamed session that logs to slog.Default.
+type SessionMachine struct {
+	name   string
+	logger *slog.Logger
+
+	// mu serializes transitions, so since always belongs to state
+	mu    sync.Mutex
+	state atomic.Int32
+	// since is when the session entered its state, and started when it last
+	// started recording, in Unix nanoseconds
+	since, started atomic.Int64
+}
+
+// NewSessionMachine returns an idle session named name, for the logs, that logs
+// illegal transitions to logger, or slog.Default if it is nil.
+func NewSessionMachine(name string, logger *slog.Logger) *SessionMachine {
+	return &SessionMachine{name: name, logger: logger}
+}
+
+// State returns the session's state.
+func (m *SessionMachine) State() SessionState {
+	return SessionState(m.state.Load())
+}
+
+// Since returns when the session entered its state, or the zero time if it never
+// left Idle.
+func (m *SessionMachine) Since() time.Time {
+	if since := m.since.Load(); since != 0 {
+		return time.Unix(0, since)
+	}
+	return time.Time{}
+}
+
+// StartedAt returns when the session last started recording, which is when its
+// current or last command started, or the zero time if it never has.
+func (m *SessionMachine) StartedAt() time.Time {
+	if started := m.started.Load(); started != 0 {
+		return time.Unix(0, started)
+	}
+	return time.Time{}
+}
+
+// Start moves the session to Recording as a command starts, and reports whether it
+// wasn't recording already.
+func (m *SessionMachine) Start() bool {
+	return m.transition("start", StateRecording, StateIdle, StateFlushing)
+}
+
+// Stop moves the session to Flushing as its command returns, and reports whether
+// it was recording.
+func (m *SessionMachine) Stop() bool {
+	return m.transition("stop", StateFlushing, StateRecording)
+}
+
+// Flushed moves the session back to Idle once the editor has flushed the output,
+// and reports whether it was flushing. The session may have started the next
+// command or been reset in the meantime, which isn't illegal, so Flushed never logs.
+func (m *SessionMachine) Flushed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.State() != StateFlushing {
+		return false
+	}
+	m.set(StateIdle)
+	return true
+}
+
+// Reset moves the session to Idle from any state, such as to recover from a desync
+// or to shut down, and returns the state it was in.
+func (m *SessionMachine) Reset() SessionState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from := m.State()
+	if from != StateIdle {
+		m.set(StateIdle)
+	}
+	return from
+}
+
+// transition moves the session to state to on event if it is in one of from, and
+// logs the event as illegal otherwise.
+func (m *SessionMachine) transition(event string, to SessionState, from ...SessionState) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.State()
+	for _, legal := range from {
+		if current == legal {
+			m.set(to)
+			return true
+		}
+	}
+	logger := m.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Warn("Illegal session state transition", "session", m.name, "state", current.String(), "event", event)
+	return false
+}
+
+// set enters state, with mu held.
+func (m *SessionMachine) set(state SessionState) {
+	now := time.Now().UnixNano()
+	m.since.Store(now)
+	if state == StateRecording {
+		m.started.Store(now)
+	}
+	m.state.Store(int32(state))
+}
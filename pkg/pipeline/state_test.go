@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestSessionMachine tests the legal transitions of a session and logging the
+// illegal ones
+func TestSessionMachine(t *testing.T) {
+	var logs bytes.Buffer
+	m := NewSessionMachine("build", slog.New(slog.NewTextHandler(&logs, nil)))
+	if m.State() != StateIdle || !m.StartedAt().IsZero() {
+		t.Fatalf("New machine is %v, started at %v, want idle and never started", m.State(), m.StartedAt())
+	}
+
+	steps := []struct {
+		event string
+		do    func() bool
+		want  bool
+		state SessionState
+	}{
+		{"start", m.Start, true, StateRecording},
+		{"start", m.Start, false, StateRecording},
+		{"stop", m.Stop, true, StateFlushing},
+		{"stop", m.Stop, false, StateFlushing},
+		// The next command may start before the last one is flushed
+		{"start", m.Start, true, StateRecording},
+		{"flushed", m.Flushed, false, StateRecording},
+		{"stop", m.Stop, true, StateFlushing},
+		{"flushed", m.Flushed, true, StateIdle},
+		{"flushed", m.Flushed, false, StateIdle},
+		{"stop", m.Stop, false, StateIdle},
+	}
+	for i, step := range steps {
+		if got := step.do(); got != step.want || m.State() != step.state {
+			t.Errorf("Step %d: %s = %v in %v, want %v in %v", i, step.event, got, m.State(), step.want, step.state)
+		}
+	}
+	if illegal := strings.Count(logs.String(), "Illegal session state transition"); illegal != 3 {
+		t.Errorf("Logged %d illegal transitions, want 3:\n%s", illegal, logs.String())
+	}
+	if !strings.Contains(logs.String(), "session=build state=idle event=stop") {
+		t.Errorf("Logs = %s, want the stop while idle", logs.String())
+	}
+
+	m.Start()
+	started := m.StartedAt()
+	m.Stop()
+	if m.StartedAt() != started || m.Since().Before(started) {
+		t.Errorf("StartedAt = %v, Since = %v, want the start kept past the stop", m.StartedAt(), m.Since())
+	}
+	if from := m.Reset(); from != StateFlushing || m.State() != StateIdle {
+		t.Errorf("Reset from %v left %v, want from flushing to idle", from, m.State())
+	}
+}
+
+// TestSessionStateString tests the names of the states
+func TestSessionStateString(t *testing.T) {
+	for state, want := range map[SessionState]string{StateIdle: "idle", StateRecording: "recording", StateFlushing: "flushing", 7: "unknown"} {
+		if got := state.String(); got != want {
+			t.Errorf("SessionState(%d) = %q, want %q", state, got, want)
+		}
+	}
+}
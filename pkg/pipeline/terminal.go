@@ -0,0 +1,487 @@
+package pipeline
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Terminal emulation modes of EditorOptions.TermEmulation
+const (
+	TermEmulationHeuristic = "heuristic"
+	TermEmulationFull      = "full"
+)
+
+// Default size of the emulated terminal
+const (
+	DefaultTermCols = 80
+	DefaultTermRows = 24
+)
+
+// terminal is a VT100/xterm emulator with a fixed-size grid, used by
+// TermEmulationFull as an alternative to the heuristic screen model.
+// It behaves like a real terminal: printable characters overwrite cells and wrap
+// at the right margin, backspace only moves the cursor, and line feeds scroll the
+// screen once the cursor reaches the bottom. A command's output is derived from
+// the difference between the empty screen it started with and the final state:
+// the lines that scrolled off the top followed by the non-blank part of the screen.
+//
+// Cells hold the bytes of one character, so output that is not valid UTF-8 is left
+// for RecordCreator's encoding detection, as with the heuristic model. The byte
+// stream is split by an EscapeParser, so both models resynchronize on interrupted
+// and malformed sequences and drop mouse reports the same way.
+type terminal struct {
+	cols, rows int
+	tabWidth   int
+	grid       [][]string
+	row, col   int
+	// wrapPending is set after a character is written in the last column; the
+	// next character wraps to the following line (deferred wrap, like xterm)
+	wrapPending bool
+	insertMode  bool
+	// scrollTop and scrollBottom bound the scrolling region (inclusive)
+	scrollTop, scrollBottom int
+	savedRow, savedCol      int
+	// mainGrid holds the main screen while the alternate screen is active
+	mainGrid [][]string
+	inAlt    bool
+	// keepAlt adds the alternate screen to the main screen when it is left
+	// (AltScreenKeep)
+	keepAlt bool
+	// scrollback holds the lines that scrolled off the top of the main screen
+	scrollback []string
+
+	parser *EscapeParser
+	links  []string
+	pasted bool
+	bells  int
+}
+
+// newTerminal returns a blank terminal of the given size with the cursor at the
+// origin. Abandoned sequences are logged to logger.
+func newTerminal(cols, rows, tabWidth int, logger *slog.Logger) *terminal {
+	t := &terminal{cols: cols, rows: rows, tabWidth: tabWidth, parser: NewEscapeParser(logger)}
+	t.grid = t.blankGrid()
+	t.scrollBottom = rows - 1
+	t.parser.Print = t.print
+	t.parser.Execute = t.execute
+	t.parser.EscDispatch = t.escDispatch
+	t.parser.CSIDispatch = t.csi
+	t.parser.OSCDispatch = t.oscDispatch
+	return t
+}
+
+func (t *terminal) blankGrid() [][]string {
+	grid := make([][]string, t.rows)
+	for i := range grid {
+		grid[i] = t.blankRow()
+	}
+	return grid
+}
+
+func (t *terminal) blankRow() []string {
+	return make([]string, t.cols)
+}
+
+// end ends the stream at the end of a command: an incomplete UTF-8 character is
+// delivered as single bytes and a sequence in progress is abandoned.
+func (t *terminal) end() {
+	t.parser.End()
+}
+
+// write feeds a single byte of terminal output to the emulator.
+func (t *terminal) write(b byte) {
+	t.parser.Advance(b)
+}
+
+// print writes a printable character at the cursor.
+func (t *terminal) print(char []byte) {
+	t.put(string(char))
+}
+
+// execute performs a control character. Others, such as DEL and the CAN and SUB
+// that abandon a sequence, have no visible effect.
+func (t *terminal) execute(b byte) {
+	switch b {
+	case '\r':
+		t.col = 0
+		t.wrapPending = false
+	case '\n', '\v', '\f':
+		t.lineFeed()
+	case BEL:
+		if !t.ignoring() {
+			t.bells++
+		}
+	case BACKSPACE:
+		if t.col > 0 {
+			t.col--
+		}
+		t.wrapPending = false
+	case TAB:
+		t.col = min((t.col/t.tabWidth+1)*t.tabWidth, t.cols-1)
+		t.wrapPending = false
+	}
+}
+
+// put writes a character at the cursor and advances it, wrapping at the right margin.
+func (t *terminal) put(char string) {
+	if t.wrapPending {
+		t.col = 0
+		t.lineFeed()
+		t.wrapPending = false
+	}
+	line := t.grid[t.row]
+	if t.insertMode {
+		copy(line[t.col+1:], line[t.col:])
+	}
+	line[t.col] = char
+	if t.col == t.cols-1 {
+		t.wrapPending = true
+	} else {
+		t.col++
+	}
+}
+
+// lineFeed moves the cursor down one row, scrolling the region at its bottom row.
+func (t *terminal) lineFeed() {
+	if t.row == t.scrollBottom {
+		t.scrollUp(1)
+	} else if t.row < t.rows-1 {
+		t.row++
+	}
+}
+
+// scrollUp scrolls the region up n lines. Lines leaving the top of the main screen
+// are kept in the scrollback, since they are part of the command's output.
+func (t *terminal) scrollUp(n int) {
+	t.deleteLines(t.scrollTop, n, t.scrollTop == 0 && !t.inAlt)
+}
+
+// scrollDown scrolls the region down n lines, discarding lines at its bottom.
+func (t *terminal) scrollDown(n int) {
+	t.insertLines(t.scrollTop, n)
+}
+
+// deleteLines removes n lines starting at row, which must be inside the scrolling
+// region, and adds blank lines at the bottom of the region. If keep is set, the
+// removed lines are added to the scrollback.
+func (t *terminal) deleteLines(row, n int, keep bool) {
+	n = min(n, t.scrollBottom-row+1)
+	if keep {
+		for _, line := range t.grid[row : row+n] {
+			t.scrollback = append(t.scrollback, renderRow(line))
+		}
+	}
+	t.grid = slices.Delete(t.grid, row, row+n)
+	for i := 0; i < n; i++ {
+		t.grid = slices.Insert(t.grid, t.scrollBottom-n+1+i, t.blankRow())
+	}
+}
+
+// insertLines inserts n blank lines at row, which must be inside the scrolling
+// region, discarding lines pushed past the bottom of the region.
+func (t *terminal) insertLines(row, n int) {
+	n = min(n, t.scrollBottom-row+1)
+	t.grid = slices.Delete(t.grid, t.scrollBottom-n+1, t.scrollBottom+1)
+	for i := 0; i < n; i++ {
+		t.grid = slices.Insert(t.grid, row, t.blankRow())
+	}
+}
+
+// moveTo moves the cursor to row and col, clamped to the screen.
+func (t *terminal) moveTo(row, col int) {
+	t.row = max(0, min(row, t.rows-1))
+	t.col = max(0, min(col, t.cols-1))
+	t.wrapPending = false
+}
+
+// escDispatch performs a complete escape sequence. Those with intermediates, such
+// as ESC ( B for charset selection, have no effect.
+func (t *terminal) escDispatch(intermediates []byte, final byte) {
+	if len(intermediates) > 0 {
+		return
+	}
+	switch final {
+	case DECSC:
+		t.savedRow, t.savedCol = t.row, t.col
+	case DECRC:
+		t.moveTo(t.savedRow, t.savedCol)
+	case IND:
+		t.lineFeed()
+	case 'E': // NEL: next line
+		t.col = 0
+		t.lineFeed()
+	case RI:
+		if t.row == t.scrollTop {
+			t.scrollDown(1)
+		} else if t.row > 0 {
+			t.row--
+		}
+	case 'c': // RIS: full reset, keeping what has already been output
+		reset := newTerminal(t.cols, t.rows, t.tabWidth, nil)
+		reset.keepAlt, reset.parser = t.keepAlt, t.parser
+		reset.scrollback, reset.links, reset.pasted, reset.bells = t.scrollback, t.links, t.pasted, t.bells
+		*t = *reset
+	}
+}
+
+// oscDispatch handles a complete OSC string, collecting OSC 8 hyperlink targets.
+func (t *terminal) oscDispatch(payload []byte) {
+	if link := oscHyperlink(payload); link != "" && !t.ignoring() && !slices.Contains(t.links, link) {
+		t.links = append(t.links, link)
+	}
+}
+
+// csi executes a complete CSI sequence (parameters and final byte).
+func (t *terminal) csi(seq []byte) {
+	final := seq[len(seq)-1]
+	params := csiParams(seq)
+	// Counts are at least 1, and no larger than the screen, so moves can't overflow
+	n := max(1, min(csiParam(params, 0, 1), max(t.cols, t.rows)))
+
+	if strings.IndexByte("?<=>", seq[0]) >= 0 {
+		// Of the private sequences, only the alternate screen modes affect the output
+		if seq[0] == '?' && (final == 'h' || final == 'l') {
+			for _, mode := range params {
+				if mode == 1049 || mode == 1047 || mode == 47 {
+					t.setAltScreen(final == 'h')
+				}
+			}
+		}
+		return
+	}
+	if string(seq) == PASTE_START && !t.ignoring() {
+		t.pasted = true
+		return
+	}
+
+	switch final {
+	case CURSOR_UP:
+		// Vertical moves stop at the scrolling region's margins when starting inside it
+		top := 0
+		if t.row >= t.scrollTop {
+			top = t.scrollTop
+		}
+		t.moveTo(max(t.row-n, top), t.col)
+	case CURSOR_DOWN:
+		bottom := t.rows - 1
+		if t.row <= t.scrollBottom {
+			bottom = t.scrollBottom
+		}
+		t.moveTo(min(t.row+n, bottom), t.col)
+	case ARROW_RIGHT:
+		t.moveTo(t.row, t.col+n)
+	case ARROW_LEFT:
+		t.moveTo(t.row, t.col-n)
+	case 'E': // CNL: cursor next line
+		t.moveTo(t.row+n, 0)
+	case 'F': // CPL: cursor previous line
+		t.moveTo(t.row-n, 0)
+	case 'G', '`': // CHA, HPA: cursor column
+		t.moveTo(t.row, n-1)
+	case 'd': // VPA: cursor row
+		t.moveTo(n-1, t.col)
+	case CURSOR_POSITION, CURSOR_POSITION_ALT:
+		t.moveTo(csiParam(params, 0, 1)-1, csiParam(params, 1, 1)-1)
+	case ERASE_IN_LINE:
+		t.eraseLine(csiParam(params, 0, 0))
+	case ERASE_IN_DISPLAY:
+		t.eraseDisplay(csiParam(params, 0, 0))
+	case 'X': // ECH: erase characters
+		n = min(n, t.cols-t.col)
+		clear(t.grid[t.row][t.col : t.col+n])
+	case '@': // ICH: insert blank characters
+		line := t.grid[t.row]
+		n = min(n, t.cols-t.col)
+		copy(line[t.col+n:], line[t.col:])
+		clear(line[t.col : t.col+n])
+	case 'P': // DCH: delete characters
+		line := t.grid[t.row]
+		n = min(n, t.cols-t.col)
+		copy(line[t.col:], line[t.col+n:])
+		clear(line[t.cols-n:])
+	case 'L', 'M': // IL, DL: insert or delete lines within the scrolling region
+		if t.row < t.scrollTop || t.row > t.scrollBottom {
+			break
+		}
+		if final == 'L' {
+			t.insertLines(t.row, n)
+		} else {
+			t.deleteLines(t.row, n, false)
+		}
+		t.col = 0
+	case SCROLL_UP:
+		t.scrollUp(n)
+	case SCROLL_DOWN:
+		t.scrollDown(n)
+	case SET_SCROLL_REGION:
+		top, bottom := csiParam(params, 0, 1)-1, csiParam(params, 1, t.rows)-1
+		if top < bottom && bottom < t.rows {
+			t.scrollTop, t.scrollBottom = top, bottom
+			t.moveTo(0, 0)
+		}
+	case SAVE_CURSOR:
+		if len(seq) == 1 {
+			t.savedRow, t.savedCol = t.row, t.col
+		}
+	case RESTORE_CURSOR:
+		if len(seq) == 1 {
+			t.moveTo(t.savedRow, t.savedCol)
+		}
+	case 'h', 'l':
+		if slices.Contains(params, 4) { // IRM: insert mode
+			t.insertMode = final == 'h'
+		}
+	}
+}
+
+// eraseLine implements CSI K (0: to end of line, 1: to cursor, 2: whole line).
+func (t *terminal) eraseLine(mode int) {
+	line := t.grid[t.row]
+	switch mode {
+	case 0:
+		clear(line[t.col:])
+	case 1:
+		clear(line[:t.col+1])
+	case 2:
+		clear(line)
+	}
+}
+
+// eraseDisplay implements CSI J (0: to end of screen, 1: to cursor, 2 and 3: all).
+// Erasing never removes lines from the scrollback.
+func (t *terminal) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.eraseLine(0)
+		for _, line := range t.grid[t.row+1:] {
+			clear(line)
+		}
+	case 1:
+		t.eraseLine(1)
+		for _, line := range t.grid[:t.row] {
+			clear(line)
+		}
+	case 2, 3:
+		for _, line := range t.grid {
+			clear(line)
+		}
+	}
+}
+
+// setAltScreen switches to or from the alternate screen, saving and restoring the
+// cursor and main screen like xterm's mode 1049.
+func (t *terminal) setAltScreen(on bool) {
+	if on == t.inAlt {
+		return
+	}
+	if on {
+		t.savedRow, t.savedCol = t.row, t.col
+		t.mainGrid = t.grid
+		t.grid = t.blankGrid()
+	} else {
+		alt := t.grid
+		t.grid = t.mainGrid
+		t.mainGrid = nil
+		t.moveTo(t.savedRow, t.savedCol)
+		if t.keepAlt {
+			t.keepGrid(alt)
+		}
+	}
+	t.inAlt = on
+}
+
+// ignoring reports whether output is being ignored because a full-screen program
+// has the alternate screen.
+func (t *terminal) ignoring() bool {
+	return t.inAlt && !t.keepAlt
+}
+
+// keepGrid writes the non-blank rows of the alternate screen grid to the screen on
+// lines of their own, starting at the cursor.
+func (t *terminal) keepGrid(grid [][]string) {
+	rows := trimBlankRows(grid)
+	if len(rows) > 0 && t.col > 0 {
+		t.col = 0
+		t.lineFeed()
+	}
+	for _, row := range rows {
+		for _, cell := range row {
+			t.put(cell)
+		}
+		t.col, t.wrapPending = 0, false
+		t.lineFeed()
+	}
+}
+
+// trimBlankRows returns the rows of grid from the first to the last non-blank one,
+// each without its trailing blank cells.
+func trimBlankRows(grid [][]string) [][]string {
+	var rows [][]string
+	for _, row := range grid {
+		end := len(row)
+		for end > 0 && (row[end-1] == "" || row[end-1] == " ") {
+			end--
+		}
+		rows = append(rows, row[:end])
+	}
+	for len(rows) > 0 && len(rows[0]) == 0 {
+		rows = rows[1:]
+	}
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows
+}
+
+// renderRow returns the contents of a row with blank cells as spaces and trailing
+// blanks removed.
+func renderRow(row []string) string {
+	var sb strings.Builder
+	for _, cell := range row {
+		if cell == "" {
+			cell = " "
+		}
+		sb.WriteString(cell)
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// String returns the command's output: the scrollback followed by the main screen,
+// without trailing blank lines, joined by "\n".
+func (t *terminal) String() string {
+	grid := t.grid
+	if t.inAlt {
+		grid = t.mainGrid
+	}
+	lines := slices.Clone(t.scrollback)
+	for _, row := range grid {
+		lines = append(lines, renderRow(row))
+	}
+	if t.inAlt && t.keepAlt {
+		// The command ends on the alternate screen, whose contents so far are kept
+		for len(lines) > 0 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		for _, row := range trimBlankRows(t.grid) {
+			lines = append(lines, renderRow(row))
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// progressLine returns the line under the cursor, or the last non-blank line above it.
+func (t *terminal) progressLine() string {
+	if t.inAlt {
+		return ""
+	}
+	for row := t.row; row >= 0; row-- {
+		if line := strings.TrimSpace(renderRow(t.grid[row])); line != "" {
+			return line
+		}
+	}
+	return ""
+}
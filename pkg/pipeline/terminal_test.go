@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestTerminal tests output reconstruction by the full terminal emulator
+func TestTerminal(t *testing.T) {
+	tests := []struct {
+		name     string
+		cols     int
+		rows     int
+		input    string
+		expected string
+	}{
+		{name: "Lines", input: "one\r\ntwo\r\n", expected: "one\ntwo"},
+		{name: "Line feed keeps column", input: "ab\ncd", expected: "ab\n  cd"},
+		{name: "Wrap at right margin", cols: 10, input: "0123456789abc", expected: "0123456789\nabc"},
+		{name: "Exact fit does not wrap early", cols: 10, input: "0123456789\r\nx", expected: "0123456789\nx"},
+		{name: "Scrolled lines are kept", rows: 3, input: "1\r\n2\r\n3\r\n4\r\n5", expected: "1\n2\n3\n4\n5"},
+		{name: "Backspace only moves the cursor", input: "abc\b\bX", expected: "aXc"},
+		{name: "Shell-style rubout", input: "abc\b \b", expected: "ab"},
+		{name: "Progress bar", input: "10%\r50%\r100%", expected: "100%"},
+		{name: "Clear screen", input: "old\r\nlines\x1b[H\x1b[2Jnew", expected: "new"},
+		{name: "Erase line", input: "Working...\r\x1b[KDone", expected: "Done"},
+		{name: "Alternate screen", input: "before\r\n\x1b[?1049hvim\x1b[10;1Hstuff\x1b[?1049lafter", expected: "before\nafter"},
+		{name: "Delete character", input: "abcd\x1b[3G\x1b[P", expected: "abd"},
+		{name: "Insert character", input: "abd\x1b[3G\x1b[@c", expected: "abcd"},
+		{name: "Insert mode", input: "abd\x1b[3G\x1b[4hc\x1b[4l", expected: "abcd"},
+		{name: "Insert line", input: "a\r\nb\x1b[1;1H\x1b[L", expected: "\na\nb"},
+		{name: "Delete line", input: "a\r\nb\r\nc\x1b[1;1H\x1b[1M", expected: "b\nc"},
+		{name: "Scroll region discards lines", rows: 5, input: "header\x1b[2;3r\x1b[2;1Hone\r\ntwo\r\nthree", expected: "header\ntwo\nthree"},
+		{name: "Cursor position is clamped", cols: 5, rows: 3, input: "\x1b[99;99Hx", expected: "\n\n    x"},
+		{name: "Tab", input: "a\tb", expected: "a       b"},
+		{name: "Save and restore cursor", input: "ab\x1b7\r\nnext\x1b8c", expected: "abc\nnext"},
+		{name: "Colors and charsets are stripped", input: "\x1b(B\x1b[1;31merror\x1b[0m", expected: "error"},
+		{name: "UTF-8 characters take one cell", input: "d\xc3\xa9j\xc3\xa0\b\bX", expected: "d\xc3\xa9X\xc3\xa0"},
+		{name: "Invalid bytes are kept", input: "caf\xe9", expected: "caf\xe9"},
+		{name: "SGR mouse reports are stripped", input: "a\x1b[<0;3;1Mb\x1b[<0;3;1m", expected: "ab"},
+		{name: "Legacy mouse reports are stripped", input: "ab\x1b[M !!cd", expected: "abcd"},
+		{name: "Sixel images are stripped", input: "a\x1bPq#0;2;0;0;0#0~~@@-\x1b\\b", expected: "ab"},
+		{name: "iTerm2 and kitty images are stripped", input: "a\x1b]1337;File=inline=1:AAAA\x07b\x1b_Ga=T;AAAA\x1b\\c", expected: "abc"},
+		{name: "Overlong CSI is ignored to its final byte", input: "\x1b[" + strings.Repeat(";", MaxCSILength) + "1mok", expected: "ok"},
+		{name: "Negative count of DCH is dropped", input: "abcd\x1b[2G\x1b[-5Pe", expected: "aecd"},
+		{name: "Negative count of ICH is dropped", input: "abcd\x1b[2G\x1b[-5@e", expected: "aecd"},
+		{name: "Negative count of ECH is dropped", input: "abcd\x1b[2G\x1b[-5Xe", expected: "aecd"},
+		{name: "Huge count of DCH deletes to the margin", input: "abcd\x1b[2G\x1b[99999999999P", expected: "a"},
+		{name: "Huge count of ICH shifts out the line", input: "abcd\x1b[2G\x1b[99999999@e", expected: "ae"},
+		{name: "Huge count of ECH erases to the margin", input: "abcd\x1b[2G\x1b[99999999Xe", expected: "ae"},
+		{name: "Count past the int range moves one step", input: "abcd\x1b[99999999999999999999999D!", expected: "abc!"},
+		{name: "Parameter after intermediate is malformed", input: "ab\x1b[ 1Dc", expected: "abc"},
+		{name: "ESC restarts an interrupted CSI", input: "ab\x1b[12\x1b[Dcd", expected: "acd"},
+		{name: "CAN abandons a CSI", input: "abc\x1b[1\x18def", expected: "abcdef"},
+		{name: "SUB abandons an OSC", input: "ab\x1b]0;title\x1acd", expected: "abcd"},
+		{name: "RIS keeps parsing", input: "old\x1bc\x1b[31mnew", expected: "new"},
+		{name: "8-bit CSI", input: "\x9b31mred\x9b0m \xc4\x9b", expected: "red \xc4\x9b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			term := newTerminal(cmp.Or(tt.cols, 20), cmp.Or(tt.rows, 5), DefaultTabWidth, nil)
+			for _, b := range []byte(tt.input) {
+				term.write(b)
+			}
+			term.write(EOF)
+			if got := term.String(); got != tt.expected {
+				t.Errorf("Output = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestTerminalOSC tests that OSC strings are stripped and hyperlinks collected
+func TestTerminalOSC(t *testing.T) {
+	term := newTerminal(40, 5, DefaultTabWidth, nil)
+	input := "\x1b]0;title\x07\x1b]8;;file:///tmp/a\x1b\\a\x1b]8;;\x1b\\ \x1b[200~pasted\x1b[201~"
+	for _, b := range []byte(input) {
+		term.write(b)
+	}
+
+	if got := term.String(); got != "a pasted" {
+		t.Errorf("Output = %q, want %q", got, "a pasted")
+	}
+	if !slices.Equal(term.links, []string{"file:///tmp/a"}) {
+		t.Errorf("Links = %q, want %q", term.links, []string{"file:///tmp/a"})
+	}
+	if !term.pasted {
+		t.Error("Expected the paste to be noted")
+	}
+}
+
+// TestTerminalBells tests that bells are counted outside of OSC strings and the alternate screen
+func TestTerminalBells(t *testing.T) {
+	term := newTerminal(40, 5, DefaultTabWidth, nil)
+	for _, b := range []byte("\x07\x1b]0;title\x07\x1b[?1049h\x07\x1b[?1049l\x07") {
+		term.write(b)
+	}
+	if term.bells != 2 {
+		t.Errorf("Bells = %d, want 2", term.bells)
+	}
+}
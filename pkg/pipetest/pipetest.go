@@ -0,0 +1,162 @@
+// Package pipetest runs a pipeline in memory for tests, so that tests of the
+// terminal cleaning, and of programs that embed or consume it, can feed a scripted
+// terminal session and check the records without FIFOs or sleeps:
+//
+//	h := pipetest.New(t)
+//	h.Feed(
+//		pipetest.Command("make"),
+//		pipetest.Start(),
+//		pipetest.Output("buidl\b\b\bild"),
+//		pipetest.Stop(),
+//	)
+//	h.ExpectRecord("make", "build")
+//
+// Steps run in order on the test's goroutine, and a command's record is sent once
+// its Stop has run, so a test only has to wait for the records it expects. Wait and
+// Chunks add timing for what depends on it, such as output that arrives in bursts.
+package pipetest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// DefaultTimeout is how long a Harness waits for a record by default.
+const DefaultTimeout = 5 * time.Second
+
+// Harness is a pipeline that runs in memory for the length of a test. Its
+// Timeout bounds each wait for a record, and can be changed before waiting.
+type Harness struct {
+	Timeout time.Duration
+
+	t        testing.TB
+	pipeline *pipeline.Pipeline
+	hooks    *pipeline.Hooks
+	cancel   context.CancelFunc
+	done     chan error
+	err      error
+	closed   bool
+}
+
+// New starts a pipeline without FIFOs, configured by opts, and returns once it is
+// ready to be fed. Its logger discards everything unless opts set one. The harness
+// relies on hooks of its own, so hooks go on Hooks: New fails the test if opts
+// include pipeline.WithHooks. The pipeline is stopped when the test ends, or by
+// Close.
+func New(t testing.TB, opts ...pipeline.Option) *Harness {
+	t.Helper()
+	h := &Harness{
+		Timeout: DefaultTimeout,
+		t:       t,
+		hooks:   &pipeline.Hooks{},
+		done:    make(chan error, 1),
+	}
+	started := make(chan struct{}, 1)
+	h.hooks.OnSessionStart(func(string) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+	})
+	opts = append([]pipeline.Option{pipeline.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), pipeline.WithHooks(h.hooks)}, opts...)
+	h.pipeline = pipeline.New("", "", opts...)
+	if h.pipeline.Hooks() != h.hooks {
+		t.Fatal("pipetest.New: register hooks on Harness.Hooks, not with pipeline.WithHooks")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go func() { h.done <- h.pipeline.Run(ctx) }()
+	t.Cleanup(func() { h.Close() })
+	select {
+	case <-started:
+	case err := <-h.done:
+		h.closed, h.err = true, err
+		t.Fatalf("The pipeline stopped before it started: %v", err)
+	case <-time.After(h.Timeout):
+		t.Fatal("Timeout waiting for the pipeline to start")
+	}
+	return h
+}
+
+// Pipeline returns the harness's pipeline, to feed it directly.
+func (h *Harness) Pipeline() *pipeline.Pipeline {
+	return h.pipeline
+}
+
+// Hooks returns the hooks that the pipeline calls, to register more on.
+func (h *Harness) Hooks() *pipeline.Hooks {
+	return h.hooks
+}
+
+// Feed runs steps in order.
+func (h *Harness) Feed(steps ...Step) {
+	for _, step := range steps {
+		step(h.pipeline)
+	}
+}
+
+// Run feeds a whole command: its command line, then output between Start and Stop.
+func (h *Harness) Run(command, output string) {
+	h.Feed(Command(command), Start(), Output(output), Stop())
+}
+
+// Next returns the next record, failing the test if none arrives within Timeout.
+func (h *Harness) Next() pipeline.CommandRecord {
+	h.t.Helper()
+	select {
+	case record, ok := <-h.pipeline.Records():
+		if !ok {
+			h.t.Fatal("The pipeline stopped while waiting for a record")
+		}
+		return record
+	case <-time.After(h.Timeout):
+		h.t.Fatal("Timeout waiting for record")
+	}
+	return pipeline.CommandRecord{}
+}
+
+// ExpectRecord returns the next record, failing the test if its command or output
+// isn't the one given.
+func (h *Harness) ExpectRecord(command, output string) pipeline.CommandRecord {
+	h.t.Helper()
+	record := h.Next()
+	if record.Command != command || record.Output != output {
+		h.t.Errorf("Record = %q with output %q, want %q with output %q", record.Command, record.Output, command, output)
+	}
+	return record
+}
+
+// ExpectNone fails the test if a record arrives within d. Records are only held
+// back by what a test feeds, so d can be short.
+func (h *Harness) ExpectNone(d time.Duration) {
+	h.t.Helper()
+	select {
+	case record, ok := <-h.pipeline.Records():
+		if ok {
+			h.t.Errorf("Unexpected record %+v", record)
+		}
+	case <-time.After(d):
+	}
+}
+
+// Close stops the pipeline and returns the error it stopped with. Records that
+// weren't read are discarded. Closing again returns the same error.
+func (h *Harness) Close() error {
+	if h.closed {
+		return h.err
+	}
+	h.closed = true
+	h.cancel()
+	select {
+	case h.err = <-h.done:
+	case <-time.After(h.Timeout):
+		h.t.Error("Timeout waiting for the pipeline to stop")
+	}
+	return h.err
+}
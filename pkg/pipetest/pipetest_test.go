@@ -0,0 +1,72 @@
+package pipetest
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestHarness tests feeding a scripted session and checking its records
+func TestHarness(t *testing.T) {
+	h := New(t)
+	exitCode := 2
+	h.Feed(
+		CommandMeta(pipeline.CommandMeta{Command: "make", ExitCode: &exitCode, Cwd: "/src"}),
+		Output("prompt$ "),
+		Start(),
+		Output("buidl\b\b\bild failed"),
+		Stop(),
+	)
+	record := h.ExpectRecord("make", "build failed")
+	if record.ID != "1" || record.ExitCode == nil || *record.ExitCode != 2 || record.Cwd != "/src" {
+		t.Errorf("Record = %+v, want ID 1 with the exit code and cwd", record)
+	}
+	h.Run("ls", "a  b")
+	if record := h.ExpectRecord("ls", "a  b"); record.ID != "2" {
+		t.Errorf("ID = %s, want 2", record.ID)
+	}
+	h.ExpectNone(10 * time.Millisecond)
+	if err := h.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+// TestHarnessOptions tests that the pipeline options reach the pipeline
+func TestHarnessOptions(t *testing.T) {
+	h := New(t, pipeline.WithProcessors(pipeline.TruncateOutput(4)))
+	h.Run("seq 100", "1\n2\n3\n4\n5")
+	if record := h.Next(); !record.OutputTruncated || !strings.HasPrefix(record.Output, "1\n2") {
+		t.Errorf("Record = %+v, want its output truncated", record)
+	}
+}
+
+// fatalRecorder is a testing.TB whose Fatal records its message and stops the
+// goroutine, as the testing package's does
+type fatalRecorder struct {
+	testing.TB
+	message string
+}
+
+func (f *fatalRecorder) Fatal(args ...any) {
+	f.message = fmt.Sprint(args...)
+	runtime.Goexit()
+}
+
+// TestHarnessRejectsWithHooks tests that New fails rather than replace the
+// harness's own hooks with the caller's
+func TestHarnessRejectsWithHooks(t *testing.T) {
+	recorder := &fatalRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		New(recorder, pipeline.WithHooks(&pipeline.Hooks{}))
+	}()
+	<-done
+	if !strings.Contains(recorder.message, "Harness.Hooks") {
+		t.Errorf("New with pipeline.WithHooks failed with %q, want a failure naming Harness.Hooks", recorder.message)
+	}
+}
@@ -0,0 +1,65 @@
+package pipetest
+
+import (
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// Step is one event of a scripted terminal session, run by Harness.Feed.
+type Step func(p *pipeline.Pipeline)
+
+// Output writes s to the terminal, as script would.
+func Output(s string) Step {
+	return func(p *pipeline.Pipeline) { p.FeedOutput([]byte(s)) }
+}
+
+// Chunks writes s to the terminal in pieces of at most size bytes, waiting gap
+// between them, as a program that writes in bursts would. Pieces split escape
+// sequences and multi-byte characters wherever size falls. Chunks panics if size
+// isn't positive.
+func Chunks(s string, size int, gap time.Duration) Step {
+	if size <= 0 {
+		panic("pipetest.Chunks: size must be positive")
+	}
+	return func(p *pipeline.Pipeline) {
+		for i := 0; i < len(s); i += size {
+			if i > 0 {
+				time.Sleep(gap)
+			}
+			p.FeedOutput([]byte(s[i:min(i+size, len(s))]))
+		}
+	}
+}
+
+// Command queues command as the command line of the next output, as the shell's
+// preexec hook would.
+func Command(command string) Step {
+	return CommandMeta(pipeline.CommandMeta{Command: command})
+}
+
+// CommandMeta queues cmd, with its exit code and working directory, as the command
+// of the next output.
+func CommandMeta(cmd pipeline.CommandMeta) Step {
+	return func(p *pipeline.Pipeline) { p.FeedCommand(cmd) }
+}
+
+// Start starts a command, so the output that follows is recorded.
+func Start() Step {
+	return func(p *pipeline.Pipeline) { p.Start() }
+}
+
+// Stop ends the command, so the pipeline records it.
+func Stop() Step {
+	return func(p *pipeline.Pipeline) { p.Stop() }
+}
+
+// Reset discards the current command, as after the FIFOs went out of sync.
+func Reset() Step {
+	return func(p *pipeline.Pipeline) { p.Reset() }
+}
+
+// Wait pauses for d.
+func Wait(d time.Duration) Step {
+	return func(*pipeline.Pipeline) { time.Sleep(d) }
+}
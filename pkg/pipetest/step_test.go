@@ -0,0 +1,41 @@
+package pipetest
+
+import (
+	"testing"
+	"time"
+)
+
+// TestChunks tests that output split anywhere, even within escape sequences and
+// characters, is cleaned as if it had been written at once
+func TestChunks(t *testing.T) {
+	h := New(t)
+	output := "\x1b[1;31mé\x1b[0mrror\r\x1b[Kerror: ünicode\n"
+	for size := 1; size <= 4; size++ {
+		h.Feed(Command("build"), Start(), Chunks(output, size, time.Millisecond), Stop())
+		h.ExpectRecord("build", "error: ünicode\n")
+	}
+}
+
+// TestWait tests that Wait pauses between steps
+func TestWait(t *testing.T) {
+	h := New(t)
+	start := time.Now()
+	h.Feed(Wait(20 * time.Millisecond))
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Wait took %v, want at least 20ms", elapsed)
+	}
+}
+
+// TestChunksSize tests that Chunks rejects a size that would never advance
+func TestChunksSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Chunks with size %d did not panic", size)
+				}
+			}()
+			Chunks("output", size, 0)
+		}()
+	}
+}
@@ -0,0 +1,98 @@
+// Package records decodes the JSON lines that script2json writes, for Go programs
+// that consume its output rather than embed its pipeline:
+//
+//	r := records.NewReader(f)
+//	for record, err := range r.All() {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(record.ID, record.Command)
+//	}
+//
+// The record format only ever grows: every version so far has added optional
+// fields, such as argv, exit_code or recorder_version, and none has removed or
+// retyped one. A Reader decodes records of any version into the current
+// CommandRecord, leaving the fields that an older script2json didn't write at their
+// zero values and ignoring those that a newer one adds, so a consumer can tell the
+// versions apart by which fields are set, or by RecorderVersion when the recorder
+// was run with --recorder-version.
+package records
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+
+	"script2json/pkg/pipeline"
+)
+
+// CommandRecord is the record of a single command, as script2json writes it.
+type CommandRecord = pipeline.CommandRecord
+
+// maxLineLength is the longest line a Reader accepts, which is the longest record
+// with a command's output, its styled copy and its output events.
+const maxLineLength = 16 * 1024 * 1024
+
+// Reader reads CommandRecords from a stream of JSON lines, such as the output of
+// script2json or of its query subcommand. Lines of the other record types, whose
+// type field is set (summaries, annotations, diagnostics, warnings and errors), and
+// blank lines are skipped. A Reader is not safe for concurrent use.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+	err     error
+}
+
+// NewReader returns a Reader of the records in r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next command record, or io.EOF at the end of the stream. A line
+// that isn't a JSON object is an error that names its line number, after which
+// Next carries on with the next line; a failure to read the stream, or a line
+// longer than 16 MiB, ends it and is returned from then on.
+func (r *Reader) Next() (CommandRecord, error) {
+	for r.err == nil {
+		if !r.scanner.Scan() {
+			if r.err = r.scanner.Err(); r.err == nil {
+				r.err = io.EOF
+			}
+			break
+		}
+		r.line++
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var typed struct {
+			Type string `json:"type"`
+			CommandRecord
+		}
+		if err := json.Unmarshal(line, &typed); err != nil {
+			return CommandRecord{}, fmt.Errorf("line %d: could not parse record: %w", r.line, err)
+		}
+		if typed.Type != "" {
+			continue
+		}
+		return typed.CommandRecord, nil
+	}
+	return CommandRecord{}, r.err
+}
+
+// All returns an iterator over the remaining records and the errors that Next
+// returns, which ends at the end of the stream or after an error that ends it.
+func (r *Reader) All() iter.Seq2[CommandRecord, error] {
+	return func(yield func(CommandRecord, error) bool) {
+		for {
+			record, err := r.Next()
+			if err == io.EOF || !yield(record, err) || (err != nil && r.err != nil) {
+				return
+			}
+		}
+	}
+}
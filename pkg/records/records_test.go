@@ -0,0 +1,148 @@
+package records
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"script2json/pkg/pipeline"
+)
+
+// TestReaderVersions tests decoding records of the first version, the current one
+// and a later one with fields this version doesn't know
+func TestReaderVersions(t *testing.T) {
+	input := strings.Join([]string{
+		`{"id":"1","command":"ls","output":"README.md\r\n","return_timestamp":"2024-01-02T03:04:05Z"}`,
+		`{"id":"2","session":"web","command":"false","output":"","return_timestamp":"2024-01-02T03:04:06Z","exit_code":1,"argv":["false"],"recorder_version":"v1.2.0"}`,
+		`{"id":"3","command":"pwd","output":"/\r\n","return_timestamp":"2024-01-02T03:04:07Z","future_field":{"nested":true}}`,
+	}, "\n")
+	r := NewReader(strings.NewReader(input))
+
+	first, err := r.Next()
+	if err != nil || first.ID != "1" || first.Command != "ls" || first.Argv != nil || first.ExitCode != nil || first.RecorderVersion != "" {
+		t.Errorf("First record = %+v, %v, want the first version's fields only", first, err)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !first.ReturnTimestamp.Equal(want) {
+		t.Errorf("ReturnTimestamp = %v, want %v", first.ReturnTimestamp, want)
+	}
+	second, err := r.Next()
+	if err != nil || second.Session != "web" || second.ExitCode == nil || *second.ExitCode != 1 || second.RecorderVersion != "v1.2.0" {
+		t.Errorf("Second record = %+v, %v, want a session, exit code and recorder version", second, err)
+	}
+	third, err := r.Next()
+	if err != nil || third.ID != "3" || third.Command != "pwd" {
+		t.Errorf("Third record = %+v, %v, want pwd with the unknown field ignored", third, err)
+	}
+	for range 2 {
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("Next at the end = %v, want io.EOF", err)
+		}
+	}
+}
+
+// TestReaderRoundTrip tests that every field of a record survives encoding and
+// decoding
+func TestReaderRoundTrip(t *testing.T) {
+	exitCode := 2
+	start := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	record := pipeline.CommandRecord{
+		ID: "7", Session: "db", Peer: &pipeline.PeerIdentity{PID: 1, UID: 2, GID: 3}, Host: "box",
+		Container:  &pipeline.ContainerInfo{Runtime: "docker", ID: "abc", Image: "alpine"},
+		Kubernetes: &pipeline.KubernetesInfo{Namespace: "default", Pod: "web-0"},
+		Command:    "sudo make", Output: "done", ReturnTimestamp: start.Add(time.Second),
+		Argv: []string{"sudo", "make"}, Privileged: true, Encoding: "iso-8859-1",
+		ProgressSamples: []pipeline.ProgressSample{{Timestamp: start, Line: "50%"}},
+		Links:           []string{"https://example.com"}, StyledOutput: "\x1b[1mdone\x1b[0m", Pasted: true,
+		ProgressFramesCollapsed: 3, BellCount: 1, StartTimestamp: &start, DurationMs: 1000,
+		ExitCode: &exitCode, Cwd: "/src", OutputEvents: []pipeline.CastEvent{{Time: 0.5, Data: "done"}},
+		OutputTruncated: true, RecorderVersion: "dev",
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := NewReader(strings.NewReader(string(data) + "\n")).Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, record) {
+		t.Errorf("Decoded %+v, want %+v", decoded, record)
+	}
+}
+
+// TestReaderSkips tests that blank lines and the other record types are skipped
+func TestReaderSkips(t *testing.T) {
+	input := strings.Join([]string{
+		``,
+		`{"type":"summary","timestamp":"2024-01-02T03:04:05Z","commands":1}`,
+		`{"id":"1","command":"ls","output":"","return_timestamp":"2024-01-02T03:04:05Z"}`,
+		`{"type":"annotation","timestamp":"2024-01-02T03:04:05Z","text":"deploy"}`,
+		`{"type":"warning","message":"slow"}`,
+		``,
+	}, "\n")
+	var ids []string
+	for record, err := range NewReader(strings.NewReader(input)).All() {
+		if err != nil {
+			t.Fatalf("All yielded %v", err)
+		}
+		ids = append(ids, record.ID)
+	}
+	if len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("IDs = %q, want only the command record", ids)
+	}
+}
+
+// TestReaderErrors tests that a malformed line is reported with its number and
+// skipped, and that a read error ends the stream
+func TestReaderErrors(t *testing.T) {
+	input := "{\"id\":\"1\"}\nnot json\n{\"id\":\"3\"}\n"
+	var ids []string
+	var errs []error
+	for record, err := range NewReader(strings.NewReader(input)).All() {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ids = append(ids, record.ID)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 2") {
+		t.Errorf("Errors = %v, want one on line 2", errs)
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+		t.Errorf("IDs = %q, want 1 and 3 around the malformed line", ids)
+	}
+
+	readErr := errors.New("disk gone")
+	r := NewReader(io.MultiReader(strings.NewReader("{\"id\":\"1\"}\n"), iotest.ErrReader(readErr)))
+	errs = nil
+	for _, err := range r.All() {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], readErr) {
+		t.Errorf("Errors = %v, want the read error once", errs)
+	}
+	if _, err := r.Next(); !errors.Is(err, readErr) {
+		t.Errorf("Next after a read error = %v, want the read error again", err)
+	}
+}
+
+// TestReaderAllBreak tests that a loop over All can stop early and carry on with Next
+func TestReaderAllBreak(t *testing.T) {
+	r := NewReader(strings.NewReader("{\"id\":\"1\"}\n{\"id\":\"2\"}\n"))
+	for record := range r.All() {
+		if record.ID != "1" {
+			t.Errorf("First record = %q, want 1", record.ID)
+		}
+		break
+	}
+	if record, err := r.Next(); err != nil || record.ID != "2" {
+		t.Errorf("Next after break = %+v, %v, want record 2", record, err)
+	}
+}